@@ -67,11 +67,13 @@ func handleMessages(w http.ResponseWriter, r *http.Request, rt *runtime.Runtime)
 		TenantID: "default", // TODO: extract from auth
 		Mode:     "interactive",
 		Input:    input,
+
+		IdempotencyKey: r.Header.Get(IdempotencyKeyHeader),
 	}
 
 	run, err := rt.CreateRun(r.Context(), createReq)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to create run: %v", err), http.StatusInternalServerError)
+		writeCreateRunError(w, err)
 		return
 	}
 
@@ -153,9 +155,8 @@ func handleMessagesStreaming(w http.ResponseWriter, r *http.Request, rt *runtime
 		return
 	}
 
-	// Subscribe to events
-	eventChan := rt.SubscribeToEvents(runID)
-	defer rt.UnsubscribeFromEvents(runID, eventChan)
+	// Stream the run's events, including any from before this request
+	eventChan := compatStreamEvents(r.Context(), rt, runID)
 
 	// Track if we've sent message_start
 	messageStarted := false
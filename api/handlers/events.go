@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/shankarg87/agent/api/streaming"
+	"github.com/shankarg87/agent/internal/events"
+	"github.com/shankarg87/agent/internal/runtime"
+	"github.com/shankarg87/agent/internal/store"
+)
+
+// RegisterEventsAPI registers the /events firehose, an SSE feed of the
+// events of every run in a tenant matching a filter. Its events carry no SSE
+// id, so a client that reconnects starts over from the pending checkpoints.
+func RegisterEventsAPI(mux *http.ServeMux, rt *runtime.Runtime) {
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		handleEvents(w, r, rt)
+	})
+}
+
+// parseEventFilter reads the firehose filter from the query string: tenant
+// (required, and not a wildcard), session, run and types (comma-separated or
+// repeated, with "*" wildcards)
+func parseEventFilter(values url.Values) (events.Filter, error) {
+	filter := events.Filter{
+		TenantID:  values.Get("tenant"),
+		SessionID: values.Get("session"),
+		RunID:     values.Get("run"),
+		Types:     splitValues(values["types"]),
+	}
+	if filter.TenantID == "" || filter.TenantID == events.Wildcard {
+		return filter, errors.New("tenant is required")
+	}
+	return filter, nil
+}
+
+func handleEvents(w http.ResponseWriter, r *http.Request, rt *runtime.Runtime) {
+	filter, err := parseEventFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid query: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	// Subscribe before reading the snapshot so no checkpoint falls between
+	// the two
+	eventChan := rt.SubscribeToMatchingEvents(filter, events.SubscribeOptions{})
+	defer rt.UnsubscribeFromMatchingEvents(eventChan)
+
+	checkpoints, err := rt.PendingCheckpoints(r.Context(), filter)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get pending checkpoints: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Set SSE headers
+	streaming.SetSSEHeaders(w)
+
+	flusher, ok := streaming.GetFlusher(w)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	flusher.Flush()
+
+	// The feed opens with the checkpoints still awaiting approval, which
+	// the live events may repeat
+	type eventKey struct {
+		runID    string
+		sequence int64
+	}
+	sent := make(map[eventKey]bool, len(checkpoints))
+	for _, event := range checkpoints {
+		if err := streaming.WriteSSEFeedEvent(w, event); err != nil {
+			return
+		}
+		sent[eventKey{event.RunID, event.Sequence}] = true
+	}
+	flusher.Flush()
+
+	// Then it's live; it ends when the client leaves or, with a lagged
+	// event, when the client falls behind
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-eventChan:
+			if !ok {
+				return
+			}
+			if sent[eventKey{event.RunID, event.Sequence}] {
+				continue
+			}
+			if err := streaming.WriteSSEFeedEvent(w, event); err != nil {
+				return
+			}
+			flusher.Flush()
+			if event.Type == store.EventTypeLagged {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shankarg87/agent/internal/store"
+)
+
+// ListResponse is the API response for a page of a listing. NextCursor is
+// passed as the cursor parameter to fetch the next page and is omitted on
+// the last one.
+type ListResponse[T any] struct {
+	Data       []T    `json:"data"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+func writeList[T any](w http.ResponseWriter, data []T, nextCursor string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ListResponse[T]{Data: data, NextCursor: nextCursor})
+}
+
+// writeListError reports a failed listing. A cursor the listing didn't
+// produce is a bad request.
+func writeListError(w http.ResponseWriter, what string, err error) {
+	if errors.Is(err, store.ErrInvalidCursor) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, fmt.Sprintf("Failed to list %s: %v", what, err), http.StatusInternalServerError)
+}
+
+// errTenantRequired rejects a listing across sessions without a tenant, which
+// would return every tenant's data
+var errTenantRequired = errors.New("tenant_id is required")
+
+// parseRunQuery reads run filters and the page from the query string:
+// tenant_id, session_id, status (comma-separated or repeated), mode,
+// created_after, created_before (RFC 3339), metadata_key, metadata_value,
+// cursor and limit
+func parseRunQuery(values url.Values) (store.RunQuery, error) {
+	query := store.RunQuery{
+		TenantID:      values.Get("tenant_id"),
+		SessionID:     values.Get("session_id"),
+		Mode:          values.Get("mode"),
+		MetadataKey:   values.Get("metadata_key"),
+		MetadataValue: values.Get("metadata_value"),
+		Cursor:        values.Get("cursor"),
+	}
+	query.Statuses = splitValues(values["status"])
+
+	var err error
+	if query.CreatedAfter, query.CreatedBefore, err = parseTimeRange(values); err != nil {
+		return query, err
+	}
+	if query.Limit, err = parseLimit(values); err != nil {
+		return query, err
+	}
+	if query.MetadataValue != "" && query.MetadataKey == "" {
+		return query, fmt.Errorf("metadata_value requires metadata_key")
+	}
+	return query, nil
+}
+
+// splitValues flattens a parameter given as comma-separated lists, repeated
+// or both
+func splitValues(params []string) []string {
+	var values []string
+	for _, param := range params {
+		for _, v := range strings.Split(param, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
+
+// parseSessionQuery reads session filters and the page from the query
+// string: tenant_id (required), created_after, created_before, metadata_key,
+// metadata_value, cursor and limit
+func parseSessionQuery(values url.Values) (store.SessionQuery, error) {
+	query := store.SessionQuery{
+		TenantID:      values.Get("tenant_id"),
+		MetadataKey:   values.Get("metadata_key"),
+		MetadataValue: values.Get("metadata_value"),
+		Cursor:        values.Get("cursor"),
+	}
+	if query.TenantID == "" {
+		return query, errTenantRequired
+	}
+
+	var err error
+	if query.CreatedAfter, query.CreatedBefore, err = parseTimeRange(values); err != nil {
+		return query, err
+	}
+	if query.Limit, err = parseLimit(values); err != nil {
+		return query, err
+	}
+	if query.MetadataValue != "" && query.MetadataKey == "" {
+		return query, fmt.Errorf("metadata_value requires metadata_key")
+	}
+	return query, nil
+}
+
+func parseTimeRange(values url.Values) (after, before time.Time, err error) {
+	if v := values.Get("created_after"); v != "" {
+		if after, err = time.Parse(time.RFC3339, v); err != nil {
+			return after, before, fmt.Errorf("invalid created_after: %w", err)
+		}
+	}
+	if v := values.Get("created_before"); v != "" {
+		if before, err = time.Parse(time.RFC3339, v); err != nil {
+			return after, before, fmt.Errorf("invalid created_before: %w", err)
+		}
+	}
+	return after, before, nil
+}
+
+// parseLimit reads the page size. The store applies the default and
+// maximum.
+func parseLimit(values url.Values) (int, error) {
+	v := values.Get("limit")
+	if v == "" {
+		return 0, nil
+	}
+	limit, err := strconv.Atoi(v)
+	if err != nil || limit < 1 {
+		return 0, fmt.Errorf("invalid limit: %q", v)
+	}
+	return limit, nil
+}
@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/shankarg87/agent/internal/runtime"
+)
+
+// RegisterMCPAPI registers the /mcp API endpoints
+func RegisterMCPAPI(mux *http.ServeMux, rt *runtime.Runtime) {
+	mux.HandleFunc("/mcp/servers", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		// Reports every configured server, so there is no next page
+		writeList(w, rt.MCPServers(), "")
+	})
+}
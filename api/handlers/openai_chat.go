@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -8,10 +9,86 @@ import (
 
 	"github.com/shankarg87/agent/api/streaming"
 	"github.com/shankarg87/agent/api/types"
+	"github.com/shankarg87/agent/internal/events"
 	"github.com/shankarg87/agent/internal/runtime"
 	"github.com/shankarg87/agent/internal/store"
 )
 
+// compatStreamOptions subscribes the OpenAI- and Anthropic-compatible
+// streams, which can't resync from the store, with a queue that waits for
+// them rather than being disconnected when they fall behind
+var compatStreamOptions = events.SubscribeOptions{Policy: events.OverflowBlock}
+
+// compatStreamEvents streams a run's events to a compatible handler: the
+// ones already stored, then live ones, closing after the run ends. A request
+// replayed by its Idempotency-Key can find its run long finished, and then
+// only the store has its events.
+func compatStreamEvents(ctx context.Context, rt *runtime.Runtime, runID string) <-chan *store.Event {
+	// Subscribe before reading history so no event falls between the two
+	eventChan := rt.SubscribeToEventsWithOptions(runID, compatStreamOptions)
+	out := make(chan *store.Event)
+
+	go func() {
+		defer close(out)
+		defer rt.UnsubscribeFromEvents(runID, eventChan)
+
+		var lastSeq int64
+		// send forwards events and reports whether the stream goes on
+		send := func(events []*store.Event) bool {
+			for _, event := range events {
+				select {
+				case out <- event:
+				case <-ctx.Done():
+					return false
+				}
+				if event.Sequence > 0 {
+					lastSeq = event.Sequence
+				}
+				if isRunEndEvent(event.Type) {
+					return false
+				}
+			}
+			return true
+		}
+
+		history, err := rt.GetEvents(ctx, runID)
+		if err != nil || !send(history) {
+			return
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-eventChan:
+				if !ok {
+					return
+				}
+
+				switch {
+				case event.Sequence == 0:
+					// Not stored, so it has no place in the sequence
+				case event.Sequence <= lastSeq:
+					// Already sent from history
+					continue
+				case event.Sequence > lastSeq+1:
+					// Events were missed; the store has them all up to this one
+					missed, err := rt.GetEventsAfter(ctx, runID, lastSeq)
+					if err != nil || !send(missed) {
+						return
+					}
+					continue
+				}
+
+				if !send([]*store.Event{event}) {
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
 // RegisterOpenAIChatAPI registers the OpenAI-compatible /v1/chat/completions endpoint
 func RegisterOpenAIChatAPI(mux *http.ServeMux, rt *runtime.Runtime) {
 	mux.HandleFunc("/v1/chat/completions", func(w http.ResponseWriter, r *http.Request) {
@@ -44,11 +121,13 @@ func handleChatCompletions(w http.ResponseWriter, r *http.Request, rt *runtime.R
 		TenantID: "default", // TODO: extract from auth
 		Mode:     "interactive",
 		Input:    input,
+
+		IdempotencyKey: r.Header.Get(IdempotencyKeyHeader),
 	}
 
 	run, err := rt.CreateRun(r.Context(), createReq)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to create run: %v", err), http.StatusInternalServerError)
+		writeCreateRunError(w, err)
 		return
 	}
 
@@ -134,9 +213,8 @@ func handleStreamingResponse(w http.ResponseWriter, r *http.Request, rt *runtime
 		return
 	}
 
-	// Subscribe to events
-	eventChan := rt.SubscribeToEvents(runID)
-	defer rt.UnsubscribeFromEvents(runID, eventChan)
+	// Stream the run's events, including any from before this request
+	eventChan := compatStreamEvents(r.Context(), rt, runID)
 
 	chunkIndex := 0
 
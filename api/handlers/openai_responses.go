@@ -44,11 +44,13 @@ func handleResponses(w http.ResponseWriter, r *http.Request, rt *runtime.Runtime
 		TenantID: "default", // TODO: extract from auth
 		Mode:     "interactive",
 		Input:    input,
+
+		IdempotencyKey: r.Header.Get(IdempotencyKeyHeader),
 	}
 
 	run, err := rt.CreateRun(r.Context(), createReq)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to create run: %v", err), http.StatusInternalServerError)
+		writeCreateRunError(w, err)
 		return
 	}
 
@@ -134,9 +136,8 @@ func handleResponsesStreaming(w http.ResponseWriter, r *http.Request, rt *runtim
 		return
 	}
 
-	// Subscribe to events
-	eventChan := rt.SubscribeToEvents(runID)
-	defer rt.UnsubscribeFromEvents(runID, eventChan)
+	// Stream the run's events, including any from before this request
+	eventChan := compatStreamEvents(r.Context(), rt, runID)
 
 	chunkIndex := 0
 
@@ -2,8 +2,10 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,6 +18,8 @@ import (
 func RegisterRunsAPI(mux *http.ServeMux, rt *runtime.Runtime) {
 	mux.HandleFunc("/runs", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
+		case http.MethodGet:
+			handleListRuns(w, r, rt)
 		case http.MethodPost:
 			handleCreateRun(w, r, rt)
 		default:
@@ -48,6 +52,13 @@ func RegisterRunsAPI(mux *http.ServeMux, rt *runtime.Runtime) {
 			case "events":
 				// /runs/{id}/events
 				handleGetRunEvents(w, r, rt, runID)
+			case "tool_calls":
+				// /runs/{id}/tool_calls
+				if r.Method == http.MethodGet {
+					handleGetRunToolCalls(w, r, rt, runID)
+				} else {
+					http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				}
 			case "cancel":
 				// /runs/{id}/cancel
 				if r.Method == http.MethodPost {
@@ -99,10 +110,11 @@ func handleCreateRun(w http.ResponseWriter, r *http.Request, rt *runtime.Runtime
 	if req.TenantID == "" {
 		req.TenantID = "default"
 	}
+	req.IdempotencyKey = r.Header.Get(IdempotencyKeyHeader)
 
 	run, err := rt.CreateRun(r.Context(), &req)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to create run: %v", err), http.StatusInternalServerError)
+		writeCreateRunError(w, err)
 		return
 	}
 
@@ -111,6 +123,38 @@ func handleCreateRun(w http.ResponseWriter, r *http.Request, rt *runtime.Runtime
 	json.NewEncoder(w).Encode(run)
 }
 
+func handleListRuns(w http.ResponseWriter, r *http.Request, rt *runtime.Runtime) {
+	query, err := parseRunQuery(r.URL.Query())
+	if err == nil && query.TenantID == "" {
+		err = errTenantRequired
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid query: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	runs, next, err := rt.SearchRuns(r.Context(), query)
+	if err != nil {
+		writeListError(w, "runs", err)
+		return
+	}
+	writeList(w, runs, next)
+}
+
+// IdempotencyKeyHeader carries a client-chosen key that makes retries of a
+// run-creating request return the original run
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// writeCreateRunError reports a failure to create a run. Reusing an
+// idempotency key for a different request is a conflict.
+func writeCreateRunError(w http.ResponseWriter, err error) {
+	if errors.Is(err, runtime.ErrIdempotencyKeyConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	http.Error(w, fmt.Sprintf("Failed to create run: %v", err), http.StatusInternalServerError)
+}
+
 func handleGetRun(w http.ResponseWriter, r *http.Request, rt *runtime.Runtime, runID string) {
 	run, err := rt.GetRun(r.Context(), runID)
 	if err != nil {
@@ -138,6 +182,33 @@ func handleGetRunEvents(w http.ResponseWriter, r *http.Request, rt *runtime.Runt
 		return
 	}
 
+	// A reconnecting client resumes after the last event it received
+	var lastSeq int64
+	if lastEventID := r.Header.Get(LastEventIDHeader); lastEventID != "" {
+		lastSeq, err = strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || lastSeq < 0 {
+			http.Error(w, fmt.Sprintf("Invalid %s: %q", LastEventIDHeader, lastEventID), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Subscribe before reading history so no event falls between the two
+	eventChan := rt.SubscribeToEvents(runID)
+	defer rt.UnsubscribeFromEvents(runID, eventChan)
+
+	// Get historical events first, starting from the last one the client
+	// received to learn whether it ended the run
+	events, err := rt.GetEventsAfter(r.Context(), runID, max(lastSeq-1, 0))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get events: %v", err), http.StatusInternalServerError)
+		return
+	}
+	resumedAfterEnd := false
+	if len(events) > 0 && lastSeq > 0 && events[0].Sequence == lastSeq {
+		resumedAfterEnd = isRunEndEvent(events[0].Type)
+		events = events[1:]
+	}
+
 	// Set SSE headers
 	streaming.SetSSEHeaders(w)
 
@@ -146,25 +217,34 @@ func handleGetRunEvents(w http.ResponseWriter, r *http.Request, rt *runtime.Runt
 		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
 		return
 	}
+	flusher.Flush()
 
-	// Get historical events first
-	events, err := rt.GetEvents(r.Context(), runID)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to get events: %v", err), http.StatusInternalServerError)
+	if resumedAfterEnd {
 		return
 	}
 
-	// Send historical events
-	for _, event := range events {
-		if err := streaming.WriteSSEEvent(w, event); err != nil {
-			return
+	// writeEvents sends events and reports whether the stream is over,
+	// either because the run ended or the client went away
+	writeEvents := func(events []*store.Event) bool {
+		for _, event := range events {
+			if err := streaming.WriteSSEEvent(w, event); err != nil {
+				return true
+			}
+			flusher.Flush()
+			if event.Sequence > 0 {
+				lastSeq = event.Sequence
+			}
+			if isRunEndEvent(event.Type) {
+				return true
+			}
 		}
-		flusher.Flush()
+		return false
 	}
 
-	// Subscribe to new events
-	eventChan := rt.SubscribeToEvents(runID)
-	defer rt.UnsubscribeFromEvents(runID, eventChan)
+	// Send historical events
+	if writeEvents(events) {
+		return
+	}
 
 	// Stream new events
 	for {
@@ -173,17 +253,73 @@ func handleGetRunEvents(w http.ResponseWriter, r *http.Request, rt *runtime.Runt
 			return
 		case event, ok := <-eventChan:
 			if !ok {
-				// Channel closed, run is done
+				// Channel closed, run is done; send anything the bus dropped
+				if events, err := rt.GetEventsAfter(r.Context(), runID, lastSeq); err == nil {
+					writeEvents(events)
+				}
 				return
 			}
-			if err := streaming.WriteSSEEvent(w, event); err != nil {
+
+			switch {
+			case event.Type == store.EventTypeLagged:
+				// The bus disconnected this slow client, which resumes from
+				// the store by reconnecting with the last event id it has
+				writeEvents([]*store.Event{event})
+				return
+			case event.Sequence == 0:
+				// Not stored, so it has no place in the sequence
+			case event.Sequence <= lastSeq:
+				// Already sent from history
+				continue
+			case event.Sequence > lastSeq+1:
+				// Events were missed; the store has them all up to this one
+				events, err := rt.GetEventsAfter(r.Context(), runID, lastSeq)
+				if err != nil || writeEvents(events) {
+					return
+				}
+				continue
+			}
+
+			if writeEvents([]*store.Event{event}) {
 				return
 			}
-			flusher.Flush()
 		}
 	}
 }
 
+// LastEventIDHeader is sent by reconnecting SSE clients with the id of the
+// last event they received
+const LastEventIDHeader = "Last-Event-ID"
+
+// isRunEndEvent reports whether an event is the last of its run
+func isRunEndEvent(eventType string) bool {
+	return eventType == store.EventTypeRunCompleted ||
+		eventType == store.EventTypeRunFailed ||
+		eventType == store.EventTypeRunCancelled
+}
+
+func handleGetRunToolCalls(w http.ResponseWriter, r *http.Request, rt *runtime.Runtime, runID string) {
+	// Check if run exists
+	_, err := rt.GetRun(r.Context(), runID)
+	if err != nil {
+		if err == store.ErrNotFound {
+			http.Error(w, "Run not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get run: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	toolCalls, err := rt.GetToolCalls(r.Context(), runID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get tool calls: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toolCalls)
+}
+
 func handleCancelRun(w http.ResponseWriter, r *http.Request, rt *runtime.Runtime, runID string) {
 	if err := rt.CancelRun(r.Context(), runID); err != nil {
 		http.Error(w, fmt.Sprintf("Failed to cancel run: %v", err), http.StatusInternalServerError)
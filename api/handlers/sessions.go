@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/shankarg87/agent/internal/runtime"
+	"github.com/shankarg87/agent/internal/store"
+)
+
+// RegisterSessionsAPI registers the /sessions API endpoints
+func RegisterSessionsAPI(mux *http.ServeMux, rt *runtime.Runtime) {
+	mux.HandleFunc("/sessions", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			handleListSessions(w, r, rt)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/sessions/", func(w http.ResponseWriter, r *http.Request) {
+		// Extract session ID from path
+		path := strings.TrimPrefix(r.URL.Path, "/sessions/")
+		parts := strings.Split(path, "/")
+		if len(parts) == 0 || parts[0] == "" {
+			http.Error(w, "Session ID required", http.StatusBadRequest)
+			return
+		}
+
+		sessionID := parts[0]
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Route based on path
+		if len(parts) == 1 {
+			// /sessions/{id}
+			handleGetSession(w, r, rt, sessionID)
+		} else if len(parts) == 2 {
+			switch parts[1] {
+			case "messages":
+				// /sessions/{id}/messages
+				handleListSessionMessages(w, r, rt, sessionID)
+			case "runs":
+				// /sessions/{id}/runs
+				handleListSessionRuns(w, r, rt, sessionID)
+			default:
+				http.Error(w, "Not found", http.StatusNotFound)
+			}
+		} else {
+			http.Error(w, "Not found", http.StatusNotFound)
+		}
+	})
+}
+
+func handleListSessions(w http.ResponseWriter, r *http.Request, rt *runtime.Runtime) {
+	query, err := parseSessionQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid query: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	sessions, next, err := rt.SearchSessions(r.Context(), query)
+	if err != nil {
+		writeListError(w, "sessions", err)
+		return
+	}
+	writeList(w, sessions, next)
+}
+
+func handleGetSession(w http.ResponseWriter, r *http.Request, rt *runtime.Runtime, sessionID string) {
+	session, ok := getSession(w, r, rt, sessionID)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
+
+func handleListSessionMessages(w http.ResponseWriter, r *http.Request, rt *runtime.Runtime, sessionID string) {
+	if _, ok := getSession(w, r, rt, sessionID); !ok {
+		return
+	}
+
+	limit, err := parseLimit(r.URL.Query())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid query: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	messages, next, err := rt.ListMessages(r.Context(), store.MessageQuery{
+		SessionID: sessionID,
+		Cursor:    r.URL.Query().Get("cursor"),
+		Limit:     limit,
+	})
+	if err != nil {
+		writeListError(w, "messages", err)
+		return
+	}
+	writeList(w, messages, next)
+}
+
+func handleListSessionRuns(w http.ResponseWriter, r *http.Request, rt *runtime.Runtime, sessionID string) {
+	if _, ok := getSession(w, r, rt, sessionID); !ok {
+		return
+	}
+
+	query, err := parseRunQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid query: %v", err), http.StatusBadRequest)
+		return
+	}
+	query.SessionID = sessionID
+
+	runs, next, err := rt.SearchRuns(r.Context(), query)
+	if err != nil {
+		writeListError(w, "runs", err)
+		return
+	}
+	writeList(w, runs, next)
+}
+
+// getSession looks up a session, writing the error response if it fails
+func getSession(w http.ResponseWriter, r *http.Request, rt *runtime.Runtime, sessionID string) (*store.Session, bool) {
+	session, err := rt.GetSession(r.Context(), sessionID)
+	if err != nil {
+		if err == store.ErrNotFound {
+			http.Error(w, "Session not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get session: %v", err), http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+	return session, true
+}
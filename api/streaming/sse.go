@@ -23,14 +23,31 @@ func GetFlusher(w http.ResponseWriter) (http.Flusher, bool) {
 }
 
 // WriteSSEEvent writes an event in Server-Sent Events format
-// Format: event: <type>\ndata: <json>\n\n
+// Format: id: <sequence>\nevent: <type>\ndata: <json>\n\n
+//
+// The id is the event's sequence within its run, which clients send back
+// as Last-Event-ID to resume the stream.
 func WriteSSEEvent(w http.ResponseWriter, event *store.Event) error {
+	return writeSSEEvent(w, event, event.Sequence > 0)
+}
+
+// WriteSSEFeedEvent writes an event of a feed that spans runs, such as
+// /events. Sequences are only unique within a run, so the event goes out
+// without an id and the feed can't be resumed with Last-Event-ID.
+// Format: event: <type>\ndata: <json>\n\n
+func WriteSSEFeedEvent(w http.ResponseWriter, event *store.Event) error {
+	return writeSSEEvent(w, event, false)
+}
+
+func writeSSEEvent(w http.ResponseWriter, event *store.Event, withID bool) error {
 	data, err := json.Marshal(event)
 	if err != nil {
 		return err
 	}
 
-	// SSE format: event: <type>\ndata: <json>\n\n
+	if withID {
+		fmt.Fprintf(w, "id: %d\n", event.Sequence)
+	}
 	fmt.Fprintf(w, "event: %s\n", event.Type)
 	fmt.Fprintf(w, "data: %s\n\n", string(data))
 
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
@@ -17,6 +18,7 @@ import (
 	"github.com/shankarg87/agent/internal/logging"
 	"github.com/shankarg87/agent/internal/mcp"
 	"github.com/shankarg87/agent/internal/metrics"
+	"github.com/shankarg87/agent/internal/pricing"
 	"github.com/shankarg87/agent/internal/provider"
 	"github.com/shankarg87/agent/internal/runtime"
 	"github.com/shankarg87/agent/internal/store"
@@ -27,6 +29,11 @@ var (
 	configPath    string
 	mcpConfigPath string
 	addr          string
+	storeBackend  string
+	storeDSN      string
+	eventBroker   string
+	eventDSN      string
+	replicaID     string
 	watchConfig   bool
 	verbose       bool
 )
@@ -42,6 +49,11 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&configPath, "config", "configs/agents/default.yaml", "path to agent config file")
 	rootCmd.PersistentFlags().StringVar(&mcpConfigPath, "mcp-config", "configs/mcp/servers.yaml", "path to MCP servers config")
 	rootCmd.PersistentFlags().StringVar(&addr, "addr", ":8080", "HTTP server address")
+	rootCmd.PersistentFlags().StringVar(&storeBackend, "store", store.BackendMemory, "storage backend (memory, sqlite, postgres)")
+	rootCmd.PersistentFlags().StringVar(&storeDSN, "store-dsn", "", "database for the storage backend, e.g. a SQLite file path or Postgres URL")
+	rootCmd.PersistentFlags().StringVar(&eventBroker, "event-broker", events.BrokerLocal, "event broker shared by replicas (local, postgres)")
+	rootCmd.PersistentFlags().StringVar(&eventDSN, "event-broker-dsn", "", "database for the event broker (default: --store-dsn)")
+	rootCmd.PersistentFlags().StringVar(&replicaID, "replica-id", "", "name of this replica in run leases, unique among replicas sharing a store (default: hostname)")
 	rootCmd.PersistentFlags().BoolVar(&watchConfig, "watch-config", true, "enable automatic config reloading")
 	rootCmd.PersistentFlags().BoolVar(&verbose, "verbose", false, "enable verbose logging")
 }
@@ -57,6 +69,21 @@ func main() {
 	if val := os.Getenv("AGENT_ADDR"); val != "" {
 		addr = val
 	}
+	if val := os.Getenv("AGENT_STORE"); val != "" {
+		storeBackend = val
+	}
+	if val := os.Getenv("AGENT_STORE_DSN"); val != "" {
+		storeDSN = val
+	}
+	if val := os.Getenv("AGENT_EVENT_BROKER"); val != "" {
+		eventBroker = val
+	}
+	if val := os.Getenv("AGENT_EVENT_BROKER_DSN"); val != "" {
+		eventDSN = val
+	}
+	if val := os.Getenv("AGENT_REPLICA_ID"); val != "" {
+		replicaID = val
+	}
 	if val := os.Getenv("AGENT_WATCH_CONFIG"); val != "" {
 		watchConfig = val == "true"
 	}
@@ -84,6 +111,9 @@ func runServer(cmd *cobra.Command, args []string) {
 		"config":       configPath,
 		"mcp-config":   mcpConfigPath,
 		"addr":         addr,
+		"store":        storeBackend,
+		"event-broker": eventBroker,
+		"replica-id":   replicaID,
 		"watch-config": watchConfig,
 		"verbose":      verbose,
 	})
@@ -125,12 +155,19 @@ func runServer(cmd *cobra.Command, args []string) {
 	ctx := context.Background()
 
 	// Storage
-	logger.Verbose("Initializing in-memory store")
-	storage := store.NewInMemoryStore()
-
-	// Event bus
-	logger.Verbose("Initializing event bus")
-	eventBus := events.NewEventBus()
+	logger.Verbose("Initializing store", "backend", storeBackend)
+	storage, err := store.Open(storeBackend, storeDSN)
+	if err != nil {
+		logger.Error("Failed to initialize store", "backend", storeBackend, "error", err)
+		log.Fatalf("Failed to initialize store: %v", err)
+	}
+	if closer, ok := storage.(io.Closer); ok {
+		defer func() {
+			logger.Verbose("Closing store")
+			closer.Close()
+		}()
+	}
+	logger.Info("Store initialized", "backend", storeBackend)
 
 	// LLM provider
 	logger.Verbose("Initializing LLM provider",
@@ -150,6 +187,37 @@ func runServer(cmd *cobra.Command, args []string) {
 		"model", cfg.PrimaryModel.Model,
 	)
 
+	// Model routing across the primary and fallback models
+	if cfg.RoutingStrategy != provider.RoutingSingle && len(cfg.FallbackModels) > 0 {
+		providers := []provider.Provider{llmProvider}
+		for _, modelCfg := range cfg.FallbackModels {
+			fallback, err := provider.NewProvider(modelCfg)
+			if err != nil {
+				logger.Warn("Skipping fallback model",
+					"provider", modelCfg.Provider,
+					"model", modelCfg.Model,
+					"error", err,
+				)
+				continue
+			}
+			providers = append(providers, fallback)
+		}
+
+		router, err := provider.NewRouter(cfg.RoutingStrategy, providers, provider.RouterOptions{
+			Prices:  pricing.NewTable(cfg.Pricing),
+			Timeout: cfg.ModelTimeout,
+		})
+		if err != nil {
+			logger.Error("Failed to initialize model router", "error", err)
+			log.Fatalf("Failed to initialize model router: %v", err)
+		}
+		llmProvider = router
+		logger.Info("Model routing enabled",
+			"strategy", cfg.RoutingStrategy,
+			"model_count", len(providers),
+		)
+	}
+
 	// MCP registry
 	logger.Verbose("Initializing MCP registry")
 	mcpRegistry := mcp.NewRegistry()
@@ -165,6 +233,13 @@ func runServer(cmd *cobra.Command, args []string) {
 	}()
 	logger.Info("MCP servers loaded successfully", "server_count", len(mcpCfg.Servers))
 
+	// Apply servers.yaml changes without a restart
+	configManager.OnMCPConfigChange(func(newCfg *config.MCPConfig) {
+		if err := mcpRegistry.Reconcile(ctx, newCfg); err != nil {
+			logger.Error("Failed to apply MCP config change", "error", err)
+		}
+	})
+
 	// Metrics
 	var agentMetrics *metrics.AgentMetrics
 	if cfg.MetricsEnabled {
@@ -231,11 +306,71 @@ func runServer(cmd *cobra.Command, args []string) {
 		logger.Info("Metrics disabled")
 	}
 
+	// Keep MCP servers connected
+	supervisorConfig := mcp.SupervisorConfig{Interval: mcpCfg.HealthCheckInterval}
+	if agentMetrics != nil {
+		supervisorConfig.OnStatus = func(health mcp.ServerHealth) {
+			agentMetrics.MCPConnectionStatus(context.Background(), health.Name, health.Transport, health.Status)
+		}
+	}
+	supervisor := mcp.NewSupervisor(mcpRegistry, supervisorConfig)
+	supervisor.Start(ctx)
+	defer func() {
+		logger.Verbose("Stopping MCP supervisor")
+		supervisor.Stop()
+	}()
+	logger.Info("MCP supervisor started", "interval", mcpCfg.HealthCheckInterval)
+
+	// Event bus
+	logger.Verbose("Initializing event bus")
+	overflowPolicy, err := events.ParseOverflowPolicy(cfg.EventStream.OverflowPolicy)
+	if err != nil {
+		log.Fatalf("Invalid event_stream config: %v", err)
+	}
+	eventBusConfig := events.Config{
+		Defaults: events.SubscribeOptions{
+			BufferSize:   cfg.EventStream.BufferSize,
+			Policy:       overflowPolicy,
+			BlockTimeout: cfg.EventStream.BlockTimeout,
+		},
+	}
+	if agentMetrics != nil {
+		eventBusConfig.OnDrop = func(runID string, event *store.Event, policy events.OverflowPolicy) {
+			agentMetrics.EventDropped(context.Background(), event.Type, string(policy))
+		}
+	}
+	if eventDSN == "" {
+		eventDSN = storeDSN
+	}
+	eventBus, err := events.Open(eventBroker, eventDSN, eventBusConfig, storage)
+	if err != nil {
+		logger.Error("Failed to initialize event bus", "broker", eventBroker, "error", err)
+		log.Fatalf("Failed to initialize event bus: %v", err)
+	}
+	if closer, ok := eventBus.(io.Closer); ok {
+		defer func() {
+			logger.Verbose("Closing event bus")
+			closer.Close()
+		}()
+	}
+	logger.Info("Event bus initialized", "broker", eventBroker)
+
 	// Runtime
 	logger.Verbose("Initializing agent runtime")
 	rt := runtime.NewRuntime(configManager, storage, eventBus, llmProvider, mcpRegistry, agentMetrics)
+	rt.SetReplicaID(replicaID)
 	logger.Info("Agent runtime initialized successfully")
 
+	// Pick up runs interrupted by the previous shutdown, then runs left by
+	// other replicas that stop
+	if cfg.ResumeOnRestart {
+		logger.Verbose("Resuming interrupted runs")
+		if err := rt.ResumeRuns(ctx); err != nil {
+			logger.Error("Failed to resume interrupted runs", "error", err)
+		}
+		go rt.WatchInterruptedRuns(ctx)
+	}
+
 	// HTTP server
 	logger.Verbose("Setting up HTTP server", "addr", addr)
 	mux := http.NewServeMux()
@@ -271,6 +406,9 @@ func runServer(cmd *cobra.Command, args []string) {
 	// Native /runs API
 	logger.Verbose("Registering native runs API")
 	handlers.RegisterRunsAPI(mux, rt)
+	handlers.RegisterSessionsAPI(mux, rt)
+	handlers.RegisterEventsAPI(mux, rt)
+	handlers.RegisterMCPAPI(mux, rt)
 
 	// OpenAI-compatible /v1 API
 	logger.Verbose("Registering OpenAI-compatible v1 API")
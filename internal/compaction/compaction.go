@@ -0,0 +1,336 @@
+package compaction
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/shankarg87/agent/internal/config"
+	"github.com/shankarg87/agent/internal/logging"
+	"github.com/shankarg87/agent/internal/store"
+)
+
+// Compaction strategies
+const (
+	StrategySummarize        = "summarize"
+	StrategyDropOldest       = "drop_oldest"
+	StrategyElideToolOutputs = "elide_tool_outputs"
+)
+
+const (
+	defaultThreshold          = 0.8
+	defaultToolOutputMaxChars = 500
+
+	// targetRatio is the fraction of the trigger threshold that compaction
+	// aims to bring the history down to, so it doesn't trigger every turn
+	targetRatio = 0.5
+
+	// elidedPreviewChars is how much of an elided tool output is kept
+	elidedPreviewChars = 200
+
+	// transcriptToolOutputChars caps tool outputs in summarization transcripts
+	transcriptToolOutputChars = 2000
+)
+
+// SummaryPrompt is the system prompt used to summarize older history
+const SummaryPrompt = `You compact the history of a conversation between a user and an AI agent that uses tools.
+Summarize the transcript you are given so the agent can continue the task without it.
+Preserve the user's goals and instructions, decisions made, facts and results learned from tool calls,
+open questions, and the current state of the work. Omit pleasantries and redundant detail.
+Reply with the summary only.`
+
+// Summarizer condenses older messages into a summary, typically by asking
+// the model
+type Summarizer func(ctx context.Context, messages []*store.Message) (string, error)
+
+// Compactor decides when history needs compacting and produces compaction
+// markers
+type Compactor struct {
+	strategy           string
+	threshold          float64
+	toolOutputMaxChars int
+	maxTokens          int
+	counter            Counter
+	summarize          Summarizer
+	logger             *logging.SimpleLogger
+
+	// Size the provider reported for a request that carried the first
+	// baselineMessages messages of the history; see UseBaseline
+	baselineTokens   int
+	baselineMessages int
+}
+
+// New creates a compactor for a context window of maxTokens. summarize is
+// only used by the summarize strategy.
+func New(cfg config.Compaction, maxTokens int, counter Counter, summarize Summarizer) (*Compactor, error) {
+	c := &Compactor{
+		strategy:           cfg.Strategy,
+		threshold:          cfg.Threshold,
+		toolOutputMaxChars: cfg.ToolOutputMaxChars,
+		maxTokens:          maxTokens,
+		counter:            counter,
+		summarize:          summarize,
+		logger:             logging.VerboseLogger("compaction"),
+	}
+
+	switch c.strategy {
+	case StrategySummarize, StrategyDropOldest, StrategyElideToolOutputs:
+	case "":
+		c.strategy = StrategySummarize
+	default:
+		return nil, fmt.Errorf("unsupported compaction strategy: %s", cfg.Strategy)
+	}
+	if c.strategy == StrategySummarize && summarize == nil {
+		return nil, fmt.Errorf("summarize compaction requires a summarizer")
+	}
+	if c.threshold <= 0 || c.threshold > 1 {
+		c.threshold = defaultThreshold
+	}
+	if c.toolOutputMaxChars <= 0 {
+		c.toolOutputMaxChars = defaultToolOutputMaxChars
+	}
+
+	return c, nil
+}
+
+// UseBaseline has Compact take a request's size from what the provider
+// reported for the last one rather than estimate all of it: tokens for a
+// request carrying the first messages messages of the history, including
+// everything fixedTokens covers. Only messages added since are estimated.
+// The baseline is ignored once a marker has changed what those messages
+// look like.
+func (c *Compactor) UseBaseline(tokens, messages int) {
+	c.baselineTokens = tokens
+	c.baselineMessages = messages
+}
+
+// Compact checks whether the history, plus fixedTokens for the system
+// prompt, tool definitions and output, nears the context limit. If it does,
+// Compact returns a marker message to append to the session; otherwise nil.
+// A failed summary falls back to dropping the oldest messages.
+func (c *Compactor) Compact(ctx context.Context, history []*store.Message, fixedTokens int) (*store.Message, error) {
+	if c.maxTokens <= 0 {
+		return nil, nil
+	}
+
+	view := View(history)
+	before := c.size(history, view, fixedTokens)
+	limit := int(float64(c.maxTokens) * c.threshold)
+	if before <= limit {
+		return nil, nil
+	}
+
+	cut := c.cutPoint(view, int(float64(limit)*targetRatio)-fixedTokens)
+	if cut == 0 {
+		c.logger.Warn("History exceeds context limit but cannot be compacted further",
+			"tokens", before,
+			"limit", limit,
+		)
+		return nil, nil
+	}
+
+	// A new marker supersedes the previous one, so carry over what it did.
+	// Nobody said it, so it's a system message.
+	marker := &store.Message{Role: "system", Compaction: &store.Compaction{Strategy: c.strategy}}
+	if prev := latestMarker(history); prev != nil {
+		marker.Content = prev.Content
+		marker.Compaction.ReplacesThrough = prev.Compaction.ReplacesThrough
+		marker.Compaction.ElidesThrough = prev.Compaction.ElidesThrough
+		marker.Compaction.ElideOverChars = prev.Compaction.ElideOverChars
+	}
+
+	switch c.strategy {
+	case StrategyElideToolOutputs:
+		if last := view[cut-1]; last.Compaction == nil {
+			marker.Compaction.ElidesThrough = last.ID
+			marker.Compaction.ElideOverChars = c.toolOutputMaxChars
+		}
+		// Drop messages as well if eliding outputs is not enough
+		if fixedTokens+c.counter.Messages(View(withMarker(history, marker))) > limit {
+			c.replace(marker, view, cut, dropNotice(view[:cut]))
+		}
+
+	case StrategySummarize:
+		summary, err := c.summarize(ctx, view[:cut])
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			c.logger.Warn("Summarization failed, dropping oldest messages instead", "error", err)
+			marker.Compaction.Strategy = StrategyDropOldest
+			c.replace(marker, view, cut, dropNotice(view[:cut]))
+			break
+		}
+		c.replace(marker, view, cut, "Summary of the earlier conversation:\n\n"+strings.TrimSpace(summary))
+
+	case StrategyDropOldest:
+		c.replace(marker, view, cut, dropNotice(view[:cut]))
+	}
+
+	marker.Compaction.TokensBefore = before
+	marker.Compaction.TokensAfter = fixedTokens + c.counter.Messages(View(withMarker(history, marker)))
+
+	c.logger.Info("History compacted",
+		"strategy", marker.Compaction.Strategy,
+		"tokens_before", marker.Compaction.TokensBefore,
+		"tokens_after", marker.Compaction.TokensAfter,
+		"messages_compacted", cut,
+	)
+
+	return marker, nil
+}
+
+// size returns the tokens of a request carrying the history: from the
+// baseline when there is one that still applies, otherwise estimated
+func (c *Compactor) size(history, view []*store.Message, fixedTokens int) int {
+	n := c.baselineMessages
+	if c.baselineTokens <= 0 || n > len(history) || latestMarker(history[n:]) != nil {
+		return fixedTokens + c.counter.Messages(view)
+	}
+	return c.baselineTokens + c.counter.Messages(history[n:])
+}
+
+// cutPoint returns the smallest index such that view[index:] fits within
+// budget, or failing that the largest index that keeps at least the latest
+// turn. Tool results are never separated from the call that produced them.
+// It returns 0 if nothing can be compacted.
+func (c *Compactor) cutPoint(view []*store.Message, budget int) int {
+	suffix := make([]int, len(view)+1)
+	for i := len(view) - 1; i >= 0; i-- {
+		suffix[i] = suffix[i+1] + c.counter.Message(view[i])
+	}
+
+	last := 0
+	for i := 1; i < len(view); i++ {
+		if view[i].Role == "tool" || view[i].Compaction != nil {
+			continue
+		}
+		if suffix[i] <= budget {
+			return i
+		}
+		last = i
+	}
+	return last
+}
+
+// replace makes the marker stand in for view[:cut] with the given content
+func (c *Compactor) replace(marker *store.Message, view []*store.Message, cut int, content string) {
+	// If view[:cut] is only the previous marker, what it replaced stays replaced
+	if last := view[cut-1]; last.Compaction == nil {
+		marker.Compaction.ReplacesThrough = last.ID
+	}
+	marker.Content = content
+}
+
+// View returns the history as it should be sent to the model, applying the
+// latest compaction marker. Elided messages are copies; the history is not
+// modified.
+func View(history []*store.Message) []*store.Message {
+	k := -1
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Compaction != nil {
+			k = i
+			break
+		}
+	}
+	if k < 0 {
+		return history
+	}
+
+	marker := history[k]
+	replaced := indexOf(history[:k], marker.Compaction.ReplacesThrough)
+	elided := indexOf(history[:k], marker.Compaction.ElidesThrough)
+
+	view := make([]*store.Message, 0, len(history)-replaced)
+	if marker.Content != "" {
+		view = append(view, marker)
+	}
+	for i := replaced + 1; i < len(history); i++ {
+		m := history[i]
+		if m.Compaction != nil {
+			continue
+		}
+		if i <= elided && m.Role == "tool" {
+			m = elide(m, marker.Compaction.ElideOverChars)
+		}
+		view = append(view, m)
+	}
+	return view
+}
+
+// Transcript renders messages as plain text for summarization
+func Transcript(messages []*store.Message) string {
+	var b strings.Builder
+	for _, m := range messages {
+		switch {
+		case m.Compaction != nil:
+			fmt.Fprintf(&b, "[earlier context]\n%s\n\n", m.Content)
+		case m.Role == "tool":
+			fmt.Fprintf(&b, "tool result (%s):\n%s\n\n", m.ToolName, truncate(m.Content, transcriptToolOutputChars))
+		default:
+			if m.Content != "" {
+				fmt.Fprintf(&b, "%s:\n%s\n\n", m.Role, m.Content)
+			}
+			for _, tc := range m.ToolCalls {
+				fmt.Fprintf(&b, "%s called tool %s with %s\n\n", m.Role, tc.Function.Name, tc.Function.Arguments)
+			}
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func latestMarker(history []*store.Message) *store.Message {
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Compaction != nil {
+			return history[i]
+		}
+	}
+	return nil
+}
+
+// withMarker returns the history with the marker appended, without
+// modifying the history's backing array
+func withMarker(history []*store.Message, marker *store.Message) []*store.Message {
+	return append(history[:len(history):len(history)], marker)
+}
+
+func indexOf(messages []*store.Message, id string) int {
+	if id == "" {
+		return -1
+	}
+	for i, m := range messages {
+		if m.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// elide returns a copy of a tool result with a long output shortened
+func elide(m *store.Message, overChars int) *store.Message {
+	if overChars <= 0 || len([]rune(m.Content)) <= overChars {
+		return m
+	}
+	elided := *m
+	preview := min(elidedPreviewChars, overChars)
+	elided.Content = fmt.Sprintf("%s\n[... tool output elided: %d characters]", truncate(m.Content, preview), len([]rune(m.Content))-preview)
+	return &elided
+}
+
+func dropNotice(dropped []*store.Message) string {
+	n := 0
+	for _, m := range dropped {
+		if m.Compaction == nil {
+			n++
+		}
+	}
+	return fmt.Sprintf("[%d earlier messages were removed to fit the context window]", n)
+}
+
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
@@ -0,0 +1,222 @@
+package compaction
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/shankarg87/agent/internal/config"
+	"github.com/shankarg87/agent/internal/store"
+)
+
+// toolHistory builds turns from..to-1 of user question, assistant tool call
+// and tool result, each tool result carrying outputChars of output
+func toolHistory(from, to, outputChars int) []*store.Message {
+	var history []*store.Message
+	for i := from; i < to; i++ {
+		call := store.ToolCallRef{ID: fmt.Sprintf("call_%d", i), Type: "function"}
+		call.Function.Name = "search"
+		call.Function.Arguments = `{"q":"x"}`
+
+		history = append(history,
+			&store.Message{ID: fmt.Sprintf("u%d", i), Role: "user", Content: fmt.Sprintf("question %d", i)},
+			&store.Message{ID: fmt.Sprintf("a%d", i), Role: "assistant", ToolCalls: []store.ToolCallRef{call}},
+			&store.Message{ID: fmt.Sprintf("t%d", i), Role: "tool", ToolCallID: call.ID, ToolName: "search", Content: strings.Repeat("r", outputChars)},
+		)
+	}
+	return history
+}
+
+func newTestCompactor(t *testing.T, strategy string, maxTokens int, summarize Summarizer) *Compactor {
+	t.Helper()
+	c, err := New(config.Compaction{Strategy: strategy}, maxTokens, NewCounter("openai"), summarize)
+	assertNoError(t, err)
+	return c
+}
+
+func assertToolPairsIntact(t *testing.T, view []*store.Message) {
+	t.Helper()
+	for i, m := range view {
+		if m.Role == "tool" && (i == 0 || (view[i-1].Role != "assistant" && view[i-1].Role != "tool")) {
+			t.Fatalf("Tool result %s separated from its call", m.ID)
+		}
+	}
+}
+
+func TestCounter_PerProvider(t *testing.T) {
+	text := strings.Repeat("a", 700)
+	assertEqual(t, 201, NewCounter("anthropic").Text(text))
+	assertEqual(t, 176, NewCounter("openai").Text(text))
+	assertEqual(t, 0, NewCounter("openai").Text(""))
+}
+
+func TestCompact_BelowThreshold(t *testing.T) {
+	c := newTestCompactor(t, StrategyDropOldest, 100000, nil)
+
+	marker, err := c.Compact(context.Background(), toolHistory(0, 5, 100), 0)
+	assertNoError(t, err)
+	if marker != nil {
+		t.Fatal("Expected no compaction")
+	}
+}
+
+func TestCompact_UsesProviderBaseline(t *testing.T) {
+	// The estimate is well under the 1600-token threshold
+	history := toolHistory(0, 5, 100)
+
+	// The provider counted far more for the first four turns, as it would
+	// for text the heuristic underestimates
+	c := newTestCompactor(t, StrategyDropOldest, 2000, nil)
+	c.UseBaseline(1700, 12)
+	marker, err := c.Compact(context.Background(), history, 0)
+	assertNoError(t, err)
+	assertNotNil(t, marker)
+	assertEqual(t, "system", marker.Role)
+	if marker.Compaction.TokensBefore <= 1700 {
+		t.Fatalf("Expected the baseline plus the new turn, got %d tokens", marker.Compaction.TokensBefore)
+	}
+
+	// A marker since the baseline request changed what it carried
+	marker.ID = "m1"
+	c.UseBaseline(1700, 12)
+	marker, err = c.Compact(context.Background(), append(history, marker), 0)
+	assertNoError(t, err)
+	if marker != nil {
+		t.Fatal("Expected the outdated baseline to be ignored")
+	}
+}
+
+func TestCompact_DropOldest(t *testing.T) {
+	c := newTestCompactor(t, StrategyDropOldest, 2000, nil)
+	history := toolHistory(0, 20, 400)
+
+	marker, err := c.Compact(context.Background(), history, 0)
+	assertNoError(t, err)
+	assertNotNil(t, marker)
+	assertEqual(t, StrategyDropOldest, marker.Compaction.Strategy)
+	if marker.Compaction.TokensAfter > 800 {
+		t.Fatalf("Expected history under target, got %d tokens", marker.Compaction.TokensAfter)
+	}
+
+	history = append(history, marker)
+	view := View(history)
+	assertEqual(t, marker, view[0])
+	assertEqual(t, true, strings.Contains(view[0].Content, "earlier messages were removed"))
+	assertEqual(t, "t19", view[len(view)-1].ID)
+	assertToolPairsIntact(t, view[1:])
+
+	// The view is stable, so compaction is not recomputed next turn
+	marker, err = c.Compact(context.Background(), history, 0)
+	assertNoError(t, err)
+	if marker != nil {
+		t.Fatal("Expected no compaction")
+	}
+}
+
+func TestCompact_Summarize(t *testing.T) {
+	var transcripts []string
+	summarize := func(ctx context.Context, messages []*store.Message) (string, error) {
+		transcripts = append(transcripts, Transcript(messages))
+		return fmt.Sprintf("summary %d", len(transcripts)), nil
+	}
+	c := newTestCompactor(t, StrategySummarize, 2000, summarize)
+	history := toolHistory(0, 20, 400)
+
+	marker, err := c.Compact(context.Background(), history, 0)
+	assertNoError(t, err)
+	assertNotNil(t, marker)
+	assertEqual(t, true, strings.Contains(transcripts[0], "question 0"))
+	assertEqual(t, true, strings.Contains(transcripts[0], "assistant called tool search"))
+
+	marker.ID = "m1"
+	history = append(history, marker)
+	view := View(history)
+	assertEqual(t, "Summary of the earlier conversation:\n\nsummary 1", view[0].Content)
+	assertToolPairsIntact(t, view[1:])
+
+	// A later compaction folds the previous summary into the new one
+	history = append(history, toolHistory(20, 40, 400)...)
+	marker, err = c.Compact(context.Background(), history, 0)
+	assertNoError(t, err)
+	assertNotNil(t, marker)
+	assertEqual(t, true, strings.Contains(transcripts[1], "summary 1"))
+
+	view = View(append(history, marker))
+	assertEqual(t, "Summary of the earlier conversation:\n\nsummary 2", view[0].Content)
+	for _, m := range view[1:] {
+		if m.Compaction != nil {
+			t.Fatal("Expected superseded markers to be hidden")
+		}
+	}
+}
+
+func TestCompact_SummarizeFailureDropsOldest(t *testing.T) {
+	summarize := func(ctx context.Context, messages []*store.Message) (string, error) {
+		return "", errors.New("model unavailable")
+	}
+	c := newTestCompactor(t, StrategySummarize, 2000, summarize)
+
+	marker, err := c.Compact(context.Background(), toolHistory(0, 20, 400), 0)
+	assertNoError(t, err)
+	assertNotNil(t, marker)
+	assertEqual(t, StrategyDropOldest, marker.Compaction.Strategy)
+}
+
+func TestCompact_ElideToolOutputs(t *testing.T) {
+	c := newTestCompactor(t, StrategyElideToolOutputs, 8000, nil)
+	history := toolHistory(0, 10, 3000)
+
+	marker, err := c.Compact(context.Background(), history, 0)
+	assertNoError(t, err)
+	assertNotNil(t, marker)
+	assertEqual(t, "", marker.Content)
+	assertEqual(t, "", marker.Compaction.ReplacesThrough)
+
+	view := View(append(history, marker))
+	assertEqual(t, len(history), len(view))
+	assertEqual(t, true, strings.Contains(view[2].Content, "tool output elided: 2800 characters"))
+	assertEqual(t, 3000, len(view[len(view)-1].Content))
+
+	// The stored history is untouched
+	assertEqual(t, 3000, len(history[2].Content))
+}
+
+func TestNew_InvalidStrategy(t *testing.T) {
+	_, err := New(config.Compaction{Strategy: "truncate"}, 1000, NewCounter("openai"), nil)
+	assertError(t, err)
+
+	_, err = New(config.Compaction{}, 1000, NewCounter("openai"), nil)
+	assertError(t, err)
+}
+
+// Helper functions
+
+func assertEqual(t *testing.T, expected, actual any) {
+	t.Helper()
+	if expected != actual {
+		t.Fatalf("Expected %v, got %v", expected, actual)
+	}
+}
+
+func assertNoError(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+}
+
+func assertError(t *testing.T, err error) {
+	t.Helper()
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+}
+
+func assertNotNil(t *testing.T, value any) {
+	t.Helper()
+	if value == nil {
+		t.Fatal("Expected non-nil value")
+	}
+}
@@ -0,0 +1,66 @@
+package compaction
+
+import (
+	"unicode/utf8"
+
+	"github.com/shankarg87/agent/internal/store"
+)
+
+// messageOverhead approximates the tokens each message costs beyond its
+// content (role markers and separators)
+const messageOverhead = 4
+
+// charsPerToken approximates each provider's tokenizer on English text and
+// code. Estimates err slightly high so compaction triggers before the
+// provider rejects a request, but they are approximations: text in other
+// scripts can take several times as many tokens. Compactor.UseBaseline
+// limits them to the messages the provider hasn't counted yet.
+var charsPerToken = map[string]float64{
+	"anthropic": 3.5,
+	"openai":    4.0,
+	"gemini":    4.0,
+	"ollama":    3.5,
+}
+
+const defaultCharsPerToken = 3.5
+
+// Counter estimates token counts for a provider's tokenizer from character
+// counts
+type Counter struct {
+	charsPerToken float64
+}
+
+// NewCounter returns a counter for the named provider
+func NewCounter(provider string) Counter {
+	ratio, ok := charsPerToken[provider]
+	if !ok {
+		ratio = defaultCharsPerToken
+	}
+	return Counter{charsPerToken: ratio}
+}
+
+// Text estimates the tokens in s
+func (c Counter) Text(s string) int {
+	if s == "" {
+		return 0
+	}
+	return int(float64(utf8.RuneCountInString(s))/c.charsPerToken) + 1
+}
+
+// Message estimates the tokens a message costs in a request
+func (c Counter) Message(m *store.Message) int {
+	tokens := messageOverhead + c.Text(m.Content)
+	for _, tc := range m.ToolCalls {
+		tokens += messageOverhead + c.Text(tc.Function.Name) + c.Text(tc.Function.Arguments)
+	}
+	return tokens
+}
+
+// Messages estimates the tokens of a message history
+func (c Counter) Messages(messages []*store.Message) int {
+	tokens := 0
+	for _, m := range messages {
+		tokens += c.Message(m)
+	}
+	return tokens
+}
@@ -18,8 +18,10 @@ type AgentConfig struct {
 	// Model routing
 	PrimaryModel     ModelConfig   `yaml:"primary_model"`
 	FallbackModels   []ModelConfig `yaml:"fallback_models,omitempty"`
-	RoutingStrategy  string        `yaml:"routing_strategy"` // single, fallback, cost_aware, latency_aware
+	RoutingStrategy  string        `yaml:"routing_strategy"`        // single, fallback, cost_aware, latency_aware
+	ModelTimeout     time.Duration `yaml:"model_timeout,omitempty"` // max wait for a model to start responding (first stream event or response byte) before falling back
 	MaxContextTokens int           `yaml:"max_context_tokens,omitempty"`
+	Compaction       Compaction    `yaml:"compaction,omitempty"` // how history is compacted as it nears MaxContextTokens
 	MaxOutputTokens  int           `yaml:"max_output_tokens,omitempty"`
 	Temperature      float64       `yaml:"temperature,omitempty"`
 	TopP             float64       `yaml:"top_p,omitempty"`
@@ -44,6 +46,9 @@ type AgentConfig struct {
 	MaxCostUSD        float64 `yaml:"max_cost_usd,omitempty"`
 	MaxFailuresPerRun int     `yaml:"max_failures_per_run,omitempty"`
 
+	// Pricing overrides, merged over the built-in price table
+	Pricing []ModelPricing `yaml:"pricing,omitempty"`
+
 	// Memory
 	MemoryEnabled  bool   `yaml:"memory_enabled"`
 	MemoryProvider string `yaml:"memory_provider,omitempty"`
@@ -59,16 +64,47 @@ type AgentConfig struct {
 	LogPayloadPolicy string        `yaml:"log_payload_policy"` // full, redacted, hashes_only
 
 	// Reliability
-	IdempotencyKeys bool `yaml:"idempotency_keys"`
-	ResumeOnRestart bool `yaml:"resume_on_restart"`
+	IdempotencyKeys   bool          `yaml:"idempotency_keys"`
+	IdempotencyKeyTTL time.Duration `yaml:"idempotency_key_ttl,omitempty"` // how long a key returns its original run
+	ResumeOnRestart   bool          `yaml:"resume_on_restart"`
+
+	// Streaming
+	EventStream EventStreamConfig `yaml:"event_stream,omitempty"`
 }
 
+// DefaultIdempotencyKeyTTL applies when IdempotencyKeyTTL is unset
+const DefaultIdempotencyKeyTTL = 24 * time.Hour
+
 type ModelConfig struct {
 	Provider string         `yaml:"provider"` // anthropic, openai, gemini, ollama
 	Model    string         `yaml:"model"`
 	Endpoint string         `yaml:"endpoint,omitempty"` // for custom endpoints
 	APIKey   string         `yaml:"api_key,omitempty"`  // can also use env vars
 	Params   map[string]any `yaml:"params,omitempty"`   // provider-specific params
+
+	// MaxRetries is how many times a rate-limited, overloaded or failed
+	// request is retried. Zero uses the default (3); negative disables retries.
+	MaxRetries int `yaml:"max_retries,omitempty"`
+}
+
+// Compaction controls how conversation history is compacted once it nears
+// MaxContextTokens. Zero values use the defaults noted below.
+type Compaction struct {
+	Strategy           string  `yaml:"strategy,omitempty"`              // summarize (default), drop_oldest, elide_tool_outputs
+	Threshold          float64 `yaml:"threshold,omitempty"`             // fraction of MaxContextTokens that triggers compaction (0.8)
+	ToolOutputMaxChars int     `yaml:"tool_output_max_chars,omitempty"` // elide_tool_outputs: longer outputs are elided (500)
+}
+
+// ModelPricing overrides token prices for a provider/model. Rates are USD per
+// million tokens. Model may be a prefix of the full model name, or "*" to
+// price every model of the provider.
+type ModelPricing struct {
+	Provider          string  `yaml:"provider"`
+	Model             string  `yaml:"model"`
+	PromptPerMTok     float64 `yaml:"prompt_per_mtok"`
+	CompletionPerMTok float64 `yaml:"completion_per_mtok"`
+	CacheReadPerMTok  float64 `yaml:"cache_read_per_mtok,omitempty"`
+	CacheWritePerMTok float64 `yaml:"cache_write_per_mtok,omitempty"`
 }
 
 type PromptTemplates struct {
@@ -88,6 +124,15 @@ type ToolConfig struct {
 	Denylist         []string            `yaml:"denylist,omitempty"`
 	RequiresApproval ApprovalRequirement `yaml:"requires_approval,omitempty"`
 	Redaction        RedactionConfig     `yaml:"redaction,omitempty"`
+
+	// Aliases renames the server's tools for the model, from the tool's
+	// name on the server to the name the model sees
+	Aliases map[string]string `yaml:"aliases,omitempty"`
+
+	// Idempotent marks the server's tools as safe to call again. A call
+	// interrupted by a restart is retried if so, and otherwise waits for
+	// re-approval.
+	Idempotent bool `yaml:"idempotent,omitempty"`
 }
 
 type ApprovalRequirement struct {
@@ -106,6 +151,13 @@ type ApprovalPolicies struct {
 	BudgetExceeded bool `yaml:"budget_exceeded"`
 }
 
+// EventStreamConfig sets how events are buffered for stream subscribers
+type EventStreamConfig struct {
+	BufferSize     int           `yaml:"buffer_size,omitempty"`     // events buffered per subscriber
+	OverflowPolicy string        `yaml:"overflow_policy,omitempty"` // block, drop_oldest, disconnect
+	BlockTimeout   time.Duration `yaml:"block_timeout,omitempty"`   // how long "block" waits for room for an event before dropping it
+}
+
 type MetricsConfig struct {
 	Provider   string            `yaml:"provider"`  // prometheus, otel
 	Namespace  string            `yaml:"namespace"` // metric namespace prefix
@@ -162,6 +214,9 @@ func LoadAgentConfig(path string) (*AgentConfig, error) {
 	if cfg.MaxFailuresPerRun == 0 {
 		cfg.MaxFailuresPerRun = 3
 	}
+	if cfg.IdempotencyKeyTTL == 0 {
+		cfg.IdempotencyKeyTTL = DefaultIdempotencyKeyTTL
+	}
 
 	return &cfg, nil
 }
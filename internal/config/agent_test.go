@@ -33,6 +33,15 @@ max_tool_calls: 50
 max_run_time_seconds: 600
 max_cost_usd: 10.0
 max_failures_per_run: 5
+pricing:
+  - provider: openai
+    model: gpt-4
+    prompt_per_mtok: 30
+    completion_per_mtok: 60
+    cache_read_per_mtok: 15
+compaction:
+  strategy: elide_tool_outputs
+  threshold: 0.7
 memory_enabled: true
 memory_provider: memory_server
 write_policy: auto
@@ -81,6 +90,16 @@ log_level: debug
 	assertEqual(t, 10.0, cfg.MaxCostUSD)
 	assertEqual(t, 5, cfg.MaxFailuresPerRun)
 
+	// Verify pricing overrides
+	assertEqual(t, 1, len(cfg.Pricing))
+	assertEqual(t, "gpt-4", cfg.Pricing[0].Model)
+	assertEqual(t, 60.0, cfg.Pricing[0].CompletionPerMTok)
+	assertEqual(t, 15.0, cfg.Pricing[0].CacheReadPerMTok)
+
+	// Verify compaction settings
+	assertEqual(t, "elide_tool_outputs", cfg.Compaction.Strategy)
+	assertEqual(t, 0.7, cfg.Compaction.Threshold)
+
 	// Verify memory settings
 	assertEqual(t, true, cfg.MemoryEnabled)
 	assertEqual(t, "memory_server", cfg.MemoryProvider)
@@ -119,6 +138,7 @@ system_prompt: "You are helpful."
 	assertEqual(t, 100, cfg.MaxToolCalls)
 	assertEqual(t, 300, cfg.MaxRunTimeSeconds)
 	assertEqual(t, 3, cfg.MaxFailuresPerRun)
+	assertEqual(t, DefaultIdempotencyKeyTTL, cfg.IdempotencyKeyTTL)
 }
 
 func TestLoadAgentConfig_InvalidFile(t *testing.T) {
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"path/filepath"
+	"reflect"
 	"sync"
 	"time"
 
@@ -20,6 +21,9 @@ type ConfigManager struct {
 	lastReload   time.Time
 	watchers     []*fsnotify.Watcher
 	stopWatching chan struct{}
+
+	reloadMu     sync.Mutex // serializes reloads, so listeners see changes in order
+	mcpListeners []func(*MCPConfig)
 }
 
 // NewConfigManager creates a new configuration manager with file watching
@@ -63,6 +67,14 @@ func (cm *ConfigManager) GetMCPConfig() *MCPConfig {
 	return &cfg
 }
 
+// OnMCPConfigChange registers fn to be called with the new MCP configuration
+// whenever a reload changes it. Listeners are called one reload at a time.
+func (cm *ConfigManager) OnMCPConfigChange(fn func(cfg *MCPConfig)) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.mcpListeners = append(cm.mcpListeners, fn)
+}
+
 // GetLastReload returns the timestamp of the last configuration reload
 func (cm *ConfigManager) GetLastReload() time.Time {
 	cm.mu.RLock()
@@ -90,12 +102,22 @@ func (cm *ConfigManager) loadConfigs() error {
 	}
 
 	cm.mu.Lock()
+	mcpChanged := cm.mcpConfig != nil && !reflect.DeepEqual(cm.mcpConfig, mcpCfg)
 	cm.agentConfig = agentCfg
 	cm.mcpConfig = mcpCfg
 	cm.lastReload = time.Now()
+	listeners := cm.mcpListeners
 	cm.mu.Unlock()
 
 	log.Printf("Configuration loaded successfully - Agent: %s v%s", agentCfg.ProfileName, agentCfg.ProfileVersion)
+
+	if mcpChanged {
+		log.Printf("MCP configuration changed - %d servers", len(mcpCfg.Servers))
+		for _, fn := range listeners {
+			cfg := *mcpCfg
+			fn(&cfg)
+		}
+	}
 	return nil
 }
 
@@ -176,8 +198,9 @@ func (cm *ConfigManager) watchFiles(watcher *fsnotify.Watcher, targetPath, confi
 				continue
 			}
 
-			// Process write events (config file updated)
-			if event.Has(fsnotify.Write) {
+			// Process write events (config file updated) and creates (editors
+			// that save by renaming a new file over the old one)
+			if event.Has(fsnotify.Write) || event.Has(fsnotify.Create) {
 				log.Printf("Detected %s configuration change: %s", configType, event.Name)
 
 				// Debounce rapid file changes (editors often write multiple times)
@@ -202,6 +225,8 @@ func (cm *ConfigManager) watchFiles(watcher *fsnotify.Watcher, targetPath, confi
 
 // reloadConfig reloads both configuration files
 func (cm *ConfigManager) reloadConfig() error {
+	cm.reloadMu.Lock()
+	defer cm.reloadMu.Unlock()
 	return cm.loadConfigs()
 }
 
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestConfigManager_OnMCPConfigChange(t *testing.T) {
+	tempDir := t.TempDir()
+	agentPath := filepath.Join(tempDir, "agent.yaml")
+	mcpPath := filepath.Join(tempDir, "servers.yaml")
+
+	agentContent := `profile_name: test-agent
+profile_version: 1.0.0
+primary_model:
+  provider: openai
+  model: gpt-4
+`
+	assertNoError(t, os.WriteFile(agentPath, []byte(agentContent), 0644))
+	assertNoError(t, os.WriteFile(mcpPath, []byte("servers:\n  - name: echo\n    transport: stdio\n    endpoint: ./echo\n"), 0644))
+
+	cm, err := NewConfigManager(agentPath, mcpPath)
+	assertNoError(t, err)
+	defer cm.Close()
+
+	var mu sync.Mutex
+	var changes []*MCPConfig
+	cm.OnMCPConfigChange(func(cfg *MCPConfig) {
+		mu.Lock()
+		defer mu.Unlock()
+		changes = append(changes, cfg)
+	})
+
+	// A reload without changes doesn't notify
+	assertNoError(t, cm.reloadConfig())
+	mu.Lock()
+	assertEqual(t, 0, len(changes))
+	mu.Unlock()
+
+	// Writing the file may also trigger the watcher; either way the change
+	// is reported once
+	assertNoError(t, os.WriteFile(mcpPath, []byte("servers:\n  - name: echo\n    transport: stdio\n    endpoint: ./echo\n  - name: search\n    transport: http\n    endpoint: http://localhost:9000/mcp\n"), 0644))
+	assertNoError(t, cm.reloadConfig())
+
+	mu.Lock()
+	defer mu.Unlock()
+	assertEqual(t, 1, len(changes))
+	assertEqual(t, 2, len(changes[0].Servers))
+	assertEqual(t, "search", changes[0].Servers[1].Name)
+}
@@ -10,18 +10,41 @@ import (
 // MCPConfig contains configuration for all MCP servers
 type MCPConfig struct {
 	Servers []MCPServerConfig `yaml:"servers"`
+
+	// HealthCheckInterval is how often servers are pinged; servers that
+	// don't respond are reconnected with RetryMax and RetryDelay
+	HealthCheckInterval time.Duration `yaml:"health_check_interval,omitempty"`
+
+	// ToolNamespacing names tools server__tool to tell servers' tools apart:
+	// none (default; on a name collision the server listed first wins),
+	// collisions (only colliding names) or always
+	ToolNamespacing string `yaml:"tool_namespacing,omitempty"`
 }
 
 // MCPServerConfig represents a single MCP server configuration
 type MCPServerConfig struct {
 	Name       string            `yaml:"name"`
-	Transport  string            `yaml:"transport"` // stdio, http
-	Endpoint   string            `yaml:"endpoint"`  // command for stdio, URL for http
+	Transport  string            `yaml:"transport"` // stdio, http (Streamable HTTP), sse (legacy HTTP+SSE)
+	Endpoint   string            `yaml:"endpoint"`  // command for stdio, URL for http and sse
 	Args       []string          `yaml:"args,omitempty"`
 	Env        map[string]string `yaml:"env,omitempty"`
 	Timeout    time.Duration     `yaml:"timeout,omitempty"`
 	RetryMax   int               `yaml:"retry_max,omitempty"`
 	RetryDelay time.Duration     `yaml:"retry_delay,omitempty"`
+
+	// Remote servers (http and sse)
+	Headers        map[string]string `yaml:"headers,omitempty"`          // sent with every request
+	BearerTokenEnv string            `yaml:"bearer_token_env,omitempty"` // environment variable holding a bearer token
+	TLS            *MCPTLSConfig     `yaml:"tls,omitempty"`
+}
+
+// MCPTLSConfig configures TLS for remote MCP servers
+type MCPTLSConfig struct {
+	CAFile             string `yaml:"ca_file,omitempty"`   // PEM bundle trusted instead of the system roots
+	CertFile           string `yaml:"cert_file,omitempty"` // client certificate, for mutual TLS
+	KeyFile            string `yaml:"key_file,omitempty"`
+	ServerName         string `yaml:"server_name,omitempty"` // overrides the name verified in the server certificate
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"`
 }
 
 // LoadMCPConfig loads MCP server configurations from a YAML file
@@ -37,6 +60,9 @@ func LoadMCPConfig(path string) (*MCPConfig, error) {
 	}
 
 	// Set defaults
+	if cfg.HealthCheckInterval == 0 {
+		cfg.HealthCheckInterval = 30 * time.Second
+	}
 	for i := range cfg.Servers {
 		if cfg.Servers[i].Timeout == 0 {
 			cfg.Servers[i].Timeout = 30 * time.Second
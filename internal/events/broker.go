@@ -0,0 +1,364 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shankarg87/agent/internal/logging"
+	"github.com/shankarg87/agent/internal/store"
+)
+
+// Supported brokers
+const (
+	BrokerLocal    = "local"
+	BrokerPostgres = "postgres"
+)
+
+// ErrPayloadTooLarge is returned by brokers that limit message size
+var ErrPayloadTooLarge = errors.New("payload too large for broker")
+
+// Open creates the event bus for the given broker. The local broker keeps
+// events within this process; networked brokers connect to dsn and share
+// events between agentd processes, reading events too large to send from st.
+func Open(broker, dsn string, cfg Config, st store.Store) (EventBus, error) {
+	switch broker {
+	case BrokerLocal, "":
+		return NewEventBusWithConfig(cfg), nil
+	case BrokerPostgres:
+		if dsn == "" {
+			return nil, fmt.Errorf("postgres broker requires a DSN")
+		}
+		pg, err := NewPostgresBroker(dsn)
+		if err != nil {
+			return nil, err
+		}
+		return NewBrokeredBus(NewEventBusWithConfig(cfg), pg, st), nil
+	default:
+		return nil, fmt.Errorf("unknown event broker %q", broker)
+	}
+}
+
+// Broker carries messages between agentd processes. Every message published
+// by any process, including this one, is received on Messages.
+type Broker interface {
+	Publish(ctx context.Context, payload []byte) error
+	// Messages is closed when the broker is closed
+	Messages() <-chan []byte
+	Close() error
+}
+
+// brokerPublishTimeout bounds how long publishing waits on the broker
+const brokerPublishTimeout = 5 * time.Second
+
+// brokerQueueSize is how many messages a BrokeredBus holds for sending to,
+// or delivering from, a slow broker before dropping events
+const brokerQueueSize = 1024
+
+// OverflowBrokerQueue labels the events a BrokeredBus drops because its
+// queue to or from the broker is full. It can't be chosen for a
+// subscription.
+const OverflowBrokerQueue OverflowPolicy = "broker_queue"
+
+// message is what a BrokeredBus sends through its broker. Events too large
+// for the broker are sent by sequence, and receivers read them from the store.
+type message struct {
+	Origin   string       `json:"origin"`
+	RunID    string       `json:"run_id"`
+	Event    *store.Event `json:"event,omitempty"`
+	Sequence int64        `json:"sequence,omitempty"`
+	Close    bool         `json:"close,omitempty"`
+}
+
+// BrokeredBus delivers events to local subscribers and, through a Broker, to
+// the subscribers of every other process sharing the broker and store. That
+// lets a client follow a run executing on another replica. Messages go to
+// and come from the broker through queues, so neither publishers nor the
+// broker's connection wait on the other side.
+type BrokeredBus struct {
+	local  *LocalBus
+	broker Broker
+	store  store.Store
+	origin string // identifies this process's messages
+	logger *logging.SimpleLogger
+
+	outbox chan message  // to the broker
+	inbox  chan message  // from other processes, for local subscribers
+	stop   chan struct{} // closed by Close
+	sent   chan struct{} // closed once the outbox is flushed
+	done   chan struct{} // closed once the inbox is delivered
+}
+
+// NewBrokeredBus wraps local so events are also exchanged through broker
+func NewBrokeredBus(local *LocalBus, broker Broker, st store.Store) *BrokeredBus {
+	b := &BrokeredBus{
+		local:  local,
+		broker: broker,
+		store:  st,
+		origin: uuid.New().String(),
+		logger: logging.VerboseLogger("events"),
+		outbox: make(chan message, brokerQueueSize),
+		inbox:  make(chan message, brokerQueueSize),
+		stop:   make(chan struct{}),
+		sent:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go b.sendQueued()
+	go b.receive()
+	go b.deliverReceived()
+	return b
+}
+
+// Subscribe creates a new subscription for events from a specific run
+func (b *BrokeredBus) Subscribe(runID string) <-chan *store.Event {
+	return b.local.Subscribe(runID)
+}
+
+// SubscribeWithOptions creates a subscription with its own buffer size and
+// overflow policy
+func (b *BrokeredBus) SubscribeWithOptions(runID string, opts SubscribeOptions) <-chan *store.Event {
+	return b.local.SubscribeWithOptions(runID, opts)
+}
+
+// Unsubscribe removes a subscription
+func (b *BrokeredBus) Unsubscribe(runID string, ch <-chan *store.Event) {
+	b.local.Unsubscribe(runID, ch)
+}
+
+// SubscribeMatching creates a subscription to the events of every run, in
+// any process, that pass the filter
+func (b *BrokeredBus) SubscribeMatching(filter Filter, opts SubscribeOptions) <-chan *store.Event {
+	return b.local.SubscribeMatching(filter, opts)
+}
+
+// UnsubscribeMatching removes a filtered subscription
+func (b *BrokeredBus) UnsubscribeMatching(ch <-chan *store.Event) {
+	b.local.UnsubscribeMatching(ch)
+}
+
+// Publish delivers an event to local subscribers, then queues it for other
+// processes. An event the queue has no room for is dropped.
+func (b *BrokeredBus) Publish(runID string, event *store.Event) {
+	b.local.Publish(runID, event)
+
+	select {
+	case b.outbox <- message{RunID: runID, Event: event}:
+	default:
+		b.local.dropped(runID, event, OverflowBrokerQueue)
+	}
+}
+
+// CloseAll closes all subscriptions for a run in every process. Other
+// processes' subscribers would wait for the run forever without it, so it
+// waits for room in the queue.
+func (b *BrokeredBus) CloseAll(runID string) {
+	b.local.CloseAll(runID)
+
+	timer := time.NewTimer(brokerPublishTimeout)
+	defer timer.Stop()
+
+	select {
+	case b.outbox <- message{RunID: runID, Close: true}:
+	case <-timer.C:
+		b.logger.Warn("Failed to publish run close to broker", "run_id", runID, "error", "queue full")
+	}
+}
+
+// Close sends what's queued, then stops receiving from the broker and
+// closes it
+func (b *BrokeredBus) Close() error {
+	close(b.stop)
+	<-b.sent
+	err := b.broker.Close()
+	<-b.done
+	return err
+}
+
+// sendQueued publishes queued messages to the broker in order. On Close it
+// flushes the queue, giving the broker one publish timeout in all.
+func (b *BrokeredBus) sendQueued() {
+	defer close(b.sent)
+
+	for {
+		select {
+		case msg := <-b.outbox:
+			ctx, cancel := context.WithTimeout(context.Background(), brokerPublishTimeout)
+			b.publish(ctx, msg)
+			cancel()
+
+		case <-b.stop:
+			ctx, cancel := context.WithTimeout(context.Background(), brokerPublishTimeout)
+			defer cancel()
+			for {
+				select {
+				case msg := <-b.outbox:
+					b.publish(ctx, msg)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// publish sends a message to the broker, by sequence if its event is too
+// large
+func (b *BrokeredBus) publish(ctx context.Context, msg message) {
+	err := b.send(ctx, msg)
+	if errors.Is(err, ErrPayloadTooLarge) && msg.Event != nil && msg.Event.Sequence > 0 {
+		err = b.send(ctx, message{RunID: msg.RunID, Sequence: msg.Event.Sequence})
+	}
+	if err == nil {
+		return
+	}
+
+	if msg.Close {
+		b.logger.Warn("Failed to publish run close to broker", "run_id", msg.RunID, "error", err)
+	} else {
+		b.logger.Warn("Failed to publish event to broker", "run_id", msg.RunID, "type", msg.Event.Type, "error", err)
+	}
+}
+
+func (b *BrokeredBus) send(ctx context.Context, msg message) error {
+	msg.Origin = b.origin
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return b.broker.Publish(ctx, payload)
+}
+
+// receive queues other processes' messages for local subscribers. Only run
+// closes wait for room; events the queue can't hold are dropped.
+func (b *BrokeredBus) receive() {
+	defer close(b.inbox)
+
+	for payload := range b.broker.Messages() {
+		var msg message
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			b.logger.Warn("Ignoring malformed broker message", "error", err)
+			continue
+		}
+		if msg.Origin == b.origin {
+			// Already delivered locally
+			continue
+		}
+
+		if msg.Close {
+			b.inbox <- msg
+			continue
+		}
+		select {
+		case b.inbox <- msg:
+		default:
+			event := msg.Event
+			if event == nil {
+				event = &store.Event{RunID: msg.RunID, Sequence: msg.Sequence}
+			}
+			b.local.dropped(msg.RunID, event, OverflowBrokerQueue)
+		}
+	}
+}
+
+// deliverReceived delivers other processes' messages to local subscribers
+func (b *BrokeredBus) deliverReceived() {
+	defer close(b.done)
+
+	for msg := range b.inbox {
+		switch {
+		case msg.Close:
+			b.local.CloseAll(msg.RunID)
+		case msg.Event != nil:
+			b.local.Publish(msg.RunID, msg.Event)
+		case msg.Sequence > 0:
+			event, err := b.loadEvent(msg.RunID, msg.Sequence)
+			if err != nil {
+				b.logger.Warn("Failed to load event from store", "run_id", msg.RunID, "sequence", msg.Sequence, "error", err)
+				continue
+			}
+			b.local.Publish(msg.RunID, event)
+		}
+	}
+}
+
+// loadEvent reads an event that was too large to send through the broker
+func (b *BrokeredBus) loadEvent(runID string, sequence int64) (*store.Event, error) {
+	events, err := b.store.GetEventsAfter(context.Background(), runID, sequence-1)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 || events[0].Sequence != sequence {
+		return nil, store.ErrNotFound
+	}
+	return events[0], nil
+}
+
+// MemoryBroker connects buses within one process. It stands in for a
+// networked broker in tests, with each Connect acting as another process.
+type MemoryBroker struct {
+	// MaxPayload, when set, rejects larger messages with ErrPayloadTooLarge
+	MaxPayload int
+
+	mu    sync.Mutex
+	conns []*memoryConn
+}
+
+type memoryConn struct {
+	hub      *MemoryBroker
+	messages chan []byte
+}
+
+// NewMemoryBroker creates an in-process broker
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{}
+}
+
+// Connect returns a new connection to the broker
+func (m *MemoryBroker) Connect() Broker {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	conn := &memoryConn{hub: m, messages: make(chan []byte, 1024)}
+	m.conns = append(m.conns, conn)
+	return conn
+}
+
+func (c *memoryConn) Publish(ctx context.Context, payload []byte) error {
+	if c.hub.MaxPayload > 0 && len(payload) > c.hub.MaxPayload {
+		return ErrPayloadTooLarge
+	}
+
+	c.hub.mu.Lock()
+	defer c.hub.mu.Unlock()
+
+	for _, conn := range c.hub.conns {
+		select {
+		case conn.messages <- payload:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (c *memoryConn) Messages() <-chan []byte {
+	return c.messages
+}
+
+func (c *memoryConn) Close() error {
+	c.hub.mu.Lock()
+	defer c.hub.mu.Unlock()
+
+	for i, conn := range c.hub.conns {
+		if conn == c {
+			c.hub.conns = append(c.hub.conns[:i], c.hub.conns[i+1:]...)
+			close(c.messages)
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package events
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shankarg87/agent/internal/store"
+)
+
+// newReplicas returns two buses sharing a broker and store, as two agentd
+// processes would
+func newReplicas(t *testing.T, hub *MemoryBroker, st store.Store) (*BrokeredBus, *BrokeredBus) {
+	t.Helper()
+
+	a := NewBrokeredBus(NewEventBus(), hub.Connect(), st)
+	b := NewBrokeredBus(NewEventBus(), hub.Connect(), st)
+	t.Cleanup(func() {
+		a.Close()
+		b.Close()
+	})
+	return a, b
+}
+
+func receive(t *testing.T, ch <-chan *store.Event) *store.Event {
+	t.Helper()
+
+	select {
+	case event := <-ch:
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("Expected an event")
+		return nil
+	}
+}
+
+func TestBrokeredBus_DeliversAcrossProcesses(t *testing.T) {
+	a, b := newReplicas(t, NewMemoryBroker(), store.NewInMemoryStore())
+
+	local := a.Subscribe("run-1")
+	remote := b.Subscribe("run-1")
+
+	a.Publish("run-1", &store.Event{ID: "event-1", RunID: "run-1", Sequence: 1, Type: store.EventTypeTextDelta, Data: map[string]any{"text": "hi"}})
+
+	event := receive(t, remote)
+	assertEqual(t, "event-1", event.ID)
+	assertEqual(t, int64(1), event.Sequence)
+	assertEqual(t, "hi", event.Data["text"])
+
+	// The publishing process delivers once, not again from the broker
+	assertEqual(t, "event-1", receive(t, local).ID)
+	select {
+	case event := <-local:
+		t.Fatalf("Unexpected duplicate event %v", event.ID)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// The run ending closes subscriptions everywhere
+	a.CloseAll("run-1")
+	select {
+	case _, ok := <-remote:
+		assertEqual(t, false, ok)
+	case <-time.After(time.Second):
+		t.Fatal("Expected the remote subscription to close")
+	}
+}
+
+func TestBrokeredBus_LoadsOversizedEvents(t *testing.T) {
+	hub := NewMemoryBroker()
+	hub.MaxPayload = 256
+	st := store.NewInMemoryStore()
+	a, b := newReplicas(t, hub, st)
+
+	remote := b.Subscribe("run-1")
+
+	event := &store.Event{RunID: "run-1", Type: store.EventTypeToolCompleted, Data: map[string]any{"output": strings.Repeat("x", 1024)}}
+	assertEqual(t, nil, st.AddEvent(context.Background(), "run-1", event))
+	a.Publish("run-1", event)
+
+	received := receive(t, remote)
+	assertEqual(t, event.Sequence, received.Sequence)
+	assertEqual(t, 1024, len(received.Data["output"].(string)))
+}
+
+// stalledBroker doesn't finish publishing until released, like a broker
+// that stopped responding
+type stalledBroker struct {
+	released chan struct{}
+	messages chan []byte
+}
+
+func (s stalledBroker) Publish(ctx context.Context, payload []byte) error {
+	select {
+	case <-s.released:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s stalledBroker) Messages() <-chan []byte { return s.messages }
+
+func (s stalledBroker) Close() error {
+	close(s.messages)
+	return nil
+}
+
+func TestBrokeredBus_PublishDoesNotWaitForBroker(t *testing.T) {
+	var dropped []int64
+	broker := stalledBroker{released: make(chan struct{}), messages: make(chan []byte)}
+	bus := NewBrokeredBus(NewEventBusWithConfig(recordDrops(&dropped)), broker, store.NewInMemoryStore())
+	ch := bus.Subscribe("run-1")
+
+	// Local subscribers get events at once, and what the queue to the
+	// stalled broker can't hold is dropped
+	start := time.Now()
+	for seq := int64(1); seq <= brokerQueueSize+2; seq++ {
+		bus.Publish("run-1", sequencedEvent(seq))
+		assertEqual(t, seq, receive(t, ch).Sequence)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Publish waited %v for the broker", elapsed)
+	}
+	if len(dropped) == 0 || dropped[len(dropped)-1] != brokerQueueSize+2 {
+		t.Fatalf("Expected the last events to be dropped, got %v", dropped)
+	}
+
+	close(broker.released)
+	assertEqual(t, nil, bus.Close())
+}
+
+func TestPostgresBroker(t *testing.T) {
+	dsn := os.Getenv("AGENT_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("AGENT_TEST_POSTGRES_DSN not set")
+	}
+
+	a, err := NewPostgresBroker(dsn)
+	assertEqual(t, nil, err)
+	defer a.Close()
+	b, err := NewPostgresBroker(dsn)
+	assertEqual(t, nil, err)
+	defer b.Close()
+
+	assertEqual(t, nil, a.Publish(context.Background(), []byte(`{"run_id":"run-1"}`)))
+	select {
+	case payload := <-b.Messages():
+		assertEqual(t, `{"run_id":"run-1"}`, string(payload))
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a notification")
+	}
+
+	err = a.Publish(context.Background(), make([]byte, postgresMaxPayload+1))
+	assertEqual(t, ErrPayloadTooLarge, err)
+}
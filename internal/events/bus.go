@@ -1,45 +1,207 @@
 package events
 
 import (
+	"fmt"
 	"sync"
+	"time"
 
 	"github.com/shankarg87/agent/internal/store"
 )
 
-// EventBus manages event subscriptions and publishing
-type EventBus struct {
+// OverflowPolicy decides what Publish does when a subscriber's buffer is full
+type OverflowPolicy string
+
+const (
+	// OverflowBlock queues up to another buffer of events for the
+	// subscriber's own goroutine, which waits up to the block timeout for
+	// room for each before dropping it. Publish never waits.
+	OverflowBlock OverflowPolicy = "block"
+	// OverflowDropOldest discards the subscriber's oldest buffered event to make room
+	OverflowDropOldest OverflowPolicy = "drop_oldest"
+	// OverflowDisconnect ends the subscription with a lagged event; the
+	// subscriber is expected to resync from the store
+	OverflowDisconnect OverflowPolicy = "disconnect"
+)
+
+// Subscription defaults used when no config overrides them
+const (
+	DefaultBufferSize     = 100
+	DefaultOverflowPolicy = OverflowDisconnect
+	DefaultBlockTimeout   = time.Second
+)
+
+// SubscribeOptions controls buffering for a single subscriber. Zero values
+// fall back to the bus defaults.
+type SubscribeOptions struct {
+	BufferSize   int
+	Policy       OverflowPolicy
+	BlockTimeout time.Duration
+}
+
+// Config configures an EventBus
+type Config struct {
+	// Defaults applies to subscriptions that don't set their own options
+	Defaults SubscribeOptions
+
+	// OnDrop is called for every event a subscriber doesn't receive, and
+	// with OverflowBrokerQueue for every event a BrokeredBus drops
+	OnDrop func(runID string, event *store.Event, policy OverflowPolicy)
+}
+
+// ParseOverflowPolicy validates a policy name; an empty name selects the default
+func ParseOverflowPolicy(name string) (OverflowPolicy, error) {
+	switch policy := OverflowPolicy(name); policy {
+	case "":
+		return DefaultOverflowPolicy, nil
+	case OverflowBlock, OverflowDropOldest, OverflowDisconnect:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown overflow policy %q (expected block, drop_oldest or disconnect)", name)
+	}
+}
+
+// EventBus manages event subscriptions and publishing. LocalBus delivers
+// within one process; BrokeredBus also delivers to other agentd processes.
+type EventBus interface {
+	// Subscribe creates a subscription with the bus's default options
+	Subscribe(runID string) <-chan *store.Event
+	// SubscribeWithOptions creates a subscription with its own options
+	SubscribeWithOptions(runID string, opts SubscribeOptions) <-chan *store.Event
+	// Unsubscribe removes a subscription and closes its channel
+	Unsubscribe(runID string, ch <-chan *store.Event)
+	// SubscribeMatching creates a subscription to every run's events that
+	// pass the filter. It outlives the runs, so CloseAll leaves it open.
+	SubscribeMatching(filter Filter, opts SubscribeOptions) <-chan *store.Event
+	// UnsubscribeMatching removes a filtered subscription and closes its channel
+	UnsubscribeMatching(ch <-chan *store.Event)
+	// Publish sends an event to every subscriber of a run
+	Publish(runID string, event *store.Event)
+	// CloseAll closes every subscription to a run once it has ended
+	CloseAll(runID string)
+}
+
+// LocalBus is an in-process EventBus
+type LocalBus struct {
 	mu          sync.RWMutex
-	subscribers map[string][]chan *store.Event // runID -> channels
+	subscribers map[string][]*subscriber // runID -> subscribers
+	matching    []*subscriber            // filtered subscriptions across runs
+	config      Config
+}
+
+// subscriber is one subscription's channel and overflow handling. Its mutex
+// orders sends against closing the channel.
+type subscriber struct {
+	mu     sync.Mutex
+	ch     chan *store.Event
+	opts   SubscribeOptions
+	filter Filter // for subscriptions across runs
+	closed bool
+
+	// A blocking subscriber's events wait here for its pump, which closes
+	// the channel once the subscription ends
+	queue   []queuedEvent
+	sending bool          // the pump is waiting to send an event
+	ready   chan struct{} // wakes the pump
+	abort   chan struct{} // closed on unsubscribe to discard the queue
+}
+
+type queuedEvent struct {
+	runID string
+	event *store.Event
+}
+
+// NewEventBus creates an in-process event bus with the default subscription
+// options
+func NewEventBus() *LocalBus {
+	return NewEventBusWithConfig(Config{})
+}
+
+// NewEventBusWithConfig creates an in-process event bus
+func NewEventBusWithConfig(cfg Config) *LocalBus {
+	cfg.Defaults = withDefaults(cfg.Defaults, SubscribeOptions{
+		BufferSize:   DefaultBufferSize,
+		Policy:       DefaultOverflowPolicy,
+		BlockTimeout: DefaultBlockTimeout,
+	})
+
+	return &LocalBus{
+		subscribers: make(map[string][]*subscriber),
+		config:      cfg,
+	}
 }
 
-// NewEventBus creates a new event bus
-func NewEventBus() *EventBus {
-	return &EventBus{
-		subscribers: make(map[string][]chan *store.Event),
+// withDefaults fills the unset fields of opts from defaults
+func withDefaults(opts, defaults SubscribeOptions) SubscribeOptions {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = defaults.BufferSize
 	}
+	if opts.Policy == "" {
+		opts.Policy = defaults.Policy
+	}
+	if opts.BlockTimeout <= 0 {
+		opts.BlockTimeout = defaults.BlockTimeout
+	}
+	return opts
 }
 
 // Subscribe creates a new subscription for events from a specific run
-func (b *EventBus) Subscribe(runID string) <-chan *store.Event {
+func (b *LocalBus) Subscribe(runID string) <-chan *store.Event {
+	return b.SubscribeWithOptions(runID, SubscribeOptions{})
+}
+
+// SubscribeWithOptions creates a subscription with its own buffer size and
+// overflow policy
+func (b *LocalBus) SubscribeWithOptions(runID string, opts SubscribeOptions) <-chan *store.Event {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	ch := make(chan *store.Event, 100)
-	b.subscribers[runID] = append(b.subscribers[runID], ch)
+	sub := b.newSubscriber(opts)
+	b.subscribers[runID] = append(b.subscribers[runID], sub)
 
-	return ch
+	return sub.ch
+}
+
+// SubscribeMatching creates a subscription to the events of every run that
+// pass the filter
+func (b *LocalBus) SubscribeMatching(filter Filter, opts SubscribeOptions) <-chan *store.Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := b.newSubscriber(opts)
+	sub.filter = filter
+	b.matching = append(b.matching, sub)
+
+	return sub.ch
+}
+
+func (b *LocalBus) newSubscriber(opts SubscribeOptions) *subscriber {
+	opts = withDefaults(opts, b.config.Defaults)
+
+	// Disconnecting subscribers keep a spare slot for the lagged event
+	capacity := opts.BufferSize
+	if opts.Policy == OverflowDisconnect {
+		capacity++
+	}
+
+	sub := &subscriber{ch: make(chan *store.Event, capacity), opts: opts}
+	if opts.Policy == OverflowBlock {
+		sub.ready = make(chan struct{}, 1)
+		sub.abort = make(chan struct{})
+		go b.pump(sub)
+	}
+	return sub
 }
 
 // Unsubscribe removes a subscription
-func (b *EventBus) Unsubscribe(runID string, ch <-chan *store.Event) {
+func (b *LocalBus) Unsubscribe(runID string, ch <-chan *store.Event) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
 	subs := b.subscribers[runID]
 	for i, sub := range subs {
-		if sub == ch {
+		if sub.ch == ch {
 			// Close and remove the channel
-			close(sub)
+			sub.close(false)
 			b.subscribers[runID] = append(subs[:i], subs[i+1:]...)
 			break
 		}
@@ -51,27 +213,193 @@ func (b *EventBus) Unsubscribe(runID string, ch <-chan *store.Event) {
 	}
 }
 
-// Publish sends an event to all subscribers of a run
-func (b *EventBus) Publish(runID string, event *store.Event) {
+// UnsubscribeMatching removes a filtered subscription
+func (b *LocalBus) UnsubscribeMatching(ch <-chan *store.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i, sub := range b.matching {
+		if sub.ch == ch {
+			sub.close(false)
+			b.matching = append(b.matching[:i], b.matching[i+1:]...)
+			break
+		}
+	}
+}
+
+// Publish sends an event to all subscribers of a run, applying each
+// subscriber's overflow policy when its buffer is full
+func (b *LocalBus) Publish(runID string, event *store.Event) {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 
-	for _, ch := range b.subscribers[runID] {
+	for _, sub := range b.subscribers[runID] {
+		b.deliver(runID, sub, event)
+	}
+	for _, sub := range b.matching {
+		if sub.filter.Matches(event) {
+			b.deliver(runID, sub, event)
+		}
+	}
+}
+
+// deliver sends an event to one subscriber
+func (b *LocalBus) deliver(runID string, sub *subscriber, event *store.Event) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	if sub.closed {
+		return
+	}
+
+	switch sub.opts.Policy {
+	case OverflowBlock:
+		// Straight into the buffer unless earlier events are still waiting
+		if len(sub.queue) == 0 && !sub.sending {
+			select {
+			case sub.ch <- event:
+				return
+			default:
+			}
+		}
+
+		// Publish holds the bus lock, and callers their own, so waiting for
+		// room is left to the pump
+		if len(sub.queue) >= sub.opts.BufferSize {
+			b.dropped(runID, event, sub.opts.Policy)
+			return
+		}
+		sub.queue = append(sub.queue, queuedEvent{runID: runID, event: event})
+		sub.wake()
+
+	case OverflowDropOldest:
+		for {
+			select {
+			case sub.ch <- event:
+				return
+			default:
+			}
+
+			// Make room; the consumer may have freed a slot in the meantime
+			select {
+			case oldest := <-sub.ch:
+				b.dropped(runID, oldest, sub.opts.Policy)
+			default:
+			}
+		}
+
+	default:
+		if len(sub.ch) < sub.opts.BufferSize {
+			sub.ch <- event
+			return
+		}
+
+		// The spare slot is always free, so the lagged event never blocks
+		b.dropped(runID, event, sub.opts.Policy)
+		sub.ch <- laggedEvent(runID, event)
+		sub.closed = true
+		close(sub.ch)
+	}
+}
+
+// pump sends a blocking subscriber's queued events in order, waiting up to
+// the block timeout for room for each. Once the subscription ends it sends
+// what's left unless it was unsubscribed, then closes the channel.
+func (b *LocalBus) pump(sub *subscriber) {
+	defer close(sub.ch)
+
+	for {
+		sub.mu.Lock()
+		sub.sending = false
+		for len(sub.queue) == 0 && !sub.closed {
+			sub.mu.Unlock()
+			<-sub.ready
+			sub.mu.Lock()
+		}
 		select {
-		case ch <- event:
+		case <-sub.abort:
+			sub.queue = nil
 		default:
-			// Channel full, skip to prevent blocking
 		}
+		if len(sub.queue) == 0 {
+			sub.mu.Unlock()
+			return
+		}
+		next := sub.queue[0]
+		sub.queue = sub.queue[1:]
+		sub.sending = true
+		sub.mu.Unlock()
+
+		timer := time.NewTimer(sub.opts.BlockTimeout)
+		select {
+		case sub.ch <- next.event:
+		case <-timer.C:
+			b.dropped(next.runID, next.event, sub.opts.Policy)
+		case <-sub.abort:
+		}
+		timer.Stop()
+	}
+}
+
+// wake signals the pump that the queue or subscription changed; the caller
+// holds the subscriber's lock
+func (s *subscriber) wake() {
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+// dropped reports an event a subscriber won't receive
+func (b *LocalBus) dropped(runID string, event *store.Event, policy OverflowPolicy) {
+	if b.config.OnDrop != nil {
+		b.config.OnDrop(runID, event, policy)
+	}
+}
+
+// laggedEvent tells a disconnected subscriber which event it missed first.
+// It isn't stored, so it carries no sequence.
+func laggedEvent(runID string, missed *store.Event) *store.Event {
+	return &store.Event{
+		RunID: runID,
+		Type:  store.EventTypeLagged,
+		Data: map[string]any{
+			"missed_sequence": missed.Sequence,
+		},
+		Timestamp: time.Now(),
+	}
+}
+
+// close closes the subscriber's channel unless the bus already did. A
+// blocking subscriber's pump closes it instead, after sending the queued
+// events if drain is set.
+func (s *subscriber) close(drain bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.closed = true
+
+	if s.opts.Policy != OverflowBlock {
+		close(s.ch)
+		return
+	}
+	if !drain {
+		close(s.abort)
 	}
+	s.wake()
 }
 
 // CloseAll closes all subscriptions for a run
-func (b *EventBus) CloseAll(runID string) {
+func (b *LocalBus) CloseAll(runID string) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	for _, ch := range b.subscribers[runID] {
-		close(ch)
+	// The run's last events are still on their way to blocking subscribers
+	for _, sub := range b.subscribers[runID] {
+		sub.close(true)
 	}
 
 	delete(b.subscribers, runID)
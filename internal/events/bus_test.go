@@ -1,6 +1,7 @@
 package events
 
 import (
+	"sync"
 	"testing"
 	"time"
 
@@ -273,6 +274,191 @@ func TestEventBus_UnsubscribeNonExistentChannel(t *testing.T) {
 	bus.mu.RUnlock()
 }
 
+// recordDrops returns a bus config that records the sequences of dropped events
+func recordDrops(dropped *[]int64) Config {
+	var mu sync.Mutex
+	return Config{
+		OnDrop: func(runID string, event *store.Event, policy OverflowPolicy) {
+			mu.Lock()
+			defer mu.Unlock()
+			*dropped = append(*dropped, event.Sequence)
+		},
+	}
+}
+
+func sequencedEvent(seq int64) *store.Event {
+	return &store.Event{RunID: "run-1", Sequence: seq, Type: store.EventTypeTextDelta, Timestamp: time.Now()}
+}
+
+func TestEventBus_DisconnectSlowSubscriber(t *testing.T) {
+	var dropped []int64
+	bus := NewEventBusWithConfig(recordDrops(&dropped))
+	ch := bus.SubscribeWithOptions("run-1", SubscribeOptions{BufferSize: 2, Policy: OverflowDisconnect})
+
+	for seq := int64(1); seq <= 4; seq++ {
+		bus.Publish("run-1", sequencedEvent(seq))
+	}
+
+	// Buffered events come first, then the lagged event, then the close
+	assertEqual(t, int64(1), (<-ch).Sequence)
+	assertEqual(t, int64(2), (<-ch).Sequence)
+	lagged := <-ch
+	assertEqual(t, store.EventTypeLagged, lagged.Type)
+	assertEqual(t, int64(3), lagged.Data["missed_sequence"].(int64))
+	_, ok := <-ch
+	assertEqual(t, false, ok)
+
+	// Only the event that overflowed is reported; later ones have no subscriber
+	assertEqual(t, 1, len(dropped))
+	assertEqual(t, int64(3), dropped[0])
+
+	// Unsubscribing a disconnected channel must not close it twice
+	bus.Unsubscribe("run-1", ch)
+}
+
+func TestEventBus_DropOldest(t *testing.T) {
+	var dropped []int64
+	bus := NewEventBusWithConfig(recordDrops(&dropped))
+	ch := bus.SubscribeWithOptions("run-1", SubscribeOptions{BufferSize: 2, Policy: OverflowDropOldest})
+
+	for seq := int64(1); seq <= 3; seq++ {
+		bus.Publish("run-1", sequencedEvent(seq))
+	}
+
+	assertEqual(t, int64(2), (<-ch).Sequence)
+	assertEqual(t, int64(3), (<-ch).Sequence)
+	assertEqual(t, 1, len(dropped))
+	assertEqual(t, int64(1), dropped[0])
+}
+
+func TestEventBus_BlockWaitsForRoom(t *testing.T) {
+	var dropped []int64
+	bus := NewEventBusWithConfig(recordDrops(&dropped))
+	ch := bus.SubscribeWithOptions("run-1", SubscribeOptions{BufferSize: 1, Policy: OverflowBlock, BlockTimeout: time.Second})
+
+	// The second event waits for room without holding up Publish
+	bus.Publish("run-1", sequencedEvent(1))
+	bus.Publish("run-1", sequencedEvent(2))
+
+	assertEqual(t, int64(1), (<-ch).Sequence)
+	assertEqual(t, int64(2), (<-ch).Sequence)
+
+	bus.CloseAll("run-1")
+	_, ok := <-ch
+	assertEqual(t, false, ok)
+	assertEqual(t, 0, len(dropped))
+}
+
+func TestEventBus_BlockTimeoutDrops(t *testing.T) {
+	var dropped []int64
+	bus := NewEventBusWithConfig(recordDrops(&dropped))
+	ch := bus.SubscribeWithOptions("run-1", SubscribeOptions{BufferSize: 1, Policy: OverflowBlock, BlockTimeout: 10 * time.Millisecond})
+
+	bus.Publish("run-1", sequencedEvent(1))
+	bus.Publish("run-1", sequencedEvent(2))
+	time.Sleep(50 * time.Millisecond)
+
+	assertEqual(t, int64(1), (<-ch).Sequence)
+	bus.CloseAll("run-1")
+	_, ok := <-ch
+	assertEqual(t, false, ok)
+
+	assertEqual(t, 1, len(dropped))
+	assertEqual(t, int64(2), dropped[0])
+}
+
+func TestEventBus_BlockNeverHoldsUpPublish(t *testing.T) {
+	var dropped []int64
+	bus := NewEventBusWithConfig(recordDrops(&dropped))
+	stalled := bus.SubscribeWithOptions("run-1", SubscribeOptions{BufferSize: 1, Policy: OverflowBlock, BlockTimeout: time.Minute})
+	other := bus.Subscribe("run-1")
+
+	// A client that stops reading costs the publisher nothing, and other
+	// subscribers keep receiving
+	start := time.Now()
+	for seq := int64(1); seq <= 4; seq++ {
+		bus.Publish("run-1", sequencedEvent(seq))
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("Publish waited %v for a stalled subscriber", elapsed)
+	}
+	for seq := int64(1); seq <= 4; seq++ {
+		assertEqual(t, seq, (<-other).Sequence)
+	}
+
+	// Beyond its buffer and queue the stalled subscriber loses the newest
+	// event, and unsubscribing discards what's queued
+	assertEqual(t, int64(4), dropped[len(dropped)-1])
+	bus.Unsubscribe("run-1", stalled)
+	assertEqual(t, int64(1), (<-stalled).Sequence)
+	_, ok := <-stalled
+	assertEqual(t, false, ok)
+}
+
+func TestEventBus_BlockDeliversQueuedEventsOnClose(t *testing.T) {
+	bus := NewEventBus()
+	ch := bus.SubscribeWithOptions("run-1", SubscribeOptions{BufferSize: 1, Policy: OverflowBlock, BlockTimeout: time.Second})
+
+	// The run ends before its last event has room
+	bus.Publish("run-1", sequencedEvent(1))
+	bus.Publish("run-1", sequencedEvent(2))
+	bus.CloseAll("run-1")
+
+	assertEqual(t, int64(1), (<-ch).Sequence)
+	assertEqual(t, int64(2), (<-ch).Sequence)
+	_, ok := <-ch
+	assertEqual(t, false, ok)
+}
+
+func TestEventBus_SubscribeMatching(t *testing.T) {
+	bus := NewEventBus()
+	checkpoints := bus.SubscribeMatching(Filter{TenantID: "tenant-1", Types: []string{store.EventTypeCheckpointRequired}}, SubscribeOptions{})
+
+	publish := func(runID, tenantID, eventType string) {
+		bus.Publish(runID, &store.Event{ID: runID + "-" + eventType, RunID: runID, TenantID: tenantID, Type: eventType})
+	}
+	publish("run-1", "tenant-1", store.EventTypeTextDelta)
+	publish("run-1", "tenant-1", store.EventTypeCheckpointRequired)
+	publish("run-2", "tenant-2", store.EventTypeCheckpointRequired)
+	publish("run-3", "tenant-1", store.EventTypeCheckpointRequired)
+
+	// Only matching events arrive, from every run
+	assertEqual(t, "run-1-checkpoint_required", (<-checkpoints).ID)
+	assertEqual(t, "run-3-checkpoint_required", (<-checkpoints).ID)
+	select {
+	case event := <-checkpoints:
+		t.Fatalf("Unexpected event %v", event.ID)
+	default:
+	}
+
+	// Runs ending leave the subscription open
+	bus.CloseAll("run-1")
+	publish("run-4", "tenant-1", store.EventTypeCheckpointRequired)
+	assertEqual(t, "run-4-checkpoint_required", (<-checkpoints).ID)
+
+	bus.UnsubscribeMatching(checkpoints)
+	_, ok := <-checkpoints
+	assertEqual(t, false, ok)
+
+	bus.mu.RLock()
+	assertEqual(t, 0, len(bus.matching))
+	bus.mu.RUnlock()
+}
+
+func TestParseOverflowPolicy(t *testing.T) {
+	policy, err := ParseOverflowPolicy("")
+	assertEqual(t, nil, err)
+	assertEqual(t, DefaultOverflowPolicy, policy)
+
+	policy, err = ParseOverflowPolicy("drop_oldest")
+	assertEqual(t, nil, err)
+	assertEqual(t, OverflowDropOldest, policy)
+
+	if _, err := ParseOverflowPolicy("drop_newest"); err == nil {
+		t.Fatal("Expected an error for an unknown policy")
+	}
+}
+
 // Test helpers
 func assertNotNil(t *testing.T, value any) {
 	t.Helper()
@@ -0,0 +1,52 @@
+package events
+
+import (
+	"strings"
+
+	"github.com/shankarg87/agent/internal/store"
+)
+
+// Wildcard matches any value in a Filter field
+const Wildcard = "*"
+
+// Filter selects events across runs. Empty fields match everything.
+type Filter struct {
+	TenantID  string
+	SessionID string
+	RunID     string
+
+	// Types lists the event types to match. An entry ending in "*" matches
+	// by prefix, so "tool_*" matches every tool event and "*" matches all.
+	Types []string
+}
+
+// Matches reports whether an event passes the filter
+func (f Filter) Matches(event *store.Event) bool {
+	if !matchField(f.TenantID, event.TenantID) ||
+		!matchField(f.SessionID, event.SessionID) ||
+		!matchField(f.RunID, event.RunID) {
+		return false
+	}
+	return f.MatchesType(event.Type)
+}
+
+// MatchesType reports whether events of a type can pass the filter
+func (f Filter) MatchesType(eventType string) bool {
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, pattern := range f.Types {
+		if prefix, ok := strings.CutSuffix(pattern, Wildcard); ok {
+			if strings.HasPrefix(eventType, prefix) {
+				return true
+			}
+		} else if pattern == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func matchField(want, got string) bool {
+	return want == "" || want == Wildcard || want == got
+}
@@ -0,0 +1,38 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/shankarg87/agent/internal/store"
+)
+
+func TestFilter_Matches(t *testing.T) {
+	event := &store.Event{RunID: "run-1", TenantID: "tenant-1", SessionID: "session-1", Type: store.EventTypeCheckpointRequired}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{"empty filter matches everything", Filter{}, true},
+		{"tenant", Filter{TenantID: "tenant-1"}, true},
+		{"other tenant", Filter{TenantID: "tenant-2"}, false},
+		{"wildcard tenant", Filter{TenantID: "*"}, true},
+		{"session", Filter{SessionID: "session-1"}, true},
+		{"other run", Filter{RunID: "run-2"}, false},
+		{"type", Filter{Types: []string{store.EventTypeCheckpointRequired}}, true},
+		{"any listed type", Filter{Types: []string{store.EventTypeRunStarted, store.EventTypeCheckpointRequired}}, true},
+		{"other type", Filter{Types: []string{store.EventTypeRunStarted}}, false},
+		{"type prefix", Filter{Types: []string{"checkpoint_*"}}, true},
+		{"other type prefix", Filter{Types: []string{"run_*"}}, false},
+		{"wildcard type", Filter{Types: []string{"*"}}, true},
+		{"all fields", Filter{TenantID: "tenant-1", SessionID: "session-1", Types: []string{"checkpoint_*"}}, true},
+		{"one field differs", Filter{TenantID: "tenant-1", SessionID: "session-2", Types: []string{"*"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertEqual(t, tt.want, tt.filter.Matches(event))
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/shankarg87/agent/internal/logging"
+)
+
+const (
+	// postgresChannel is the LISTEN/NOTIFY channel agentd processes share
+	postgresChannel = "agent_events"
+
+	// NOTIFY rejects payloads of 8000 bytes or more
+	postgresMaxPayload = 7999
+
+	// postgresPingInterval keeps an idle listener connection checked
+	postgresPingInterval = 90 * time.Second
+)
+
+// PostgresBroker carries messages over Postgres LISTEN/NOTIFY, so replicas
+// sharing a Postgres store need no other infrastructure
+type PostgresBroker struct {
+	db       *sql.DB
+	listener *pq.Listener
+	messages chan []byte
+	done     chan struct{}
+	logger   *logging.SimpleLogger
+}
+
+// NewPostgresBroker connects to the database at dsn and starts listening
+func NewPostgresBroker(dsn string) (*PostgresBroker, error) {
+	logger := logging.VerboseLogger("events")
+	logger.Verbose("Opening Postgres event broker")
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open postgres database: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to postgres: %w", err)
+	}
+
+	listener := pq.NewListener(dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			logger.Warn("Postgres event listener connection problem", "error", err)
+		}
+	})
+	if err := listener.Listen(postgresChannel); err != nil {
+		listener.Close()
+		db.Close()
+		return nil, fmt.Errorf("failed to listen for events: %w", err)
+	}
+
+	b := &PostgresBroker{
+		db:       db,
+		listener: listener,
+		messages: make(chan []byte, 1024),
+		done:     make(chan struct{}),
+		logger:   logger,
+	}
+	go b.receive()
+	return b, nil
+}
+
+// Publish sends a message to every listening process
+func (b *PostgresBroker) Publish(ctx context.Context, payload []byte) error {
+	if len(payload) > postgresMaxPayload {
+		return ErrPayloadTooLarge
+	}
+	if _, err := b.db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, postgresChannel, string(payload)); err != nil {
+		return fmt.Errorf("failed to notify: %w", err)
+	}
+	return nil
+}
+
+// Messages returns the messages published by all processes
+func (b *PostgresBroker) Messages() <-chan []byte {
+	return b.messages
+}
+
+// Close stops listening and closes the database
+func (b *PostgresBroker) Close() error {
+	close(b.done)
+	b.listener.Close()
+	return b.db.Close()
+}
+
+func (b *PostgresBroker) receive() {
+	defer close(b.messages)
+
+	ticker := time.NewTicker(postgresPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C:
+			go b.listener.Ping()
+		case notification, ok := <-b.listener.Notify:
+			if !ok {
+				return
+			}
+			if notification == nil {
+				// The listener reconnected; anything sent meanwhile is lost,
+				// and stream clients fill such gaps from the store
+				b.logger.Warn("Postgres event listener reconnected")
+				continue
+			}
+			select {
+			case b.messages <- []byte(notification.Extra):
+			case <-b.done:
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package mcp
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/shankarg87/agent/internal/config"
+)
+
+// Tool namespacing modes, set by tool_namespacing in the MCP config
+const (
+	// NamespacingNone keeps tool names as the servers give them. When
+	// servers share a tool name, the server listed first wins.
+	NamespacingNone = "none"
+	// NamespacingCollisions prefixes only tool names offered by more than
+	// one server, as server__tool
+	NamespacingCollisions = "collisions"
+	// NamespacingAlways prefixes every tool name, as server__tool
+	NamespacingAlways = "always"
+)
+
+// NamespaceSeparator joins a server name and a tool name
+const NamespaceSeparator = "__"
+
+// SetToolNamespacing sets how tool names are namespaced
+func (r *Registry) SetToolNamespacing(mode string) error {
+	switch mode {
+	case "":
+		mode = NamespacingNone
+	case NamespacingNone, NamespacingCollisions, NamespacingAlways:
+	default:
+		return fmt.Errorf("unknown tool namespacing %q (expected %s, %s or %s)",
+			mode, NamespacingNone, NamespacingCollisions, NamespacingAlways)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.namespacing = mode
+	return nil
+}
+
+// remoteName returns the tool's name on its server
+func (t *Tool) remoteName() string {
+	if t.RemoteName != "" {
+		return t.RemoteName
+	}
+	return t.Name
+}
+
+// orderedServers returns the servers in load order, then any added
+// directly in name order. Callers must hold r.mu.
+func (r *Registry) orderedServers() []*MCPServer {
+	servers := make([]*MCPServer, 0, len(r.servers))
+	listed := make(map[string]bool, len(r.order))
+	for _, name := range r.order {
+		if server, ok := r.servers[name]; ok && !listed[name] {
+			servers = append(servers, server)
+			listed[name] = true
+		}
+	}
+
+	var rest []string
+	for name := range r.servers {
+		if !listed[name] {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	for _, name := range rest {
+		servers = append(servers, r.servers[name])
+	}
+	return servers
+}
+
+// namedTools returns every tool under the name the model sees, in server
+// order, along with the tool names offered by more than one server and the
+// servers offering them. Aliases from toolConfigs are applied first, then
+// namespacing to the rest; when two tools still share a name, the earlier
+// server keeps it. Callers must hold r.mu.
+func (r *Registry) namedTools(toolConfigs []config.ToolConfig) ([]*Tool, map[string][]string) {
+	servers := r.orderedServers()
+	aliases := func(serverName string) map[string]string {
+		for i := range toolConfigs {
+			if toolConfigs[i].ServerName == serverName {
+				return toolConfigs[i].Aliases
+			}
+		}
+		return nil
+	}
+
+	owners := make(map[string][]string)
+	unaliased := make(map[string]int)
+	for _, server := range servers {
+		serverAliases := aliases(server.Name)
+		for name := range server.Tools {
+			owners[name] = append(owners[name], server.Name)
+			if _, ok := serverAliases[name]; !ok {
+				unaliased[name]++
+			}
+		}
+	}
+
+	var tools []*Tool
+	taken := make(map[string]bool)
+	for _, server := range servers {
+		serverAliases := aliases(server.Name)
+		for _, name := range slices.Sorted(maps.Keys(server.Tools)) {
+			exposed := name
+			if alias, ok := serverAliases[name]; ok {
+				exposed = alias
+			} else if r.namespacing == NamespacingAlways ||
+				(r.namespacing == NamespacingCollisions && unaliased[name] > 1) {
+				exposed = server.Name + NamespaceSeparator + name
+			}
+			if taken[exposed] {
+				// An earlier server already offers this name
+				continue
+			}
+			taken[exposed] = true
+
+			named := *server.Tools[name]
+			named.Name = exposed
+			if exposed != name {
+				named.RemoteName = name
+			}
+			tools = append(tools, &named)
+		}
+	}
+
+	collisions := make(map[string][]string)
+	for name, servers := range owners {
+		if len(servers) > 1 {
+			collisions[name] = servers
+		}
+	}
+	return tools, collisions
+}
+
+// ResolveTool returns the tool the model called by name, applying the
+// aliases in the agent's tool configuration
+func (r *Registry) ResolveTool(name string, toolConfigs []config.ToolConfig) (*Tool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tools, _ := r.namedTools(toolConfigs)
+	for _, tool := range tools {
+		if tool.Name == name {
+			return tool, nil
+		}
+	}
+	return nil, fmt.Errorf("tool not found: %s", name)
+}
+
+// reportCollisions logs tool names offered by more than one server and how
+// they are resolved
+func (r *Registry) reportCollisions() {
+	r.mu.RLock()
+	_, collisions := r.namedTools(nil)
+	namespacing := r.namespacing
+	r.mu.RUnlock()
+
+	for _, name := range slices.Sorted(maps.Keys(collisions)) {
+		servers := collisions[name]
+		if namespacing == NamespacingNone {
+			r.logger.Warn("Tool name collision, calls go to the first server",
+				"tool", name,
+				"servers", strings.Join(servers, ","),
+				"server_used", servers[0],
+				"hint", "set tool_namespacing or aliases to expose each server's tool",
+			)
+		} else {
+			r.logger.Info("Tool name collision resolved by namespacing",
+				"tool", name,
+				"servers", strings.Join(servers, ","),
+			)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package mcp
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/shankarg87/agent/internal/config"
+)
+
+// newFilesystemRegistry returns a registry with two servers that both offer
+// read_file, plus a tool unique to the second
+func newFilesystemRegistry(t *testing.T, namespacing string) *Registry {
+	t.Helper()
+
+	registry := NewRegistry()
+	assertNoError(t, registry.SetToolNamespacing(namespacing))
+	registry.SetServer("home", &MCPServer{Name: "home", Tools: map[string]*Tool{
+		"read_file": {Name: "read_file", ServerName: "home"},
+	}})
+	registry.SetServer("archive", &MCPServer{Name: "archive", Tools: map[string]*Tool{
+		"read_file":  {Name: "read_file", ServerName: "archive"},
+		"list_files": {Name: "list_files", ServerName: "archive"},
+	}})
+	return registry
+}
+
+func toolNames(tools []*Tool) []string {
+	names := make([]string, len(tools))
+	for i, tool := range tools {
+		names[i] = tool.Name
+	}
+	return names
+}
+
+func assertNames(t *testing.T, expected []string, tools []*Tool) {
+	t.Helper()
+	names := toolNames(tools)
+	if len(names) != len(expected) {
+		t.Fatalf("Expected tools %v, got %v", expected, names)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Fatalf("Expected tools %v, got %v", expected, names)
+		}
+	}
+}
+
+func TestRegistry_ToolNamespacing(t *testing.T) {
+	tests := []struct {
+		namespacing string
+		expected    []string
+	}{
+		// The first server loaded wins the shared name
+		{NamespacingNone, []string{"read_file", "list_files"}},
+		{NamespacingCollisions, []string{"home__read_file", "list_files", "archive__read_file"}},
+		{NamespacingAlways, []string{"home__read_file", "archive__list_files", "archive__read_file"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.namespacing, func(t *testing.T) {
+			registry := newFilesystemRegistry(t, tt.namespacing)
+			assertNames(t, tt.expected, registry.ListTools())
+
+			for _, name := range tt.expected {
+				tool, err := registry.GetTool(name)
+				assertNoError(t, err)
+				assertEqual(t, name, tool.Name)
+			}
+		})
+	}
+}
+
+func TestRegistry_GetToolIsDeterministic(t *testing.T) {
+	registry := newFilesystemRegistry(t, NamespacingNone)
+
+	for range 50 {
+		tool, err := registry.GetTool("read_file")
+		assertNoError(t, err)
+		assertEqual(t, "home", tool.ServerName)
+	}
+
+	// Both servers report the collision
+	for _, health := range registry.Health() {
+		assertEqual(t, 1, len(health.Collisions))
+		assertEqual(t, "read_file", health.Collisions[0])
+	}
+}
+
+func TestRegistry_ToolAliases(t *testing.T) {
+	registry := newFilesystemRegistry(t, NamespacingNone)
+	toolConfigs := []config.ToolConfig{{
+		ServerName: "archive",
+		Aliases:    map[string]string{"read_file": "read_archived_file"},
+	}}
+
+	assertNames(t, []string{"read_file", "list_files", "read_archived_file"}, registry.ListToolsFiltered(toolConfigs))
+
+	tool, err := registry.ResolveTool("read_archived_file", toolConfigs)
+	assertNoError(t, err)
+	assertEqual(t, "archive", tool.ServerName)
+	assertEqual(t, "read_file", tool.RemoteName)
+
+	tool, err = registry.ResolveTool("read_file", toolConfigs)
+	assertNoError(t, err)
+	assertEqual(t, "home", tool.ServerName)
+
+	_, err = registry.ResolveTool("missing", toolConfigs)
+	assertError(t, err)
+}
+
+func TestRegistry_ToolAliasesFilterByServerName(t *testing.T) {
+	registry := newFilesystemRegistry(t, NamespacingAlways)
+	toolConfigs := []config.ToolConfig{{
+		ServerName: "archive",
+		Allowlist:  []string{"^read_file$"},
+		Aliases:    map[string]string{"read_file": "read_archived_file"},
+	}}
+
+	assertNames(t, []string{"home__read_file", "read_archived_file"}, registry.ListToolsFiltered(toolConfigs))
+}
+
+func TestSetToolNamespacing_Invalid(t *testing.T) {
+	registry := NewRegistry()
+	err := registry.SetToolNamespacing("prefix")
+	assertError(t, err)
+	if !contains(err.Error(), `unknown tool namespacing "prefix"`) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+// newFilesystemServer serves a read_file tool that reports which server ran it
+func newFilesystemServer(t *testing.T, label string) config.MCPServerConfig {
+	t.Helper()
+
+	s := server.NewMCPServer(label, "1.0.0")
+	s.AddTool(mcp.NewTool("read_file"), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText(label), nil
+	})
+	ts := httptest.NewServer(server.NewStreamableHTTPServer(s))
+	t.Cleanup(ts.Close)
+
+	return httpServerConfig(label, ts)
+}
+
+func TestRegistry_CallNamespacedTool(t *testing.T) {
+	home := newFilesystemServer(t, "home")
+	archive := newFilesystemServer(t, "archive")
+
+	registry := NewRegistry()
+	t.Cleanup(func() { registry.Close() })
+
+	ctx := context.Background()
+	assertNoError(t, registry.LoadServers(ctx, &config.MCPConfig{
+		Servers:         []config.MCPServerConfig{home, archive},
+		ToolNamespacing: NamespacingCollisions,
+	}))
+
+	for _, label := range []string{"home", "archive"} {
+		result, err := registry.CallTool(ctx, label+NamespaceSeparator+"read_file", nil, nil)
+		assertNoError(t, err)
+		assertEqual(t, label, result.Content[0].Text)
+	}
+
+	// An alias reaches its server through the server's tool config
+	toolConfig := &config.ToolConfig{ServerName: "archive", Aliases: map[string]string{"read_file": "read_archived_file"}}
+	result, err := registry.CallTool(ctx, "read_archived_file", nil, toolConfig)
+	assertNoError(t, err)
+	assertEqual(t, "archive", result.Content[0].Text)
+}
@@ -2,9 +2,9 @@ package mcp
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"regexp"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -17,9 +17,15 @@ import (
 
 // Registry manages MCP server connections and tool invocations
 type Registry struct {
-	mu      sync.RWMutex
-	servers map[string]*MCPServer
-	logger  *logging.SimpleLogger
+	mu          sync.RWMutex
+	servers     map[string]*MCPServer
+	order       []string // server names in load order, which settles tool name collisions
+	namespacing string   // one of the Namespacing modes
+	health      map[string]*ServerHealth
+	statusHook  func(health ServerHealth) // a supervisor's OnStatus, told of servers Reconcile adds or removes
+	reconcileMu sync.Mutex                // serializes Reconcile
+	refreshMu   sync.Mutex                // serializes tool refreshes
+	logger      *logging.SimpleLogger
 }
 
 // MCPServer wraps an MCP client with metadata
@@ -28,11 +34,15 @@ type MCPServer struct {
 	Config config.MCPServerConfig
 	Client *client.Client
 	Tools  map[string]*Tool
+
+	inflight sync.WaitGroup // tool calls in progress, drained before closing
 }
 
-// Tool represents an MCP tool definition
+// Tool represents an MCP tool definition. Name is the name the model sees,
+// which namespacing or an alias may change from the name on the server.
 type Tool struct {
 	Name        string         `json:"name"`
+	RemoteName  string         `json:"remote_name,omitempty"` // name on the server, when it differs
 	Description string         `json:"description"`
 	InputSchema map[string]any `json:"input_schema"`
 	ServerName  string         `json:"server_name"`
@@ -57,8 +67,10 @@ func NewRegistry() *Registry {
 	logger.Verbose("Creating new MCP registry")
 
 	return &Registry{
-		servers: make(map[string]*MCPServer),
-		logger:  logger,
+		servers:     make(map[string]*MCPServer),
+		namespacing: NamespacingNone,
+		health:      make(map[string]*ServerHealth),
+		logger:      logger,
 	}
 }
 
@@ -66,6 +78,10 @@ func NewRegistry() *Registry {
 func (r *Registry) LoadServers(ctx context.Context, cfg *config.MCPConfig) error {
 	r.logger.Info("Loading MCP servers", "server_count", len(cfg.Servers))
 
+	if err := r.SetToolNamespacing(cfg.ToolNamespacing); err != nil {
+		return err
+	}
+
 	for _, serverCfg := range cfg.Servers {
 		r.logger.Verbose("Loading MCP server",
 			"name", serverCfg.Name,
@@ -85,52 +101,59 @@ func (r *Registry) LoadServers(ctx context.Context, cfg *config.MCPConfig) error
 	}
 
 	r.logger.Info("All MCP servers loaded successfully", "total_servers", len(cfg.Servers))
+	r.reportCollisions()
 	return nil
 }
 
 // LoadServer loads a single MCP server
 func (r *Registry) LoadServer(ctx context.Context, cfg config.MCPServerConfig) error {
 	start := time.Now()
-	r.logger.Verbose("Starting MCP server initialization",
-		"name", cfg.Name,
-		"transport", cfg.Transport,
-		"endpoint", cfg.Endpoint,
-		"args", cfg.Args,
-	)
-
-	r.mu.Lock()
-	defer r.mu.Unlock()
 
-	if cfg.Transport != "stdio" {
-		r.logger.Error("Unsupported transport type",
-			"name", cfg.Name,
-			"transport", cfg.Transport,
-		)
-		return fmt.Errorf("only stdio transport is currently supported")
+	server, err := r.connect(ctx, cfg)
+	if err != nil {
+		return err
 	}
 
-	// Convert env map to slice
-	var envSlice []string
-	for k, v := range cfg.Env {
-		envSlice = append(envSlice, fmt.Sprintf("%s=%s", k, v))
-	}
+	r.addServer(server)
+
+	r.logger.LogMCPConnection(cfg.Name, cfg.Transport, cfg.Endpoint, true)
+	r.logger.LogPerformance("load_mcp_server", time.Since(start), map[string]interface{}{
+		"server_name": cfg.Name,
+		"tool_count":  len(server.Tools),
+	})
 
-	r.logger.Verbose("Environment variables prepared",
+	return nil
+}
+
+// connect starts a client for the server, initializes it and lists its tools
+func (r *Registry) connect(ctx context.Context, cfg config.MCPServerConfig) (*MCPServer, error) {
+	r.logger.Verbose("Starting MCP server initialization",
 		"name", cfg.Name,
-		"env_count", len(envSlice),
+		"transport", cfg.Transport,
+		"endpoint", cfg.Endpoint,
+		"args", cfg.Args,
 	)
 
-	// Create stdio client (automatically starts)
+	// Create the client for the server's transport
 	r.logger.Verbose("Creating MCP client", "name", cfg.Name)
-	mcpClient, err := client.NewStdioMCPClient(cfg.Endpoint, envSlice, cfg.Args...)
+	mcpClient, err := newClient(ctx, cfg)
 	if err != nil {
 		r.logger.Error("Failed to create MCP client",
 			"name", cfg.Name,
+			"transport", cfg.Transport,
 			"error", err,
 		)
-		return fmt.Errorf("failed to create MCP client: %w", err)
+		return nil, fmt.Errorf("failed to create MCP client: %w", err)
 	}
 
+	// Refresh the server's tools when it reports they changed
+	mcpClient.OnNotification(func(notification mcp.JSONRPCNotification) {
+		if notification.Method == mcp.MethodNotificationToolsListChanged {
+			// Not on the transport's goroutine, which the refresh's request needs
+			go r.refreshTools(cfg.Name, mcpClient)
+		}
+	})
+
 	// Initialize the client
 	r.logger.Verbose("Initializing MCP client", "name", cfg.Name)
 	initReq := mcp.InitializeRequest{
@@ -151,68 +174,48 @@ func (r *Registry) LoadServer(ctx context.Context, cfg config.MCPServerConfig) e
 			"error", err,
 		)
 		mcpClient.Close()
-		return fmt.Errorf("failed to initialize MCP client: %w", err)
+		return nil, fmt.Errorf("failed to initialize MCP client: %w", err)
 	}
 
 	r.logger.Verbose("MCP client initialized successfully", "name", cfg.Name)
 
 	// List available tools
-	r.logger.Verbose("Listing available tools", "name", cfg.Name)
-	toolsResp, err := mcpClient.ListTools(ctx, mcp.ListToolsRequest{})
+	tools, err := r.listTools(ctx, cfg.Name, mcpClient)
 	if err != nil {
-		r.logger.Error("Failed to list tools",
-			"name", cfg.Name,
-			"error", err,
-		)
 		mcpClient.Close()
-		return fmt.Errorf("failed to list tools: %w", err)
-	}
-
-	r.logger.Verbose("Tools listed successfully",
-		"name", cfg.Name,
-		"tool_count", len(toolsResp.Tools),
-	)
-
-	// Build tool map
-	tools := make(map[string]*Tool)
-	for _, t := range toolsResp.Tools {
-		// Convert InputSchema to map[string]any
-		schemaBytes, _ := json.Marshal(t.InputSchema)
-		var schemaMap map[string]any
-		json.Unmarshal(schemaBytes, &schemaMap)
-
-		tools[t.Name] = &Tool{
-			Name:        t.Name,
-			Description: t.Description,
-			InputSchema: schemaMap,
-			ServerName:  cfg.Name,
-		}
-
-		r.logger.Verbose("Tool registered",
-			"server_name", cfg.Name,
-			"tool_name", t.Name,
-			"description", t.Description,
-		)
+		return nil, err
 	}
 
-	r.servers[cfg.Name] = &MCPServer{
+	return &MCPServer{
 		Name:   cfg.Name,
 		Config: cfg,
 		Client: mcpClient,
 		Tools:  tools,
-	}
+	}, nil
+}
 
-	r.logger.LogMCPConnection(cfg.Name, cfg.Transport, cfg.Endpoint, true)
-	r.logger.LogPerformance("load_mcp_server", time.Since(start), map[string]interface{}{
-		"server_name": cfg.Name,
-		"tool_count":  len(tools),
-	})
+// addServer adds a connected server, returning the server it replaces
+func (r *Registry) addServer(server *MCPServer) *MCPServer {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
-	return nil
+	previous := r.servers[server.Name]
+	if previous == nil && !slices.Contains(r.order, server.Name) {
+		r.order = append(r.order, server.Name)
+	}
+	r.servers[server.Name] = server
+	r.health[server.Name] = &ServerHealth{
+		Name:      server.Name,
+		Transport: server.Config.Transport,
+		Endpoint:  server.Config.Endpoint,
+		Status:    StatusConnected,
+	}
+	return previous
 }
 
-// GetServer returns an MCP server by name
-func (r *Registry) GetServer(name string) (*MCPServer, error) {
+// acquireServer returns a server by name, counting a tool call in flight
+// until the caller calls inflight.Done
+func (r *Registry) acquireServer(name string) (*MCPServer, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
@@ -221,21 +224,29 @@ func (r *Registry) GetServer(name string) (*MCPServer, error) {
 		return nil, fmt.Errorf("server not found: %s", name)
 	}
 
+	// Adding under the lock means a server removed from the map gains no
+	// new calls, so draining it can't miss one
+	server.inflight.Add(1)
 	return server, nil
 }
 
-// GetTool returns a tool by name, searching across all servers
-func (r *Registry) GetTool(toolName string) (*Tool, error) {
+// GetServer returns an MCP server by name
+func (r *Registry) GetServer(name string) (*MCPServer, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	for _, server := range r.servers {
-		if tool, ok := server.Tools[toolName]; ok {
-			return tool, nil
-		}
+	server, ok := r.servers[name]
+	if !ok {
+		return nil, fmt.Errorf("server not found: %s", name)
 	}
 
-	return nil, fmt.Errorf("tool not found: %s", toolName)
+	return server, nil
+}
+
+// GetTool returns a tool by the name the model sees, searching across all
+// servers
+func (r *Registry) GetTool(toolName string) (*Tool, error) {
+	return r.ResolveTool(toolName, nil)
 }
 
 // ListTools returns all available tools across all servers
@@ -243,28 +254,25 @@ func (r *Registry) ListTools() []*Tool {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	var tools []*Tool
-	for _, server := range r.servers {
-		for _, tool := range server.Tools {
-			tools = append(tools, tool)
-		}
-	}
-
+	tools, _ := r.namedTools(nil)
 	return tools
 }
 
-// ListToolsFiltered returns tools filtered by agent configuration (allowlist/denylist)
+// ListToolsFiltered returns tools filtered by agent configuration
+// (allowlist/denylist), with its aliases applied. Patterns match the names on
+// the servers, before namespacing or aliases.
 func (r *Registry) ListToolsFiltered(toolConfigs []config.ToolConfig) []*Tool {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
+	tools, _ := r.namedTools(toolConfigs)
 	var filteredTools []*Tool
 
-	for _, server := range r.servers {
+	for _, tool := range tools {
 		// Find the tool config for this server
 		var toolConfig *config.ToolConfig
 		for i := range toolConfigs {
-			if toolConfigs[i].ServerName == server.Name {
+			if toolConfigs[i].ServerName == tool.ServerName {
 				toolConfig = &toolConfigs[i]
 				break
 			}
@@ -272,27 +280,23 @@ func (r *Registry) ListToolsFiltered(toolConfigs []config.ToolConfig) []*Tool {
 
 		// If no config found, include all tools from this server
 		if toolConfig == nil {
-			for _, tool := range server.Tools {
-				filteredTools = append(filteredTools, tool)
-			}
+			filteredTools = append(filteredTools, tool)
 			continue
 		}
 
 		// Filter tools based on allowlist/denylist
-		for _, tool := range server.Tools {
-			if r.isToolAllowed(tool.Name, toolConfig) {
-				filteredTools = append(filteredTools, tool)
-				r.logger.Verbose("Tool included in filtered list",
-					"tool", tool.Name,
-					"server", server.Name,
-				)
-			} else {
-				r.logger.Info("Tool filtered out from LLM schema",
-					"tool", tool.Name,
-					"server", server.Name,
-					"reason", "denied by allowlist/denylist",
-				)
-			}
+		if r.isToolAllowed(tool.remoteName(), toolConfig) {
+			filteredTools = append(filteredTools, tool)
+			r.logger.Verbose("Tool included in filtered list",
+				"tool", tool.Name,
+				"server", tool.ServerName,
+			)
+		} else {
+			r.logger.Info("Tool filtered out from LLM schema",
+				"tool", tool.Name,
+				"server", tool.ServerName,
+				"reason", "denied by allowlist/denylist",
+			)
 		}
 	}
 
@@ -334,21 +338,39 @@ func (r *Registry) isToolAllowed(toolName string, toolConfig *config.ToolConfig)
 	return true
 }
 
-// CallTool executes a tool by name with safety checks
+// CallTool executes a tool by the name the model sees with safety checks.
+// toolConfig is the configuration of the tool's server; its aliases apply.
 func (r *Registry) CallTool(ctx context.Context, toolName string, arguments map[string]any, toolConfig *config.ToolConfig) (*ToolResult, error) {
-	tool, err := r.GetTool(toolName)
+	var toolConfigs []config.ToolConfig
+	if toolConfig != nil {
+		toolConfigs = []config.ToolConfig{*toolConfig}
+	}
+	tool, err := r.ResolveTool(toolName, toolConfigs)
 	if err != nil {
 		return nil, err
 	}
+	return r.CallResolvedTool(ctx, tool, arguments, toolConfig)
+}
+
+// CallResolvedTool executes a tool returned by ResolveTool with safety
+// checks, so it reaches the same server the name was resolved to
+func (r *Registry) CallResolvedTool(ctx context.Context, tool *Tool, arguments map[string]any, toolConfig *config.ToolConfig) (*ToolResult, error) {
+	toolName := tool.Name
+	remote := tool.remoteName()
 
-	server, err := r.GetServer(tool.ServerName)
+	server, err := r.acquireServer(tool.ServerName)
 	if err != nil {
 		return nil, err
 	}
+	defer server.inflight.Done()
+
+	if status := r.serverStatus(tool.ServerName); status != StatusConnected {
+		return nil, fmt.Errorf("server %s is %s", tool.ServerName, status)
+	}
 
 	// Apply tool authorization and safety checks
 	if toolConfig != nil {
-		if err := r.validateToolAuthorization(toolName, arguments, toolConfig); err != nil {
+		if err := r.validateToolAuthorization(remote, arguments, toolConfig); err != nil {
 			r.logger.Warn("Tool authorization failed",
 				"tool", toolName,
 				"error", err,
@@ -359,6 +381,7 @@ func (r *Registry) CallTool(ctx context.Context, toolName string, arguments map[
 
 	r.logger.Verbose("Executing tool",
 		"tool", toolName,
+		"remote_name", remote,
 		"server", tool.ServerName,
 		"args_count", len(arguments),
 	)
@@ -366,7 +389,7 @@ func (r *Registry) CallTool(ctx context.Context, toolName string, arguments map[
 	// Execute the tool
 	result, err := server.Client.CallTool(ctx, mcp.CallToolRequest{
 		Params: mcp.CallToolParams{
-			Name:      toolName,
+			Name:      remote,
 			Arguments: arguments,
 		},
 	})
@@ -431,6 +454,9 @@ func (r *Registry) SetServer(name string, server *MCPServer) {
 	if r.servers == nil {
 		r.servers = make(map[string]*MCPServer)
 	}
+	if !slices.Contains(r.order, name) {
+		r.order = append(r.order, name)
+	}
 	r.servers[name] = server
 }
 
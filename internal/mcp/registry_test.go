@@ -223,13 +223,13 @@ func TestRegistry_UnsupportedTransport(t *testing.T) {
 
 	cfg := config.MCPServerConfig{
 		Name:      "test-server",
-		Transport: "http", // Unsupported transport
-		Endpoint:  "http://localhost:8080",
+		Transport: "websocket", // Unsupported transport
+		Endpoint:  "ws://localhost:8080",
 	}
 
 	err := registry.LoadServer(ctx, cfg)
 	assertError(t, err)
-	if err != nil && !contains(err.Error(), "only stdio transport is currently supported") {
+	if err != nil && !contains(err.Error(), `unsupported transport "websocket"`) {
 		t.Errorf("Expected transport error, got: %v", err)
 	}
 }
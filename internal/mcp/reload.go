@@ -0,0 +1,139 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/shankarg87/agent/internal/config"
+)
+
+// defaultDrainTimeout bounds draining servers without a configured timeout
+const defaultDrainTimeout = 30 * time.Second
+
+// Reconcile brings the registry in line with cfg. It starts servers that
+// were added, restarts servers whose config changed and stops servers that
+// were removed; unchanged servers are left alone. Replaced and removed
+// servers take no new tool calls and are closed once their in-flight calls
+// finish, or after their timeout. A changed server that fails to start keeps
+// its old connection. A started Supervisor's OnStatus hears of the servers
+// added or removed.
+func (r *Registry) Reconcile(ctx context.Context, cfg *config.MCPConfig) error {
+	r.reconcileMu.Lock()
+	defer r.reconcileMu.Unlock()
+
+	r.logger.Info("Reconciling MCP servers", "server_count", len(cfg.Servers))
+
+	if err := r.SetToolNamespacing(cfg.ToolNamespacing); err != nil {
+		return err
+	}
+
+	desired := make(map[string]bool, len(cfg.Servers))
+	var retired []*MCPServer
+	var reports []ServerHealth
+	var errs []error
+
+	// Start added servers and restart changed ones
+	for _, serverCfg := range cfg.Servers {
+		desired[serverCfg.Name] = true
+
+		current, err := r.GetServer(serverCfg.Name)
+		if err == nil && reflect.DeepEqual(current.Config, serverCfg) {
+			continue
+		}
+
+		server, err := r.connect(ctx, serverCfg)
+		if err != nil {
+			r.logger.Error("Failed to start MCP server", "name", serverCfg.Name, "error", err)
+			errs = append(errs, fmt.Errorf("failed to load server %s: %w", serverCfg.Name, err))
+			continue
+		}
+
+		if previous := r.addServer(server); previous != nil {
+			r.logger.Info("MCP server restarted with new config", "name", serverCfg.Name)
+			retired = append(retired, previous)
+		} else {
+			r.logger.Info("MCP server added", "name", serverCfg.Name)
+		}
+		r.logger.LogMCPConnection(serverCfg.Name, serverCfg.Transport, serverCfg.Endpoint, true)
+		reports = append(reports, ServerHealth{
+			Name:      serverCfg.Name,
+			Transport: serverCfg.Transport,
+			Endpoint:  serverCfg.Endpoint,
+			Status:    StatusConnected,
+			ToolCount: len(server.Tools),
+		})
+	}
+
+	// Stop removed servers, and settle tool name collisions in the
+	// config's order
+	r.mu.Lock()
+	r.order = r.order[:0]
+	for _, serverCfg := range cfg.Servers {
+		r.order = append(r.order, serverCfg.Name)
+	}
+	for name, server := range r.servers {
+		if !desired[name] {
+			delete(r.servers, name)
+			delete(r.health, name)
+			retired = append(retired, server)
+			reports = append(reports, ServerHealth{
+				Name:      name,
+				Transport: server.Config.Transport,
+				Endpoint:  server.Config.Endpoint,
+				Status:    StatusDisconnected,
+			})
+			r.logger.Info("MCP server removed", "name", name)
+		}
+	}
+	r.mu.Unlock()
+	r.reportCollisions()
+
+	for _, health := range reports {
+		r.reportStatus(health)
+	}
+
+	var wg sync.WaitGroup
+	for _, server := range retired {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.drain(server)
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// drain waits for a retired server's in-flight tool calls, then closes it
+func (r *Registry) drain(server *MCPServer) {
+	done := make(chan struct{})
+	go func() {
+		server.inflight.Wait()
+		close(done)
+	}()
+
+	timeout := server.Config.Timeout
+	if timeout <= 0 {
+		timeout = defaultDrainTimeout
+	}
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		r.logger.Warn("Closing MCP server with tool calls still in flight",
+			"name", server.Name,
+			"timeout", timeout,
+		)
+	}
+
+	if server.Client != nil {
+		if err := server.Client.Close(); err != nil {
+			r.logger.Warn("Failed to close MCP server", "name", server.Name, "error", err)
+		}
+	}
+	r.logger.LogMCPConnection(server.Name, server.Config.Transport, server.Config.Endpoint, false)
+}
@@ -0,0 +1,139 @@
+package mcp
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/shankarg87/agent/internal/config"
+)
+
+// newToolServer serves an MCP server whose single tool returns its name.
+// When release is set, the tool signals started and waits for release.
+func newToolServer(t *testing.T, tool string, started, release chan struct{}) *httptest.Server {
+	t.Helper()
+
+	s := server.NewMCPServer(tool, "1.0.0")
+	s.AddTool(mcp.NewTool(tool), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if release != nil {
+			close(started)
+			<-release
+		}
+		return mcp.NewToolResultText(tool), nil
+	})
+
+	ts := httptest.NewServer(server.NewStreamableHTTPServer(s))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func httpServerConfig(name string, ts *httptest.Server) config.MCPServerConfig {
+	return config.MCPServerConfig{
+		Name:      name,
+		Transport: TransportHTTP,
+		Endpoint:  ts.URL + "/mcp",
+		Timeout:   5 * time.Second,
+	}
+}
+
+func TestRegistry_Reconcile(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	keepServer := newToolServer(t, "keep_tool", nil, nil)
+	dropServer := newToolServer(t, "drop_tool", started, release)
+	changeServer := newToolServer(t, "change_tool", nil, nil)
+	addServer := newToolServer(t, "add_tool", nil, nil)
+
+	registry := NewRegistry()
+	t.Cleanup(func() { registry.Close() })
+
+	ctx := context.Background()
+	keep := httpServerConfig("keep", keepServer)
+	change := httpServerConfig("change", changeServer)
+	assertNoError(t, registry.LoadServers(ctx, &config.MCPConfig{Servers: []config.MCPServerConfig{
+		keep, httpServerConfig("drop", dropServer), change,
+	}}))
+	kept, _ := registry.GetServer("keep")
+	changed, _ := registry.GetServer("change")
+
+	// Hold a tool call in flight on the server being removed
+	callDone := make(chan error, 1)
+	go func() {
+		result, err := registry.CallTool(ctx, "drop_tool", nil, nil)
+		if err == nil && result.Content[0].Text != "drop_tool" {
+			t.Errorf("Unexpected result %v", result.Content)
+		}
+		callDone <- err
+	}()
+	<-started
+
+	change.Headers = map[string]string{"X-Version": "2"}
+	reconciled := make(chan error, 1)
+	go func() {
+		reconciled <- registry.Reconcile(ctx, &config.MCPConfig{Servers: []config.MCPServerConfig{
+			keep, change, httpServerConfig("add", addServer),
+		}})
+	}()
+
+	// The removed server takes no new calls while the in-flight one drains
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := registry.GetTool("drop_tool"); err != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Removed server was never taken out of the registry")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case err := <-reconciled:
+		t.Fatalf("Reconcile returned before the in-flight call finished: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	assertNoError(t, <-callDone)
+	assertNoError(t, <-reconciled)
+
+	// Unchanged servers keep their connection, changed ones are restarted
+	// and new ones are started
+	current, err := registry.GetServer("keep")
+	assertNoError(t, err)
+	if current != kept {
+		t.Fatal("Expected the unchanged server to keep its connection")
+	}
+	current, err = registry.GetServer("change")
+	assertNoError(t, err)
+	if current == changed || current.Config.Headers["X-Version"] != "2" {
+		t.Fatal("Expected the changed server to be restarted with its new config")
+	}
+
+	for _, tool := range []string{"keep_tool", "change_tool", "add_tool"} {
+		result, err := registry.CallTool(ctx, tool, nil, nil)
+		assertNoError(t, err)
+		assertEqual(t, tool, result.Content[0].Text)
+	}
+	assertEqual(t, 3, len(registry.Health()))
+}
+
+func TestRegistry_ReconcileKeepsServerThatFailsToRestart(t *testing.T) {
+	ts := newToolServer(t, "keep_tool", nil, nil)
+
+	registry := NewRegistry()
+	t.Cleanup(func() { registry.Close() })
+
+	ctx := context.Background()
+	cfg := httpServerConfig("keep", ts)
+	assertNoError(t, registry.LoadServer(ctx, cfg))
+
+	cfg.Endpoint = "http://127.0.0.1:1/mcp"
+	err := registry.Reconcile(ctx, &config.MCPConfig{Servers: []config.MCPServerConfig{cfg}})
+	assertError(t, err)
+
+	result, err := registry.CallTool(ctx, "keep_tool", nil, nil)
+	assertNoError(t, err)
+	assertEqual(t, "keep_tool", result.Content[0].Text)
+}
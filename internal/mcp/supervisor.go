@@ -0,0 +1,340 @@
+package mcp
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shankarg87/agent/internal/logging"
+)
+
+// MCP server connection statuses
+const (
+	StatusConnected    = "connected"
+	StatusReconnecting = "reconnecting"
+	StatusDisconnected = "disconnected"
+)
+
+// DefaultHealthCheckInterval is how often a Supervisor pings servers
+const DefaultHealthCheckInterval = 30 * time.Second
+
+const (
+	defaultPingTimeout = 10 * time.Second
+	maxReconnectDelay  = time.Minute
+)
+
+// ServerHealth reports the connection state of an MCP server
+type ServerHealth struct {
+	Name       string     `json:"name"`
+	Transport  string     `json:"transport"`
+	Endpoint   string     `json:"endpoint"`
+	Status     string     `json:"status"`
+	ToolCount  int        `json:"tool_count"`
+	Collisions []string   `json:"collisions,omitempty"` // tool names other servers also offer
+	LastCheck  *time.Time `json:"last_check,omitempty"`
+	LastError  string     `json:"last_error,omitempty"`
+	Reconnects int        `json:"reconnects"`
+}
+
+// Health returns the connection state of every server, sorted by name
+func (r *Registry) Health() []ServerHealth {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, collisions := r.namedTools(nil)
+	byServer := make(map[string][]string)
+	for tool, servers := range collisions {
+		for _, server := range servers {
+			byServer[server] = append(byServer[server], tool)
+		}
+	}
+
+	result := make([]ServerHealth, 0, len(r.servers))
+	for name, server := range r.servers {
+		health := ServerHealth{
+			Name:      name,
+			Transport: server.Config.Transport,
+			Endpoint:  server.Config.Endpoint,
+			Status:    StatusConnected,
+		}
+		if h, ok := r.health[name]; ok {
+			health = *h
+		}
+		health.ToolCount = len(server.Tools)
+		health.Collisions = byServer[name]
+		sort.Strings(health.Collisions)
+		result = append(result, health)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// serverStatus returns a server's connection status. Servers added without
+// LoadServer are assumed connected.
+func (r *Registry) serverStatus(name string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if h, ok := r.health[name]; ok {
+		return h.Status
+	}
+	return StatusConnected
+}
+
+// replaceServer swaps in a reconnected server, unless the server was
+// replaced or removed since old was read
+func (r *Registry) replaceServer(old, replacement *MCPServer) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.servers[old.Name] != old {
+		return false
+	}
+	r.servers[old.Name] = replacement
+	return true
+}
+
+// watchStatus has Reconcile report the servers it adds or removes to hook;
+// nil stops it
+func (r *Registry) watchStatus(hook func(health ServerHealth)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statusHook = hook
+}
+
+// reportStatus passes health to the hook set by watchStatus, if any
+func (r *Registry) reportStatus(health ServerHealth) {
+	r.mu.RLock()
+	hook := r.statusHook
+	r.mu.RUnlock()
+
+	if hook != nil {
+		hook(health)
+	}
+}
+
+// updateHealth applies update to a server's health and returns the result,
+// reporting whether the status changed. Removed servers are ignored.
+func (r *Registry) updateHealth(name string, update func(h *ServerHealth)) (ServerHealth, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	server, ok := r.servers[name]
+	if !ok {
+		// Removed while it was being checked
+		return ServerHealth{}, false
+	}
+
+	h, ok := r.health[name]
+	if !ok {
+		h = &ServerHealth{
+			Name:      name,
+			Transport: server.Config.Transport,
+			Endpoint:  server.Config.Endpoint,
+			Status:    StatusConnected,
+		}
+		r.health[name] = h
+	}
+
+	previous := h.Status
+	update(h)
+	h.ToolCount = len(server.Tools)
+	return *h, h.Status != previous
+}
+
+// SupervisorConfig configures a Supervisor
+type SupervisorConfig struct {
+	// Interval between health checks, DefaultHealthCheckInterval when zero
+	Interval time.Duration
+	// OnStatus, when set, is called whenever a server's status changes,
+	// including servers a config reload adds (connected) or removes
+	// (disconnected)
+	OnStatus func(health ServerHealth)
+}
+
+// Supervisor pings a registry's servers and reconnects the ones that stop
+// responding, restarting stdio processes and re-listing tools. Reconnects
+// make up to the server's RetryMax attempts, doubling RetryDelay between
+// them; a server still down stays disconnected until the next check.
+type Supervisor struct {
+	registry *Registry
+	cfg      SupervisorConfig
+	logger   *logging.SimpleLogger
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewSupervisor creates a supervisor for the registry's servers
+func NewSupervisor(registry *Registry, cfg SupervisorConfig) *Supervisor {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultHealthCheckInterval
+	}
+	return &Supervisor{
+		registry: registry,
+		cfg:      cfg,
+		logger:   logging.VerboseLogger("mcp"),
+	}
+}
+
+// Start begins checking servers in the background until Stop is called
+func (s *Supervisor) Start(ctx context.Context) {
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.done = make(chan struct{})
+
+	// Report the initial status of every server, then those of servers
+	// added or removed by Reconcile
+	if s.cfg.OnStatus != nil {
+		s.registry.watchStatus(s.cfg.OnStatus)
+		for _, health := range s.registry.Health() {
+			s.cfg.OnStatus(health)
+		}
+	}
+
+	go func() {
+		defer close(s.done)
+
+		ticker := time.NewTicker(s.cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.checkAll(ctx)
+			}
+		}
+	}()
+}
+
+// Stop stops checking servers and waits for any reconnects in progress
+func (s *Supervisor) Stop() {
+	if s.cancel == nil {
+		return
+	}
+	s.registry.watchStatus(nil)
+	s.cancel()
+	<-s.done
+}
+
+// checkAll checks every server concurrently, so one slow server doesn't
+// delay the others
+func (s *Supervisor) checkAll(ctx context.Context) {
+	s.registry.mu.RLock()
+	names := make([]string, 0, len(s.registry.servers))
+	for name := range s.registry.servers {
+		names = append(names, name)
+	}
+	s.registry.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.check(ctx, name)
+		}()
+	}
+	wg.Wait()
+}
+
+// check pings a server and reconnects it if the ping fails
+func (s *Supervisor) check(ctx context.Context, name string) {
+	server, err := s.registry.GetServer(name)
+	if err != nil || server.Client == nil {
+		return
+	}
+
+	if s.registry.serverStatus(name) == StatusConnected {
+		timeout := server.Config.Timeout
+		if timeout <= 0 {
+			timeout = defaultPingTimeout
+		}
+		pingCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := server.Client.Ping(pingCtx)
+		cancel()
+
+		now := time.Now()
+		if err == nil {
+			s.registry.updateHealth(name, func(h *ServerHealth) {
+				h.LastCheck = &now
+				h.LastError = ""
+			})
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		s.logger.Warn("MCP server failed health check", "name", name, "error", err)
+		s.setStatus(name, StatusReconnecting, err)
+	}
+
+	s.reconnect(ctx, server)
+}
+
+// reconnect replaces a server's client, retrying with backoff. The old
+// client is closed once the replacement is connected and swapped in, after
+// the calls still in flight on it finish.
+func (s *Supervisor) reconnect(ctx context.Context, server *MCPServer) {
+	cfg := server.Config
+
+	attempts := max(cfg.RetryMax, 1)
+	delay := cfg.RetryDelay
+	for attempt := 1; ; attempt++ {
+		s.logger.Info("Reconnecting MCP server", "name", cfg.Name, "attempt", attempt, "max_attempts", attempts)
+
+		replacement, err := s.registry.connect(ctx, cfg)
+		if err == nil {
+			if !s.registry.replaceServer(server, replacement) {
+				// Reconcile replaced or removed the server meanwhile
+				replacement.Client.Close()
+				return
+			}
+
+			s.registry.logger.LogMCPConnection(cfg.Name, cfg.Transport, cfg.Endpoint, true)
+			s.setStatus(cfg.Name, StatusConnected, nil)
+			s.registry.drain(server)
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		if attempt >= attempts {
+			s.logger.Error("MCP server is unavailable", "name", cfg.Name, "attempts", attempt, "error", err)
+			s.setStatus(cfg.Name, StatusDisconnected, err)
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxReconnectDelay)
+	}
+}
+
+// setStatus records a server's status and reports changes
+func (s *Supervisor) setStatus(name, status string, err error) {
+	now := time.Now()
+	health, changed := s.registry.updateHealth(name, func(h *ServerHealth) {
+		if h.Status != StatusConnected && status == StatusConnected {
+			h.Reconnects++
+		}
+		h.Status = status
+		h.LastCheck = &now
+		h.LastError = ""
+		if err != nil {
+			h.LastError = err.Error()
+		}
+	})
+
+	if changed && s.cfg.OnStatus != nil {
+		s.cfg.OnStatus(health)
+	}
+}
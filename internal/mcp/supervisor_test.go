@@ -0,0 +1,193 @@
+package mcp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/shankarg87/agent/internal/config"
+)
+
+// flakyHandler fails every request while down, as a crashed server would
+type flakyHandler struct {
+	http.Handler
+	down atomic.Bool
+}
+
+func (h *flakyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.down.Load() {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	h.Handler.ServeHTTP(w, r)
+}
+
+func TestSupervisor_ReconnectsFailedServer(t *testing.T) {
+	handler := &flakyHandler{Handler: server.NewStreamableHTTPServer(newEchoMCPServer())}
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+
+	registry := NewRegistry()
+	t.Cleanup(func() { registry.Close() })
+
+	ctx := context.Background()
+	assertNoError(t, registry.LoadServer(ctx, config.MCPServerConfig{
+		Name:       "remote",
+		Transport:  TransportHTTP,
+		Endpoint:   ts.URL + "/mcp",
+		Timeout:    time.Second,
+		RetryMax:   2,
+		RetryDelay: time.Millisecond,
+	}))
+
+	var mu sync.Mutex
+	var statuses []string
+	supervisor := NewSupervisor(registry, SupervisorConfig{
+		OnStatus: func(health ServerHealth) {
+			mu.Lock()
+			defer mu.Unlock()
+			statuses = append(statuses, health.Status)
+		},
+	})
+
+	// A healthy server stays connected
+	supervisor.checkAll(ctx)
+	assertEqual(t, StatusConnected, registry.Health()[0].Status)
+
+	// A server that stops responding is disconnected once retries run out,
+	// and its tools can't be called
+	handler.down.Store(true)
+	supervisor.checkAll(ctx)
+
+	health := registry.Health()[0]
+	assertEqual(t, StatusDisconnected, health.Status)
+	if health.LastError == "" {
+		t.Fatal("Expected the failure to be reported")
+	}
+	_, err := registry.CallTool(ctx, "echo", map[string]any{"message": "hello"}, nil)
+	assertError(t, err)
+	if !contains(err.Error(), "server remote is disconnected") {
+		t.Fatalf("Expected a disconnected error, got %v", err)
+	}
+
+	// Once it's back, the next check reconnects and re-lists its tools
+	handler.down.Store(false)
+	supervisor.checkAll(ctx)
+
+	health = registry.Health()[0]
+	assertEqual(t, StatusConnected, health.Status)
+	assertEqual(t, 1, health.Reconnects)
+	assertEqual(t, 1, health.ToolCount)
+
+	result, err := registry.CallTool(ctx, "echo", map[string]any{"message": "hello"}, nil)
+	assertNoError(t, err)
+	assertEqual(t, "hello", result.Content[0].Text)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assertEqual(t, "reconnecting,disconnected,connected", strings.Join(statuses, ","))
+}
+
+func TestSupervisor_StartStop(t *testing.T) {
+	registry := NewRegistry()
+	registry.SetServer("mock", &MCPServer{Name: "mock", Tools: map[string]*Tool{}})
+
+	var reported []ServerHealth
+	supervisor := NewSupervisor(registry, SupervisorConfig{
+		Interval: time.Millisecond,
+		OnStatus: func(health ServerHealth) { reported = append(reported, health) },
+	})
+	supervisor.Start(context.Background())
+	time.Sleep(10 * time.Millisecond)
+	supervisor.Stop()
+
+	// Start reports each server's initial status; servers without a client
+	// aren't checked
+	assertEqual(t, 1, len(reported))
+	assertEqual(t, StatusConnected, reported[0].Status)
+}
+
+func TestSupervisor_ReportsServersAddedByReconcile(t *testing.T) {
+	first := newToolServer(t, "first_tool", nil, nil)
+	second := newToolServer(t, "second_tool", nil, nil)
+
+	registry := NewRegistry()
+	t.Cleanup(func() { registry.Close() })
+
+	ctx := context.Background()
+	assertNoError(t, registry.Reconcile(ctx, &config.MCPConfig{
+		Servers: []config.MCPServerConfig{httpServerConfig("first", first)},
+	}))
+
+	var mu sync.Mutex
+	var reported []string
+	supervisor := NewSupervisor(registry, SupervisorConfig{
+		Interval: time.Hour,
+		OnStatus: func(health ServerHealth) {
+			mu.Lock()
+			defer mu.Unlock()
+			reported = append(reported, health.Name+"="+health.Status)
+		},
+	})
+	supervisor.Start(ctx)
+	defer supervisor.Stop()
+
+	assertNoError(t, registry.Reconcile(ctx, &config.MCPConfig{
+		Servers: []config.MCPServerConfig{httpServerConfig("second", second)},
+	}))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assertEqual(t, "first=connected,second=connected,first=disconnected", strings.Join(reported, ","))
+}
+
+func TestSupervisor_ReconnectSwapsBeforeClosing(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	ts := newToolServer(t, "slow_tool", started, release)
+
+	registry := NewRegistry()
+	t.Cleanup(func() { registry.Close() })
+
+	ctx := context.Background()
+	assertNoError(t, registry.LoadServer(ctx, httpServerConfig("remote", ts)))
+	old, err := registry.GetServer("remote")
+	assertNoError(t, err)
+
+	callErr := make(chan error, 1)
+	go func() {
+		_, err := registry.CallTool(ctx, "slow_tool", nil, nil)
+		callErr <- err
+	}()
+	<-started
+
+	supervisor := NewSupervisor(registry, SupervisorConfig{})
+	reconnected := make(chan struct{})
+	go func() {
+		supervisor.reconnect(ctx, old)
+		close(reconnected)
+	}()
+
+	// The replacement takes over while the old client finishes its call
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		current, err := registry.GetServer("remote")
+		assertNoError(t, err)
+		if current != old {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the replacement client")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	close(release)
+	assertNoError(t, <-callErr)
+	<-reconnected
+}
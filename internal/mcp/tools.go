@@ -0,0 +1,107 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// refreshTimeout bounds re-listing a server's tools after it reports a change
+const refreshTimeout = 30 * time.Second
+
+// listTools lists every tool a server offers, following nextCursor through
+// each page
+func (r *Registry) listTools(ctx context.Context, serverName string, mcpClient *client.Client) (map[string]*Tool, error) {
+	r.logger.Verbose("Listing available tools", "name", serverName)
+
+	tools := make(map[string]*Tool)
+	seen := make(map[mcp.Cursor]bool)
+	var cursor mcp.Cursor
+	for page := 1; ; page++ {
+		req := mcp.ListToolsRequest{}
+		req.Params.Cursor = cursor
+
+		resp, err := mcpClient.ListToolsByPage(ctx, req)
+		if err != nil {
+			r.logger.Error("Failed to list tools",
+				"name", serverName,
+				"page", page,
+				"error", err,
+			)
+			return nil, fmt.Errorf("failed to list tools: %w", err)
+		}
+
+		for _, t := range resp.Tools {
+			// Convert InputSchema to map[string]any
+			schemaBytes, _ := json.Marshal(t.InputSchema)
+			var schemaMap map[string]any
+			json.Unmarshal(schemaBytes, &schemaMap)
+
+			tools[t.Name] = &Tool{
+				Name:        t.Name,
+				Description: t.Description,
+				InputSchema: schemaMap,
+				ServerName:  serverName,
+			}
+
+			r.logger.Verbose("Tool registered",
+				"server_name", serverName,
+				"tool_name", t.Name,
+				"description", t.Description,
+			)
+		}
+
+		if resp.NextCursor == "" {
+			break
+		}
+		// A server handing back a cursor it already gave would page forever
+		if seen[resp.NextCursor] {
+			return nil, fmt.Errorf("failed to list tools: server repeated cursor %q", resp.NextCursor)
+		}
+		seen[resp.NextCursor] = true
+		cursor = resp.NextCursor
+	}
+
+	r.logger.Verbose("Tools listed successfully",
+		"name", serverName,
+		"tool_count", len(tools),
+	)
+	return tools, nil
+}
+
+// refreshTools re-lists a server's tools after it sends
+// notifications/tools/list_changed. Runs pick up the new tool set the next
+// time they build their tool list.
+func (r *Registry) refreshTools(serverName string, mcpClient *client.Client) {
+	// Refreshes run one at a time, so a slow listing can't overwrite a
+	// newer one
+	r.refreshMu.Lock()
+	defer r.refreshMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+	defer cancel()
+
+	tools, err := r.listTools(ctx, serverName, mcpClient)
+	if err != nil {
+		r.logger.Warn("Failed to refresh tools after list change", "name", serverName, "error", err)
+		return
+	}
+
+	r.mu.Lock()
+
+	// The server may have been reconnected, restarted or removed meanwhile
+	server, ok := r.servers[serverName]
+	if !ok || server.Client != mcpClient {
+		r.mu.Unlock()
+		return
+	}
+	server.Tools = tools
+	r.mu.Unlock()
+
+	r.logger.Info("MCP server tools refreshed", "name", serverName, "tool_count", len(tools))
+	r.reportCollisions()
+}
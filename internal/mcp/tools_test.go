@@ -0,0 +1,90 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/shankarg87/agent/internal/config"
+)
+
+func textTool(name string) (mcp.Tool, server.ToolHandlerFunc) {
+	return mcp.NewTool(name), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText(name), nil
+	}
+}
+
+// loadToolServer serves s over Streamable HTTP and loads it into a new registry
+func loadToolServer(t *testing.T, s *server.MCPServer) *Registry {
+	t.Helper()
+
+	ts := httptest.NewServer(server.NewStreamableHTTPServer(s))
+	t.Cleanup(ts.Close)
+
+	registry := NewRegistry()
+	t.Cleanup(func() { registry.Close() })
+
+	assertNoError(t, registry.LoadServer(context.Background(), config.MCPServerConfig{
+		Name:      "dynamic",
+		Transport: TransportHTTP,
+		Endpoint:  ts.URL + "/mcp",
+	}))
+	return registry
+}
+
+// waitForTool waits until the tool's presence in the registry matches want
+func waitForTool(t *testing.T, registry *Registry, name string, want bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, err := registry.GetTool(name)
+		if (err == nil) == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for tool %s present=%v", name, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLoadServer_PaginatedTools(t *testing.T) {
+	s := server.NewMCPServer("paged", "1.0.0", server.WithPaginationLimit(2))
+	for i := range 5 {
+		s.AddTool(textTool(fmt.Sprintf("tool_%d", i)))
+	}
+
+	registry := loadToolServer(t, s)
+
+	assertEqual(t, 5, len(registry.ListTools()))
+	for i := range 5 {
+		_, err := registry.GetTool(fmt.Sprintf("tool_%d", i))
+		assertNoError(t, err)
+	}
+}
+
+func TestRegistry_RefreshesToolsOnListChanged(t *testing.T) {
+	s := server.NewMCPServer("dynamic", "1.0.0", server.WithToolCapabilities(true))
+	s.AddTool(textTool("public_tool"))
+
+	registry := loadToolServer(t, s)
+	waitForTool(t, registry, "public_tool", true)
+
+	// Tools added after loading show up once the server announces them
+	s.AddTool(textTool("account_tool"))
+	waitForTool(t, registry, "account_tool", true)
+
+	result, err := registry.CallTool(context.Background(), "account_tool", nil, nil)
+	assertNoError(t, err)
+	assertEqual(t, "account_tool", result.Content[0].Text)
+
+	// And removed ones disappear
+	s.DeleteTools("account_tool")
+	waitForTool(t, registry, "account_tool", false)
+	assertEqual(t, 1, len(registry.ListTools()))
+}
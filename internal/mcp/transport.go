@@ -0,0 +1,132 @@
+package mcp
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/shankarg87/agent/internal/config"
+)
+
+// Supported MCP transports
+const (
+	TransportStdio = "stdio"
+	TransportHTTP  = "http" // Streamable HTTP
+	TransportSSE   = "sse"  // legacy HTTP+SSE
+)
+
+// newClient creates a started client for the server's transport
+func newClient(ctx context.Context, cfg config.MCPServerConfig) (*client.Client, error) {
+	switch cfg.Transport {
+	case TransportStdio:
+		// Convert env map to slice
+		var envSlice []string
+		for k, v := range cfg.Env {
+			envSlice = append(envSlice, fmt.Sprintf("%s=%s", k, v))
+		}
+
+		// Stdio clients start automatically
+		return client.NewStdioMCPClient(cfg.Endpoint, envSlice, cfg.Args...)
+
+	case TransportHTTP, TransportSSE:
+		httpClient, err := newHTTPClient(cfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+		headers, err := requestHeaders(cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		var mcpClient *client.Client
+		if cfg.Transport == TransportHTTP {
+			mcpClient, err = client.NewStreamableHttpClient(cfg.Endpoint,
+				transport.WithHTTPBasicClient(httpClient),
+				transport.WithHTTPHeaders(headers),
+				// Keep a stream open for notifications such as tools/list_changed
+				transport.WithContinuousListening(),
+			)
+		} else {
+			mcpClient, err = client.NewSSEMCPClient(cfg.Endpoint,
+				transport.WithHTTPClient(httpClient),
+				transport.WithHeaders(headers),
+			)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// The SSE stream lives as long as the context it starts with, so it
+		// must outlive ctx, which only bounds loading the server
+		if err := mcpClient.Start(context.WithoutCancel(ctx)); err != nil {
+			mcpClient.Close()
+			return nil, fmt.Errorf("failed to connect: %w", err)
+		}
+		return mcpClient, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported transport %q (expected %s, %s or %s)",
+			cfg.Transport, TransportStdio, TransportHTTP, TransportSSE)
+	}
+}
+
+// requestHeaders returns the configured headers, plus the bearer token when
+// one is read from the environment
+func requestHeaders(cfg config.MCPServerConfig) (map[string]string, error) {
+	headers := maps.Clone(cfg.Headers)
+	if cfg.BearerTokenEnv == "" {
+		return headers, nil
+	}
+
+	token := os.Getenv(cfg.BearerTokenEnv)
+	if token == "" {
+		return nil, fmt.Errorf("bearer token environment variable %s is not set", cfg.BearerTokenEnv)
+	}
+	if headers == nil {
+		headers = make(map[string]string)
+	}
+	headers["Authorization"] = "Bearer " + token
+	return headers, nil
+}
+
+// newHTTPClient returns an HTTP client using the server's TLS options
+func newHTTPClient(cfg *config.MCPTLSConfig) (*http.Client, error) {
+	if cfg == nil {
+		return &http.Client{}, nil
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	httpTransport := http.DefaultTransport.(*http.Transport).Clone()
+	httpTransport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: httpTransport}, nil
+}
@@ -0,0 +1,141 @@
+package mcp
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/shankarg87/agent/internal/config"
+)
+
+// newEchoMCPServer returns an in-process MCP server with a single echo tool
+func newEchoMCPServer() *server.MCPServer {
+	s := server.NewMCPServer("echo", "1.0.0")
+	s.AddTool(mcp.NewTool("echo",
+		mcp.WithDescription("Echoes the message"),
+		mcp.WithString("message", mcp.Required()),
+	), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText(req.GetString("message", "")), nil
+	})
+	return s
+}
+
+// headerRecorder wraps a handler and keeps the headers of every request
+type headerRecorder struct {
+	http.Handler
+	mu      sync.Mutex
+	headers []http.Header
+}
+
+func (h *headerRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	h.headers = append(h.headers, r.Header.Clone())
+	h.mu.Unlock()
+	h.Handler.ServeHTTP(w, r)
+}
+
+// allHave reports whether every recorded request carried the header value
+func (h *headerRecorder) allHave(name, value string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, header := range h.headers {
+		if header.Get(name) != value {
+			return false
+		}
+	}
+	return len(h.headers) > 0
+}
+
+// callEcho loads a server into a new registry and calls its echo tool
+func callEcho(t *testing.T, cfg config.MCPServerConfig) {
+	t.Helper()
+
+	registry := NewRegistry()
+	t.Cleanup(func() { registry.Close() })
+
+	ctx := context.Background()
+	assertNoError(t, registry.LoadServer(ctx, cfg))
+
+	result, err := registry.CallTool(ctx, "echo", map[string]any{"message": "hello"}, nil)
+	assertNoError(t, err)
+	assertEqual(t, "hello", result.Content[0].Text)
+}
+
+func TestLoadServer_StreamableHTTP(t *testing.T) {
+	t.Setenv("ECHO_TOKEN", "secret")
+
+	recorder := &headerRecorder{Handler: server.NewStreamableHTTPServer(newEchoMCPServer())}
+	ts := httptest.NewTLSServer(recorder)
+	t.Cleanup(ts.Close) // after the registry's cleanup closes its streams
+
+	// Trust the test server's certificate through a CA file
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	assertNoError(t, os.WriteFile(caFile, caPEM, 0o600))
+
+	callEcho(t, config.MCPServerConfig{
+		Name:           "remote",
+		Transport:      TransportHTTP,
+		Endpoint:       ts.URL + "/mcp",
+		Headers:        map[string]string{"X-Team": "tools"},
+		BearerTokenEnv: "ECHO_TOKEN",
+		TLS:            &config.MCPTLSConfig{CAFile: caFile},
+	})
+
+	if !recorder.allHave("Authorization", "Bearer secret") || !recorder.allHave("X-Team", "tools") {
+		t.Fatalf("Expected every request to carry the configured headers, got %v", recorder.headers)
+	}
+}
+
+func TestLoadServer_SSE(t *testing.T) {
+	recorder := &headerRecorder{}
+	ts := httptest.NewUnstartedServer(recorder)
+	ts.Start()
+	t.Cleanup(ts.Close) // after the registry's cleanup closes its streams
+	recorder.Handler = server.NewSSEServer(newEchoMCPServer(), server.WithBaseURL(ts.URL))
+
+	callEcho(t, config.MCPServerConfig{
+		Name:      "remote",
+		Transport: TransportSSE,
+		Endpoint:  ts.URL + "/sse",
+		Headers:   map[string]string{"X-Team": "tools"},
+	})
+
+	if !recorder.allHave("X-Team", "tools") {
+		t.Fatalf("Expected every request to carry the configured headers, got %v", recorder.headers)
+	}
+}
+
+func TestLoadServer_RemoteErrors(t *testing.T) {
+	ts := httptest.NewTLSServer(server.NewStreamableHTTPServer(newEchoMCPServer()))
+	defer ts.Close()
+
+	registry := NewRegistry()
+	ctx := context.Background()
+
+	// The token's variable must be set
+	err := registry.LoadServer(ctx, config.MCPServerConfig{
+		Name:           "remote",
+		Transport:      TransportHTTP,
+		Endpoint:       ts.URL + "/mcp",
+		BearerTokenEnv: "MISSING_ECHO_TOKEN",
+	})
+	assertError(t, err)
+
+	// The server's certificate isn't trusted without a CA file
+	err = registry.LoadServer(ctx, config.MCPServerConfig{
+		Name:      "remote",
+		Transport: TransportHTTP,
+		Endpoint:  ts.URL + "/mcp",
+	})
+	assertError(t, err)
+	assertEqual(t, 0, len(registry.servers))
+}
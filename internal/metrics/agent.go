@@ -171,18 +171,24 @@ func (m *AgentMetrics) RunStateTransition(ctx context.Context, fromState, toStat
 	})
 }
 
-// MCPConnectionStatus records MCP server connection status
+// mcpStatuses are the statuses reported by MCPConnectionStatus
+var mcpStatuses = []string{"connected", "reconnecting", "disconnected"}
+
+// MCPConnectionStatus records MCP server connection status, setting the
+// gauge to 1 for the current status and 0 for the others
 func (m *AgentMetrics) MCPConnectionStatus(ctx context.Context, serverName, transport, status string) {
-	value := float64(0)
-	if status == "connected" {
-		value = 1
-	}
+	for _, s := range mcpStatuses {
+		value := float64(0)
+		if s == status {
+			value = 1
+		}
 
-	m.provider.SetGauge(ctx, "agent_mcp_connections", value, map[string]string{
-		"server_name": serverName,
-		"transport":   transport,
-		"status":      status,
-	})
+		m.provider.SetGauge(ctx, MCPConnectionsMetric.Name, value, map[string]string{
+			"server_name": serverName,
+			"transport":   transport,
+			"status":      s,
+		})
+	}
 }
 
 // EventBusEvent records events published to the event bus
@@ -193,6 +199,16 @@ func (m *AgentMetrics) EventBusEvent(ctx context.Context, eventType, runID strin
 	})
 }
 
+// EventDropped records an event a subscriber missed because its buffer was
+// full, labeled by the subscriber's overflow policy, or that the event
+// broker's queue had no room for, labeled broker_queue
+func (m *AgentMetrics) EventDropped(ctx context.Context, eventType, policy string) {
+	m.provider.IncrementCounter(ctx, EventsDroppedMetric.Name, 1, map[string]string{
+		"event_type": eventType,
+		"policy":     policy,
+	})
+}
+
 // StorageOperation records storage operations (reads, writes, etc.)
 func (m *AgentMetrics) StorageOperation(ctx context.Context, operation, status string, duration time.Duration) {
 	labels := map[string]string{
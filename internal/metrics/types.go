@@ -163,6 +163,21 @@ var (
 		Type:        MetricTypeHistogram,
 		Buckets:     []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 2.5, 5, 10},
 	}
+
+	// Event bus metrics
+	MCPConnectionsMetric = MetricDefinition{
+		Name:        "agent_mcp_connections",
+		Description: "MCP server connection status, 1 for the server's current status",
+		Unit:        "1",
+		Type:        MetricTypeGauge,
+	}
+
+	EventsDroppedMetric = MetricDefinition{
+		Name:        "agent_events_dropped_total",
+		Description: "Events not delivered to a slow stream subscriber",
+		Unit:        "1",
+		Type:        MetricTypeCounter,
+	}
 )
 
 // AllMetrics returns all predefined metrics for registration
@@ -179,5 +194,7 @@ func AllMetrics() []MetricDefinition {
 		LLMTokensUsedMetric,
 		HTTPRequestsMetric,
 		HTTPDurationMetric,
+		MCPConnectionsMetric,
+		EventsDroppedMetric,
 	}
 }
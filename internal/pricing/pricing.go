@@ -0,0 +1,203 @@
+package pricing
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/shankarg87/agent/internal/config"
+)
+
+// Rate holds token prices in USD per million tokens
+type Rate struct {
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
+	CacheRead  float64 `json:"cache_read,omitempty"`
+	CacheWrite float64 `json:"cache_write,omitempty"`
+}
+
+// Usage is the token usage of a single LLM call. PromptTokens includes any
+// cache read and cache write tokens.
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+	CacheReadTokens  int
+	CacheWriteTokens int
+}
+
+// Breakdown itemizes the cost of an LLM call in USD
+type Breakdown struct {
+	Prompt     float64 `json:"prompt_usd"`
+	Completion float64 `json:"completion_usd"`
+	CacheRead  float64 `json:"cache_read_usd,omitempty"`
+	CacheWrite float64 `json:"cache_write_usd,omitempty"`
+}
+
+// Total returns the total cost in USD
+func (b Breakdown) Total() float64 {
+	return b.Prompt + b.Completion + b.CacheRead + b.CacheWrite
+}
+
+// wildcardModel prices every model of a provider that has no closer match
+const wildcardModel = "*"
+
+// DefaultRate is charged for models with no pricing entry, so that budgets
+// still apply to unknown models
+var DefaultRate = Rate{Prompt: 10, Completion: 10}
+
+// defaultRates are list prices keyed by provider, then model name prefix.
+// Lookup takes the longest matching prefix, so a model priced differently
+// from an older one its name starts with (claude-opus-4-5 against
+// claude-opus-4, o1-mini against o1) needs its own entry.
+var defaultRates = map[string]map[string]Rate{
+	"anthropic": {
+		"claude-3-haiku":    {Prompt: 0.25, Completion: 1.25, CacheRead: 0.03, CacheWrite: 0.30},
+		"claude-3-5-haiku":  {Prompt: 0.80, Completion: 4, CacheRead: 0.08, CacheWrite: 1},
+		"claude-haiku-4-5":  {Prompt: 1, Completion: 5, CacheRead: 0.10, CacheWrite: 1.25},
+		"claude-3-5-sonnet": {Prompt: 3, Completion: 15, CacheRead: 0.30, CacheWrite: 3.75},
+		"claude-3-7-sonnet": {Prompt: 3, Completion: 15, CacheRead: 0.30, CacheWrite: 3.75},
+		"claude-sonnet-4":   {Prompt: 3, Completion: 15, CacheRead: 0.30, CacheWrite: 3.75},
+		"claude-3-opus":     {Prompt: 15, Completion: 75, CacheRead: 1.50, CacheWrite: 18.75},
+		"claude-opus-4":     {Prompt: 15, Completion: 75, CacheRead: 1.50, CacheWrite: 18.75},
+		"claude-opus-4-5":   {Prompt: 5, Completion: 25, CacheRead: 0.50, CacheWrite: 6.25},
+	},
+	"openai": {
+		"gpt-3.5-turbo": {Prompt: 0.50, Completion: 1.50},
+		"gpt-4":         {Prompt: 30, Completion: 60},
+		"gpt-4-turbo":   {Prompt: 10, Completion: 30},
+		"gpt-4o":        {Prompt: 2.50, Completion: 10, CacheRead: 1.25},
+		"gpt-4o-mini":   {Prompt: 0.15, Completion: 0.60, CacheRead: 0.075},
+		"gpt-4.1":       {Prompt: 2, Completion: 8, CacheRead: 0.50},
+		"gpt-4.1-mini":  {Prompt: 0.40, Completion: 1.60, CacheRead: 0.10},
+		"gpt-4.1-nano":  {Prompt: 0.10, Completion: 0.40, CacheRead: 0.025},
+		"o1":            {Prompt: 15, Completion: 60, CacheRead: 7.50},
+		"o1-mini":       {Prompt: 1.10, Completion: 4.40, CacheRead: 0.55},
+		"o1-pro":        {Prompt: 150, Completion: 600},
+		"o3-mini":       {Prompt: 1.10, Completion: 4.40, CacheRead: 0.55},
+	},
+	"gemini": {
+		"gemini-1.5-flash": {Prompt: 0.075, Completion: 0.30},
+		"gemini-1.5-pro":   {Prompt: 1.25, Completion: 5},
+		"gemini-2.0-flash": {Prompt: 0.10, Completion: 0.40, CacheRead: 0.025},
+		"gemini-2.5-flash": {Prompt: 0.30, Completion: 2.50, CacheRead: 0.075},
+		"gemini-2.5-pro":   {Prompt: 1.25, Completion: 10, CacheRead: 0.31},
+	},
+	"ollama": {
+		// Local models have no per-token cost
+		wildcardModel: {},
+	},
+}
+
+// Table looks up token prices by provider and model
+type Table struct {
+	mu    sync.RWMutex
+	rates map[string]map[string]Rate // provider -> model prefix -> rate
+}
+
+// NewTable creates a price table from the built-in list prices with the given
+// overrides applied on top
+func NewTable(overrides []config.ModelPricing) *Table {
+	t := &Table{
+		rates: make(map[string]map[string]Rate),
+	}
+
+	for prov, models := range defaultRates {
+		for model, rate := range models {
+			t.Set(prov, model, rate)
+		}
+	}
+
+	for _, o := range overrides {
+		t.Set(o.Provider, o.Model, Rate{
+			Prompt:     o.PromptPerMTok,
+			Completion: o.CompletionPerMTok,
+			CacheRead:  o.CacheReadPerMTok,
+			CacheWrite: o.CacheWritePerMTok,
+		})
+	}
+
+	return t
+}
+
+// Set adds or replaces the rate for a provider/model
+func (t *Table) Set(prov, model string, rate Rate) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.rates[prov] == nil {
+		t.rates[prov] = make(map[string]Rate)
+	}
+	if model == "" {
+		model = wildcardModel
+	}
+	t.rates[prov][model] = rate
+}
+
+// Lookup returns the rate for a provider/model. Model names are matched
+// exactly first, then by longest prefix (so dated versions such as
+// "gpt-4o-mini-2024-07-18" resolve to "gpt-4o-mini"), then by the provider
+// wildcard. The second return value is false if no entry matched.
+func (t *Table) Lookup(prov, model string) (Rate, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	models, ok := t.rates[prov]
+	if !ok {
+		return Rate{}, false
+	}
+
+	if rate, ok := models[model]; ok {
+		return rate, true
+	}
+
+	best := ""
+	for prefix := range models {
+		if prefix != wildcardModel && strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best != "" {
+		return models[best], true
+	}
+
+	rate, ok := models[wildcardModel]
+	return rate, ok
+}
+
+// Cost prices a single LLM call. Models without a pricing entry are charged
+// at DefaultRate.
+func (t *Table) Cost(prov, model string, usage Usage) Breakdown {
+	rate, ok := t.Lookup(prov, model)
+	if !ok {
+		rate = DefaultRate
+	}
+	return rate.Cost(usage)
+}
+
+// Cost prices a single LLM call at this rate. Cache tokens are charged at
+// the prompt rate when the rate has no cache pricing.
+func (r Rate) Cost(usage Usage) Breakdown {
+	cacheRead := r.CacheRead
+	if cacheRead == 0 {
+		cacheRead = r.Prompt
+	}
+	cacheWrite := r.CacheWrite
+	if cacheWrite == 0 {
+		cacheWrite = r.Prompt
+	}
+
+	uncached := usage.PromptTokens - usage.CacheReadTokens - usage.CacheWriteTokens
+	if uncached < 0 {
+		uncached = 0
+	}
+
+	return Breakdown{
+		Prompt:     perToken(uncached, r.Prompt),
+		Completion: perToken(usage.CompletionTokens, r.Completion),
+		CacheRead:  perToken(usage.CacheReadTokens, cacheRead),
+		CacheWrite: perToken(usage.CacheWriteTokens, cacheWrite),
+	}
+}
+
+func perToken(tokens int, perMillion float64) float64 {
+	return float64(tokens) * perMillion / 1_000_000
+}
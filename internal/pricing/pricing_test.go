@@ -0,0 +1,137 @@
+package pricing
+
+import (
+	"math"
+	"testing"
+
+	"github.com/shankarg87/agent/internal/config"
+)
+
+func TestTable_LookupExactAndPrefix(t *testing.T) {
+	table := NewTable(nil)
+
+	rate, ok := table.Lookup("openai", "gpt-4o")
+	assertEqual(t, true, ok)
+	assertEqual(t, 2.50, rate.Prompt)
+
+	// Dated model versions resolve to the longest matching prefix
+	rate, ok = table.Lookup("openai", "gpt-4o-mini-2024-07-18")
+	assertEqual(t, true, ok)
+	assertEqual(t, 0.15, rate.Prompt)
+
+	rate, ok = table.Lookup("anthropic", "claude-sonnet-4-5-20250929")
+	assertEqual(t, true, ok)
+	assertEqual(t, 15.0, rate.Completion)
+	assertEqual(t, 3.75, rate.CacheWrite)
+}
+
+func TestTable_LookupPrefixesOfOtherModels(t *testing.T) {
+	table := NewTable(nil)
+
+	// Each model's name starts with another, differently priced model's
+	tests := []struct {
+		provider   string
+		model      string
+		prompt     float64
+		completion float64
+	}{
+		{"anthropic", "claude-opus-4-20250514", 15, 75},
+		{"anthropic", "claude-opus-4-1-20250805", 15, 75},
+		{"anthropic", "claude-opus-4-5", 5, 25},
+		{"anthropic", "claude-opus-4-5-20251101", 5, 25},
+		{"openai", "o1", 15, 60},
+		{"openai", "o1-2024-12-17", 15, 60},
+		{"openai", "o1-mini", 1.10, 4.40},
+		{"openai", "o1-mini-2024-09-12", 1.10, 4.40},
+		{"openai", "o1-pro", 150, 600},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			rate, ok := table.Lookup(tt.provider, tt.model)
+			assertEqual(t, true, ok)
+			assertEqual(t, tt.prompt, rate.Prompt)
+			assertEqual(t, tt.completion, rate.Completion)
+		})
+	}
+}
+
+func TestTable_LookupWildcardAndUnknown(t *testing.T) {
+	table := NewTable(nil)
+
+	rate, ok := table.Lookup("ollama", "llama3.1:8b")
+	assertEqual(t, true, ok)
+	assertEqual(t, Rate{}, rate)
+
+	_, ok = table.Lookup("openai", "unknown-model")
+	assertEqual(t, false, ok)
+
+	_, ok = table.Lookup("unknown-provider", "gpt-4o")
+	assertEqual(t, false, ok)
+}
+
+func TestTable_Overrides(t *testing.T) {
+	table := NewTable([]config.ModelPricing{
+		{Provider: "openai", Model: "gpt-4o", PromptPerMTok: 1, CompletionPerMTok: 2},
+		{Provider: "custom", Model: "*", PromptPerMTok: 5, CompletionPerMTok: 5},
+	})
+
+	rate, _ := table.Lookup("openai", "gpt-4o")
+	assertEqual(t, 1.0, rate.Prompt)
+	assertEqual(t, 2.0, rate.Completion)
+
+	rate, ok := table.Lookup("custom", "anything")
+	assertEqual(t, true, ok)
+	assertEqual(t, 5.0, rate.Prompt)
+
+	// Untouched defaults remain
+	rate, _ = table.Lookup("openai", "gpt-4o-mini")
+	assertEqual(t, 0.15, rate.Prompt)
+}
+
+func TestTable_CostWithCacheTokens(t *testing.T) {
+	table := NewTable(nil)
+
+	// 1M prompt tokens of which 400k were cache reads and 100k cache writes
+	breakdown := table.Cost("anthropic", "claude-3-5-sonnet-20241022", Usage{
+		PromptTokens:     1_000_000,
+		CompletionTokens: 100_000,
+		CacheReadTokens:  400_000,
+		CacheWriteTokens: 100_000,
+	})
+
+	assertClose(t, 1.50, breakdown.Prompt)      // 500k * $3/M
+	assertClose(t, 1.50, breakdown.Completion)  // 100k * $15/M
+	assertClose(t, 0.12, breakdown.CacheRead)   // 400k * $0.30/M
+	assertClose(t, 0.375, breakdown.CacheWrite) // 100k * $3.75/M
+	assertClose(t, 3.495, breakdown.Total())
+}
+
+func TestTable_CostUnknownModelUsesDefaultRate(t *testing.T) {
+	table := NewTable(nil)
+
+	breakdown := table.Cost("openai", "unknown-model", Usage{PromptTokens: 1000, CompletionTokens: 1000})
+	assertClose(t, 2000*DefaultRate.Prompt/1_000_000, breakdown.Total())
+}
+
+func TestRate_CostWithoutCachePricing(t *testing.T) {
+	rate := Rate{Prompt: 2, Completion: 4}
+
+	breakdown := rate.Cost(Usage{PromptTokens: 1_000_000, CacheReadTokens: 500_000})
+	assertClose(t, 1.0, breakdown.Prompt)
+	assertClose(t, 1.0, breakdown.CacheRead)
+}
+
+func assertEqual[T comparable](t *testing.T, expected, actual T) {
+	t.Helper()
+	if expected != actual {
+		t.Fatalf("Expected %v, got %v", expected, actual)
+	}
+}
+
+func assertClose(t *testing.T, expected, actual float64) {
+	t.Helper()
+	if math.Abs(expected-actual) > 1e-9 {
+		t.Fatalf("Expected %v, got %v", expected, actual)
+	}
+}
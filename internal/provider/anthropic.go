@@ -123,7 +123,7 @@ func (p *AnthropicProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatRe
 			"status_code", resp.StatusCode,
 			"response_body", string(bodyBytes),
 		)
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(bodyBytes))
+		return nil, newAPIError(resp, bodyBytes)
 	}
 
 	var anthropicResp anthropicResponse
@@ -175,7 +175,7 @@ func (p *AnthropicProvider) Stream(ctx context.Context, req *ChatRequest) (<-cha
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
 		resp.Body.Close()
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(bodyBytes))
+		return nil, newAPIError(resp, bodyBytes)
 	}
 
 	eventChan := make(chan StreamEvent, 10)
@@ -184,6 +184,9 @@ func (p *AnthropicProvider) Stream(ctx context.Context, req *ChatRequest) (<-cha
 		defer resp.Body.Close()
 		defer close(eventChan)
 
+		// Input token usage is only reported on message_start
+		var inputUsage anthropicUsage
+
 		scanner := bufio.NewScanner(resp.Body)
 		for scanner.Scan() {
 			line := scanner.Text()
@@ -193,24 +196,40 @@ func (p *AnthropicProvider) Stream(ctx context.Context, req *ChatRequest) (<-cha
 
 			data := strings.TrimPrefix(line, "data: ")
 			if data == "[DONE]" {
-				eventChan <- StreamEvent{Type: "done", Done: true}
+				sendEvent(ctx, eventChan, StreamEvent{Type: "done", Done: true})
 				return
 			}
 
 			var chunk anthropicStreamChunk
 			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
-				eventChan <- StreamEvent{Type: "error", Error: err}
+				sendEvent(ctx, eventChan, StreamEvent{Type: "error", Error: err})
+				return
+			}
+
+			if chunk.Type == "error" && chunk.Error != nil {
+				sendEvent(ctx, eventChan, StreamEvent{Type: "error", Error: chunk.Error.toAPIError(data)})
 				return
 			}
 
+			if chunk.Type == "message_start" && chunk.Message != nil {
+				inputUsage = chunk.Message.Usage
+			}
+
 			event := p.convertStreamChunk(&chunk)
 			if event != nil {
-				eventChan <- *event
+				if event.Usage != nil {
+					inputUsage.OutputTokens = event.Usage.CompletionTokens
+					usage := inputUsage.toUsage()
+					event.Usage = &usage
+				}
+				if !sendEvent(ctx, eventChan, *event) {
+					return
+				}
 			}
 		}
 
 		if err := scanner.Err(); err != nil {
-			eventChan <- StreamEvent{Type: "error", Error: err}
+			sendEvent(ctx, eventChan, StreamEvent{Type: "error", Error: err})
 		}
 	}()
 
@@ -230,16 +249,55 @@ func (p *AnthropicProvider) convertRequest(req *ChatRequest) *anthropicRequest {
 		anthropicReq.MaxTokens = 4096
 	}
 
-	// Extract system message if present
 	for _, msg := range req.Messages {
-		if msg.Role == "system" {
+		var message anthropicMessage
+
+		switch msg.Role {
+		case "system":
 			anthropicReq.System = msg.Content
-		} else {
-			anthropicReq.Messages = append(anthropicReq.Messages, anthropicMessage{
-				Role:    msg.Role,
-				Content: msg.Content,
-			})
+			continue
+
+		case "tool":
+			// Tool results are sent back as tool_result blocks in a user
+			// message, linked to the tool_use block by ID
+			message.Role = "user"
+			message.Content = []anthropicContent{{
+				Type:      "tool_result",
+				ToolUseID: msg.ToolCallID,
+				Content:   msg.Content,
+			}}
+
+		default:
+			message.Role = msg.Role
+			if msg.Content != "" {
+				message.Content = append(message.Content, anthropicContent{Type: "text", Text: msg.Content})
+			}
+			for _, tc := range msg.ToolCalls {
+				var input map[string]any
+				json.Unmarshal([]byte(tc.Function.Arguments), &input)
+				if input == nil {
+					input = map[string]any{}
+				}
+				message.Content = append(message.Content, anthropicContent{
+					Type:  "tool_use",
+					ID:    tc.ID,
+					Name:  tc.Function.Name,
+					Input: input,
+				})
+			}
+		}
+
+		if len(message.Content) == 0 {
+			continue
 		}
+
+		// Merge consecutive messages from the same role, so the results of
+		// parallel tool calls go back together in a single user turn
+		if n := len(anthropicReq.Messages); n > 0 && anthropicReq.Messages[n-1].Role == message.Role {
+			anthropicReq.Messages[n-1].Content = append(anthropicReq.Messages[n-1].Content, message.Content...)
+			continue
+		}
+		anthropicReq.Messages = append(anthropicReq.Messages, message)
 	}
 
 	// Convert tools
@@ -262,11 +320,7 @@ func (p *AnthropicProvider) convertResponse(resp *anthropicResponse) *ChatRespon
 		ID:           resp.ID,
 		Role:         resp.Role,
 		FinishReason: resp.StopReason,
-		Usage: Usage{
-			PromptTokens:     resp.Usage.InputTokens,
-			CompletionTokens: resp.Usage.OutputTokens,
-			TotalTokens:      resp.Usage.InputTokens + resp.Usage.OutputTokens,
-		},
+		Usage:        resp.Usage.toUsage(),
 	}
 
 	// Extract content and tool calls
@@ -291,23 +345,45 @@ func (p *AnthropicProvider) convertResponse(resp *anthropicResponse) *ChatRespon
 
 func (p *AnthropicProvider) convertStreamChunk(chunk *anthropicStreamChunk) *StreamEvent {
 	switch chunk.Type {
+	case "content_block_start":
+		if chunk.ContentBlock != nil && chunk.ContentBlock.Type == "tool_use" {
+			return &StreamEvent{
+				Type:  "tool_call",
+				Index: chunk.Index,
+				ToolCall: &ToolCall{
+					ID:   chunk.ContentBlock.ID,
+					Type: "function",
+					Function: FunctionCall{
+						Name: chunk.ContentBlock.Name,
+					},
+				},
+			}
+		}
 	case "content_block_delta":
-		if chunk.Delta.Type == "text_delta" {
+		switch chunk.Delta.Type {
+		case "text_delta":
 			return &StreamEvent{
 				Type:    "content_delta",
 				Content: chunk.Delta.Text,
 			}
+		case "input_json_delta":
+			return &StreamEvent{
+				Type:  "tool_call",
+				Index: chunk.Index,
+				ToolCall: &ToolCall{
+					Function: FunctionCall{
+						Arguments: chunk.Delta.PartialJSON,
+					},
+				},
+			}
 		}
 	case "message_delta":
 		if chunk.Delta.StopReason != "" {
 			return &StreamEvent{
-				Type: "done",
-				Done: true,
-				Usage: &Usage{
-					PromptTokens:     chunk.Usage.InputTokens,
-					CompletionTokens: chunk.Usage.OutputTokens,
-					TotalTokens:      chunk.Usage.InputTokens + chunk.Usage.OutputTokens,
-				},
+				Type:         "done",
+				Done:         true,
+				FinishReason: chunk.Delta.StopReason,
+				Usage:        &Usage{CompletionTokens: chunk.Usage.OutputTokens},
 			}
 		}
 	}
@@ -328,8 +404,8 @@ type anthropicRequest struct {
 }
 
 type anthropicMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role    string             `json:"role"`
+	Content []anthropicContent `json:"content"`
 }
 
 type anthropicTool struct {
@@ -348,24 +424,77 @@ type anthropicResponse struct {
 }
 
 type anthropicContent struct {
-	Type  string         `json:"type"`
-	Text  string         `json:"text,omitempty"`
-	ID    string         `json:"id,omitempty"`
-	Name  string         `json:"name,omitempty"`
-	Input map[string]any `json:"input,omitempty"`
+	Type  string `json:"type"` // text, tool_use, tool_result
+	Text  string `json:"text,omitempty"`
+	ID    string `json:"id,omitempty"`
+	Name  string `json:"name,omitempty"`
+	Input any    `json:"input,omitempty"` // always set on tool_use, even when empty
+
+	// tool_result fields
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Content   string `json:"content,omitempty"`
 }
 
 type anthropicUsage struct {
-	InputTokens  int `json:"input_tokens"`
-	OutputTokens int `json:"output_tokens"`
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens,omitempty"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens,omitempty"`
+}
+
+// toUsage converts Anthropic usage, where input_tokens excludes cached
+// tokens, into Usage where PromptTokens includes them
+func (u anthropicUsage) toUsage() Usage {
+	prompt := u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+	return Usage{
+		PromptTokens:     prompt,
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      prompt + u.OutputTokens,
+		CacheReadTokens:  u.CacheReadInputTokens,
+		CacheWriteTokens: u.CacheCreationInputTokens,
+	}
 }
 
 type anthropicStreamChunk struct {
 	Type  string `json:"type"`
+	Index int    `json:"index"`
 	Delta struct {
-		Type       string `json:"type"`
-		Text       string `json:"text"`
-		StopReason string `json:"stop_reason,omitempty"`
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json,omitempty"`
+		StopReason  string `json:"stop_reason,omitempty"`
 	} `json:"delta"`
-	Usage anthropicUsage `json:"usage,omitempty"`
+	ContentBlock *anthropicContent  `json:"content_block,omitempty"`
+	Message      *anthropicResponse `json:"message,omitempty"`
+	Usage        anthropicUsage     `json:"usage,omitempty"`
+	Error        *anthropicError    `json:"error,omitempty"`
+}
+
+// anthropicError is the error object of an error event sent mid-stream
+type anthropicError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// anthropicErrorStatus maps Anthropic error types to the HTTP status the
+// same error has when returned outside a stream
+var anthropicErrorStatus = map[string]int{
+	"invalid_request_error": http.StatusBadRequest,
+	"authentication_error":  http.StatusUnauthorized,
+	"permission_error":      http.StatusForbidden,
+	"not_found_error":       http.StatusNotFound,
+	"request_too_large":     http.StatusRequestEntityTooLarge,
+	"rate_limit_error":      http.StatusTooManyRequests,
+	"api_error":             http.StatusInternalServerError,
+	"overloaded_error":      statusOverloaded,
+}
+
+// toAPIError converts a stream error event so it classifies like the
+// equivalent HTTP error
+func (e *anthropicError) toAPIError(body string) *APIError {
+	status, ok := anthropicErrorStatus[e.Type]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	return &APIError{StatusCode: status, Body: body}
 }
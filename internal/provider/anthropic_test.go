@@ -0,0 +1,50 @@
+package provider
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestAnthropicProvider_ConvertRequest_ToolResults(t *testing.T) {
+	p := &AnthropicProvider{model: "claude-sonnet-4-5"}
+
+	req := p.convertRequest(&ChatRequest{
+		Messages: []Message{
+			{Role: "system", Content: "You are helpful"},
+			{Role: "user", Content: "Weather in Paris and Rome?"},
+			{Role: "assistant", Content: "Checking both."},
+			{Role: "assistant", ToolCalls: []ToolCall{
+				{ID: "toolu_1", Type: "function", Function: FunctionCall{Name: "get_weather", Arguments: `{"city":"Paris"}`}},
+				{ID: "toolu_2", Type: "function", Function: FunctionCall{Name: "get_weather", Arguments: ""}},
+			}},
+			{Role: "tool", ToolCallID: "toolu_1", Name: "get_weather", Content: "Sunny"},
+			{Role: "tool", ToolCallID: "toolu_2", Name: "get_weather", Content: "Rainy"},
+		},
+	})
+
+	assertEqual(t, "You are helpful", req.System)
+	assertEqual(t, 3, len(req.Messages))
+
+	// Text and tool_use blocks from the same turn are merged
+	assistant := req.Messages[1]
+	assertEqual(t, "assistant", assistant.Role)
+	assertEqual(t, 3, len(assistant.Content))
+	assertEqual(t, "text", assistant.Content[0].Type)
+	assertEqual(t, "tool_use", assistant.Content[1].Type)
+	assertEqual(t, "toolu_1", assistant.Content[1].ID)
+	assertEqual(t, "toolu_2", assistant.Content[2].ID)
+
+	// Parallel results go back in one user turn, linked by tool_use_id
+	results := req.Messages[2]
+	assertEqual(t, "user", results.Role)
+	assertEqual(t, 2, len(results.Content))
+	assertEqual(t, "tool_result", results.Content[0].Type)
+	assertEqual(t, "toolu_1", results.Content[0].ToolUseID)
+	assertEqual(t, "Sunny", results.Content[0].Content)
+	assertEqual(t, "toolu_2", results.Content[1].ToolUseID)
+
+	// tool_use input is required even when the call had no arguments
+	body, err := json.Marshal(assistant.Content[2])
+	assertNoError(t, err)
+	assertEqual(t, `{"type":"tool_use","id":"toolu_2","name":"get_weather","input":{}}`, string(body))
+}
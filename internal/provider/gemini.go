@@ -1,22 +1,68 @@
 package provider
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/shankarg87/agent/internal/config"
+	"github.com/shankarg87/agent/internal/logging"
 )
 
+const geminiAPIURL = "https://generativelanguage.googleapis.com/v1beta"
+
 // GeminiProvider implements Provider for Google Gemini models
-// TODO: Implement full Gemini support
 type GeminiProvider struct {
-	apiKey string
-	model  string
+	apiKey   string
+	model    string
+	endpoint string // base URL; requests go to {endpoint}/models/{model}:{method}
+	client   *http.Client
+	logger   *logging.SimpleLogger
 }
 
 // NewGeminiProvider creates a new Gemini provider
 func NewGeminiProvider(cfg config.ModelConfig) (*GeminiProvider, error) {
-	return nil, fmt.Errorf("gemini provider not yet implemented")
+	logger := logging.VerboseLogger("gemini")
+	logger.Verbose("Initializing Gemini provider", "model", cfg.Model)
+
+	apiKey := cfg.APIKey
+	if apiKey == "" {
+		apiKey = os.Getenv("GEMINI_API_KEY")
+	}
+	if apiKey == "" {
+		apiKey = os.Getenv("GOOGLE_API_KEY")
+	}
+	if apiKey == "" {
+		logger.Error("Gemini API key not configured")
+		return nil, fmt.Errorf("gemini API key not configured")
+	}
+
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = geminiAPIURL
+	}
+
+	logger.Info("Gemini provider initialized",
+		"model", cfg.Model,
+		"endpoint", endpoint,
+		"api_key_set", apiKey != "",
+	)
+
+	return &GeminiProvider{
+		apiKey:   apiKey,
+		model:    cfg.Model,
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		client:   &http.Client{},
+		logger:   logger,
+	}, nil
 }
 
 func (p *GeminiProvider) Name() string {
@@ -28,9 +74,390 @@ func (p *GeminiProvider) Model() string {
 }
 
 func (p *GeminiProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
-	return nil, fmt.Errorf("gemini provider not yet implemented")
+	start := time.Now()
+	p.logger.Verbose("Starting Gemini chat request",
+		"model", p.model,
+		"messages_count", len(req.Messages),
+		"tools_count", len(req.Tools),
+	)
+
+	resp, err := p.doRequest(ctx, "generateContent", req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var geminiResp geminiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&geminiResp); err != nil {
+		p.logger.Error("Failed to decode response", "error", err)
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	response := p.convertResponse(&geminiResp)
+
+	p.logger.Verbose("Chat request completed",
+		"finish_reason", response.FinishReason,
+		"prompt_tokens", response.Usage.PromptTokens,
+		"completion_tokens", response.Usage.CompletionTokens,
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
+
+	return response, nil
 }
 
 func (p *GeminiProvider) Stream(ctx context.Context, req *ChatRequest) (<-chan StreamEvent, error) {
-	return nil, fmt.Errorf("gemini provider not yet implemented")
+	resp, err := p.doRequest(ctx, "streamGenerateContent?alt=sse", req)
+	if err != nil {
+		return nil, err
+	}
+
+	eventChan := make(chan StreamEvent, 10)
+
+	go func() {
+		defer resp.Body.Close()
+		defer close(eventChan)
+
+		// Gemini sends whole function calls (not fragments), so each call
+		// gets its own index. Usage is cumulative and reported on every chunk.
+		var usage *Usage
+		var finishReason string
+		toolCalls := 0
+
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if !strings.HasPrefix(line, "data: ") {
+				continue
+			}
+
+			var chunk geminiResponse
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &chunk); err != nil {
+				sendEvent(ctx, eventChan, StreamEvent{Type: "error", Error: err})
+				return
+			}
+
+			if chunk.UsageMetadata != nil {
+				u := chunk.UsageMetadata.toUsage()
+				usage = &u
+			}
+
+			if len(chunk.Candidates) == 0 {
+				continue
+			}
+
+			candidate := chunk.Candidates[0]
+			for _, part := range candidate.Content.Parts {
+				if part.FunctionCall != nil {
+					tc := p.convertFunctionCall(part.FunctionCall)
+					if !sendEvent(ctx, eventChan, StreamEvent{Type: "tool_call", Index: toolCalls, ToolCall: &tc}) {
+						return
+					}
+					toolCalls++
+				} else if part.Text != "" && !part.Thought {
+					if !sendEvent(ctx, eventChan, StreamEvent{Type: "content_delta", Content: part.Text}) {
+						return
+					}
+				}
+			}
+
+			if candidate.FinishReason != "" {
+				finishReason = convertGeminiFinishReason(candidate.FinishReason, toolCalls > 0)
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			sendEvent(ctx, eventChan, StreamEvent{Type: "error", Error: err})
+			return
+		}
+
+		sendEvent(ctx, eventChan, StreamEvent{Type: "done", Done: true, FinishReason: finishReason, Usage: usage})
+	}()
+
+	return eventChan, nil
+}
+
+// doRequest posts a converted request to the given model method and returns
+// the response if it succeeded
+func (p *GeminiProvider) doRequest(ctx context.Context, method string, req *ChatRequest) (*http.Response, error) {
+	body, err := json.Marshal(p.convertRequest(req))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/models/%s:%s", p.endpoint, p.model, method)
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-goog-api-key", p.apiKey)
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		p.logger.Error("HTTP request failed", "error", err)
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		p.logger.Error("API error",
+			"status_code", resp.StatusCode,
+			"response_body", string(bodyBytes),
+		)
+		return nil, newAPIError(resp, bodyBytes)
+	}
+
+	return resp, nil
+}
+
+func (p *GeminiProvider) convertRequest(req *ChatRequest) *geminiRequest {
+	geminiReq := &geminiRequest{
+		Contents: make([]geminiContent, 0, len(req.Messages)),
+		GenerationConfig: &geminiGenerationConfig{
+			Temperature:     req.Temperature,
+			TopP:            req.TopP,
+			MaxOutputTokens: req.MaxTokens,
+			StopSequences:   req.Stop,
+		},
+	}
+
+	// Gemini function responses are matched by name, not ID, so remember
+	// the name of every call the model has made
+	callNames := make(map[string]string)
+	var pendingCalls []string
+
+	for _, msg := range req.Messages {
+		var content geminiContent
+
+		switch msg.Role {
+		case "system":
+			geminiReq.SystemInstruction = &geminiContent{
+				Parts: []geminiPart{{Text: msg.Content}},
+			}
+			continue
+
+		case "assistant":
+			content.Role = "model"
+			if msg.Content != "" {
+				content.Parts = append(content.Parts, geminiPart{Text: msg.Content})
+			}
+			pendingCalls = pendingCalls[:0]
+			for _, tc := range msg.ToolCalls {
+				var args map[string]any
+				json.Unmarshal([]byte(tc.Function.Arguments), &args)
+				content.Parts = append(content.Parts, geminiPart{
+					FunctionCall: &geminiFunctionCall{Name: tc.Function.Name, Args: args},
+				})
+				callNames[tc.ID] = tc.Function.Name
+				pendingCalls = append(pendingCalls, tc.Function.Name)
+			}
+
+		case "tool":
+			// Resolve the function name by call ID, falling back to the
+			// order in which the calls were made
+			name := msg.Name
+			if name == "" {
+				name = callNames[msg.ToolCallID]
+			}
+			if name == "" && len(pendingCalls) > 0 {
+				name = pendingCalls[0]
+			}
+			if len(pendingCalls) > 0 {
+				pendingCalls = pendingCalls[1:]
+			}
+			content.Role = "user"
+			content.Parts = []geminiPart{{
+				FunctionResponse: &geminiFunctionResponse{
+					Name:     name,
+					Response: map[string]any{"content": msg.Content},
+				},
+			}}
+
+		default:
+			content.Role = "user"
+			content.Parts = []geminiPart{{Text: msg.Content}}
+		}
+
+		if len(content.Parts) == 0 {
+			continue
+		}
+
+		// Gemini expects turns to alternate, so merge consecutive turns from
+		// the same role (e.g. the responses to parallel function calls)
+		if n := len(geminiReq.Contents); n > 0 && geminiReq.Contents[n-1].Role == content.Role {
+			geminiReq.Contents[n-1].Parts = append(geminiReq.Contents[n-1].Parts, content.Parts...)
+			continue
+		}
+		geminiReq.Contents = append(geminiReq.Contents, content)
+	}
+
+	if len(req.Tools) > 0 {
+		decls := make([]geminiFunctionDeclaration, len(req.Tools))
+		for i, tool := range req.Tools {
+			decls[i] = geminiFunctionDeclaration{
+				Name:        tool.Function.Name,
+				Description: tool.Function.Description,
+				Parameters:  tool.Function.Parameters,
+			}
+		}
+		geminiReq.Tools = []geminiTool{{FunctionDeclarations: decls}}
+	}
+
+	return geminiReq
+}
+
+func (p *GeminiProvider) convertResponse(resp *geminiResponse) *ChatResponse {
+	chatResp := &ChatResponse{
+		ID:   resp.ResponseID,
+		Role: "assistant",
+	}
+
+	if resp.UsageMetadata != nil {
+		chatResp.Usage = resp.UsageMetadata.toUsage()
+	}
+
+	if len(resp.Candidates) == 0 {
+		chatResp.FinishReason = "stop"
+		return chatResp
+	}
+
+	candidate := resp.Candidates[0]
+	for _, part := range candidate.Content.Parts {
+		if part.FunctionCall != nil {
+			chatResp.ToolCalls = append(chatResp.ToolCalls, p.convertFunctionCall(part.FunctionCall))
+		} else if !part.Thought {
+			chatResp.Content += part.Text
+		}
+	}
+
+	chatResp.FinishReason = convertGeminiFinishReason(candidate.FinishReason, len(chatResp.ToolCalls) > 0)
+
+	return chatResp
+}
+
+// convertFunctionCall converts a Gemini function call into a ToolCall.
+// Older Gemini models do not assign call IDs, so one is generated.
+func (p *GeminiProvider) convertFunctionCall(fc *geminiFunctionCall) ToolCall {
+	id := fc.ID
+	if id == "" {
+		id = "call_" + strings.ReplaceAll(uuid.New().String(), "-", "")[:24]
+	}
+
+	args := fc.Args
+	if args == nil {
+		args = map[string]any{}
+	}
+	argsJSON, _ := json.Marshal(args)
+
+	return ToolCall{
+		ID:   id,
+		Type: "function",
+		Function: FunctionCall{
+			Name:      fc.Name,
+			Arguments: string(argsJSON),
+		},
+	}
+}
+
+// convertGeminiFinishReason maps Gemini finish reasons onto the OpenAI-style
+// values the runtime understands
+func convertGeminiFinishReason(reason string, hasToolCalls bool) string {
+	if hasToolCalls {
+		return "tool_calls"
+	}
+	switch reason {
+	case "STOP", "":
+		return "stop"
+	case "MAX_TOKENS":
+		return "length"
+	default:
+		return strings.ToLower(reason)
+	}
+}
+
+// Gemini API types
+
+type geminiRequest struct {
+	Contents          []geminiContent         `json:"contents"`
+	SystemInstruction *geminiContent          `json:"systemInstruction,omitempty"`
+	Tools             []geminiTool            `json:"tools,omitempty"`
+	GenerationConfig  *geminiGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"` // user, model
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	Thought          bool                    `json:"thought,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type geminiFunctionCall struct {
+	ID   string         `json:"id,omitempty"`
+	Name string         `json:"name"`
+	Args map[string]any `json:"args,omitempty"`
+}
+
+type geminiFunctionResponse struct {
+	Name     string         `json:"name"`
+	Response map[string]any `json:"response"`
+}
+
+type geminiTool struct {
+	FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+type geminiFunctionDeclaration struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Parameters  map[string]any `json:"parameters,omitempty"`
+}
+
+type geminiGenerationConfig struct {
+	Temperature     float64  `json:"temperature,omitempty"`
+	TopP            float64  `json:"topP,omitempty"`
+	MaxOutputTokens int      `json:"maxOutputTokens,omitempty"`
+	StopSequences   []string `json:"stopSequences,omitempty"`
+}
+
+type geminiResponse struct {
+	ResponseID    string               `json:"responseId,omitempty"`
+	Candidates    []geminiCandidate    `json:"candidates"`
+	UsageMetadata *geminiUsageMetadata `json:"usageMetadata,omitempty"`
+}
+
+type geminiCandidate struct {
+	Content      geminiContent `json:"content"`
+	FinishReason string        `json:"finishReason,omitempty"`
+}
+
+type geminiUsageMetadata struct {
+	PromptTokenCount        int `json:"promptTokenCount"`
+	CandidatesTokenCount    int `json:"candidatesTokenCount"`
+	ThoughtsTokenCount      int `json:"thoughtsTokenCount,omitempty"`
+	CachedContentTokenCount int `json:"cachedContentTokenCount,omitempty"`
+	TotalTokenCount         int `json:"totalTokenCount"`
+}
+
+// toUsage converts Gemini usage metadata. Thinking tokens are billed as
+// output, and cached tokens are a subset of the prompt.
+func (u geminiUsageMetadata) toUsage() Usage {
+	completion := u.CandidatesTokenCount + u.ThoughtsTokenCount
+	total := u.TotalTokenCount
+	if total == 0 {
+		total = u.PromptTokenCount + completion
+	}
+	return Usage{
+		PromptTokens:     u.PromptTokenCount,
+		CompletionTokens: completion,
+		TotalTokens:      total,
+		CacheReadTokens:  u.CachedContentTokenCount,
+	}
 }
@@ -0,0 +1,180 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shankarg87/agent/internal/config"
+)
+
+func newTestGeminiProvider(t *testing.T, handler http.HandlerFunc) *GeminiProvider {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	provider, err := NewGeminiProvider(config.ModelConfig{
+		Provider: "gemini",
+		Model:    "gemini-2.5-flash",
+		APIKey:   "test-key",
+		Endpoint: server.URL,
+	})
+	assertNoError(t, err)
+	return provider
+}
+
+func TestNewGeminiProvider_NoAPIKey(t *testing.T) {
+	t.Setenv("GEMINI_API_KEY", "")
+	t.Setenv("GOOGLE_API_KEY", "")
+
+	provider, err := NewGeminiProvider(config.ModelConfig{Provider: "gemini", Model: "gemini-2.5-flash"})
+	assertError(t, err)
+	if provider != nil {
+		t.Error("Expected nil provider")
+	}
+}
+
+func TestNewGeminiProvider_WithEnvironmentKey(t *testing.T) {
+	t.Setenv("GEMINI_API_KEY", "")
+	t.Setenv("GOOGLE_API_KEY", "env-test-key")
+
+	provider, err := NewGeminiProvider(config.ModelConfig{Provider: "gemini", Model: "gemini-2.5-pro"})
+	assertNoError(t, err)
+	assertEqual(t, "gemini", provider.Name())
+	assertEqual(t, "gemini-2.5-pro", provider.Model())
+	assertEqual(t, "env-test-key", provider.apiKey)
+	assertEqual(t, geminiAPIURL, provider.endpoint)
+}
+
+func TestGeminiProvider_Chat_WithToolCalls(t *testing.T) {
+	var got geminiRequest
+	provider := newTestGeminiProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		assertEqual(t, "/models/gemini-2.5-flash:generateContent", r.URL.Path)
+		assertEqual(t, "test-key", r.Header.Get("x-goog-api-key"))
+		assertNoError(t, json.NewDecoder(r.Body).Decode(&got))
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{
+			"candidates": [{
+				"content": {"role": "model", "parts": [
+					{"text": "Let me check."},
+					{"functionCall": {"name": "get_weather", "args": {"city": "Paris"}}}
+				]},
+				"finishReason": "STOP"
+			}],
+			"usageMetadata": {
+				"promptTokenCount": 120,
+				"candidatesTokenCount": 15,
+				"thoughtsTokenCount": 5,
+				"cachedContentTokenCount": 100,
+				"totalTokenCount": 140
+			}
+		}`)
+	})
+
+	resp, err := provider.Chat(context.Background(), &ChatRequest{
+		Messages: []Message{
+			{Role: "system", Content: "You are helpful"},
+			{Role: "user", Content: "Weather in Paris and Rome?"},
+			{Role: "assistant", ToolCalls: []ToolCall{
+				{ID: "call_1", Type: "function", Function: FunctionCall{Name: "get_weather", Arguments: `{"city":"Paris"}`}},
+				{ID: "call_2", Type: "function", Function: FunctionCall{Name: "get_time", Arguments: `{"city":"Rome"}`}},
+			}},
+			{Role: "tool", ToolCallID: "call_2", Content: "14:00"},
+			{Role: "tool", ToolCallID: "call_1", Content: "Sunny"},
+		},
+		Tools: []Tool{{
+			Type: "function",
+			Function: Function{
+				Name:        "get_weather",
+				Description: "Get the weather",
+				Parameters:  map[string]any{"type": "object"},
+			},
+		}},
+		MaxTokens:   256,
+		Temperature: 0.5,
+	})
+	assertNoError(t, err)
+
+	// Request shape
+	assertNotNil(t, got.SystemInstruction)
+	assertEqual(t, "You are helpful", got.SystemInstruction.Parts[0].Text)
+	assertEqual(t, 1, len(got.Tools))
+	assertEqual(t, "get_weather", got.Tools[0].FunctionDeclarations[0].Name)
+	assertEqual(t, 256, got.GenerationConfig.MaxOutputTokens)
+
+	assertEqual(t, 3, len(got.Contents))
+	assertEqual(t, "user", got.Contents[0].Role)
+	assertEqual(t, "model", got.Contents[1].Role)
+	assertEqual(t, 2, len(got.Contents[1].Parts))
+	assertEqual(t, "Paris", got.Contents[1].Parts[0].FunctionCall.Args["city"].(string))
+
+	// Both function responses are merged into one user turn and named by call ID
+	assertEqual(t, "user", got.Contents[2].Role)
+	assertEqual(t, 2, len(got.Contents[2].Parts))
+	assertEqual(t, "get_time", got.Contents[2].Parts[0].FunctionResponse.Name)
+	assertEqual(t, "14:00", got.Contents[2].Parts[0].FunctionResponse.Response["content"].(string))
+	assertEqual(t, "get_weather", got.Contents[2].Parts[1].FunctionResponse.Name)
+
+	// Response mapping
+	assertEqual(t, "Let me check.", resp.Content)
+	assertEqual(t, "tool_calls", resp.FinishReason)
+	assertEqual(t, 1, len(resp.ToolCalls))
+	assertEqual(t, "get_weather", resp.ToolCalls[0].Function.Name)
+	assertEqual(t, `{"city":"Paris"}`, resp.ToolCalls[0].Function.Arguments)
+	if resp.ToolCalls[0].ID == "" {
+		t.Error("Expected a generated tool call ID")
+	}
+
+	assertEqual(t, 120, resp.Usage.PromptTokens)
+	assertEqual(t, 20, resp.Usage.CompletionTokens)
+	assertEqual(t, 140, resp.Usage.TotalTokens)
+	assertEqual(t, 100, resp.Usage.CacheReadTokens)
+}
+
+func TestGeminiProvider_Chat_APIError(t *testing.T) {
+	provider := newTestGeminiProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, `{"error": {"status": "RESOURCE_EXHAUSTED"}}`)
+	})
+
+	_, err := provider.Chat(context.Background(), &ChatRequest{
+		Messages: []Message{{Role: "user", Content: "Hello"}},
+	})
+	assertError(t, err)
+
+	var apiErr *APIError
+	assertEqual(t, true, errors.As(err, &apiErr))
+	assertEqual(t, http.StatusTooManyRequests, apiErr.StatusCode)
+}
+
+func TestGeminiProvider_Stream(t *testing.T) {
+	provider := newTestGeminiProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		assertEqual(t, "/models/gemini-2.5-flash:streamGenerateContent", r.URL.Path)
+		assertEqual(t, "sse", r.URL.Query().Get("alt"))
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `data: {"candidates": [{"content": {"role": "model", "parts": [{"text": "Hel"}]}}], "usageMetadata": {"promptTokenCount": 10}}`+"\n\n")
+		fmt.Fprint(w, `data: {"candidates": [{"content": {"role": "model", "parts": [{"text": "lo"}]}}]}`+"\n\n")
+		fmt.Fprint(w, `data: {"candidates": [{"content": {"role": "model", "parts": [{"functionCall": {"id": "fc_1", "name": "echo", "args": {"message": "hi"}}}]}, "finishReason": "STOP"}], "usageMetadata": {"promptTokenCount": 10, "candidatesTokenCount": 7, "totalTokenCount": 17}}`+"\n\n")
+	})
+
+	stream, err := provider.Stream(context.Background(), &ChatRequest{
+		Messages: []Message{{Role: "user", Content: "Say hello"}},
+	})
+	assertNoError(t, err)
+
+	resp := collect(t, stream)
+	assertEqual(t, "Hello", resp.Content)
+	assertEqual(t, "tool_calls", resp.FinishReason)
+	assertEqual(t, 1, len(resp.ToolCalls))
+	assertEqual(t, "fc_1", resp.ToolCalls[0].ID)
+	assertEqual(t, "echo", resp.ToolCalls[0].Function.Name)
+	assertEqual(t, `{"message":"hi"}`, resp.ToolCalls[0].Function.Arguments)
+	assertEqual(t, 17, resp.Usage.TotalTokens)
+	assertEqual(t, 7, resp.Usage.CompletionTokens)
+}
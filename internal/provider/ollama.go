@@ -1,22 +1,60 @@
 package provider
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/shankarg87/agent/internal/config"
+	"github.com/shankarg87/agent/internal/logging"
 )
 
+const ollamaDefaultEndpoint = "http://localhost:11434"
+
 // OllamaProvider implements Provider for Ollama models
-// TODO: Implement full Ollama support
 type OllamaProvider struct {
 	endpoint string
 	model    string
+	params   map[string]any
+	client   *http.Client
+	logger   *logging.SimpleLogger
 }
 
 // NewOllamaProvider creates a new Ollama provider
 func NewOllamaProvider(cfg config.ModelConfig) (*OllamaProvider, error) {
-	return nil, fmt.Errorf("ollama provider not yet implemented")
+	logger := logging.VerboseLogger("ollama")
+	logger.Verbose("Initializing Ollama provider", "model", cfg.Model)
+
+	if cfg.Model == "" {
+		logger.Error("Ollama model not configured")
+		return nil, fmt.Errorf("ollama model not configured")
+	}
+
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = ollamaDefaultEndpoint
+	}
+
+	logger.Info("Ollama provider initialized",
+		"model", cfg.Model,
+		"endpoint", endpoint,
+		"params_count", len(cfg.Params),
+	)
+
+	return &OllamaProvider{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		model:    cfg.Model,
+		params:   cfg.Params,
+		client:   &http.Client{},
+		logger:   logger,
+	}, nil
 }
 
 func (p *OllamaProvider) Name() string {
@@ -28,9 +66,314 @@ func (p *OllamaProvider) Model() string {
 }
 
 func (p *OllamaProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
-	return nil, fmt.Errorf("ollama provider not yet implemented")
+	start := time.Now()
+	p.logger.Verbose("Starting Ollama chat request",
+		"model", p.model,
+		"messages_count", len(req.Messages),
+		"tools_count", len(req.Tools),
+	)
+
+	resp, err := p.doRequest(ctx, req, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var ollamaResp ollamaResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ollamaResp); err != nil {
+		p.logger.Error("Failed to decode response", "error", err)
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	response := p.convertResponse(&ollamaResp)
+
+	p.logger.Verbose("Chat request completed",
+		"finish_reason", response.FinishReason,
+		"prompt_tokens", response.Usage.PromptTokens,
+		"completion_tokens", response.Usage.CompletionTokens,
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
+
+	return response, nil
 }
 
 func (p *OllamaProvider) Stream(ctx context.Context, req *ChatRequest) (<-chan StreamEvent, error) {
-	return nil, fmt.Errorf("ollama provider not yet implemented")
+	resp, err := p.doRequest(ctx, req, true)
+	if err != nil {
+		return nil, err
+	}
+
+	eventChan := make(chan StreamEvent, 10)
+
+	go func() {
+		defer resp.Body.Close()
+		defer close(eventChan)
+
+		// Ollama streams newline-delimited JSON objects. Tool calls arrive
+		// whole rather than in fragments, so each gets its own index.
+		toolCalls := 0
+
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+
+			var chunk ollamaResponse
+			if err := json.Unmarshal(line, &chunk); err != nil {
+				sendEvent(ctx, eventChan, StreamEvent{Type: "error", Error: err})
+				return
+			}
+
+			if chunk.Error != "" {
+				sendEvent(ctx, eventChan, StreamEvent{Type: "error", Error: fmt.Errorf("ollama error: %s", chunk.Error)})
+				return
+			}
+
+			if chunk.Message.Content != "" {
+				if !sendEvent(ctx, eventChan, StreamEvent{Type: "content_delta", Content: chunk.Message.Content}) {
+					return
+				}
+			}
+
+			for _, call := range chunk.Message.ToolCalls {
+				tc := p.convertToolCall(call)
+				if !sendEvent(ctx, eventChan, StreamEvent{Type: "tool_call", Index: toolCalls, ToolCall: &tc}) {
+					return
+				}
+				toolCalls++
+			}
+
+			if chunk.Done {
+				usage := chunk.usage()
+				sendEvent(ctx, eventChan, StreamEvent{
+					Type:         "done",
+					Done:         true,
+					FinishReason: convertOllamaDoneReason(chunk.DoneReason, toolCalls > 0),
+					Usage:        &usage,
+				})
+				return
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			sendEvent(ctx, eventChan, StreamEvent{Type: "error", Error: err})
+			return
+		}
+
+		// The stream ended without a final done object
+		sendEvent(ctx, eventChan, StreamEvent{Type: "error", Error: fmt.Errorf("ollama stream ended unexpectedly")})
+	}()
+
+	return eventChan, nil
+}
+
+// doRequest posts a converted request to /api/chat and returns the response
+// if it succeeded
+func (p *OllamaProvider) doRequest(ctx context.Context, req *ChatRequest, stream bool) (*http.Response, error) {
+	body, err := json.Marshal(p.convertRequest(req, stream))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.endpoint+"/api/chat", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		p.logger.Error("HTTP request failed", "error", err, "endpoint", p.endpoint)
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		p.logger.Error("API error",
+			"status_code", resp.StatusCode,
+			"response_body", string(bodyBytes),
+		)
+		return nil, newAPIError(resp, bodyBytes)
+	}
+
+	return resp, nil
+}
+
+func (p *OllamaProvider) convertRequest(req *ChatRequest, stream bool) *ollamaRequest {
+	ollamaReq := &ollamaRequest{
+		Model:    p.model,
+		Messages: make([]ollamaMessage, 0, len(req.Messages)),
+		Stream:   stream,
+		Options:  make(map[string]any),
+	}
+
+	// keep_alive, format and think belong at the top level of the request;
+	// all other params are model options (num_ctx, num_gpu, seed, ...)
+	for key, value := range p.params {
+		switch key {
+		case "keep_alive":
+			ollamaReq.KeepAlive = value
+		case "format":
+			ollamaReq.Format = value
+		case "think":
+			ollamaReq.Think = value
+		default:
+			ollamaReq.Options[key] = value
+		}
+	}
+
+	// Request values take precedence over configured options
+	if req.Temperature != 0 {
+		ollamaReq.Options["temperature"] = req.Temperature
+	}
+	if req.TopP != 0 {
+		ollamaReq.Options["top_p"] = req.TopP
+	}
+	if req.MaxTokens > 0 {
+		ollamaReq.Options["num_predict"] = req.MaxTokens
+	}
+	if len(req.Stop) > 0 {
+		ollamaReq.Options["stop"] = req.Stop
+	}
+	if len(ollamaReq.Options) == 0 {
+		ollamaReq.Options = nil
+	}
+
+	// Ollama matches tool results to calls by function name
+	callNames := make(map[string]string)
+
+	for _, msg := range req.Messages {
+		ollamaMsg := ollamaMessage{
+			Role:    msg.Role,
+			Content: msg.Content,
+		}
+
+		for _, tc := range msg.ToolCalls {
+			var args map[string]any
+			json.Unmarshal([]byte(tc.Function.Arguments), &args)
+			if args == nil {
+				args = map[string]any{}
+			}
+			ollamaMsg.ToolCalls = append(ollamaMsg.ToolCalls, ollamaToolCall{
+				Function: ollamaFunctionCall{Name: tc.Function.Name, Arguments: args},
+			})
+			callNames[tc.ID] = tc.Function.Name
+		}
+
+		if msg.Role == "tool" {
+			ollamaMsg.ToolName = msg.Name
+			if ollamaMsg.ToolName == "" {
+				ollamaMsg.ToolName = callNames[msg.ToolCallID]
+			}
+		}
+
+		ollamaReq.Messages = append(ollamaReq.Messages, ollamaMsg)
+	}
+
+	// Ollama accepts OpenAI-style tool definitions as-is
+	ollamaReq.Tools = req.Tools
+
+	return ollamaReq
+}
+
+func (p *OllamaProvider) convertResponse(resp *ollamaResponse) *ChatResponse {
+	chatResp := &ChatResponse{
+		Content: resp.Message.Content,
+		Role:    "assistant",
+		Usage:   resp.usage(),
+	}
+
+	for _, call := range resp.Message.ToolCalls {
+		chatResp.ToolCalls = append(chatResp.ToolCalls, p.convertToolCall(call))
+	}
+
+	chatResp.FinishReason = convertOllamaDoneReason(resp.DoneReason, len(chatResp.ToolCalls) > 0)
+
+	return chatResp
+}
+
+// convertToolCall converts an Ollama tool call into a ToolCall. Ollama does
+// not assign call IDs, so one is generated.
+func (p *OllamaProvider) convertToolCall(call ollamaToolCall) ToolCall {
+	args := call.Function.Arguments
+	if args == nil {
+		args = map[string]any{}
+	}
+	argsJSON, _ := json.Marshal(args)
+
+	return ToolCall{
+		ID:   "call_" + strings.ReplaceAll(uuid.New().String(), "-", "")[:24],
+		Type: "function",
+		Function: FunctionCall{
+			Name:      call.Function.Name,
+			Arguments: string(argsJSON),
+		},
+	}
+}
+
+// convertOllamaDoneReason maps Ollama done reasons onto the OpenAI-style
+// values the runtime understands
+func convertOllamaDoneReason(reason string, hasToolCalls bool) string {
+	if hasToolCalls {
+		return "tool_calls"
+	}
+	switch reason {
+	case "stop", "":
+		return "stop"
+	case "length":
+		return "length"
+	default:
+		return reason
+	}
+}
+
+// Ollama API types
+
+type ollamaRequest struct {
+	Model     string          `json:"model"`
+	Messages  []ollamaMessage `json:"messages"`
+	Tools     []Tool          `json:"tools,omitempty"`
+	Stream    bool            `json:"stream"`
+	Options   map[string]any  `json:"options,omitempty"`
+	KeepAlive any             `json:"keep_alive,omitempty"` // duration string or seconds
+	Format    any             `json:"format,omitempty"`     // "json" or a JSON schema
+	Think     any             `json:"think,omitempty"`
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"` // for tool response messages
+}
+
+type ollamaToolCall struct {
+	Function ollamaFunctionCall `json:"function"`
+}
+
+type ollamaFunctionCall struct {
+	Name      string         `json:"name"`
+	Arguments map[string]any `json:"arguments"`
+}
+
+type ollamaResponse struct {
+	Model           string        `json:"model"`
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason,omitempty"`
+	PromptEvalCount int           `json:"prompt_eval_count,omitempty"`
+	EvalCount       int           `json:"eval_count,omitempty"`
+	Error           string        `json:"error,omitempty"`
+}
+
+func (r *ollamaResponse) usage() Usage {
+	return Usage{
+		PromptTokens:     r.PromptEvalCount,
+		CompletionTokens: r.EvalCount,
+		TotalTokens:      r.PromptEvalCount + r.EvalCount,
+	}
 }
@@ -0,0 +1,151 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shankarg87/agent/internal/config"
+)
+
+func newTestOllamaProvider(t *testing.T, params map[string]any, handler http.HandlerFunc) *OllamaProvider {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	provider, err := NewOllamaProvider(config.ModelConfig{
+		Provider: "ollama",
+		Model:    "llama3.1",
+		Endpoint: server.URL,
+		Params:   params,
+	})
+	assertNoError(t, err)
+	return provider
+}
+
+func TestNewOllamaProvider_DefaultEndpoint(t *testing.T) {
+	provider, err := NewOllamaProvider(config.ModelConfig{Provider: "ollama", Model: "llama3.1"})
+	assertNoError(t, err)
+	assertEqual(t, "ollama", provider.Name())
+	assertEqual(t, "llama3.1", provider.Model())
+	assertEqual(t, "http://localhost:11434", provider.endpoint)
+}
+
+func TestOllamaProvider_Chat_WithToolCalls(t *testing.T) {
+	var got map[string]any
+	provider := newTestOllamaProvider(t, map[string]any{"num_ctx": 8192, "keep_alive": "10m"}, func(w http.ResponseWriter, r *http.Request) {
+		assertEqual(t, "/api/chat", r.URL.Path)
+		assertNoError(t, json.NewDecoder(r.Body).Decode(&got))
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{
+			"model": "llama3.1",
+			"message": {"role": "assistant", "content": "", "tool_calls": [
+				{"function": {"name": "get_weather", "arguments": {"city": "Paris"}}}
+			]},
+			"done": true,
+			"done_reason": "stop",
+			"prompt_eval_count": 42,
+			"eval_count": 8
+		}`)
+	})
+
+	resp, err := provider.Chat(context.Background(), &ChatRequest{
+		Messages: []Message{
+			{Role: "user", Content: "Weather in Paris?"},
+			{Role: "assistant", ToolCalls: []ToolCall{
+				{ID: "call_1", Type: "function", Function: FunctionCall{Name: "get_weather", Arguments: `{"city":"Paris"}`}},
+			}},
+			{Role: "tool", ToolCallID: "call_1", Content: "Sunny"},
+		},
+		Tools: []Tool{{
+			Type:     "function",
+			Function: Function{Name: "get_weather", Parameters: map[string]any{"type": "object"}},
+		}},
+		MaxTokens: 128,
+	})
+	assertNoError(t, err)
+
+	// Request shape: params split between options and top-level fields
+	assertEqual(t, false, got["stream"].(bool))
+	assertEqual(t, "10m", got["keep_alive"].(string))
+	options := got["options"].(map[string]any)
+	assertEqual(t, float64(8192), options["num_ctx"].(float64))
+	assertEqual(t, float64(128), options["num_predict"].(float64))
+	assertEqual(t, 1, len(got["tools"].([]any)))
+
+	messages := got["messages"].([]any)
+	assertEqual(t, 3, len(messages))
+	call := messages[1].(map[string]any)["tool_calls"].([]any)[0].(map[string]any)["function"].(map[string]any)
+	assertEqual(t, "Paris", call["arguments"].(map[string]any)["city"].(string))
+	assertEqual(t, "get_weather", messages[2].(map[string]any)["tool_name"].(string))
+
+	// Response mapping
+	assertEqual(t, "tool_calls", resp.FinishReason)
+	assertEqual(t, 1, len(resp.ToolCalls))
+	assertEqual(t, "get_weather", resp.ToolCalls[0].Function.Name)
+	assertEqual(t, `{"city":"Paris"}`, resp.ToolCalls[0].Function.Arguments)
+	assertEqual(t, 42, resp.Usage.PromptTokens)
+	assertEqual(t, 8, resp.Usage.CompletionTokens)
+	assertEqual(t, 50, resp.Usage.TotalTokens)
+}
+
+func TestOllamaProvider_Chat_APIError(t *testing.T) {
+	provider := newTestOllamaProvider(t, nil, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error": "model \"llama3.1\" not found, try pulling it first"}`)
+	})
+
+	_, err := provider.Chat(context.Background(), &ChatRequest{
+		Messages: []Message{{Role: "user", Content: "Hello"}},
+	})
+	assertError(t, err)
+
+	var apiErr *APIError
+	assertEqual(t, true, errors.As(err, &apiErr))
+	assertEqual(t, http.StatusNotFound, apiErr.StatusCode)
+}
+
+func TestOllamaProvider_Stream(t *testing.T) {
+	provider := newTestOllamaProvider(t, nil, func(w http.ResponseWriter, r *http.Request) {
+		var req ollamaRequest
+		assertNoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assertEqual(t, true, req.Stream)
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		fmt.Fprintln(w, `{"model":"llama3.1","message":{"role":"assistant","content":"Hel"},"done":false}`)
+		fmt.Fprintln(w, `{"model":"llama3.1","message":{"role":"assistant","content":"lo"},"done":false}`)
+		fmt.Fprintln(w, `{"model":"llama3.1","message":{"role":"assistant","content":""},"done":true,"done_reason":"length","prompt_eval_count":5,"eval_count":2}`)
+	})
+
+	stream, err := provider.Stream(context.Background(), &ChatRequest{
+		Messages: []Message{{Role: "user", Content: "Say hello"}},
+	})
+	assertNoError(t, err)
+
+	resp := collect(t, stream)
+	assertEqual(t, "Hello", resp.Content)
+	assertEqual(t, "length", resp.FinishReason)
+	assertEqual(t, 7, resp.Usage.TotalTokens)
+}
+
+func TestOllamaProvider_Stream_Truncated(t *testing.T) {
+	provider := newTestOllamaProvider(t, nil, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"model":"llama3.1","message":{"role":"assistant","content":"Hel"},"done":false}`)
+	})
+
+	stream, err := provider.Stream(context.Background(), &ChatRequest{
+		Messages: []Message{{Role: "user", Content: "Say hello"}},
+	})
+	assertNoError(t, err)
+
+	var last StreamEvent
+	for event := range stream {
+		last = event
+	}
+	assertEqual(t, "error", last.Type)
+}
@@ -80,7 +80,7 @@ func (p *OpenAIProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatRespo
 
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(bodyBytes))
+		return nil, newAPIError(resp, bodyBytes)
 	}
 
 	var openaiResp openaiResponse
@@ -94,6 +94,7 @@ func (p *OpenAIProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatRespo
 func (p *OpenAIProvider) Stream(ctx context.Context, req *ChatRequest) (<-chan StreamEvent, error) {
 	openaiReq := p.convertRequest(req)
 	openaiReq.Stream = true
+	openaiReq.StreamOptions = &openaiStreamOptions{IncludeUsage: true}
 
 	body, err := json.Marshal(openaiReq)
 	if err != nil {
@@ -116,7 +117,7 @@ func (p *OpenAIProvider) Stream(ctx context.Context, req *ChatRequest) (<-chan S
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
 		resp.Body.Close()
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(bodyBytes))
+		return nil, newAPIError(resp, bodyBytes)
 	}
 
 	eventChan := make(chan StreamEvent, 10)
@@ -134,24 +135,25 @@ func (p *OpenAIProvider) Stream(ctx context.Context, req *ChatRequest) (<-chan S
 
 			data := strings.TrimPrefix(line, "data: ")
 			if data == "[DONE]" {
-				eventChan <- StreamEvent{Type: "done", Done: true}
+				sendEvent(ctx, eventChan, StreamEvent{Type: "done", Done: true})
 				return
 			}
 
 			var chunk openaiStreamChunk
 			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
-				eventChan <- StreamEvent{Type: "error", Error: err}
+				sendEvent(ctx, eventChan, StreamEvent{Type: "error", Error: err})
 				return
 			}
 
-			event := p.convertStreamChunk(&chunk)
-			if event != nil {
-				eventChan <- *event
+			for _, event := range p.convertStreamChunk(&chunk) {
+				if !sendEvent(ctx, eventChan, event) {
+					return
+				}
 			}
 		}
 
 		if err := scanner.Err(); err != nil {
-			eventChan <- StreamEvent{Type: "error", Error: err}
+			sendEvent(ctx, eventChan, StreamEvent{Type: "error", Error: err})
 		}
 	}()
 
@@ -221,11 +223,7 @@ func (p *OpenAIProvider) convertResponse(resp *openaiResponse) *ChatResponse {
 		Content:      choice.Message.Content,
 		Role:         choice.Message.Role,
 		FinishReason: choice.FinishReason,
-		Usage: Usage{
-			PromptTokens:     resp.Usage.PromptTokens,
-			CompletionTokens: resp.Usage.CompletionTokens,
-			TotalTokens:      resp.Usage.TotalTokens,
-		},
+		Usage:        resp.Usage.toUsage(),
 	}
 
 	if len(choice.Message.ToolCalls) > 0 {
@@ -245,24 +243,35 @@ func (p *OpenAIProvider) convertResponse(resp *openaiResponse) *ChatResponse {
 	return chatResp
 }
 
-func (p *OpenAIProvider) convertStreamChunk(chunk *openaiStreamChunk) *StreamEvent {
+func (p *OpenAIProvider) convertStreamChunk(chunk *openaiStreamChunk) []StreamEvent {
+	var events []StreamEvent
+
+	// The final chunk carries usage (when requested) and no choices
 	if len(chunk.Choices) == 0 {
-		return nil
+		if chunk.Usage != nil {
+			usage := chunk.Usage.toUsage()
+			events = append(events, StreamEvent{
+				Type:  "done",
+				Done:  true,
+				Usage: &usage,
+			})
+		}
+		return events
 	}
 
 	choice := chunk.Choices[0]
 
 	if choice.Delta.Content != "" {
-		return &StreamEvent{
+		events = append(events, StreamEvent{
 			Type:    "content_delta",
 			Content: choice.Delta.Content,
-		}
+		})
 	}
 
-	if len(choice.Delta.ToolCalls) > 0 {
-		tc := choice.Delta.ToolCalls[0]
-		return &StreamEvent{
-			Type: "tool_call",
+	for _, tc := range choice.Delta.ToolCalls {
+		events = append(events, StreamEvent{
+			Type:  "tool_call",
+			Index: tc.Index,
 			ToolCall: &ToolCall{
 				ID:   tc.ID,
 				Type: tc.Type,
@@ -271,30 +280,36 @@ func (p *OpenAIProvider) convertStreamChunk(chunk *openaiStreamChunk) *StreamEve
 					Arguments: tc.Function.Arguments,
 				},
 			},
-		}
+		})
 	}
 
 	if choice.FinishReason != "" {
-		return &StreamEvent{
-			Type: "done",
-			Done: true,
-		}
+		events = append(events, StreamEvent{
+			Type:         "done",
+			Done:         true,
+			FinishReason: choice.FinishReason,
+		})
 	}
 
-	return nil
+	return events
 }
 
 // OpenAI API types
 
 type openaiRequest struct {
-	Model       string          `json:"model"`
-	Messages    []openaiMessage `json:"messages"`
-	MaxTokens   int             `json:"max_tokens,omitempty"`
-	Temperature float64         `json:"temperature,omitempty"`
-	TopP        float64         `json:"top_p,omitempty"`
-	Stop        []string        `json:"stop,omitempty"`
-	Tools       []openaiTool    `json:"tools,omitempty"`
-	Stream      bool            `json:"stream,omitempty"`
+	Model         string               `json:"model"`
+	Messages      []openaiMessage      `json:"messages"`
+	MaxTokens     int                  `json:"max_tokens,omitempty"`
+	Temperature   float64              `json:"temperature,omitempty"`
+	TopP          float64              `json:"top_p,omitempty"`
+	Stop          []string             `json:"stop,omitempty"`
+	Tools         []openaiTool         `json:"tools,omitempty"`
+	Stream        bool                 `json:"stream,omitempty"`
+	StreamOptions *openaiStreamOptions `json:"stream_options,omitempty"`
+}
+
+type openaiStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 type openaiMessage struct {
@@ -305,6 +320,7 @@ type openaiMessage struct {
 }
 
 type openaiToolCall struct {
+	Index    int            `json:"index,omitempty"` // only set on streamed deltas
 	ID       string         `json:"id"`
 	Type     string         `json:"type"`
 	Function openaiFunction `json:"function"`
@@ -342,9 +358,24 @@ type openaiChoice struct {
 }
 
 type openaiUsage struct {
-	PromptTokens     int `json:"prompt_tokens"`
-	CompletionTokens int `json:"completion_tokens"`
-	TotalTokens      int `json:"total_tokens"`
+	PromptTokens        int `json:"prompt_tokens"`
+	CompletionTokens    int `json:"completion_tokens"`
+	TotalTokens         int `json:"total_tokens"`
+	PromptTokensDetails *struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"prompt_tokens_details,omitempty"`
+}
+
+func (u openaiUsage) toUsage() Usage {
+	usage := Usage{
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      u.TotalTokens,
+	}
+	if u.PromptTokensDetails != nil {
+		usage.CacheReadTokens = u.PromptTokensDetails.CachedTokens
+	}
+	return usage
 }
 
 type openaiStreamChunk struct {
@@ -353,6 +384,7 @@ type openaiStreamChunk struct {
 	Created int64                `json:"created"`
 	Model   string               `json:"model"`
 	Choices []openaiStreamChoice `json:"choices"`
+	Usage   *openaiUsage         `json:"usage,omitempty"`
 }
 
 type openaiStreamChoice struct {
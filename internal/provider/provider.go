@@ -3,6 +3,7 @@ package provider
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/shankarg87/agent/internal/config"
 )
@@ -42,16 +43,40 @@ type ChatResponse struct {
 	ToolCalls    []ToolCall `json:"tool_calls,omitempty"`
 	FinishReason string     `json:"finish_reason"`
 	Usage        Usage      `json:"usage"`
+	Provider     string     `json:"provider,omitempty"` // provider that served the response, when routed
+	Model        string     `json:"model,omitempty"`    // model that served the response, when routed
 }
 
 // StreamEvent represents a streaming response event
 type StreamEvent struct {
-	Type     string    `json:"type"` // content_delta, tool_call, done, error
-	Content  string    `json:"content,omitempty"`
-	ToolCall *ToolCall `json:"tool_call,omitempty"`
-	Done     bool      `json:"done,omitempty"`
-	Error    error     `json:"error,omitempty"`
-	Usage    *Usage    `json:"usage,omitempty"`
+	Type         string    `json:"type"` // content_delta, tool_call, done, error
+	Content      string    `json:"content,omitempty"`
+	ToolCall     *ToolCall `json:"tool_call,omitempty"`
+	Index        int       `json:"index,omitempty"` // position of the tool call being streamed
+	FinishReason string    `json:"finish_reason,omitempty"`
+	Done         bool      `json:"done,omitempty"`
+	Error        error     `json:"error,omitempty"`
+	Usage        *Usage    `json:"usage,omitempty"`
+	Provider     string    `json:"provider,omitempty"` // set by Router
+	Model        string    `json:"model,omitempty"`    // set by Router
+}
+
+// APIError is returned when a provider API responds with a non-success
+// status. It matches its error class (ErrRateLimited, ErrOverloaded,
+// ErrServerError or ErrClientError) with errors.Is.
+type APIError struct {
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration // server-requested delay before retrying, if any
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API error (status %d): %s", e.StatusCode, e.Body)
+}
+
+// Unwrap returns the error's class
+func (e *APIError) Unwrap() error {
+	return classifyStatus(e.StatusCode, e.Body)
 }
 
 // Message represents a chat message
@@ -60,6 +85,7 @@ type Message struct {
 	Content    string     `json:"content"`
 	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
 	ToolCallID string     `json:"tool_call_id,omitempty"` // for tool response messages
+	Name       string     `json:"name,omitempty"`         // tool name, for tool response messages
 }
 
 // Tool represents a tool definition
@@ -88,25 +114,38 @@ type FunctionCall struct {
 	Arguments string `json:"arguments"` // JSON string
 }
 
-// Usage represents token usage
+// Usage represents token usage. PromptTokens includes any prompt tokens
+// served from (CacheReadTokens) or written to (CacheWriteTokens) the
+// provider's prompt cache.
 type Usage struct {
 	PromptTokens     int `json:"prompt_tokens"`
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
+	CacheReadTokens  int `json:"cache_read_tokens,omitempty"`
+	CacheWriteTokens int `json:"cache_write_tokens,omitempty"`
 }
 
-// NewProvider creates a new provider based on the model config
+// NewProvider creates a new provider based on the model config. Transient
+// failures are retried according to cfg.MaxRetries.
 func NewProvider(cfg config.ModelConfig) (Provider, error) {
+	var p Provider
+	var err error
+
 	switch cfg.Provider {
 	case "anthropic":
-		return NewAnthropicProvider(cfg)
+		p, err = NewAnthropicProvider(cfg)
 	case "openai":
-		return NewOpenAIProvider(cfg)
+		p, err = NewOpenAIProvider(cfg)
 	case "gemini":
-		return NewGeminiProvider(cfg)
+		p, err = NewGeminiProvider(cfg)
 	case "ollama":
-		return NewOllamaProvider(cfg)
+		p, err = NewOllamaProvider(cfg)
 	default:
 		return nil, fmt.Errorf("unsupported provider: %s", cfg.Provider)
 	}
+	if err != nil {
+		return nil, err
+	}
+
+	return NewRetryProvider(p, retryPolicyFor(cfg)), nil
 }
@@ -1,6 +1,7 @@
 package provider
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/shankarg87/agent/internal/config"
@@ -33,6 +34,25 @@ func TestNewProvider(t *testing.T) {
 			expectedType: "anthropic",
 			shouldError:  false,
 		},
+		{
+			name: "Gemini provider",
+			config: config.ModelConfig{
+				Provider: "gemini",
+				Model:    "gemini-2.5-flash",
+				APIKey:   "test-key",
+			},
+			expectedType: "gemini",
+			shouldError:  false,
+		},
+		{
+			name: "Ollama provider",
+			config: config.ModelConfig{
+				Provider: "ollama",
+				Model:    "llama3.1",
+			},
+			expectedType: "ollama",
+			shouldError:  false,
+		},
 		{
 			name: "Unsupported provider",
 			config: config.ModelConfig{
@@ -316,3 +336,22 @@ func assertNil(t *testing.T, value any) {
 		t.Fatalf("Expected nil value, got %v", value)
 	}
 }
+
+func TestUsage_CacheTokens(t *testing.T) {
+	// Anthropic reports cached tokens separately from input_tokens
+	var anthropic anthropicUsage
+	assertNoError(t, json.Unmarshal([]byte(`{"input_tokens":100,"output_tokens":20,"cache_creation_input_tokens":300,"cache_read_input_tokens":600}`), &anthropic))
+	usage := anthropic.toUsage()
+	assertEqual(t, 1000, usage.PromptTokens)
+	assertEqual(t, 1020, usage.TotalTokens)
+	assertEqual(t, 600, usage.CacheReadTokens)
+	assertEqual(t, 300, usage.CacheWriteTokens)
+
+	// OpenAI reports cached tokens as a subset of prompt_tokens
+	var openai openaiUsage
+	assertNoError(t, json.Unmarshal([]byte(`{"prompt_tokens":1000,"completion_tokens":20,"total_tokens":1020,"prompt_tokens_details":{"cached_tokens":768}}`), &openai))
+	usage = openai.toUsage()
+	assertEqual(t, 1000, usage.PromptTokens)
+	assertEqual(t, 768, usage.CacheReadTokens)
+	assertEqual(t, 0, usage.CacheWriteTokens)
+}
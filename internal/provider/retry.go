@@ -0,0 +1,274 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shankarg87/agent/internal/config"
+	"github.com/shankarg87/agent/internal/logging"
+)
+
+// Error classes for provider API failures. An *APIError matches exactly one
+// of these with errors.Is.
+var (
+	// ErrRateLimited means the request was rejected by a rate limit (429)
+	ErrRateLimited = errors.New("rate limited")
+
+	// ErrOverloaded means the provider is temporarily over capacity
+	// (Anthropic's 529 / overloaded_error)
+	ErrOverloaded = errors.New("provider overloaded")
+
+	// ErrServerError means the provider failed to handle the request (5xx)
+	ErrServerError = errors.New("provider server error")
+
+	// ErrClientError means the request itself was rejected (4xx) and will
+	// fail the same way if retried
+	ErrClientError = errors.New("provider client error")
+)
+
+// statusOverloaded is the non-standard status Anthropic uses when overloaded
+const statusOverloaded = 529
+
+// classifyStatus returns the error class for an API response
+func classifyStatus(statusCode int, body string) error {
+	switch {
+	case statusCode == statusOverloaded || strings.Contains(body, "overloaded_error"):
+		return ErrOverloaded
+	case statusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case statusCode >= 500:
+		return ErrServerError
+	default:
+		return ErrClientError
+	}
+}
+
+// IsRetryable reports whether err is a transient provider failure: a rate
+// limit, an overloaded provider or a server error
+func IsRetryable(err error) bool {
+	return errors.Is(err, ErrRateLimited) || errors.Is(err, ErrOverloaded) || errors.Is(err, ErrServerError)
+}
+
+// newAPIError reads a failed response into an APIError, including any
+// Retry-After hint. The caller still owns resp.Body.
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	return &APIError{
+		StatusCode: resp.StatusCode,
+		Body:       string(body),
+		RetryAfter: parseRetryAfter(resp.Header, time.Now()),
+	}
+}
+
+// parseRetryAfter reads the retry-after-ms header (sent by OpenAI) or the
+// standard Retry-After header, in seconds or as an HTTP date
+func parseRetryAfter(header http.Header, now time.Time) time.Duration {
+	if ms, err := strconv.ParseFloat(header.Get("retry-after-ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseFloat(value, 64); err == nil && secs > 0 {
+		return time.Duration(secs * float64(time.Second))
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+// RetryPolicy controls how transient provider failures are retried
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first attempt
+	MaxRetries int
+
+	// BaseDelay is the backoff before the first retry; it doubles on each
+	// subsequent retry
+	BaseDelay time.Duration
+
+	// MaxDelay caps the backoff. A Retry-After longer than MaxDelay is not
+	// waited out; the error is returned so a router can fall back instead.
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy is used when a model does not configure retries
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 3,
+	BaseDelay:  500 * time.Millisecond,
+	MaxDelay:   30 * time.Second,
+}
+
+// retryPolicyFor returns the retry policy for a model config. A negative
+// MaxRetries disables retries.
+func retryPolicyFor(cfg config.ModelConfig) RetryPolicy {
+	policy := DefaultRetryPolicy
+	switch {
+	case cfg.MaxRetries < 0:
+		policy.MaxRetries = 0
+	case cfg.MaxRetries > 0:
+		policy.MaxRetries = cfg.MaxRetries
+	}
+	return policy
+}
+
+// delay returns how long to wait before the given retry (0-based), or false
+// if the error should not be retried
+func (rp RetryPolicy) delay(retry int, err error) (time.Duration, bool) {
+	if retry >= rp.MaxRetries || !IsRetryable(err) {
+		return 0, false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		if rp.MaxDelay > 0 && apiErr.RetryAfter > rp.MaxDelay {
+			return 0, false
+		}
+		return apiErr.RetryAfter, true
+	}
+
+	// Exponential backoff with equal jitter: half fixed, half random, so
+	// concurrent runs hitting the same limit spread out
+	backoff := rp.BaseDelay << retry
+	if rp.MaxDelay > 0 && (backoff > rp.MaxDelay || backoff <= 0) {
+		backoff = rp.MaxDelay
+	}
+	half := backoff / 2
+	if half <= 0 {
+		return backoff, true
+	}
+	return half + rand.N(half), true
+}
+
+// RetryProvider is a Provider that retries rate limits, overload and server
+// errors from the provider it wraps
+type RetryProvider struct {
+	provider Provider
+	policy   RetryPolicy
+	logger   *logging.SimpleLogger
+}
+
+// NewRetryProvider wraps a provider with retries
+func NewRetryProvider(p Provider, policy RetryPolicy) *RetryProvider {
+	return &RetryProvider{
+		provider: p,
+		policy:   policy,
+		logger:   logging.VerboseLogger("retry"),
+	}
+}
+
+func (r *RetryProvider) Name() string {
+	return r.provider.Name()
+}
+
+func (r *RetryProvider) Model() string {
+	return r.provider.Model()
+}
+
+// Chat sends the request, retrying transient failures
+func (r *RetryProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	for retry := 0; ; retry++ {
+		resp, err := r.provider.Chat(ctx, req)
+		if err == nil {
+			return resp, nil
+		}
+		if err := r.wait(ctx, retry, err); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Stream starts a stream, retrying transient failures that happen before the
+// first event. Providers such as Anthropic report overload as the first event
+// of an otherwise successful response. Once events are flowing the stream is
+// not retried.
+func (r *RetryProvider) Stream(ctx context.Context, req *ChatRequest) (<-chan StreamEvent, error) {
+	for retry := 0; ; retry++ {
+		stream, err := r.provider.Stream(ctx, req)
+		if err == nil {
+			var first StreamEvent
+			var received bool
+			select {
+			case first, received = <-stream:
+			case <-ctx.Done():
+				go drain(stream)
+				return nil, ctx.Err()
+			}
+			if !received || first.Type != "error" {
+				return r.forward(ctx, stream, first, received), nil
+			}
+			go drain(stream)
+			err = first.Error
+		}
+		if err := r.wait(ctx, retry, err); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// wait sleeps before the next retry of a failed attempt. It returns the
+// error to give up with if the attempt should not be retried.
+func (r *RetryProvider) wait(ctx context.Context, retry int, err error) error {
+	delay, ok := r.policy.delay(retry, err)
+	if !ok {
+		if retry > 0 {
+			return fmt.Errorf("giving up after %d retries: %w", retry, err)
+		}
+		return err
+	}
+
+	r.logger.Warn("Model request failed, retrying",
+		"provider", r.provider.Name(),
+		"model", r.provider.Model(),
+		"retry", retry+1,
+		"max_retries", r.policy.MaxRetries,
+		"delay_ms", delay.Milliseconds(),
+		"error", err,
+	)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// forward relays a stream whose first event has already been read
+func (r *RetryProvider) forward(ctx context.Context, stream <-chan StreamEvent, first StreamEvent, received bool) <-chan StreamEvent {
+	out := make(chan StreamEvent, 10)
+
+	go func() {
+		defer close(out)
+
+		if !received {
+			return
+		}
+
+		event := first
+		for {
+			select {
+			case out <- event:
+			case <-ctx.Done():
+				go drain(stream)
+				return
+			}
+
+			var ok bool
+			if event, ok = <-stream; !ok {
+				return
+			}
+		}
+	}()
+
+	return out
+}
@@ -0,0 +1,165 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shankarg87/agent/internal/config"
+)
+
+// flakyProvider fails with each of errs in turn, then succeeds
+type flakyProvider struct {
+	errs  []error
+	calls int32
+}
+
+func (f *flakyProvider) Name() string  { return "flaky" }
+func (f *flakyProvider) Model() string { return "flaky-1" }
+
+func (f *flakyProvider) next() error {
+	n := int(atomic.AddInt32(&f.calls, 1)) - 1
+	if n < len(f.errs) {
+		return f.errs[n]
+	}
+	return nil
+}
+
+func (f *flakyProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	if err := f.next(); err != nil {
+		return nil, err
+	}
+	return &ChatResponse{Content: "ok", FinishReason: "stop"}, nil
+}
+
+// Stream reports failures as the first event, the way Anthropic reports
+// overload on an already-open stream
+func (f *flakyProvider) Stream(ctx context.Context, req *ChatRequest) (<-chan StreamEvent, error) {
+	ch := make(chan StreamEvent, 2)
+	if err := f.next(); err != nil {
+		ch <- StreamEvent{Type: "error", Error: err}
+	} else {
+		ch <- StreamEvent{Type: "content_delta", Content: "ok"}
+		ch <- StreamEvent{Type: "done", Done: true, FinishReason: "stop"}
+	}
+	close(ch)
+	return ch, nil
+}
+
+var testRetryPolicy = RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: time.Second}
+
+func TestAPIError_Classes(t *testing.T) {
+	tests := []struct {
+		err   *APIError
+		class error
+	}{
+		{&APIError{StatusCode: 429}, ErrRateLimited},
+		{&APIError{StatusCode: 529}, ErrOverloaded},
+		{&APIError{StatusCode: 500, Body: `{"type":"error","error":{"type":"overloaded_error"}}`}, ErrOverloaded},
+		{&APIError{StatusCode: 502}, ErrServerError},
+		{&APIError{StatusCode: 400}, ErrClientError},
+		{&APIError{StatusCode: 401}, ErrClientError},
+	}
+
+	for _, tt := range tests {
+		assertEqual(t, true, errors.Is(tt.err, tt.class))
+		assertEqual(t, tt.class != ErrClientError, IsRetryable(tt.err))
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	header := http.Header{}
+	header.Set("Retry-After", "2")
+	assertEqual(t, 2*time.Second, parseRetryAfter(header, now))
+
+	header.Set("retry-after-ms", "150")
+	assertEqual(t, 150*time.Millisecond, parseRetryAfter(header, now))
+
+	header = http.Header{}
+	header.Set("Retry-After", now.Add(5*time.Second).Format(http.TimeFormat))
+	assertEqual(t, 5*time.Second, parseRetryAfter(header, now))
+
+	header.Set("Retry-After", "soon")
+	assertEqual(t, time.Duration(0), parseRetryAfter(header, now))
+}
+
+func TestRetryProvider_RetriesTransientErrors(t *testing.T) {
+	inner := &flakyProvider{errs: []error{
+		&APIError{StatusCode: 429, RetryAfter: 20 * time.Millisecond},
+		&APIError{StatusCode: 529},
+		&APIError{StatusCode: 503},
+	}}
+	retrier := NewRetryProvider(inner, testRetryPolicy)
+
+	start := time.Now()
+	resp, err := retrier.Chat(context.Background(), &ChatRequest{})
+	assertNoError(t, err)
+	assertEqual(t, "ok", resp.Content)
+	assertEqual(t, int32(4), atomic.LoadInt32(&inner.calls))
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("Expected Retry-After to be honored, retried after %v", elapsed)
+	}
+}
+
+func TestRetryProvider_ClientErrorNotRetried(t *testing.T) {
+	inner := &flakyProvider{errs: []error{&APIError{StatusCode: 400, Body: "bad request"}}}
+	retrier := NewRetryProvider(inner, testRetryPolicy)
+
+	_, err := retrier.Chat(context.Background(), &ChatRequest{})
+	assertError(t, err)
+	assertEqual(t, true, errors.Is(err, ErrClientError))
+	assertEqual(t, int32(1), atomic.LoadInt32(&inner.calls))
+}
+
+func TestRetryProvider_GivesUp(t *testing.T) {
+	serverErr := &APIError{StatusCode: 500}
+	inner := &flakyProvider{errs: []error{serverErr, serverErr, serverErr, serverErr, serverErr}}
+	retrier := NewRetryProvider(inner, testRetryPolicy)
+
+	_, err := retrier.Chat(context.Background(), &ChatRequest{})
+	assertError(t, err)
+	assertEqual(t, true, errors.Is(err, ErrServerError))
+	assertEqual(t, int32(4), atomic.LoadInt32(&inner.calls))
+
+	// A Retry-After beyond MaxDelay is returned immediately
+	inner = &flakyProvider{errs: []error{&APIError{StatusCode: 429, RetryAfter: time.Minute}}}
+	retrier = NewRetryProvider(inner, testRetryPolicy)
+
+	_, err = retrier.Chat(context.Background(), &ChatRequest{})
+	assertEqual(t, true, errors.Is(err, ErrRateLimited))
+	assertEqual(t, int32(1), atomic.LoadInt32(&inner.calls))
+}
+
+func TestRetryProvider_StreamRetriesFirstEventError(t *testing.T) {
+	inner := &flakyProvider{errs: []error{&APIError{StatusCode: 529, Body: "overloaded"}}}
+	retrier := NewRetryProvider(inner, testRetryPolicy)
+
+	stream, err := retrier.Stream(context.Background(), &ChatRequest{})
+	assertNoError(t, err)
+	assertEqual(t, "ok", collect(t, stream).Content)
+	assertEqual(t, int32(2), atomic.LoadInt32(&inner.calls))
+}
+
+func TestAnthropicProvider_StreamOverloadedEvent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}\n\n"))
+	}))
+	defer server.Close()
+
+	p, err := NewAnthropicProvider(config.ModelConfig{Provider: "anthropic", Model: "claude", APIKey: "test-key", Endpoint: server.URL})
+	assertNoError(t, err)
+
+	stream, err := p.Stream(context.Background(), &ChatRequest{})
+	assertNoError(t, err)
+
+	event := <-stream
+	assertEqual(t, "error", event.Type)
+	assertEqual(t, true, errors.Is(event.Error, ErrOverloaded))
+}
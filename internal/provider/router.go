@@ -0,0 +1,340 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http/httptrace"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/shankarg87/agent/internal/logging"
+	"github.com/shankarg87/agent/internal/pricing"
+)
+
+// Routing strategies
+const (
+	RoutingSingle       = "single"
+	RoutingFallback     = "fallback"
+	RoutingCostAware    = "cost_aware"
+	RoutingLatencyAware = "latency_aware"
+)
+
+const (
+	// latencySmoothing is the weight of the newest sample in the latency average
+	latencySmoothing = 0.3
+
+	// latencyFailurePenalty is added to the latency sample of a failed attempt
+	// so that latency_aware routing moves away from failing models
+	latencyFailurePenalty = 10 * time.Second
+)
+
+// RouterOptions configures a Router
+type RouterOptions struct {
+	// Prices ranks models for the cost_aware strategy
+	Prices *pricing.Table
+
+	// Timeout bounds how long to wait for a model to start responding before
+	// falling back to the next model: the first stream event, or for Chat the
+	// first byte of the HTTP response. A slow body after that is not cut off.
+	// Zero means no limit.
+	Timeout time.Duration
+}
+
+// Router is a Provider that routes each request across several providers.
+// Providers are tried in an order chosen by the strategy; when an attempt
+// fails with a 5xx, a rate limit or a timeout, the next provider is tried.
+// Responses and stream events are stamped with the provider and model that
+// served them.
+type Router struct {
+	strategy  string
+	providers []Provider
+	prices    *pricing.Table
+	timeout   time.Duration
+	logger    *logging.SimpleLogger
+
+	mu      sync.Mutex
+	latency []time.Duration // smoothed time to first response, per provider; 0 if unmeasured
+}
+
+// NewRouter creates a routing provider. The first provider is the primary.
+func NewRouter(strategy string, providers []Provider, opts RouterOptions) (*Router, error) {
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("router requires at least one provider")
+	}
+
+	switch strategy {
+	case RoutingSingle, RoutingFallback, RoutingCostAware, RoutingLatencyAware:
+	case "":
+		strategy = RoutingFallback
+	default:
+		return nil, fmt.Errorf("unsupported routing strategy: %s", strategy)
+	}
+
+	prices := opts.Prices
+	if prices == nil {
+		prices = pricing.NewTable(nil)
+	}
+
+	logger := logging.VerboseLogger("router")
+	logger.Info("Model router initialized",
+		"strategy", strategy,
+		"provider_count", len(providers),
+	)
+
+	return &Router{
+		strategy:  strategy,
+		providers: providers,
+		prices:    prices,
+		timeout:   opts.Timeout,
+		logger:    logger,
+		latency:   make([]time.Duration, len(providers)),
+	}, nil
+}
+
+// Name returns the primary provider's name
+func (r *Router) Name() string {
+	return r.providers[0].Name()
+}
+
+// Model returns the primary provider's model
+func (r *Router) Model() string {
+	return r.providers[0].Model()
+}
+
+// Chat sends the request to providers in strategy order until one succeeds
+func (r *Router) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	var lastErr error
+	order := r.order()
+
+	for n, i := range order {
+		p := r.providers[i]
+
+		attemptCtx, cancel, responding, timedOut := r.startAttempt(ctx)
+		// Providers calling an HTTP API report their response headers
+		// through the trace; for any other, the timeout covers the whole call
+		attemptCtx = httptrace.WithClientTrace(attemptCtx, &httptrace.ClientTrace{
+			GotFirstResponseByte: responding,
+		})
+		start := time.Now()
+		resp, err := p.Chat(attemptCtx, req)
+		responding()
+		cancel()
+
+		if err == nil {
+			r.observeLatency(i, time.Since(start))
+			resp.Provider = p.Name()
+			resp.Model = p.Model()
+			return resp, nil
+		}
+
+		if timedOut() && ctx.Err() == nil {
+			err = fmt.Errorf("%s/%s timed out after %v: %w", p.Name(), p.Model(), r.timeout, context.DeadlineExceeded)
+		}
+		if ctx.Err() != nil || !r.shouldFallback(err) || n == len(order)-1 {
+			return nil, err
+		}
+
+		r.observeLatency(i, time.Since(start)+latencyFailurePenalty)
+		r.logFallback(p, r.providers[order[n+1]], err)
+		lastErr = err
+	}
+
+	return nil, lastErr
+}
+
+// Stream starts a stream with providers in strategy order. A provider is
+// abandoned if it fails before producing its first event; once events are
+// flowing the stream is committed to that provider.
+func (r *Router) Stream(ctx context.Context, req *ChatRequest) (<-chan StreamEvent, error) {
+	var lastErr error
+	order := r.order()
+
+	for n, i := range order {
+		p := r.providers[i]
+
+		attemptCtx, cancel, responding, timedOut := r.startAttempt(ctx)
+		start := time.Now()
+		stream, err := p.Stream(attemptCtx, req)
+
+		var first StreamEvent
+		received := false
+		if err == nil {
+			select {
+			case first, received = <-stream:
+				if received && first.Type == "error" {
+					err = first.Error
+				}
+			case <-attemptCtx.Done():
+				err = attemptCtx.Err()
+			}
+		}
+		responding()
+
+		if err == nil {
+			r.observeLatency(i, time.Since(start))
+			return r.forward(attemptCtx, p, stream, first, received, cancel), nil
+		}
+
+		cancel()
+		if stream != nil {
+			go drain(stream)
+		}
+
+		if timedOut() && ctx.Err() == nil {
+			err = fmt.Errorf("%s/%s timed out after %v: %w", p.Name(), p.Model(), r.timeout, context.DeadlineExceeded)
+		}
+		if ctx.Err() != nil || !r.shouldFallback(err) || n == len(order)-1 {
+			return nil, err
+		}
+
+		r.observeLatency(i, time.Since(start)+latencyFailurePenalty)
+		r.logFallback(p, r.providers[order[n+1]], err)
+		lastErr = err
+	}
+
+	return nil, lastErr
+}
+
+// forward relays a committed stream, stamping each event with the provider
+// and model that produced it
+func (r *Router) forward(ctx context.Context, p Provider, stream <-chan StreamEvent, first StreamEvent, received bool, cancel context.CancelFunc) <-chan StreamEvent {
+	out := make(chan StreamEvent, 10)
+
+	go func() {
+		defer close(out)
+		defer cancel()
+
+		if !received {
+			return
+		}
+
+		event := first
+		for {
+			event.Provider, event.Model = p.Name(), p.Model()
+			select {
+			case out <- event:
+			case <-ctx.Done():
+				go drain(stream)
+				return
+			}
+
+			var ok bool
+			if event, ok = <-stream; !ok {
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// startAttempt derives the context for one attempt, which the router
+// timeout cancels unless responding is called first. timedOut reports
+// whether the timeout fired.
+func (r *Router) startAttempt(ctx context.Context) (attemptCtx context.Context, cancel context.CancelFunc, responding func(), timedOut func() bool) {
+	attemptCtx, cancel = context.WithCancel(ctx)
+	if r.timeout <= 0 {
+		return attemptCtx, cancel, func() {}, func() bool { return false }
+	}
+
+	var fired atomic.Bool
+	timer := time.AfterFunc(r.timeout, func() {
+		fired.Store(true)
+		cancel()
+	})
+	return attemptCtx, cancel, func() { timer.Stop() }, fired.Load
+}
+
+// order returns provider indexes in the order they should be tried
+func (r *Router) order() []int {
+	order := make([]int, len(r.providers))
+	for i := range order {
+		order[i] = i
+	}
+
+	switch r.strategy {
+	case RoutingSingle:
+		return order[:1]
+
+	case RoutingCostAware:
+		costs := make([]float64, len(r.providers))
+		for i, p := range r.providers {
+			rate, ok := r.prices.Lookup(p.Name(), p.Model())
+			if !ok {
+				rate = pricing.DefaultRate
+			}
+			costs[i] = rate.Prompt + rate.Completion
+		}
+		sort.SliceStable(order, func(a, b int) bool {
+			return costs[order[a]] < costs[order[b]]
+		})
+
+	case RoutingLatencyAware:
+		// Unmeasured providers sort first so every model gets sampled
+		latency := r.latencies()
+		sort.SliceStable(order, func(a, b int) bool {
+			return latency[order[a]] < latency[order[b]]
+		})
+	}
+
+	return order
+}
+
+// observeLatency folds a latency sample into the provider's moving average
+func (r *Router) observeLatency(i int, sample time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.latency[i] == 0 {
+		r.latency[i] = sample
+		return
+	}
+	r.latency[i] = time.Duration(latencySmoothing*float64(sample) + (1-latencySmoothing)*float64(r.latency[i]))
+}
+
+func (r *Router) latencies() []time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	latency := make([]time.Duration, len(r.latency))
+	copy(latency, r.latency)
+	return latency
+}
+
+// shouldFallback reports whether an error warrants trying the next model:
+// server errors, overload, rate limits and timeouts. Client errors such as a bad
+// request or invalid key would fail the same way on every attempt.
+func (r *Router) shouldFallback(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return IsRetryable(err)
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func (r *Router) logFallback(from, to Provider, err error) {
+	r.logger.Warn("Model request failed, falling back",
+		"strategy", r.strategy,
+		"from_provider", from.Name(),
+		"from_model", from.Model(),
+		"to_provider", to.Name(),
+		"to_model", to.Model(),
+		"error", err,
+	)
+}
+
+// drain discards the rest of an abandoned stream so its producer can exit
+func drain(stream <-chan StreamEvent) {
+	for range stream {
+	}
+}
@@ -0,0 +1,221 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shankarg87/agent/internal/config"
+	"github.com/shankarg87/agent/internal/pricing"
+)
+
+// fakeProvider is a scripted Provider for router tests
+type fakeProvider struct {
+	name  string
+	model string
+	err   error
+	delay time.Duration
+	calls int32
+}
+
+func (f *fakeProvider) Name() string  { return f.name }
+func (f *fakeProvider) Model() string { return f.model }
+
+func (f *fakeProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	atomic.AddInt32(&f.calls, 1)
+	select {
+	case <-time.After(f.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &ChatResponse{Content: "from " + f.model, FinishReason: "stop"}, nil
+}
+
+func (f *fakeProvider) Stream(ctx context.Context, req *ChatRequest) (<-chan StreamEvent, error) {
+	atomic.AddInt32(&f.calls, 1)
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	ch := make(chan StreamEvent, 2)
+	go func() {
+		defer close(ch)
+		select {
+		case <-time.After(f.delay):
+		case <-ctx.Done():
+			ch <- StreamEvent{Type: "error", Error: ctx.Err()}
+			return
+		}
+		ch <- StreamEvent{Type: "content_delta", Content: "from " + f.model}
+		ch <- StreamEvent{Type: "done", Done: true, FinishReason: "stop"}
+	}()
+	return ch, nil
+}
+
+func collect(t *testing.T, stream <-chan StreamEvent) *ChatResponse {
+	t.Helper()
+	acc := NewStreamAccumulator()
+	for event := range stream {
+		acc.Add(event)
+	}
+	return acc.Response()
+}
+
+func TestRouter_FallbackOnServerError(t *testing.T) {
+	primary := &fakeProvider{name: "anthropic", model: "claude", err: &APIError{StatusCode: 529, Body: "overloaded"}}
+	backup := &fakeProvider{name: "openai", model: "gpt-4o"}
+
+	router, err := NewRouter(RoutingFallback, []Provider{primary, backup}, RouterOptions{})
+	assertNoError(t, err)
+
+	resp, err := router.Chat(context.Background(), &ChatRequest{})
+	assertNoError(t, err)
+	assertEqual(t, "from gpt-4o", resp.Content)
+	assertEqual(t, "openai", resp.Provider)
+	assertEqual(t, "gpt-4o", resp.Model)
+
+	stream, err := router.Stream(context.Background(), &ChatRequest{})
+	assertNoError(t, err)
+	resp = collect(t, stream)
+	assertEqual(t, "from gpt-4o", resp.Content)
+	assertEqual(t, "openai", resp.Provider)
+	assertEqual(t, "gpt-4o", resp.Model)
+}
+
+func TestRouter_FallbackOnRateLimit(t *testing.T) {
+	primary := &fakeProvider{name: "openai", model: "gpt-4o", err: &APIError{StatusCode: 429, Body: "slow down"}}
+	backup := &fakeProvider{name: "openai", model: "gpt-4o-mini"}
+
+	router, err := NewRouter(RoutingFallback, []Provider{primary, backup}, RouterOptions{})
+	assertNoError(t, err)
+
+	resp, err := router.Chat(context.Background(), &ChatRequest{})
+	assertNoError(t, err)
+	assertEqual(t, "gpt-4o-mini", resp.Model)
+}
+
+func TestRouter_NoFallbackOnClientError(t *testing.T) {
+	primary := &fakeProvider{name: "openai", model: "gpt-4o", err: &APIError{StatusCode: 400, Body: "bad request"}}
+	backup := &fakeProvider{name: "openai", model: "gpt-4o-mini"}
+
+	router, err := NewRouter(RoutingFallback, []Provider{primary, backup}, RouterOptions{})
+	assertNoError(t, err)
+
+	_, err = router.Chat(context.Background(), &ChatRequest{})
+	assertError(t, err)
+
+	var apiErr *APIError
+	assertEqual(t, true, errors.As(err, &apiErr))
+	assertEqual(t, 400, apiErr.StatusCode)
+	assertEqual(t, "API error (status 400): bad request", err.Error())
+	assertEqual(t, int32(0), atomic.LoadInt32(&backup.calls))
+}
+
+func TestRouter_FallbackOnTimeout(t *testing.T) {
+	primary := &fakeProvider{name: "openai", model: "slow", delay: time.Second}
+	backup := &fakeProvider{name: "openai", model: "fast"}
+
+	router, err := NewRouter(RoutingFallback, []Provider{primary, backup}, RouterOptions{Timeout: 20 * time.Millisecond})
+	assertNoError(t, err)
+
+	resp, err := router.Chat(context.Background(), &ChatRequest{})
+	assertNoError(t, err)
+	assertEqual(t, "fast", resp.Model)
+
+	stream, err := router.Stream(context.Background(), &ChatRequest{})
+	assertNoError(t, err)
+	assertEqual(t, "fast", collect(t, stream).Model)
+}
+
+func TestRouter_TimeoutCoversOnlyFirstResponseByte(t *testing.T) {
+	// The model answers at once but takes longer than the timeout to finish
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"slow body"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	primary, err := NewOpenAIProvider(config.ModelConfig{Model: "gpt-4o", APIKey: "test", Endpoint: server.URL})
+	assertNoError(t, err)
+	backup := &fakeProvider{name: "openai", model: "backup"}
+
+	router, err := NewRouter(RoutingFallback, []Provider{primary, backup}, RouterOptions{Timeout: 20 * time.Millisecond})
+	assertNoError(t, err)
+
+	resp, err := router.Chat(context.Background(), &ChatRequest{})
+	assertNoError(t, err)
+	assertEqual(t, "slow body", resp.Content)
+	assertEqual(t, int32(0), atomic.LoadInt32(&backup.calls))
+}
+
+func TestRouter_AllProvidersFail(t *testing.T) {
+	primary := &fakeProvider{name: "openai", model: "a", err: &APIError{StatusCode: 500, Body: "boom"}}
+	backup := &fakeProvider{name: "openai", model: "b", err: &APIError{StatusCode: 503, Body: "unavailable"}}
+
+	router, err := NewRouter(RoutingFallback, []Provider{primary, backup}, RouterOptions{})
+	assertNoError(t, err)
+
+	_, err = router.Stream(context.Background(), &ChatRequest{})
+	assertError(t, err)
+	assertEqual(t, "API error (status 503): unavailable", err.Error())
+}
+
+func TestRouter_CostAwarePrefersCheapestModel(t *testing.T) {
+	expensive := &fakeProvider{name: "openai", model: "gpt-4"}
+	cheap := &fakeProvider{name: "openai", model: "gpt-4o-mini"}
+
+	router, err := NewRouter(RoutingCostAware, []Provider{expensive, cheap}, RouterOptions{Prices: pricing.NewTable(nil)})
+	assertNoError(t, err)
+
+	resp, err := router.Chat(context.Background(), &ChatRequest{})
+	assertNoError(t, err)
+	assertEqual(t, "gpt-4o-mini", resp.Model)
+	assertEqual(t, int32(0), atomic.LoadInt32(&expensive.calls))
+}
+
+func TestRouter_LatencyAwarePrefersFastestModel(t *testing.T) {
+	slow := &fakeProvider{name: "openai", model: "slow", delay: 30 * time.Millisecond}
+	fast := &fakeProvider{name: "openai", model: "fast", delay: time.Millisecond}
+
+	router, err := NewRouter(RoutingLatencyAware, []Provider{slow, fast}, RouterOptions{})
+	assertNoError(t, err)
+
+	// Unmeasured models are sampled first
+	resp, err := router.Chat(context.Background(), &ChatRequest{})
+	assertNoError(t, err)
+	assertEqual(t, "slow", resp.Model)
+	resp, err = router.Chat(context.Background(), &ChatRequest{})
+	assertNoError(t, err)
+	assertEqual(t, "fast", resp.Model)
+
+	// Once both are measured the faster model wins
+	for i := 0; i < 3; i++ {
+		resp, err = router.Chat(context.Background(), &ChatRequest{})
+		assertNoError(t, err)
+		assertEqual(t, "fast", resp.Model)
+	}
+	assertEqual(t, int32(1), atomic.LoadInt32(&slow.calls))
+}
+
+func TestNewRouter_Validation(t *testing.T) {
+	_, err := NewRouter(RoutingFallback, nil, RouterOptions{})
+	assertError(t, err)
+
+	_, err = NewRouter("round_robin", []Provider{&fakeProvider{}}, RouterOptions{})
+	assertError(t, err)
+
+	router, err := NewRouter(RoutingSingle, []Provider{&fakeProvider{name: "openai", model: "gpt-4o"}}, RouterOptions{})
+	assertNoError(t, err)
+	assertEqual(t, "openai", router.Name())
+	assertEqual(t, "gpt-4o", router.Model())
+}
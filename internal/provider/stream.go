@@ -0,0 +1,110 @@
+package provider
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// StreamAccumulator assembles StreamEvents into a complete ChatResponse.
+// Tool calls arrive in fragments (an ID and name first, then argument
+// chunks) and are grouped by their stream index.
+type StreamAccumulator struct {
+	content      strings.Builder
+	toolCalls    map[int]*ToolCall
+	finishReason string
+	usage        Usage
+	provider     string
+	model        string
+}
+
+// NewStreamAccumulator creates an empty accumulator
+func NewStreamAccumulator() *StreamAccumulator {
+	return &StreamAccumulator{
+		toolCalls: make(map[int]*ToolCall),
+	}
+}
+
+// Add merges a single stream event into the accumulated response
+func (a *StreamAccumulator) Add(event StreamEvent) {
+	switch event.Type {
+	case "content_delta":
+		a.content.WriteString(event.Content)
+	case "tool_call":
+		if event.ToolCall == nil {
+			return
+		}
+		tc, ok := a.toolCalls[event.Index]
+		if !ok {
+			tc = &ToolCall{Type: "function"}
+			a.toolCalls[event.Index] = tc
+		}
+		if event.ToolCall.ID != "" {
+			tc.ID = event.ToolCall.ID
+		}
+		if event.ToolCall.Type != "" {
+			tc.Type = event.ToolCall.Type
+		}
+		tc.Function.Name += event.ToolCall.Function.Name
+		tc.Function.Arguments += event.ToolCall.Function.Arguments
+	}
+
+	if event.FinishReason != "" {
+		a.finishReason = event.FinishReason
+	}
+	if event.Usage != nil {
+		a.usage = *event.Usage
+	}
+	if event.Provider != "" {
+		a.provider = event.Provider
+		a.model = event.Model
+	}
+}
+
+// Response returns the assembled chat response
+func (a *StreamAccumulator) Response() *ChatResponse {
+	resp := &ChatResponse{
+		Content:      a.content.String(),
+		Role:         "assistant",
+		FinishReason: a.finishReason,
+		Usage:        a.usage,
+		Provider:     a.provider,
+		Model:        a.model,
+	}
+
+	indexes := make([]int, 0, len(a.toolCalls))
+	for i := range a.toolCalls {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	for _, i := range indexes {
+		tc := *a.toolCalls[i]
+		if tc.Function.Arguments == "" {
+			tc.Function.Arguments = "{}"
+		}
+		resp.ToolCalls = append(resp.ToolCalls, tc)
+	}
+
+	if resp.FinishReason == "" {
+		if len(resp.ToolCalls) > 0 {
+			resp.FinishReason = "tool_calls"
+		} else {
+			resp.FinishReason = "stop"
+		}
+	}
+
+	return resp
+}
+
+// sendEvent delivers an event unless ctx is done first, so a provider's
+// stream goroutine exits (and closes its response body) once the reader
+// has gone away. It reports whether the event was sent.
+func sendEvent(ctx context.Context, events chan<- StreamEvent, event StreamEvent) bool {
+	select {
+	case events <- event:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
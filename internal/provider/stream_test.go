@@ -0,0 +1,170 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shankarg87/agent/internal/config"
+)
+
+func TestStreamAccumulator_ContentAndToolCalls(t *testing.T) {
+	acc := NewStreamAccumulator()
+
+	events := []StreamEvent{
+		{Type: "content_delta", Content: "Let me "},
+		{Type: "content_delta", Content: "check."},
+		{Type: "tool_call", Index: 1, ToolCall: &ToolCall{ID: "call_b", Type: "function", Function: FunctionCall{Name: "uppercase"}}},
+		{Type: "tool_call", Index: 0, ToolCall: &ToolCall{ID: "call_a", Type: "function", Function: FunctionCall{Name: "echo"}}},
+		{Type: "tool_call", Index: 0, ToolCall: &ToolCall{Function: FunctionCall{Arguments: `{"message":`}}},
+		{Type: "tool_call", Index: 0, ToolCall: &ToolCall{Function: FunctionCall{Arguments: `"hi"}`}}},
+		{Type: "done", Done: true, FinishReason: "tool_calls"},
+		{Type: "done", Done: true, Usage: &Usage{PromptTokens: 12, CompletionTokens: 8, TotalTokens: 20}},
+	}
+	for _, e := range events {
+		acc.Add(e)
+	}
+
+	resp := acc.Response()
+	assertEqual(t, "Let me check.", resp.Content)
+	assertEqual(t, "tool_calls", resp.FinishReason)
+	assertEqual(t, 20, resp.Usage.TotalTokens)
+	assertEqual(t, 2, len(resp.ToolCalls))
+	assertEqual(t, "call_a", resp.ToolCalls[0].ID)
+	assertEqual(t, "echo", resp.ToolCalls[0].Function.Name)
+	assertEqual(t, `{"message":"hi"}`, resp.ToolCalls[0].Function.Arguments)
+	assertEqual(t, "call_b", resp.ToolCalls[1].ID)
+	assertEqual(t, "{}", resp.ToolCalls[1].Function.Arguments)
+}
+
+func TestStreamAccumulator_DefaultFinishReason(t *testing.T) {
+	acc := NewStreamAccumulator()
+	acc.Add(StreamEvent{Type: "content_delta", Content: "Hello"})
+
+	resp := acc.Response()
+	assertEqual(t, "stop", resp.FinishReason)
+	assertEqual(t, 0, len(resp.ToolCalls))
+}
+
+func TestOpenAIProvider_Stream_ToolCalls(t *testing.T) {
+	chunks := []string{
+		`{"choices":[{"index":0,"delta":{"role":"assistant","content":"Hi"}}]}`,
+		`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"echo","arguments":""}}]}}]}`,
+		`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"message\":\"hi\"}"}}]}}]}`,
+		`{"choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+		`{"choices":[],"usage":{"prompt_tokens":5,"completion_tokens":7,"total_tokens":12}}`,
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, c := range chunks {
+			fmt.Fprintf(w, "data: %s\n\n", c)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	p, err := NewOpenAIProvider(config.ModelConfig{Model: "gpt-4", APIKey: "test-key", Endpoint: server.URL})
+	assertNoError(t, err)
+
+	stream, err := p.Stream(context.Background(), &ChatRequest{Messages: []Message{{Role: "user", Content: "Hi"}}})
+	assertNoError(t, err)
+
+	acc := NewStreamAccumulator()
+	for event := range stream {
+		acc.Add(event)
+	}
+
+	resp := acc.Response()
+	assertEqual(t, "Hi", resp.Content)
+	assertEqual(t, "tool_calls", resp.FinishReason)
+	assertEqual(t, 12, resp.Usage.TotalTokens)
+	assertEqual(t, 1, len(resp.ToolCalls))
+	assertEqual(t, "call_1", resp.ToolCalls[0].ID)
+	assertEqual(t, "echo", resp.ToolCalls[0].Function.Name)
+	assertEqual(t, `{"message":"hi"}`, resp.ToolCalls[0].Function.Arguments)
+}
+
+func TestOpenAIProvider_Stream_StopsWhenReaderGoesAway(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		// More chunks than the event channel buffers
+		for range 50 {
+			fmt.Fprint(w, `data: {"choices":[{"index":0,"delta":{"content":"x"}}]}`+"\n\n")
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	p, err := NewOpenAIProvider(config.ModelConfig{Model: "gpt-4", APIKey: "test-key", Endpoint: server.URL})
+	assertNoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := p.Stream(ctx, &ChatRequest{Messages: []Message{{Role: "user", Content: "Hi"}}})
+	assertNoError(t, err)
+
+	// Read one event, then stop reading as the runtime does on cancellation
+	<-stream
+	cancel()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for streamGoroutineRunning() {
+		if time.Now().After(deadline) {
+			t.Fatal("Stream goroutine still blocked after the reader went away")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// streamGoroutineRunning reports whether an OpenAI stream goroutine is alive
+func streamGoroutineRunning() bool {
+	buf := make([]byte, 1<<20)
+	n := runtime.Stack(buf, true)
+	return strings.Contains(string(buf[:n]), "(*OpenAIProvider).Stream.func")
+}
+
+func TestAnthropicProvider_Stream_ToolCalls(t *testing.T) {
+	chunks := []string{
+		`{"type":"message_start","message":{"id":"msg_1","role":"assistant","usage":{"input_tokens":9,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Sure"}}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"echo","input":{}}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"message\":"}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"hi\"}"}}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":15}}`,
+		`{"type":"message_stop"}`,
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, c := range chunks {
+			fmt.Fprintf(w, "event: x\ndata: %s\n\n", c)
+		}
+	}))
+	defer server.Close()
+
+	p, err := NewAnthropicProvider(config.ModelConfig{Model: "claude", APIKey: "test-key", Endpoint: server.URL})
+	assertNoError(t, err)
+
+	stream, err := p.Stream(context.Background(), &ChatRequest{Messages: []Message{{Role: "user", Content: "Hi"}}})
+	assertNoError(t, err)
+
+	acc := NewStreamAccumulator()
+	for event := range stream {
+		acc.Add(event)
+	}
+
+	resp := acc.Response()
+	assertEqual(t, "Sure", resp.Content)
+	assertEqual(t, "tool_use", resp.FinishReason)
+	assertEqual(t, 9, resp.Usage.PromptTokens)
+	assertEqual(t, 24, resp.Usage.TotalTokens)
+	assertEqual(t, 1, len(resp.ToolCalls))
+	assertEqual(t, "toolu_1", resp.ToolCalls[0].ID)
+	assertEqual(t, `{"message":"hi"}`, resp.ToolCalls[0].Function.Arguments)
+}
@@ -2,17 +2,27 @@ package runtime
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/shankarg87/agent/internal/compaction"
 	"github.com/shankarg87/agent/internal/config"
 	"github.com/shankarg87/agent/internal/events"
 	"github.com/shankarg87/agent/internal/logging"
 	"github.com/shankarg87/agent/internal/mcp"
 	"github.com/shankarg87/agent/internal/metrics"
+	"github.com/shankarg87/agent/internal/pricing"
 	"github.com/shankarg87/agent/internal/provider"
 	"github.com/shankarg87/agent/internal/store"
 )
@@ -21,15 +31,27 @@ import (
 type Runtime struct {
 	configManager *config.ConfigManager
 	store         store.Store
-	eventBus      *events.EventBus
+	eventBus      events.EventBus
 	provider      provider.Provider
 	mcpRegistry   *mcp.Registry
 	metrics       *metrics.AgentMetrics
 	logger        *logging.SimpleLogger
 
+	// Names this replica in the leases it holds on the runs it executes
+	replicaID string
+
 	mu            sync.RWMutex
 	activeRuns    map[string]*RunContext
 	cancellations map[string]context.CancelFunc
+
+	// Semaphores enforcing ToolConfig.ConcurrencyLimit, one per server and
+	// limit so that runs on different config snapshots each keep their own
+	limiterMu    sync.Mutex
+	toolLimiters map[toolLimiterKey]chan struct{}
+
+	// Striped by run so that each run's events are stored and published in
+	// sequence order
+	eventLocks [32]sync.Mutex
 }
 
 // RunContext holds the execution context for a single run
@@ -41,19 +63,27 @@ type RunContext struct {
 	Cancel        context.CancelFunc
 	ToolCallCount int
 	FailureCount  int
+	BudgetUSD     float64 // Current cost limit; 0 means unlimited. Extended when an operator approves more spend
+	Pricing       *pricing.Table
+
+	// Prompt tokens the provider reported for the last model request, which
+	// carried the first promptMessages messages; compaction counts from them
+	promptTokens   int
+	promptMessages int
 
 	// Pause/resume state
-	mu           sync.RWMutex
-	isPaused     bool
-	pauseSignal  chan struct{}
-	resumeSignal chan struct{}
+	mu             sync.RWMutex
+	isPaused       bool
+	checkpointType string // tool_approval or budget_exceeded while paused at a checkpoint
+	pauseSignal    chan struct{}
+	resumeSignal   chan struct{}
 }
 
 // NewRuntime creates a new runtime instance
 func NewRuntime(
 	configManager *config.ConfigManager,
 	st store.Store,
-	eb *events.EventBus,
+	eb events.EventBus,
 	prov provider.Provider,
 	mcpReg *mcp.Registry,
 	met *metrics.AgentMetrics,
@@ -69,8 +99,27 @@ func NewRuntime(
 		mcpRegistry:   mcpReg,
 		metrics:       met,
 		logger:        logger,
+		replicaID:     defaultReplicaID(),
 		activeRuns:    make(map[string]*RunContext),
 		cancellations: make(map[string]context.CancelFunc),
+		toolLimiters:  make(map[toolLimiterKey]chan struct{}),
+	}
+}
+
+// defaultReplicaID names a replica after its host, so a restarted process
+// takes back its own runs without waiting for their leases to expire
+func defaultReplicaID() string {
+	if host, err := os.Hostname(); err == nil && host != "" {
+		return host
+	}
+	return uuid.New().String()
+}
+
+// SetReplicaID sets the name this replica holds run leases under. Replicas
+// sharing a store must have different IDs.
+func (r *Runtime) SetReplicaID(id string) {
+	if id != "" {
+		r.replicaID = id
 	}
 }
 
@@ -98,6 +147,7 @@ func (r *Runtime) CreateRun(ctx context.Context, req *CreateRunRequest) (*store.
 
 	// Get or create session
 	var session *store.Session
+	newSession := false
 	if req.SessionID != "" {
 		r.logger.Verbose("Getting existing session", "session_id", req.SessionID)
 		s, err := r.store.GetSession(ctx, req.SessionID)
@@ -111,22 +161,15 @@ func (r *Runtime) CreateRun(ctx context.Context, req *CreateRunRequest) (*store.
 		session = s
 		r.logger.Verbose("Existing session retrieved", "session_id", session.ID)
 	} else {
-		r.logger.Verbose("Creating new session")
 		session = &store.Session{
 			ID:          uuid.New().String(),
 			TenantID:    req.TenantID,
 			ProfileName: currentConfig.ProfileName,
 			Metadata:    req.Metadata,
 		}
-		if err := r.store.CreateSession(ctx, session); err != nil {
-			r.logger.Error("Failed to create session", "error", err)
-			return nil, fmt.Errorf("failed to create session: %w", err)
-		}
-		r.logger.Verbose("New session created", "session_id", session.ID)
+		newSession = true
 	}
 
-	// Create run
-	r.logger.Verbose("Creating new run")
 	run := &store.Run{
 		ID:        uuid.New().String(),
 		SessionID: session.ID,
@@ -137,9 +180,81 @@ func (r *Runtime) CreateRun(ctx context.Context, req *CreateRunRequest) (*store.
 		Metadata:  req.Metadata,
 	}
 
-	if err := r.store.CreateRun(ctx, run); err != nil {
-		r.logger.Error("Failed to create run", "run_id", run.ID, "error", err)
-		return nil, fmt.Errorf("failed to create run: %w", err)
+	// The first request with an idempotency key claims it for the new run
+	var idempotencyKey *store.IdempotencyKey
+	if req.IdempotencyKey != "" && currentConfig.IdempotencyKeys {
+		ttl := currentConfig.IdempotencyKeyTTL
+		if ttl <= 0 {
+			ttl = config.DefaultIdempotencyKeyTTL
+		}
+		idempotencyKey = &store.IdempotencyKey{
+			TenantID:    req.TenantID,
+			Key:         req.IdempotencyKey,
+			RequestHash: req.hash(),
+			RunID:       run.ID,
+			ExpiresAt:   time.Now().Add(ttl),
+		}
+	}
+
+	// The session, run and input message are written together so a failure
+	// can't leave a run without its input
+	keyTaken := false
+	err := store.WithTx(ctx, r.store, func(tx store.Store) error {
+		if newSession {
+			r.logger.Verbose("Creating new session")
+			if err := tx.CreateSession(ctx, session); err != nil {
+				r.logger.Error("Failed to create session", "error", err)
+				return fmt.Errorf("failed to create session: %w", err)
+			}
+			r.logger.Verbose("New session created", "session_id", session.ID)
+		}
+
+		r.logger.Verbose("Creating new run")
+		if err := tx.CreateRun(ctx, run); err != nil {
+			r.logger.Error("Failed to create run", "run_id", run.ID, "error", err)
+			return fmt.Errorf("failed to create run: %w", err)
+		}
+
+		// The key is claimed once its run exists, so a retry that finds the
+		// key also finds the run
+		if idempotencyKey != nil {
+			err := tx.CreateIdempotencyKey(ctx, idempotencyKey)
+			keyTaken = errors.Is(err, store.ErrAlreadyExists)
+			if err != nil {
+				return fmt.Errorf("failed to claim idempotency key: %w", err)
+			}
+		}
+
+		// This replica executes the run, so other replicas' ResumeRuns
+		// leave it alone
+		if err := tx.ClaimRun(ctx, run.ID, r.replicaID, time.Now().Add(RunLeaseDuration)); err != nil {
+			return fmt.Errorf("failed to claim run: %w", err)
+		}
+
+		// Add user message if input provided
+		if req.Input != "" {
+			r.logger.Verbose("Adding user message", "run_id", run.ID, "input_length", len(req.Input))
+			msg := &store.Message{
+				Role:      "user",
+				Content:   req.Input,
+				SessionID: session.ID,
+			}
+			if err := tx.AddMessage(ctx, session.ID, msg); err != nil {
+				r.logger.Error("Failed to add message", "run_id", run.ID, "error", err)
+				return fmt.Errorf("failed to add message: %w", err)
+			}
+			r.logger.Verbose("User message added", "run_id", run.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		r.discardRun(ctx, run, newSession)
+	}
+	if keyTaken {
+		return r.replayRun(ctx, idempotencyKey)
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	r.logger.Info("Run created",
@@ -149,24 +264,9 @@ func (r *Runtime) CreateRun(ctx context.Context, req *CreateRunRequest) (*store.
 		"mode", req.Mode,
 	)
 
-	// Add user message if input provided
-	if req.Input != "" {
-		r.logger.Verbose("Adding user message", "run_id", run.ID, "input_length", len(req.Input))
-		msg := &store.Message{
-			Role:      "user",
-			Content:   req.Input,
-			SessionID: session.ID,
-		}
-		if err := r.store.AddMessage(ctx, session.ID, msg); err != nil {
-			r.logger.Error("Failed to add message", "run_id", run.ID, "error", err)
-			return nil, fmt.Errorf("failed to add message: %w", err)
-		}
-		r.logger.Verbose("User message added", "run_id", run.ID)
-	}
-
 	// Start execution
 	r.logger.Verbose("Starting run execution", "run_id", run.ID)
-	go r.executeRun(context.Background(), run.ID)
+	go r.executeRun(context.Background(), run.ID, false)
 
 	r.logger.LogPerformance("create_run", time.Since(start), map[string]interface{}{
 		"run_id": run.ID,
@@ -176,6 +276,55 @@ func (r *Runtime) CreateRun(ctx context.Context, req *CreateRunRequest) (*store.
 	return run, nil
 }
 
+// discardRun removes what a failed CreateRun wrote to a store without
+// transactions, including the idempotency key it claimed for the run
+func (r *Runtime) discardRun(ctx context.Context, run *store.Run, newSession bool) {
+	if _, ok := r.store.(store.Transactor); ok {
+		return
+	}
+
+	var err error
+	if newSession {
+		err = r.store.DeleteSession(ctx, run.SessionID)
+	} else {
+		err = r.store.DeleteRun(ctx, run.ID)
+	}
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		r.logger.Error("Failed to discard run", "run_id", run.ID, "error", err)
+	}
+}
+
+// ErrIdempotencyKeyConflict is returned by CreateRun when an idempotency key
+// is reused for a different request
+var ErrIdempotencyKeyConflict = errors.New("idempotency key was already used for a different request")
+
+// replayRun returns the run created by the first request with an idempotency
+// key that has already been claimed
+func (r *Runtime) replayRun(ctx context.Context, key *store.IdempotencyKey) (*store.Run, error) {
+	existing, err := r.store.GetIdempotencyKey(ctx, key.TenantID, key.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get idempotency key: %w", err)
+	}
+	if existing.RequestHash != key.RequestHash {
+		r.logger.Warn("Idempotency key reused for a different request",
+			"tenant_id", key.TenantID,
+			"run_id", existing.RunID,
+		)
+		return nil, ErrIdempotencyKeyConflict
+	}
+
+	run, err := r.store.GetRun(ctx, existing.RunID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get run for idempotency key: %w", err)
+	}
+
+	r.logger.Info("Returning existing run for idempotency key",
+		"run_id", run.ID,
+		"tenant_id", key.TenantID,
+	)
+	return run, nil
+}
+
 // GetRun retrieves a run by ID
 func (r *Runtime) GetRun(ctx context.Context, runID string) (*store.Run, error) {
 	r.logger.Verbose("Getting run", "run_id", runID)
@@ -212,18 +361,14 @@ func (r *Runtime) CancelRun(ctx context.Context, runID string) error {
 	cancel()
 
 	// Update run status
-	run, err := r.store.GetRun(ctx, runID)
+	_, err := r.updateRun(ctx, runID, func(run *store.Run) error {
+		r.logger.LogStateTransition(runID, string(run.Status), string(store.RunStateCancelled), "user_cancellation")
+		run.Status = store.RunStateCancelled
+		now := time.Now()
+		run.EndedAt = &now
+		return nil
+	})
 	if err != nil {
-		r.logger.Error("Failed to get run for cancellation", "run_id", runID, "error", err)
-		return err
-	}
-
-	r.logger.LogStateTransition(runID, string(run.Status), string(store.RunStateCancelled), "user_cancellation")
-	run.Status = store.RunStateCancelled
-	now := time.Now()
-	run.EndedAt = &now
-
-	if err := r.store.UpdateRun(ctx, run); err != nil {
 		r.logger.Error("Failed to update run status after cancellation", "run_id", runID, "error", err)
 		return err
 	}
@@ -254,22 +399,19 @@ func (r *Runtime) PauseRun(ctx context.Context, runID string) error {
 	}
 
 	// Update run status
-	run, err := r.store.GetRun(ctx, runID)
+	_, err := r.updateRun(ctx, runID, func(run *store.Run) error {
+		if run.Status != store.RunStateRunning {
+			return fmt.Errorf("run is not in running state, current status: %s", run.Status)
+		}
+		run.Status = store.RunStatePaused
+		return nil
+	})
 	if err != nil {
 		return err
 	}
 
-	if run.Status != store.RunStateRunning {
-		return fmt.Errorf("run is not in running state, current status: %s", run.Status)
-	}
-
-	run.Status = store.RunStatePaused
-	if err := r.store.UpdateRun(ctx, run); err != nil {
-		return err
-	}
-
+	// runCtx.Run is left to the agent loop goroutine, which owns it
 	runCtx.isPaused = true
-	runCtx.Run = run
 
 	// Signal pause to the agent loop
 	select {
@@ -305,22 +447,18 @@ func (r *Runtime) ResumeRun(ctx context.Context, runID string) error {
 	}
 
 	// Update run status
-	run, err := r.store.GetRun(ctx, runID)
+	_, err := r.updateRun(ctx, runID, func(run *store.Run) error {
+		if run.Status != store.RunStatePaused {
+			return fmt.Errorf("run is not in paused state, current status: %s", run.Status)
+		}
+		run.Status = store.RunStateRunning
+		return nil
+	})
 	if err != nil {
 		return err
 	}
 
-	if run.Status != store.RunStatePaused {
-		return fmt.Errorf("run is not in paused state, current status: %s", run.Status)
-	}
-
-	run.Status = store.RunStateRunning
-	if err := r.store.UpdateRun(ctx, run); err != nil {
-		return err
-	}
-
 	runCtx.isPaused = false
-	runCtx.Run = run
 
 	// Signal resume to the agent loop
 	select {
@@ -360,25 +498,33 @@ func (r *Runtime) ApproveToolCall(ctx context.Context, runID string, approved bo
 		return fmt.Errorf("run is not paused for approval, current status: %s", runCtx.Run.Status)
 	}
 
+	budgetCheckpoint := runCtx.checkpointType == CheckpointTypeBudgetExceeded
+
 	if !approved {
-		// User denied the tool execution - cancel the run
-		r.logger.Info("Tool execution denied by user",
+		// User denied the tool execution (or extra spend) - cancel the run
+		r.logger.Info("Checkpoint denied by user",
 			"run_id", runID,
+			"checkpoint_type", runCtx.checkpointType,
 			"reason", reason,
 		)
 
+		denialReason := "tool_execution_denied"
 		runCtx.Run.Status = store.RunStateCancelled
 		runCtx.Run.Error = fmt.Sprintf("Tool execution denied by user: %s", reason)
+		if budgetCheckpoint {
+			denialReason = "budget_extension_denied"
+			runCtx.Run.Error = fmt.Sprintf("Budget extension denied by user: %s", reason)
+		}
 		now := time.Now()
 		runCtx.Run.EndedAt = &now
 
-		if err := r.store.UpdateRun(ctx, runCtx.Run); err != nil {
+		if err := r.saveRun(ctx, r.store, runCtx.Run); err != nil {
 			return err
 		}
 
 		// Emit cancellation event
 		r.publishEvent(runID, store.EventTypeRunCancelled, map[string]any{
-			"reason":      "tool_execution_denied",
+			"reason":      denialReason,
 			"user_reason": reason,
 		})
 
@@ -392,14 +538,20 @@ func (r *Runtime) ApproveToolCall(ctx context.Context, runID string, approved bo
 	}
 
 	// User approved - resume execution
-	r.logger.Info("Tool execution approved by user",
+	r.logger.Info("Checkpoint approved by user",
 		"run_id", runID,
+		"checkpoint_type", runCtx.checkpointType,
 		"reason", reason,
 	)
 
+	approvalReason := "tool_approved"
+	if budgetCheckpoint {
+		approvalReason = "budget_approved"
+	}
+
 	// Emit approval event
 	r.publishEvent(runID, store.EventTypeRunResumed, map[string]any{
-		"reason":      "tool_approved",
+		"reason":      approvalReason,
 		"user_reason": reason,
 	})
 
@@ -416,16 +568,142 @@ func (r *Runtime) ApproveToolCall(ctx context.Context, runID string, approved bo
 	return nil
 }
 
-// executeRun is the main execution loop for a run
-func (r *Runtime) executeRun(parentCtx context.Context, runID string) {
-	ctx, cancel := context.WithCancel(parentCtx)
+// RunLeaseDuration is how long a replica's claim on a run lasts. Replicas
+// renew the leases of the runs they execute well before they expire; a run
+// whose lease expires has been abandoned and may be resumed elsewhere.
+const RunLeaseDuration = 30 * time.Second
+
+// errLeaseLost stops a run that another replica has taken over
+var errLeaseLost = errors.New("run lease taken over by another replica")
+
+// ResumeRuns restarts runs left queued, running or paused by a previous
+// daemon process, or by another replica that stopped renewing its lease on
+// them. Each run is claimed first, so when several replicas share a store
+// only one of them resumes it.
+func (r *Runtime) ResumeRuns(ctx context.Context) error {
+	runs, err := r.store.ListRunsByStatus(ctx,
+		store.RunStateQueued,
+		store.RunStateRunning,
+		store.RunStatePaused,
+		store.RunStatePausedCheckpoint,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to list interrupted runs: %w", err)
+	}
+
+	resumed := 0
+	for _, run := range runs {
+		if r.isExecuting(run.ID) {
+			continue
+		}
+		if err := r.claimRun(ctx, run.ID); err != nil {
+			if !errors.Is(err, store.ErrConflict) {
+				r.logger.Warn("Failed to claim interrupted run", "run_id", run.ID, "error", err)
+			}
+			continue
+		}
+
+		r.logger.Info("Resuming interrupted run",
+			"run_id", run.ID,
+			"session_id", run.SessionID,
+			"status", run.Status,
+		)
+		// A queued run never started, so it starts from the beginning
+		go r.executeRun(context.Background(), run.ID, run.Status != store.RunStateQueued)
+		resumed++
+	}
+
+	if resumed > 0 {
+		r.logger.Info("Interrupted runs resumed", "count", resumed)
+	}
+	return nil
+}
+
+// WatchInterruptedRuns calls ResumeRuns every RunLeaseDuration until ctx is
+// done, taking over the runs of replicas that have stopped
+func (r *Runtime) WatchInterruptedRuns(ctx context.Context) {
+	ticker := time.NewTicker(RunLeaseDuration)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.ResumeRuns(ctx); err != nil {
+				r.logger.Warn("Failed to resume interrupted runs", "error", err)
+			}
+		}
+	}
+}
+
+// claimRun takes or renews this replica's lease on a run
+func (r *Runtime) claimRun(ctx context.Context, runID string) error {
+	return r.store.ClaimRun(ctx, runID, r.replicaID, time.Now().Add(RunLeaseDuration))
+}
+
+// isExecuting reports whether this replica is executing a run
+func (r *Runtime) isExecuting(runID string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.cancellations[runID]
+	return ok
+}
+
+// holdLease renews this replica's lease on a run until ctx is done. If
+// another replica took the run over, because renewals failed for longer than
+// the lease, stop cancels execution here with errLeaseLost.
+func (r *Runtime) holdLease(ctx context.Context, runID string, stop context.CancelCauseFunc) {
+	ticker := time.NewTicker(RunLeaseDuration / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := r.claimRun(ctx, runID)
+		switch {
+		case err == nil:
+		case errors.Is(err, store.ErrConflict) && ctx.Err() == nil:
+			r.logger.Error("Run taken over by another replica, stopping it here", "run_id", runID)
+			stop(errLeaseLost)
+			return
+		case ctx.Err() == nil:
+			// Keep trying; the lease outlasts a few failed renewals
+			r.logger.Warn("Failed to renew run lease", "run_id", runID, "error", err)
+		}
+	}
+}
+
+// executeRun is the main execution loop for a run. A resumed run continues
+// from where a previous daemon process left it.
+func (r *Runtime) executeRun(parentCtx context.Context, runID string, resumed bool) {
+	ctx, cancelCause := context.WithCancelCause(parentCtx)
+	cancel := func() { cancelCause(context.Canceled) }
 	defer cancel()
 
-	// Register cancellation
+	// Register cancellation, unless the run is already executing here
 	r.mu.Lock()
+	if _, ok := r.cancellations[runID]; ok {
+		r.mu.Unlock()
+		return
+	}
 	r.cancellations[runID] = cancel
 	r.mu.Unlock()
 
+	// Only the replica holding the run's lease executes it
+	if err := r.claimRun(parentCtx, runID); err != nil {
+		r.logger.Warn("Not executing run claimed by another replica", "run_id", runID, "error", err)
+		r.mu.Lock()
+		delete(r.cancellations, runID)
+		r.mu.Unlock()
+		return
+	}
+	go r.holdLease(ctx, runID, cancelCause)
+
 	defer func() {
 		r.mu.Lock()
 		delete(r.cancellations, runID)
@@ -449,6 +727,10 @@ func (r *Runtime) executeRun(parentCtx context.Context, runID string) {
 		r.failRun(parentCtx, runID, fmt.Errorf("failed to load run: %w", err))
 		return
 	}
+	if isTerminalRunState(run.Status) {
+		// Finished by another replica before this one claimed it
+		return
+	}
 
 	session, err := r.store.GetSession(parentCtx, run.SessionID)
 	if err != nil {
@@ -465,43 +747,75 @@ func (r *Runtime) executeRun(parentCtx context.Context, runID string) {
 	// Get current configuration snapshot for this execution
 	currentConfig := r.configManager.GetAgentConfig()
 
+	// A resumed run keeps the budget it had when that is above the
+	// configured limit, so extensions an operator approved survive the
+	// restart even if the limit was lowered since; they were approved for
+	// this run explicitly. A raised or unlimited limit applies as configured.
+	budget := currentConfig.MaxCostUSD
+	if resumed && budget > 0 && run.BudgetUSD > budget {
+		budget = run.BudgetUSD
+	}
+	run.BudgetUSD = budget
+
 	runCtx := &RunContext{
 		Run:          run,
 		Session:      session,
 		Messages:     messages,
 		Config:       currentConfig, // Snapshot config at run start
 		Cancel:       cancel,
+		BudgetUSD:    budget,
+		Pricing:      pricing.NewTable(currentConfig.Pricing),
 		pauseSignal:  make(chan struct{}, 1),
 		resumeSignal: make(chan struct{}, 1),
 	}
 
+	if resumed {
+		runCtx.ToolCallCount = run.ToolCallCount
+
+		// A run paused by the user stays paused until ResumeRun
+		if run.Status == store.RunStatePaused {
+			runCtx.isPaused = true
+			runCtx.pauseSignal <- struct{}{}
+		}
+	}
+
 	r.mu.Lock()
 	r.activeRuns[runID] = runCtx
 	r.mu.Unlock()
 
-	// Start execution
-	r.publishEvent(runID, store.EventTypeRunStarted, map[string]any{
-		"run_id":     runID,
-		"session_id": session.ID,
-		"mode":       run.Mode,
-	})
+	if resumed {
+		err = r.resumeAgentLoop(ctx, runCtx)
+	} else {
+		// Start execution
+		r.publishEvent(runID, store.EventTypeRunStarted, map[string]any{
+			"run_id":     runID,
+			"session_id": session.ID,
+			"mode":       run.Mode,
+		})
 
-	run.Status = store.RunStateRunning
-	now := time.Now()
-	run.StartedAt = &now
-	r.store.UpdateRun(parentCtx, run)
+		run.Status = store.RunStateRunning
+		now := time.Now()
+		run.StartedAt = &now
+		r.saveRun(parentCtx, r.store, run)
 
-	// Execute the agent loop
-	if err := r.runAgentLoop(ctx, runCtx); err != nil {
+		// Execute the agent loop
+		err = r.runAgentLoop(ctx, runCtx)
+	}
+	if errors.Is(context.Cause(ctx), errLeaseLost) {
+		// The replica that took the run over records how it ends
+		return
+	}
+	if err != nil {
 		r.failRun(parentCtx, runID, err)
 		return
 	}
 
-	// Complete the run
+	// Complete the run; recording costs replaces runCtx.Run
+	run = runCtx.Run
 	run.Status = store.RunStateCompleted
-	now = time.Now()
+	now := time.Now()
 	run.EndedAt = &now
-	r.store.UpdateRun(parentCtx, run)
+	r.saveRun(parentCtx, r.store, run)
 
 	r.publishEvent(runID, store.EventTypeRunCompleted, map[string]any{
 		"run_id":     runID,
@@ -518,33 +832,21 @@ func (r *Runtime) runAgentLoop(ctx context.Context, runCtx *RunContext) error {
 
 	for iteration < maxIterations {
 		// Check for pause signal
-		select {
-		case <-runCtx.pauseSignal:
-			// Handle pause - wait for resume signal
-			r.publishEvent(runCtx.Run.ID, store.EventTypeTextDelta, map[string]any{
-				"text": "\n[Run paused by user. Use /runs/{id}/resume to continue...]\n",
-			})
+		if err := r.waitIfPaused(ctx, runCtx); err != nil {
+			return err
+		}
 
-			// Wait for resume or context cancellation
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			case <-runCtx.resumeSignal:
-				// Continue execution
-				r.publishEvent(runCtx.Run.ID, store.EventTypeTextDelta, map[string]any{
-					"text": "\n[Run resumed by user. Continuing...]\n",
-				})
-			}
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
+		// Build tools for LLM (filtered by agent configuration)
+		tools := r.buildProviderTools(runCtx)
+
+		// Compact the history if it is nearing the context limit
+		if err := r.compactHistory(ctx, runCtx, tools); err != nil {
+			return err
 		}
 
 		// Build messages for LLM
 		providerMessages := r.buildProviderMessages(runCtx)
-
-		// Build tools for LLM (filtered by agent configuration)
-		tools := r.buildProviderTools(runCtx)
+		sentMessages := len(runCtx.Messages)
 
 		// Call LLM
 		req := &provider.ChatRequest{
@@ -555,8 +857,18 @@ func (r *Runtime) runAgentLoop(ctx context.Context, runCtx *RunContext) error {
 			TopP:        runCtx.Config.TopP,
 		}
 
-		resp, err := r.provider.Chat(ctx, req)
+		resp, err := r.streamCompletion(ctx, runCtx, req)
 		if err != nil {
+			// A rejected request fails the same way every time. Transient
+			// errors have already been retried with backoff by the provider.
+			if errors.Is(err, provider.ErrClientError) {
+				return fmt.Errorf("model request rejected: %w", err)
+			}
+			// Clients already have part of the reply, which a retry would
+			// follow with a whole new one
+			if errors.Is(err, errPartialStream) {
+				return err
+			}
 			runCtx.FailureCount++
 			if runCtx.FailureCount >= runCtx.Config.MaxFailuresPerRun {
 				return fmt.Errorf("max failures exceeded: %w", err)
@@ -564,8 +876,23 @@ func (r *Runtime) runAgentLoop(ctx context.Context, runCtx *RunContext) error {
 			continue
 		}
 
-		// Update usage
-		runCtx.Run.CostUSD += r.estimateCost(resp.Usage)
+		// Record which model served this turn (a routing provider may have
+		// fallen back from the primary) and what it cost
+		providerName, model := resp.Provider, resp.Model
+		if providerName == "" {
+			providerName, model = r.provider.Name(), r.provider.Model()
+		}
+		cost := r.recordUsage(ctx, runCtx, providerName, model, resp.Usage)
+		runCtx.promptTokens, runCtx.promptMessages = resp.Usage.PromptTokens, sentMessages
+
+		r.publishEvent(runCtx.Run.ID, store.EventTypeLLMCompleted, map[string]any{
+			"provider":          providerName,
+			"model":             model,
+			"finish_reason":     resp.FinishReason,
+			"prompt_tokens":     resp.Usage.PromptTokens,
+			"completion_tokens": resp.Usage.CompletionTokens,
+			"cost_usd":          cost,
+		})
 
 		// Handle response
 		if resp.Content != "" {
@@ -574,17 +901,22 @@ func (r *Runtime) runAgentLoop(ctx context.Context, runCtx *RunContext) error {
 				Role:      "assistant",
 				Content:   resp.Content,
 				SessionID: runCtx.Session.ID,
+				Metadata: map[string]any{
+					"provider": providerName,
+					"model":    model,
+				},
 			}
 			r.store.AddMessage(ctx, runCtx.Session.ID, msg)
 			runCtx.Messages = append(runCtx.Messages, msg)
 
-			r.publishEvent(runCtx.Run.ID, store.EventTypeTextDelta, map[string]any{
-				"text": resp.Content,
-			})
-
 			runCtx.Run.Output = resp.Content
 		}
 
+		// Enforce the cost budget before doing any more work
+		if err := r.checkBudget(ctx, runCtx); err != nil {
+			return err
+		}
+
 		// Handle tool calls
 		if len(resp.ToolCalls) > 0 {
 			if err := r.handleToolCalls(ctx, runCtx, resp.ToolCalls); err != nil {
@@ -609,86 +941,378 @@ func (r *Runtime) runAgentLoop(ctx context.Context, runCtx *RunContext) error {
 	return nil
 }
 
-// handleToolCalls executes tool calls and adds results to messages
-func (r *Runtime) handleToolCalls(ctx context.Context, runCtx *RunContext, toolCalls []provider.ToolCall) error {
-	// Add assistant message with tool calls
-	msg := &store.Message{
-		Role:      "assistant",
-		Content:   "",
-		SessionID: runCtx.Session.ID,
+// waitIfPaused blocks while the run is paused by the user
+func (r *Runtime) waitIfPaused(ctx context.Context, runCtx *RunContext) error {
+	select {
+	case <-runCtx.pauseSignal:
+		// Handle pause - wait for resume signal
+		r.publishEvent(runCtx.Run.ID, store.EventTypeTextDelta, map[string]any{
+			"text": "\n[Run paused by user. Use /runs/{id}/resume to continue...]\n",
+		})
+
+		// Wait for resume or context cancellation
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-runCtx.resumeSignal:
+			// Continue execution
+			r.publishEvent(runCtx.Run.ID, store.EventTypeTextDelta, map[string]any{
+				"text": "\n[Run resumed by user. Continuing...]\n",
+			})
+		}
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
 	}
+	return nil
+}
 
-	for _, tc := range toolCalls {
-		msg.ToolCalls = append(msg.ToolCalls, store.ToolCallRef{
-			ID:   tc.ID,
-			Type: tc.Type,
-			Function: struct {
-				Name      string `json:"name"`
-				Arguments string `json:"arguments"`
-			}{
-				Name:      tc.Function.Name,
-				Arguments: tc.Function.Arguments,
-			},
+// resumeAgentLoop continues a run interrupted by a restart from its last
+// completed step. It waits out a user pause, raises a pending checkpoint
+// again and settles tool calls that never recorded a result before
+// re-entering the agent loop.
+func (r *Runtime) resumeAgentLoop(ctx context.Context, runCtx *RunContext) error {
+	run := runCtx.Run
+	atCheckpoint := run.Status == store.RunStatePausedCheckpoint
+
+	if run.Status != store.RunStatePaused {
+		// A pending checkpoint is raised again below
+		r.logger.LogStateTransition(run.ID, run.Status, store.RunStateRunning, "restart")
+		run.Status = store.RunStateRunning
+		r.saveRun(ctx, r.store, run)
+
+		r.publishEvent(run.ID, store.EventTypeRunResumed, map[string]any{
+			"run_id": run.ID,
+			"reason": "restart",
 		})
 	}
 
-	r.store.AddMessage(ctx, runCtx.Session.ID, msg)
-	runCtx.Messages = append(runCtx.Messages, msg)
-
-	// Execute tool calls (potentially in parallel)
-	for _, tc := range toolCalls {
-		if err := r.executeToolCall(ctx, runCtx, tc); err != nil {
-			// Add error result
-			errorMsg := &store.Message{
-				Role:      "tool",
-				Content:   fmt.Sprintf("Error: %v", err),
-				SessionID: runCtx.Session.ID,
-				ToolCalls: []store.ToolCallRef{{ID: tc.ID}},
-			}
-			r.store.AddMessage(ctx, runCtx.Session.ID, errorMsg)
-			runCtx.Messages = append(runCtx.Messages, errorMsg)
+	if err := r.waitIfPaused(ctx, runCtx); err != nil {
+		return err
+	}
 
-			runCtx.FailureCount++
-			if runCtx.FailureCount >= runCtx.Config.MaxFailuresPerRun {
-				return fmt.Errorf("max failures exceeded")
-			}
+	pending := interruptedToolCalls(runCtx.Messages, run.CreatedAt)
+	switch {
+	case len(pending) > 0:
+		records, err := r.toolCallRecords(ctx, run.ID)
+		if err != nil {
+			return fmt.Errorf("failed to load tool calls: %w", err)
 		}
 
-		runCtx.ToolCallCount++
-		runCtx.Run.ToolCallCount++
+		// Calls waiting at an approval checkpoint had not started; otherwise
+		// any of them without a record saying otherwise may have run before
+		// the restart
+		if err := r.runToolCalls(ctx, runCtx, pending, records, !atCheckpoint); err != nil {
+			return fmt.Errorf("tool execution failed: %w", err)
+		}
+	case atCheckpoint:
+		// Without pending tool calls, the run was waiting for budget approval
+		if err := r.checkBudget(ctx, runCtx); err != nil {
+			return err
+		}
 	}
 
-	return nil
+	return r.runAgentLoop(ctx, runCtx)
 }
 
-// executeToolCall executes a single tool call
-func (r *Runtime) executeToolCall(ctx context.Context, runCtx *RunContext, tc provider.ToolCall) error {
-	r.publishEvent(runCtx.Run.ID, store.EventTypeToolStarted, map[string]any{
-		"tool_call_id": tc.ID,
-		"tool_name":    tc.Function.Name,
-		"arguments":    tc.Function.Arguments,
-	})
-
-	// Parse arguments
-	var args map[string]any
-	if err := json.Unmarshal([]byte(tc.Function.Arguments), &args); err != nil {
-		return fmt.Errorf("failed to parse tool arguments: %w", err)
-	}
-
-	// Find tool configuration for authorization checks
-	var toolConfig *config.ToolConfig
-	for i := range runCtx.Config.Tools {
-		// Check if this tool call matches any configured tool server
-		tool, err := r.mcpRegistry.GetTool(tc.Function.Name)
-		if err == nil && tool.ServerName == runCtx.Config.Tools[i].ServerName {
-			toolConfig = &runCtx.Config.Tools[i]
+// interruptedToolCalls returns the calls of the run's last tool-calling
+// assistant message that have no recorded result. Messages from before
+// runCreated belong to earlier runs in the session.
+func interruptedToolCalls(messages []*store.Message, runCreated time.Time) []provider.ToolCall {
+	answered := make(map[string]bool)
+	for i := len(messages) - 1; i >= 0; i-- {
+		msg := messages[i]
+		if msg.CreatedAt.Before(runCreated) {
 			break
 		}
-	}
+		if msg.Role == "tool" {
+			answered[msg.ToolCallID] = true
+			continue
+		}
+		if msg.Role != "assistant" || len(msg.ToolCalls) == 0 {
+			continue
+		}
 
-	// Check if tool requires user consent
-	if toolConfig != nil {
-		requiresConsent, reason := r.mcpRegistry.RequiresUserConsent(tc.Function.Name, args, toolConfig)
+		var calls []provider.ToolCall
+		for _, tc := range msg.ToolCalls {
+			if answered[tc.ID] {
+				continue
+			}
+			calls = append(calls, provider.ToolCall{
+				ID:   tc.ID,
+				Type: tc.Type,
+				Function: provider.FunctionCall{
+					Name:      tc.Function.Name,
+					Arguments: tc.Function.Arguments,
+				},
+			})
+		}
+		return calls
+	}
+	return nil
+}
+
+// errPartialStream marks a stream that failed after publishing text
+var errPartialStream = errors.New("model stream failed after partial output")
+
+// streamCompletion streams a completion from the provider, publishing a
+// text_delta event for every content chunk as it arrives, and returns the
+// assembled response including any streamed tool calls. A stream that fails
+// after publishing text returns errPartialStream.
+func (r *Runtime) streamCompletion(ctx context.Context, runCtx *RunContext, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+	req.Stream = true
+
+	stream, err := r.provider.Stream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	acc := provider.NewStreamAccumulator()
+	published := false
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case event, ok := <-stream:
+			if !ok {
+				return acc.Response(), nil
+			}
+
+			if event.Type == "error" {
+				if published {
+					return nil, fmt.Errorf("%w: %w", errPartialStream, event.Error)
+				}
+				return nil, fmt.Errorf("stream error: %w", event.Error)
+			}
+
+			if event.Type == "content_delta" && event.Content != "" {
+				published = true
+				r.publishEvent(runCtx.Run.ID, store.EventTypeTextDelta, map[string]any{
+					"text": event.Content,
+				})
+			}
+
+			acc.Add(event)
+		}
+	}
+}
+
+// handleToolCalls executes tool calls and adds results to messages
+func (r *Runtime) handleToolCalls(ctx context.Context, runCtx *RunContext, toolCalls []provider.ToolCall) error {
+	// Add assistant message with tool calls
+	msg := &store.Message{
+		Role:      "assistant",
+		Content:   "",
+		SessionID: runCtx.Session.ID,
+	}
+
+	for _, tc := range toolCalls {
+		msg.ToolCalls = append(msg.ToolCalls, store.ToolCallRef{
+			ID:   tc.ID,
+			Type: tc.Type,
+			Function: struct {
+				Name      string `json:"name"`
+				Arguments string `json:"arguments"`
+			}{
+				Name:      tc.Function.Name,
+				Arguments: tc.Function.Arguments,
+			},
+		})
+	}
+
+	r.store.AddMessage(ctx, runCtx.Session.ID, msg)
+	runCtx.Messages = append(runCtx.Messages, msg)
+
+	return r.runToolCalls(ctx, runCtx, toolCalls, nil, false)
+}
+
+// runToolCalls authorizes and executes tool calls and records their results.
+// records holds the calls' records from before a restart, and interrupted
+// marks calls without one that may already have run.
+func (r *Runtime) runToolCalls(ctx context.Context, runCtx *RunContext, toolCalls []provider.ToolCall, records map[string]*store.ToolCall, interrupted bool) error {
+	// Authorize tool calls one at a time so approval checkpoints are
+	// presented to the user in order
+	calls := make([]*pendingToolCall, len(toolCalls))
+	for i, tc := range toolCalls {
+		calls[i] = r.prepareToolCall(ctx, runCtx, tc, records[tc.ID], interrupted)
+	}
+
+	// Execute authorized tool calls in parallel, bounded per server
+	var wg sync.WaitGroup
+	for _, call := range calls {
+		if call.err != nil || call.settled {
+			continue
+		}
+		wg.Add(1)
+		go func(call *pendingToolCall) {
+			defer wg.Done()
+			call.output, call.err = r.executeToolCall(ctx, runCtx, call)
+			r.finishToolCall(ctx, runCtx, call)
+		}(call)
+	}
+	wg.Wait()
+
+	// Record results in the order the model requested them so transcripts
+	// are reproducible regardless of completion order. The results and the
+	// run's tool call count are written together.
+	var results []*store.Message
+	maxFailuresExceeded := false
+	err := store.WithTx(ctx, r.store, func(tx store.Store) error {
+		for _, call := range calls {
+			if call.err != nil {
+				// Add error result
+				errorMsg := &store.Message{
+					Role:       "tool",
+					Content:    fmt.Sprintf("Error: %v", call.err),
+					SessionID:  runCtx.Session.ID,
+					ToolCallID: call.tc.ID,
+					ToolName:   call.tc.Function.Name,
+				}
+				if err := tx.AddMessage(ctx, runCtx.Session.ID, errorMsg); err != nil {
+					return err
+				}
+				results = append(results, errorMsg)
+
+				runCtx.FailureCount++
+				if runCtx.FailureCount >= runCtx.Config.MaxFailuresPerRun {
+					maxFailuresExceeded = true
+					break
+				}
+			} else {
+				// Add tool result message
+				toolMsg := &store.Message{
+					Role:       "tool",
+					Content:    call.output,
+					SessionID:  runCtx.Session.ID,
+					ToolCallID: call.tc.ID,
+					ToolName:   call.tc.Function.Name,
+				}
+				if err := tx.AddMessage(ctx, runCtx.Session.ID, toolMsg); err != nil {
+					return err
+				}
+				results = append(results, toolMsg)
+			}
+
+			runCtx.ToolCallCount++
+			runCtx.Run.ToolCallCount++
+		}
+
+		return r.saveRun(ctx, tx, runCtx.Run)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record tool results: %w", err)
+	}
+	runCtx.Messages = append(runCtx.Messages, results...)
+
+	if maxFailuresExceeded {
+		return fmt.Errorf("max failures exceeded")
+	}
+
+	return nil
+}
+
+// pendingToolCall tracks a single tool call through authorization and execution
+type pendingToolCall struct {
+	tc         provider.ToolCall
+	args       map[string]any
+	tool       *mcp.Tool // resolved from the name the model called, nil if unknown
+	toolConfig *config.ToolConfig
+	record     *store.ToolCall
+	settled    bool // finished before a restart; the result comes from the record
+	output     string
+	err        error
+}
+
+// prepareToolCall parses arguments, resolves the tool configuration and
+// waits for user approval when the tool requires consent. An interrupted
+// call to a tool that isn't idempotent always requires approval.
+//
+// previous is the call's record from before a restart, if any. It settles
+// the call when it finished and otherwise tells whether it had started.
+func (r *Runtime) prepareToolCall(ctx context.Context, runCtx *RunContext, tc provider.ToolCall, previous *store.ToolCall, interrupted bool) *pendingToolCall {
+	call := &pendingToolCall{tc: tc, record: previous}
+
+	if previous != nil {
+		switch previous.Status {
+		case store.ToolCallStatusCompleted:
+			call.settled = true
+			call.output = previous.Output
+			return call
+		case store.ToolCallStatusFailed, store.ToolCallStatusCancelled:
+			call.settled = true
+			call.err = errors.New(previous.Error)
+			return call
+		case store.ToolCallStatusPending:
+			interrupted = false
+		case store.ToolCallStatusRunning:
+			interrupted = true
+		}
+	}
+	if call.record == nil {
+		call.record = &store.ToolCall{
+			ID:       tc.ID,
+			ToolName: tc.Function.Name,
+			Status:   store.ToolCallStatusPending,
+		}
+	}
+
+	r.publishEvent(runCtx.Run.ID, store.EventTypeToolStarted, map[string]any{
+		"tool_call_id": tc.ID,
+		"tool_name":    tc.Function.Name,
+		"arguments":    tc.Function.Arguments,
+	})
+
+	// Parse arguments
+	if err := json.Unmarshal([]byte(tc.Function.Arguments), &call.args); err != nil {
+		call.err = fmt.Errorf("failed to parse tool arguments: %w", err)
+		r.finishToolCall(ctx, runCtx, call)
+		return call
+	}
+
+	// Find the tool, which may be namespaced or aliased, and its server's
+	// configuration for authorization checks
+	remoteName := tc.Function.Name
+	if tool, err := r.mcpRegistry.ResolveTool(tc.Function.Name, runCtx.Config.Tools); err == nil {
+		call.tool = tool
+		call.record.ServerName = tool.ServerName
+		if tool.RemoteName != "" {
+			remoteName = tool.RemoteName
+		}
+		for i := range runCtx.Config.Tools {
+			if runCtx.Config.Tools[i].ServerName == tool.ServerName {
+				call.toolConfig = &runCtx.Config.Tools[i]
+				break
+			}
+		}
+	}
+	var redacted []string
+	if call.toolConfig != nil {
+		redacted = call.toolConfig.Redaction.Arguments
+	}
+	call.record.Arguments = redactArguments(call.args, redacted)
+	r.saveToolCall(ctx, runCtx, call.record)
+
+	defer func() {
+		if call.err != nil {
+			r.finishToolCall(ctx, runCtx, call)
+		}
+	}()
+
+	// The call may have run before the restart, so only repeat it with
+	// consent, even in daemon mode
+	if interrupted && (call.toolConfig == nil || !call.toolConfig.Idempotent) {
+		r.logger.Warn("Interrupted tool call requires re-approval",
+			"tool", tc.Function.Name,
+			"run_id", runCtx.Run.ID,
+		)
+		call.err = r.pauseForApproval(ctx, runCtx, tc, "It was interrupted by a restart and may already have run.")
+		return call
+	}
+
+	// Check if tool requires user consent
+	if call.toolConfig != nil {
+		// Approval patterns match the tool's name on its server
+		requiresConsent, reason := r.mcpRegistry.RequiresUserConsent(remoteName, call.args, call.toolConfig)
 		if requiresConsent {
 			r.logger.Warn("Tool requires user consent",
 				"tool", tc.Function.Name,
@@ -704,19 +1328,51 @@ func (r *Runtime) executeToolCall(ctx context.Context, runCtx *RunContext, tc pr
 				)
 			} else {
 				// Pause execution and wait for user approval
-				return r.pauseForApproval(ctx, runCtx, tc, reason)
+				call.err = r.pauseForApproval(ctx, runCtx, tc, reason)
 			}
 		}
 	}
 
-	// Execute via MCP with tool configuration
-	result, err := r.mcpRegistry.CallTool(ctx, tc.Function.Name, args, toolConfig)
+	return call
+}
+
+// executeToolCall executes a single authorized tool call and returns its output
+func (r *Runtime) executeToolCall(ctx context.Context, runCtx *RunContext, call *pendingToolCall) (string, error) {
+	tc := call.tc
+
+	// Respect the server's concurrency limit
+	if call.toolConfig != nil {
+		release, err := r.acquireToolSlot(ctx, call.toolConfig)
+		if err != nil {
+			return "", err
+		}
+		defer release()
+	}
+
+	// A record that started before is being retried after a restart
+	if call.record.StartedAt != nil {
+		call.record.RetryCount++
+	}
+	startedAt := time.Now()
+	call.record.Status = store.ToolCallStatusRunning
+	call.record.StartedAt = &startedAt
+	r.saveToolCall(ctx, runCtx, call.record)
+
+	// Execute via MCP with tool configuration, on the server the name was
+	// resolved to when the call was prepared
+	var result *mcp.ToolResult
+	var err error
+	if call.tool != nil {
+		result, err = r.mcpRegistry.CallResolvedTool(ctx, call.tool, call.args, call.toolConfig)
+	} else {
+		result, err = r.mcpRegistry.CallTool(ctx, tc.Function.Name, call.args, call.toolConfig)
+	}
 	if err != nil {
 		r.publishEvent(runCtx.Run.ID, store.EventTypeToolFailed, map[string]any{
 			"tool_call_id": tc.ID,
 			"error":        err.Error(),
 		})
-		return err
+		return "", err
 	}
 
 	// Build result content
@@ -728,7 +1384,7 @@ func (r *Runtime) executeToolCall(ctx context.Context, runCtx *RunContext, tc pr
 	}
 
 	// Apply redaction if configured
-	if toolConfig != nil && toolConfig.Redaction.Outputs {
+	if call.toolConfig != nil && call.toolConfig.Redaction.Outputs {
 		resultText = "[REDACTED]"
 		r.logger.Info("Tool output redacted",
 			"tool", tc.Function.Name,
@@ -736,21 +1392,138 @@ func (r *Runtime) executeToolCall(ctx context.Context, runCtx *RunContext, tc pr
 		)
 	}
 
-	// Add tool result message
-	toolMsg := &store.Message{
-		Role:      "tool",
-		Content:   resultText,
-		SessionID: runCtx.Session.ID,
-	}
-	r.store.AddMessage(ctx, runCtx.Session.ID, toolMsg)
-	runCtx.Messages = append(runCtx.Messages, toolMsg)
-
 	r.publishEvent(runCtx.Run.ID, store.EventTypeToolCompleted, map[string]any{
 		"tool_call_id": tc.ID,
 		"output":       resultText,
 	})
 
-	return nil
+	return resultText, nil
+}
+
+// finishToolCall records the outcome of a tool call. Calls stopped by the
+// run's cancellation or a denied approval are cancelled rather than failed.
+func (r *Runtime) finishToolCall(ctx context.Context, runCtx *RunContext, call *pendingToolCall) {
+	completedAt := time.Now()
+	call.record.CompletedAt = &completedAt
+
+	switch {
+	case call.err == nil:
+		call.record.Status = store.ToolCallStatusCompleted
+		call.record.Output = call.output
+	case ctx.Err() != nil:
+		call.record.Status = store.ToolCallStatusCancelled
+		call.record.Error = call.err.Error()
+	default:
+		call.record.Status = store.ToolCallStatusFailed
+		call.record.Error = call.err.Error()
+	}
+
+	r.saveToolCall(ctx, runCtx, call.record)
+}
+
+// saveToolCall persists a copy of a tool call record, adding it the first
+// time. The audit trail is best effort, so failures are only logged.
+func (r *Runtime) saveToolCall(ctx context.Context, runCtx *RunContext, record *store.ToolCall) {
+	// The record must outlive a cancelled run
+	ctx = context.WithoutCancel(ctx)
+
+	saved := *record
+	var err error
+	if record.CreatedAt.IsZero() {
+		err = r.store.AddToolCall(ctx, runCtx.Run.ID, &saved)
+		record.RunID = saved.RunID
+		record.CreatedAt = saved.CreatedAt
+	} else {
+		err = r.store.UpdateToolCall(ctx, &saved)
+	}
+	if err != nil {
+		r.logger.Warn("Failed to record tool call",
+			"tool_call_id", record.ID,
+			"run_id", runCtx.Run.ID,
+			"error", err,
+		)
+	}
+}
+
+// toolCallRecords returns the run's tool call records by ID
+func (r *Runtime) toolCallRecords(ctx context.Context, runID string) (map[string]*store.ToolCall, error) {
+	toolCalls, err := r.store.GetToolCalls(ctx, runID)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make(map[string]*store.ToolCall, len(toolCalls))
+	for _, tc := range toolCalls {
+		// Work on a copy; the in-memory store shares its records
+		record := *tc
+		records[tc.ID] = &record
+	}
+	return records, nil
+}
+
+// redactArguments copies tool arguments for the audit trail, replacing the
+// values of arguments whose names contain any of the given names,
+// case-insensitively
+func redactArguments(args map[string]any, names []string) map[string]any {
+	if args == nil {
+		return nil
+	}
+
+	redacted := make(map[string]any, len(args))
+	for key, value := range args {
+		if matchesAny(key, names) {
+			redacted[key] = "[REDACTED]"
+		} else if nested, ok := value.(map[string]any); ok {
+			redacted[key] = redactArguments(nested, names)
+		} else {
+			redacted[key] = value
+		}
+	}
+	return redacted
+}
+
+func matchesAny(key string, names []string) bool {
+	key = strings.ToLower(key)
+	for _, name := range names {
+		if strings.Contains(key, strings.ToLower(name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// toolLimiterKey identifies the semaphore for a server under one
+// concurrency limit
+type toolLimiterKey struct {
+	server string
+	limit  int
+}
+
+// acquireToolSlot blocks until the tool's server has capacity for another
+// call under the run's concurrency limit. Runs started before a config
+// reload keep sharing the old limit's semaphore, so a changed limit applies
+// to the runs that see it without resetting the count for the others. The
+// returned function releases the slot.
+func (r *Runtime) acquireToolSlot(ctx context.Context, toolConfig *config.ToolConfig) (func(), error) {
+	if toolConfig.ConcurrencyLimit <= 0 {
+		return func() {}, nil
+	}
+
+	key := toolLimiterKey{server: toolConfig.ServerName, limit: toolConfig.ConcurrencyLimit}
+	r.limiterMu.Lock()
+	sem, ok := r.toolLimiters[key]
+	if !ok {
+		sem = make(chan struct{}, toolConfig.ConcurrencyLimit)
+		r.toolLimiters[key] = sem
+	}
+	r.limiterMu.Unlock()
+
+	select {
+	case sem <- struct{}{}:
+		return func() { <-sem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 }
 
 // pauseForApproval pauses execution and waits for user approval for a tool call
@@ -763,11 +1536,12 @@ func (r *Runtime) pauseForApproval(ctx context.Context, runCtx *RunContext, tc p
 
 	// Update run status to paused_checkpoint
 	runCtx.Run.Status = store.RunStatePausedCheckpoint
-	r.store.UpdateRun(ctx, runCtx.Run)
+	r.saveRun(ctx, r.store, runCtx.Run)
 
 	// Set pause state
 	runCtx.mu.Lock()
 	runCtx.isPaused = true
+	runCtx.checkpointType = CheckpointTypeToolApproval
 	if runCtx.pauseSignal == nil {
 		runCtx.pauseSignal = make(chan struct{})
 	}
@@ -778,6 +1552,7 @@ func (r *Runtime) pauseForApproval(ctx context.Context, runCtx *RunContext, tc p
 
 	// Emit checkpoint event for user interaction
 	r.publishEvent(runCtx.Run.ID, store.EventTypeCheckpointRequired, map[string]any{
+		"checkpoint_type":   CheckpointTypeToolApproval,
 		"tool_call_id":      tc.ID,
 		"tool_name":         tc.Function.Name,
 		"reason":            reason,
@@ -816,7 +1591,7 @@ func (r *Runtime) pauseForApproval(ctx context.Context, runCtx *RunContext, tc p
 
 		// Update run status back to running
 		runCtx.Run.Status = store.RunStateRunning
-		r.store.UpdateRun(ctx, runCtx.Run)
+		r.saveRun(ctx, r.store, runCtx.Run)
 
 		// Emit resume event
 		r.publishEvent(runCtx.Run.ID, store.EventTypeRunResumed, map[string]any{
@@ -827,6 +1602,7 @@ func (r *Runtime) pauseForApproval(ctx context.Context, runCtx *RunContext, tc p
 		// Clear pause state
 		runCtx.mu.Lock()
 		runCtx.isPaused = false
+		runCtx.checkpointType = ""
 		runCtx.mu.Unlock()
 
 		return nil // Continue with tool execution
@@ -837,10 +1613,182 @@ func (r *Runtime) pauseForApproval(ctx context.Context, runCtx *RunContext, tc p
 			"tool", tc.Function.Name,
 		)
 
-		// Update run status to cancelled
+		// Update run status to cancelled; ctx is done, so save without it
 		runCtx.Run.Status = store.RunStateCancelled
-		r.store.UpdateRun(ctx, runCtx.Run)
+		r.saveRun(context.WithoutCancel(ctx), r.store, runCtx.Run)
+
+		return ctx.Err()
+	}
+}
+
+// recordUsage prices an LLM call for the given provider/model, adds it to
+// the run's cost breakdown and the run and session totals, and returns its cost
+func (r *Runtime) recordUsage(ctx context.Context, runCtx *RunContext, providerName, model string, usage provider.Usage) float64 {
+	if runCtx.Pricing == nil {
+		runCtx.Pricing = pricing.NewTable(runCtx.Config.Pricing)
+	}
+
+	cost := runCtx.Pricing.Cost(providerName, model, pricing.Usage{
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		CacheReadTokens:  usage.CacheReadTokens,
+		CacheWriteTokens: usage.CacheWriteTokens,
+	})
+
+	r.recordCost(ctx, runCtx, cost.Total(), store.CostBreakdown{
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		CacheReadTokens:  usage.CacheReadTokens,
+		CacheWriteTokens: usage.CacheWriteTokens,
+		PromptUSD:        cost.Prompt,
+		CompletionUSD:    cost.Completion,
+		CacheReadUSD:     cost.CacheRead,
+		CacheWriteUSD:    cost.CacheWrite,
+	})
+	return cost.Total()
+}
+
+// recordCost adds the cost of an LLM call, itemized by usage, to the run and
+// session totals. The run is changed on a copy that is saved before it
+// replaces runCtx.Run, so handlers reading the run under runCtx.mu never see
+// a half-updated breakdown.
+func (r *Runtime) recordCost(ctx context.Context, runCtx *RunContext, cost float64, usage store.CostBreakdown) {
+	if cost <= 0 && usage == (store.CostBreakdown{}) {
+		return
+	}
+
+	run := *runCtx.Run
+	run.CostUSD += cost
+	breakdown := &run.CostBreakdown
+	breakdown.PromptTokens += usage.PromptTokens
+	breakdown.CompletionTokens += usage.CompletionTokens
+	breakdown.CacheReadTokens += usage.CacheReadTokens
+	breakdown.CacheWriteTokens += usage.CacheWriteTokens
+	breakdown.PromptUSD += usage.PromptUSD
+	breakdown.CompletionUSD += usage.CompletionUSD
+	breakdown.CacheReadUSD += usage.CacheReadUSD
+	breakdown.CacheWriteUSD += usage.CacheWriteUSD
+	r.saveRun(ctx, r.store, &run)
+
+	runCtx.mu.Lock()
+	runCtx.Run = &run
+	runCtx.mu.Unlock()
 
+	if cost <= 0 {
+		return
+	}
+
+	// Other runs in the session add to the same total, so add to the stored
+	// value rather than writing back this run's copy of the session
+	total, err := r.store.AddSessionCost(ctx, runCtx.Session.ID, cost)
+	if err != nil {
+		r.logger.Warn("Failed to update session cost",
+			"session_id", runCtx.Session.ID,
+			"error", err,
+		)
+		return
+	}
+	runCtx.Session.CostUSD = total
+}
+
+// checkBudget enforces MaxCostUSD. A run over budget fails, unless the
+// budget_exceeded approval policy is set, in which case it pauses until an
+// operator approves more spend.
+func (r *Runtime) checkBudget(ctx context.Context, runCtx *RunContext) error {
+	if runCtx.BudgetUSD <= 0 || runCtx.Run.CostUSD <= runCtx.BudgetUSD {
+		return nil
+	}
+
+	r.logger.Warn("Run exceeded cost budget",
+		"run_id", runCtx.Run.ID,
+		"cost_usd", runCtx.Run.CostUSD,
+		"budget_usd", runCtx.BudgetUSD,
+	)
+
+	if !runCtx.Config.ApprovalPolicies.BudgetExceeded {
+		return fmt.Errorf("budget exceeded: run cost $%.4f exceeds limit of $%.4f", runCtx.Run.CostUSD, runCtx.BudgetUSD)
+	}
+
+	if err := r.pauseForBudget(ctx, runCtx); err != nil {
+		return err
+	}
+
+	// Approved - extend the budget by as many MaxCostUSD increments as
+	// cover the cost, and record it so a restart doesn't take it back. A
+	// limit since lifted to unlimited lifts the run's budget too.
+	if increment := runCtx.Config.MaxCostUSD; increment > 0 {
+		runCtx.BudgetUSD += math.Ceil((runCtx.Run.CostUSD-runCtx.BudgetUSD)/increment) * increment
+	} else {
+		runCtx.BudgetUSD = 0
+	}
+	runCtx.Run.BudgetUSD = runCtx.BudgetUSD
+	r.saveRun(ctx, r.store, runCtx.Run)
+
+	r.logger.Info("Run budget extended",
+		"run_id", runCtx.Run.ID,
+		"budget_usd", runCtx.BudgetUSD,
+	)
+
+	return nil
+}
+
+// pauseForBudget pauses execution and waits for an operator to approve spending
+// beyond the run's budget
+func (r *Runtime) pauseForBudget(ctx context.Context, runCtx *RunContext) error {
+	// Update run status to paused_checkpoint
+	runCtx.Run.Status = store.RunStatePausedCheckpoint
+	r.saveRun(ctx, r.store, runCtx.Run)
+
+	runCtx.mu.Lock()
+	runCtx.isPaused = true
+	runCtx.checkpointType = CheckpointTypeBudgetExceeded
+	runCtx.mu.Unlock()
+
+	r.publishEvent(runCtx.Run.ID, store.EventTypeCheckpointRequired, map[string]any{
+		"checkpoint_type":   CheckpointTypeBudgetExceeded,
+		"reason":            "budget_exceeded",
+		"cost_usd":          runCtx.Run.CostUSD,
+		"budget_usd":        runCtx.BudgetUSD,
+		"session_cost_usd":  runCtx.Session.CostUSD,
+		"prompt":            fmt.Sprintf("This run has spent $%.4f, exceeding its budget of $%.4f. Approve additional spend?", runCtx.Run.CostUSD, runCtx.BudgetUSD),
+		"approval_required": true,
+		"approval_schema": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"approved": map[string]any{
+					"type":        "boolean",
+					"description": "Whether to allow the run to keep spending",
+				},
+				"reason": map[string]any{
+					"type":        "string",
+					"description": "Optional reason for the decision",
+				},
+			},
+			"required": []string{"approved"},
+		},
+	})
+
+	r.publishEvent(runCtx.Run.ID, store.EventTypeRunPaused, map[string]any{
+		"reason":   "budget_exceeded",
+		"cost_usd": runCtx.Run.CostUSD,
+	})
+
+	select {
+	case <-runCtx.resumeSignal:
+		r.logger.Info("Run resumed after budget approval", "run_id", runCtx.Run.ID)
+
+		runCtx.Run.Status = store.RunStateRunning
+		r.saveRun(ctx, r.store, runCtx.Run)
+
+		runCtx.mu.Lock()
+		runCtx.isPaused = false
+		runCtx.checkpointType = ""
+		runCtx.mu.Unlock()
+
+		return nil
+
+	case <-ctx.Done():
+		r.logger.Info("Run cancelled while waiting for budget approval", "run_id", runCtx.Run.ID)
 		return ctx.Err()
 	}
 }
@@ -856,11 +1804,19 @@ func (r *Runtime) buildProviderMessages(runCtx *RunContext) []provider.Message {
 		})
 	}
 
-	// Add conversation messages
-	for _, msg := range runCtx.Messages {
+	// Add conversation messages, with older history compacted
+	for _, msg := range compaction.View(runCtx.Messages) {
 		provMsg := provider.Message{
-			Role:    msg.Role,
-			Content: msg.Content,
+			Role:       msg.Role,
+			Content:    msg.Content,
+			ToolCallID: msg.ToolCallID,
+			Name:       msg.ToolName,
+		}
+		if msg.Compaction != nil {
+			// A marker is stored as a system message but opens the
+			// conversation it stands in for, and providers expect that
+			// to be a user turn
+			provMsg.Role = "user"
 		}
 
 		if len(msg.ToolCalls) > 0 {
@@ -883,6 +1839,76 @@ func (r *Runtime) buildProviderMessages(runCtx *RunContext) []provider.Message {
 	return messages
 }
 
+// compactHistory appends a compaction marker to the session when the history
+// nears the configured MaxContextTokens
+func (r *Runtime) compactHistory(ctx context.Context, runCtx *RunContext, tools []provider.Tool) error {
+	cfg := runCtx.Config
+	if cfg.MaxContextTokens <= 0 {
+		return nil
+	}
+
+	counter := compaction.NewCounter(r.provider.Name())
+	compactor, err := compaction.New(cfg.Compaction, cfg.MaxContextTokens, counter, func(ctx context.Context, messages []*store.Message) (string, error) {
+		return r.summarizeHistory(ctx, runCtx, messages)
+	})
+	if err != nil {
+		r.logger.Warn("Compaction disabled", "run_id", runCtx.Run.ID, "error", err)
+		return nil
+	}
+
+	// The system prompt, tool definitions and response share the window.
+	// What the provider counted for the last request beats estimating them.
+	toolsJSON, _ := json.Marshal(tools)
+	fixed := counter.Text(cfg.SystemPrompt) + counter.Text(string(toolsJSON)) + cfg.MaxOutputTokens
+	if runCtx.promptTokens > 0 {
+		compactor.UseBaseline(runCtx.promptTokens+cfg.MaxOutputTokens, runCtx.promptMessages)
+	}
+
+	marker, err := compactor.Compact(ctx, runCtx.Messages, fixed)
+	if err != nil || marker == nil {
+		return err
+	}
+
+	if err := r.store.AddMessage(ctx, runCtx.Session.ID, marker); err != nil {
+		return fmt.Errorf("failed to store compaction: %w", err)
+	}
+	runCtx.Messages = append(runCtx.Messages, marker)
+
+	r.publishEvent(runCtx.Run.ID, store.EventTypeContextCompacted, map[string]any{
+		"strategy":      marker.Compaction.Strategy,
+		"tokens_before": marker.Compaction.TokensBefore,
+		"tokens_after":  marker.Compaction.TokensAfter,
+		"max_tokens":    cfg.MaxContextTokens,
+	})
+
+	return nil
+}
+
+// summarizeHistory asks the model to summarize older history for compaction
+func (r *Runtime) summarizeHistory(ctx context.Context, runCtx *RunContext, messages []*store.Message) (string, error) {
+	resp, err := r.provider.Chat(ctx, &provider.ChatRequest{
+		Messages: []provider.Message{
+			{Role: "system", Content: compaction.SummaryPrompt},
+			{Role: "user", Content: compaction.Transcript(messages)},
+		},
+		MaxTokens: runCtx.Config.MaxOutputTokens,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	providerName, model := resp.Provider, resp.Model
+	if providerName == "" {
+		providerName, model = r.provider.Name(), r.provider.Model()
+	}
+	r.recordUsage(ctx, runCtx, providerName, model, resp.Usage)
+
+	if strings.TrimSpace(resp.Content) == "" {
+		return "", fmt.Errorf("model returned an empty summary")
+	}
+	return resp.Content, nil
+}
+
 func (r *Runtime) buildProviderTools(runCtx *RunContext) []provider.Tool {
 	// Use filtered tools based on agent configuration
 	mcpTools := r.mcpRegistry.ListToolsFiltered(runCtx.Config.Tools)
@@ -913,38 +1939,129 @@ func (r *Runtime) buildProviderTools(runCtx *RunContext) []provider.Tool {
 	return tools
 }
 
-func (r *Runtime) estimateCost(usage provider.Usage) float64 {
-	// Simplified cost estimation
-	// TODO: Implement provider-specific pricing
-	return float64(usage.TotalTokens) * 0.00001
-}
-
 func (r *Runtime) failRun(ctx context.Context, runID string, err error) {
-	run, getErr := r.store.GetRun(ctx, runID)
-	if getErr != nil {
+	_, updateErr := r.updateRun(ctx, runID, func(run *store.Run) error {
+		// A run cancelled by the user (or a denied checkpoint) stays cancelled
+		if run.Status == store.RunStateCancelled {
+			return errRunCancelled
+		}
+
+		run.Status = store.RunStateFailed
+		run.Error = err.Error()
+		now := time.Now()
+		run.EndedAt = &now
+		return nil
+	})
+	if updateErr != nil {
 		return
 	}
 
-	run.Status = store.RunStateFailed
-	run.Error = err.Error()
-	now := time.Now()
-	run.EndedAt = &now
-
-	r.store.UpdateRun(ctx, run)
-
 	r.publishEvent(runID, store.EventTypeRunFailed, map[string]any{
 		"run_id": runID,
 		"error":  err.Error(),
 	})
 }
 
+// errRunCancelled stops an update to a run that has been cancelled
+var errRunCancelled = errors.New("run cancelled")
+
+// maxRunUpdateAttempts bounds retries of run updates that lose a race with
+// another writer
+const maxRunUpdateAttempts = 5
+
+// saveRun persists the state of a run held by the agent loop. If another
+// writer (an operator, or another replica) updated the run first, the loop's
+// copy is merged into the latest version with mergeStoredRun and saved again.
+func (r *Runtime) saveRun(ctx context.Context, st store.Store, run *store.Run) error {
+	err := st.UpdateRun(ctx, run)
+	for attempt := 1; errors.Is(err, store.ErrConflict) && attempt < maxRunUpdateAttempts; attempt++ {
+		latest, getErr := st.GetRun(ctx, run.ID)
+		if getErr != nil {
+			err = getErr
+			break
+		}
+		mergeStoredRun(run, latest)
+		err = st.UpdateRun(ctx, run)
+	}
+
+	if err != nil {
+		r.logger.Warn("Failed to save run", "run_id", run.ID, "error", err)
+	}
+	return err
+}
+
+// mergeStoredRun updates run, the agent loop's copy, to latest, keeping only
+// the fields the loop owns: output, start time, cost, budget and step
+// counters. The stored status stands, so an operator's pause or cancellation
+// isn't overwritten, unless the loop is starting a queued run, raising a
+// checkpoint or ending the run, which only the loop does. A run the store
+// already has as ended stays ended.
+func mergeStoredRun(run, latest *store.Run) {
+	owned := *run
+	*run = *latest
+
+	run.Output = owned.Output
+	if run.StartedAt == nil {
+		run.StartedAt = owned.StartedAt
+	}
+	run.ToolCallCount = owned.ToolCallCount
+	run.FailureCount = owned.FailureCount
+	run.CostUSD = owned.CostUSD
+	run.CostBreakdown = owned.CostBreakdown
+	run.BudgetUSD = owned.BudgetUSD
+
+	if isTerminalRunState(latest.Status) {
+		return
+	}
+	if latest.Status == store.RunStateQueued || owned.Status == store.RunStatePausedCheckpoint || isTerminalRunState(owned.Status) {
+		run.Status = owned.Status
+		run.Error = owned.Error
+		run.EndedAt = owned.EndedAt
+	}
+}
+
+// updateRun applies fn to the latest stored version of a run and saves it,
+// re-reading and reapplying fn if another writer updates the run in between
+func (r *Runtime) updateRun(ctx context.Context, runID string, fn func(run *store.Run) error) (*store.Run, error) {
+	for attempt := 1; ; attempt++ {
+		run, err := r.store.GetRun(ctx, runID)
+		if err != nil {
+			return nil, err
+		}
+		if err := fn(run); err != nil {
+			return nil, err
+		}
+
+		err = r.store.UpdateRun(ctx, run)
+		if err == nil {
+			return run, nil
+		}
+		if !errors.Is(err, store.ErrConflict) || attempt == maxRunUpdateAttempts {
+			return nil, err
+		}
+	}
+}
+
+func isTerminalRunState(status string) bool {
+	return status == store.RunStateCompleted || status == store.RunStateFailed || status == store.RunStateCancelled
+}
+
 func (r *Runtime) publishEvent(runID string, eventType string, data map[string]any) {
+	tenantID, sessionID := r.runOwner(runID)
 	event := &store.Event{
-		RunID: runID,
-		Type:  eventType,
-		Data:  data,
+		RunID:     runID,
+		TenantID:  tenantID,
+		SessionID: sessionID,
+		Type:      eventType,
+		Data:      data,
 	}
 
+	// Tool calls publish concurrently; subscribers rely on receiving a
+	// run's events in sequence order
+	lock := r.eventLock(runID)
+	lock.Lock()
+	defer lock.Unlock()
+
 	r.store.AddEvent(context.Background(), runID, event)
 
 	// Record event bus metrics
@@ -955,6 +2072,30 @@ func (r *Runtime) publishEvent(runID string, eventType string, data map[string]a
 	r.eventBus.Publish(runID, event)
 }
 
+// runOwner returns the tenant and session of a run, which events carry for
+// subscribers following more than one run
+func (r *Runtime) runOwner(runID string) (tenantID, sessionID string) {
+	r.mu.RLock()
+	runCtx, ok := r.activeRuns[runID]
+	r.mu.RUnlock()
+	if ok && runCtx.Session != nil {
+		return runCtx.Session.TenantID, runCtx.Session.ID
+	}
+
+	run, err := r.store.GetRun(context.Background(), runID)
+	if err != nil {
+		return "", ""
+	}
+	return run.TenantID, run.SessionID
+}
+
+// eventLock returns the lock that orders a run's events
+func (r *Runtime) eventLock(runID string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(runID))
+	return &r.eventLocks[h.Sum32()%uint32(len(r.eventLocks))]
+}
+
 // getActiveRunCountForTenant returns the number of active runs for a specific tenant
 func (r *Runtime) getActiveRunCountForTenant(tenantID string) int {
 	r.mu.RLock()
@@ -974,16 +2115,135 @@ func (r *Runtime) GetEvents(ctx context.Context, runID string) ([]*store.Event,
 	return r.store.GetEvents(ctx, runID)
 }
 
+// GetEventsAfter retrieves the events of a run that follow the given
+// sequence number, for clients resuming a stream
+func (r *Runtime) GetEventsAfter(ctx context.Context, runID string, sequence int64) ([]*store.Event, error) {
+	return r.store.GetEventsAfter(ctx, runID, sequence)
+}
+
+// GetToolCalls retrieves the recorded tool calls of a run, oldest first
+func (r *Runtime) GetToolCalls(ctx context.Context, runID string) ([]*store.ToolCall, error) {
+	return r.store.GetToolCalls(ctx, runID)
+}
+
+// GetSession retrieves a session by ID
+func (r *Runtime) GetSession(ctx context.Context, sessionID string) (*store.Session, error) {
+	return r.store.GetSession(ctx, sessionID)
+}
+
+// SearchSessions retrieves a page of sessions matching the query, newest
+// first, and the cursor of the next page
+func (r *Runtime) SearchSessions(ctx context.Context, query store.SessionQuery) ([]*store.Session, string, error) {
+	return r.store.SearchSessions(ctx, query)
+}
+
+// SearchRuns retrieves a page of runs matching the query, newest first, and
+// the cursor of the next page
+func (r *Runtime) SearchRuns(ctx context.Context, query store.RunQuery) ([]*store.Run, string, error) {
+	return r.store.SearchRuns(ctx, query)
+}
+
+// ListMessages retrieves a page of a session's messages, oldest first, and
+// the cursor of the next page
+func (r *Runtime) ListMessages(ctx context.Context, query store.MessageQuery) ([]*store.Message, string, error) {
+	return r.store.ListMessages(ctx, query)
+}
+
+// MCPServers reports the connection state of each MCP server
+func (r *Runtime) MCPServers() []mcp.ServerHealth {
+	return r.mcpRegistry.Health()
+}
+
 // SubscribeToEvents subscribes to events for a run
 func (r *Runtime) SubscribeToEvents(runID string) <-chan *store.Event {
 	return r.eventBus.Subscribe(runID)
 }
 
+// SubscribeToEventsWithOptions subscribes to events for a run with its own
+// buffer size and overflow policy
+func (r *Runtime) SubscribeToEventsWithOptions(runID string, opts events.SubscribeOptions) <-chan *store.Event {
+	return r.eventBus.SubscribeWithOptions(runID, opts)
+}
+
+// SubscribeToMatchingEvents subscribes to the events of every run that pass
+// the filter
+func (r *Runtime) SubscribeToMatchingEvents(filter events.Filter, opts events.SubscribeOptions) <-chan *store.Event {
+	return r.eventBus.SubscribeMatching(filter, opts)
+}
+
+// PendingCheckpoints returns the checkpoint_required event of each run that
+// is still awaiting approval and passes the filter, oldest first. A client
+// of the live feed reads it first to learn of checkpoints raised before it
+// subscribed.
+func (r *Runtime) PendingCheckpoints(ctx context.Context, filter events.Filter) ([]*store.Event, error) {
+	if !filter.MatchesType(store.EventTypeCheckpointRequired) {
+		return nil, nil
+	}
+
+	query := store.RunQuery{
+		TenantID:  filter.TenantID,
+		SessionID: filter.SessionID,
+		Statuses:  []string{store.RunStatePausedCheckpoint},
+		Limit:     store.MaxPageSize,
+	}
+	if query.TenantID == events.Wildcard {
+		query.TenantID = ""
+	}
+	if query.SessionID == events.Wildcard {
+		query.SessionID = ""
+	}
+
+	var checkpoints []*store.Event
+	for {
+		runs, next, err := r.store.SearchRuns(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		for _, run := range runs {
+			runEvents, err := r.store.GetEvents(ctx, run.ID)
+			if err != nil {
+				return nil, err
+			}
+			for i := len(runEvents) - 1; i >= 0; i-- {
+				if runEvents[i].Type != store.EventTypeCheckpointRequired {
+					continue
+				}
+				// Events stored before they carried their run's owner lack it
+				event := *runEvents[i]
+				event.TenantID, event.SessionID = run.TenantID, run.SessionID
+				if filter.Matches(&event) {
+					checkpoints = append(checkpoints, &event)
+				}
+				break
+			}
+		}
+		if next == "" {
+			break
+		}
+		query.Cursor = next
+	}
+
+	// Runs are listed newest first
+	slices.Reverse(checkpoints)
+	return checkpoints, nil
+}
+
+// UnsubscribeFromMatchingEvents removes a filtered subscription
+func (r *Runtime) UnsubscribeFromMatchingEvents(ch <-chan *store.Event) {
+	r.eventBus.UnsubscribeMatching(ch)
+}
+
 // UnsubscribeFromEvents unsubscribes from events for a run
 func (r *Runtime) UnsubscribeFromEvents(runID string, ch <-chan *store.Event) {
 	r.eventBus.Unsubscribe(runID, ch)
 }
 
+// Checkpoint types reported in checkpoint_required events
+const (
+	CheckpointTypeToolApproval   = "tool_approval"
+	CheckpointTypeBudgetExceeded = "budget_exceeded"
+)
+
 // CreateRunRequest represents a request to create a new run
 type CreateRunRequest struct {
 	SessionID string         `json:"session_id,omitempty"`
@@ -991,4 +2251,16 @@ type CreateRunRequest struct {
 	Mode      string         `json:"mode"` // interactive, autonomous
 	Input     string         `json:"input"`
 	Metadata  map[string]any `json:"metadata,omitempty"`
+
+	// IdempotencyKey makes retries of the request return the run created by
+	// the first attempt, when the agent config enables idempotency keys
+	IdempotencyKey string `json:"-"`
+}
+
+// hash fingerprints the request so a reused idempotency key can be checked
+// against the request that claimed it
+func (req *CreateRunRequest) hash() string {
+	data, _ := json.Marshal(req)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
 }
@@ -0,0 +1,276 @@
+package runtime
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shankarg87/agent/internal/config"
+	"github.com/shankarg87/agent/internal/events"
+	"github.com/shankarg87/agent/internal/mcp"
+	"github.com/shankarg87/agent/internal/provider"
+	"github.com/shankarg87/agent/internal/store"
+)
+
+func newBudgetTestRuntime(t *testing.T, maxCost float64, pauseOnBudget bool) (*Runtime, *RunContext) {
+	t.Helper()
+
+	cfg := testAgentConfig()
+	cfg.MaxCostUSD = maxCost
+	cfg.ApprovalPolicies.BudgetExceeded = pauseOnBudget
+
+	ctx := context.Background()
+	st := store.NewInMemoryStore()
+	session := &store.Session{ID: "session-1", TenantID: "tenant-1"}
+	assertNoError(t, st.CreateSession(ctx, session))
+	run := &store.Run{ID: "run-1", SessionID: session.ID, TenantID: "tenant-1", Mode: "autonomous", Status: store.RunStateRunning}
+	assertNoError(t, st.CreateRun(ctx, run))
+
+	rt := NewRuntime(config.NewConfigManagerForTest(cfg, &config.MCPConfig{}), st, events.NewEventBus(), &MockProvider{}, mcp.NewRegistry(), nil)
+	runCtx := &RunContext{
+		Run:          run,
+		Session:      session,
+		Config:       cfg,
+		BudgetUSD:    cfg.MaxCostUSD,
+		pauseSignal:  make(chan struct{}, 1),
+		resumeSignal: make(chan struct{}, 1),
+	}
+
+	return rt, runCtx
+}
+
+// registerActiveRun makes the run visible to ApproveToolCall
+func registerActiveRun(rt *Runtime, runCtx *RunContext, cancel context.CancelFunc) {
+	rt.mu.Lock()
+	rt.activeRuns[runCtx.Run.ID] = runCtx
+	rt.cancellations[runCtx.Run.ID] = cancel
+	rt.mu.Unlock()
+}
+
+func waitForEvent(t *testing.T, ch <-chan *store.Event, eventType string) *store.Event {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case event := <-ch:
+			if event.Type == eventType {
+				return event
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for %s event", eventType)
+		}
+	}
+}
+
+func TestRecordCost_UpdatesRunAndSession(t *testing.T) {
+	rt, runCtx := newBudgetTestRuntime(t, 1.0, false)
+	ctx := context.Background()
+
+	rt.recordCost(ctx, runCtx, 0.25, store.CostBreakdown{})
+	rt.recordCost(ctx, runCtx, 0.5, store.CostBreakdown{})
+
+	assertEqual(t, 0.75, runCtx.Run.CostUSD)
+
+	session, err := rt.store.GetSession(ctx, "session-1")
+	assertNoError(t, err)
+	assertEqual(t, 0.75, session.CostUSD)
+}
+
+func TestRecordCost_RunsInSameSessionAddUp(t *testing.T) {
+	rt, first := newBudgetTestRuntime(t, 0, false)
+	ctx := context.Background()
+
+	// Each run holds its own copy of the session, as one loaded from a
+	// SQL store would
+	sessionCopy := *first.Session
+	second := &RunContext{
+		Run:     &store.Run{ID: "run-2", SessionID: "session-1", TenantID: "tenant-1"},
+		Session: &sessionCopy,
+		Config:  first.Config,
+	}
+
+	rt.recordCost(ctx, first, 0.25, store.CostBreakdown{})
+	rt.recordCost(ctx, second, 0.5, store.CostBreakdown{})
+	rt.recordCost(ctx, first, 0.25, store.CostBreakdown{})
+
+	session, err := rt.store.GetSession(ctx, "session-1")
+	assertNoError(t, err)
+	assertEqual(t, 1.0, session.CostUSD)
+	assertEqual(t, 1.0, first.Session.CostUSD)
+}
+
+func TestCheckBudget_UnderBudgetOrUnlimited(t *testing.T) {
+	rt, runCtx := newBudgetTestRuntime(t, 1.0, false)
+	runCtx.Run.CostUSD = 0.5
+	assertNoError(t, rt.checkBudget(context.Background(), runCtx))
+
+	runCtx.BudgetUSD = 0
+	runCtx.Run.CostUSD = 100
+	assertNoError(t, rt.checkBudget(context.Background(), runCtx))
+}
+
+func TestCheckBudget_FailsWithoutApprovalPolicy(t *testing.T) {
+	rt, runCtx := newBudgetTestRuntime(t, 1.0, false)
+	runCtx.Run.CostUSD = 1.5
+
+	err := rt.checkBudget(context.Background(), runCtx)
+	assertError(t, err)
+	if !strings.Contains(err.Error(), "budget exceeded") {
+		t.Fatalf("Expected budget exceeded error, got: %v", err)
+	}
+}
+
+func TestCheckBudget_PausesAndExtendsOnApproval(t *testing.T) {
+	rt, runCtx := newBudgetTestRuntime(t, 1.0, true)
+	runCtx.Run.CostUSD = 1.5
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	registerActiveRun(rt, runCtx, cancel)
+
+	eventCh := rt.SubscribeToEvents(runCtx.Run.ID)
+	done := make(chan error, 1)
+	go func() { done <- rt.checkBudget(ctx, runCtx) }()
+
+	event := waitForEvent(t, eventCh, store.EventTypeCheckpointRequired)
+	assertEqual(t, CheckpointTypeBudgetExceeded, event.Data["checkpoint_type"].(string))
+	assertEqual(t, 1.5, event.Data["cost_usd"].(float64))
+	assertEqual(t, store.RunStatePausedCheckpoint, runCtx.Run.Status)
+
+	assertNoError(t, rt.ApproveToolCall(context.Background(), runCtx.Run.ID, true, "keep going"))
+
+	select {
+	case err := <-done:
+		assertNoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("checkBudget did not return after approval")
+	}
+
+	assertEqual(t, store.RunStateRunning, runCtx.Run.Status)
+	assertEqual(t, 2.0, runCtx.BudgetUSD)
+}
+
+func TestCheckBudget_ApprovalLiftsBudgetWhenLimitRemoved(t *testing.T) {
+	// The run was resumed with the budget it had before the limit was
+	// lifted to unlimited
+	rt, runCtx := newBudgetTestRuntime(t, 0, true)
+	runCtx.BudgetUSD = 1.0
+	runCtx.Run.CostUSD = 1.5
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	registerActiveRun(rt, runCtx, cancel)
+
+	eventCh := rt.SubscribeToEvents(runCtx.Run.ID)
+	done := make(chan error, 1)
+	go func() { done <- rt.checkBudget(ctx, runCtx) }()
+
+	waitForEvent(t, eventCh, store.EventTypeCheckpointRequired)
+	assertNoError(t, rt.ApproveToolCall(context.Background(), runCtx.Run.ID, true, "keep going"))
+
+	select {
+	case err := <-done:
+		assertNoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("checkBudget did not return after approval")
+	}
+	assertEqual(t, 0.0, runCtx.BudgetUSD)
+	assertNoError(t, rt.checkBudget(ctx, runCtx))
+}
+
+func TestCheckBudget_DenialCancelsRun(t *testing.T) {
+	rt, runCtx := newBudgetTestRuntime(t, 1.0, true)
+	runCtx.Run.CostUSD = 1.5
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	registerActiveRun(rt, runCtx, cancel)
+
+	eventCh := rt.SubscribeToEvents(runCtx.Run.ID)
+	done := make(chan error, 1)
+	go func() { done <- rt.checkBudget(ctx, runCtx) }()
+
+	waitForEvent(t, eventCh, store.EventTypeCheckpointRequired)
+	assertNoError(t, rt.ApproveToolCall(context.Background(), runCtx.Run.ID, false, "too expensive"))
+
+	event := waitForEvent(t, eventCh, store.EventTypeRunCancelled)
+	assertEqual(t, "budget_extension_denied", event.Data["reason"].(string))
+
+	select {
+	case err := <-done:
+		assertError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("checkBudget did not return after denial")
+	}
+
+	// failRun must not overwrite the cancellation
+	rt.failRun(context.Background(), runCtx.Run.ID, context.Canceled)
+	run, err := rt.store.GetRun(context.Background(), runCtx.Run.ID)
+	assertNoError(t, err)
+	assertEqual(t, store.RunStateCancelled, run.Status)
+}
+
+func TestRunAgentLoop_FailsWhenBudgetExceeded(t *testing.T) {
+	rt, runCtx := newBudgetTestRuntime(t, 0.0001, false)
+	rt.provider = &MockProvider{
+		StreamEvents: []provider.StreamEvent{
+			{Type: "content_delta", Content: "expensive"},
+			{Type: "tool_call", ToolCall: &provider.ToolCall{ID: "call_1", Function: provider.FunctionCall{Name: "lookup"}}},
+			{Type: "done", Done: true, Usage: &provider.Usage{PromptTokens: 500, CompletionTokens: 500, TotalTokens: 1000}},
+		},
+	}
+
+	err := rt.runAgentLoop(context.Background(), runCtx)
+	assertError(t, err)
+	if !strings.Contains(err.Error(), "budget exceeded") {
+		t.Fatalf("Expected budget exceeded error, got: %v", err)
+	}
+
+	// The tool call must not run once the budget is exhausted
+	assertEqual(t, 0, runCtx.ToolCallCount)
+}
+
+func TestRecordUsage_PricesByProviderAndModel(t *testing.T) {
+	rt, runCtx := newBudgetTestRuntime(t, 0, false)
+	runCtx.Config.Pricing = []config.ModelPricing{
+		{Provider: "openai", Model: "gpt-4o", PromptPerMTok: 2, CompletionPerMTok: 8, CacheReadPerMTok: 1},
+	}
+	ctx := context.Background()
+
+	rt.recordUsage(ctx, runCtx, "openai", "gpt-4o-2024-08-06", provider.Usage{
+		PromptTokens:     1_500_000,
+		CompletionTokens: 250_000,
+		CacheReadTokens:  500_000,
+	})
+
+	breakdown := runCtx.Run.CostBreakdown
+	assertEqual(t, 1_500_000, breakdown.PromptTokens)
+	assertEqual(t, 500_000, breakdown.CacheReadTokens)
+	assertEqual(t, 2.0, breakdown.PromptUSD)
+	assertEqual(t, 2.0, breakdown.CompletionUSD)
+	assertEqual(t, 0.5, breakdown.CacheReadUSD)
+	assertEqual(t, 4.5, runCtx.Run.CostUSD)
+	assertEqual(t, 4.5, runCtx.Session.CostUSD)
+}
+
+func TestRecordUsage_SavesBreakdownOnCopy(t *testing.T) {
+	rt, runCtx := newBudgetTestRuntime(t, 0, false)
+	runCtx.Config.Pricing = []config.ModelPricing{
+		{Provider: "openai", Model: "gpt-4o", PromptPerMTok: 2, CompletionPerMTok: 8},
+	}
+	ctx := context.Background()
+	before := runCtx.Run
+
+	rt.recordUsage(ctx, runCtx, "openai", "gpt-4o", provider.Usage{PromptTokens: 1_000_000})
+
+	// A handler holding the previous run never sees it change
+	assertEqual(t, 0, before.CostBreakdown.PromptTokens)
+	assertEqual(t, 0.0, before.CostUSD)
+
+	stored, err := rt.store.GetRun(ctx, runCtx.Run.ID)
+	assertNoError(t, err)
+	assertEqual(t, 1_000_000, stored.CostBreakdown.PromptTokens)
+	assertEqual(t, 2.0, stored.CostBreakdown.PromptUSD)
+	assertEqual(t, 2.0, stored.CostUSD)
+}
@@ -0,0 +1,85 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/shankarg87/agent/internal/compaction"
+	"github.com/shankarg87/agent/internal/provider"
+	"github.com/shankarg87/agent/internal/store"
+)
+
+func TestCompactHistory_SummarizesAndStoresMarker(t *testing.T) {
+	rt, runCtx := newBudgetTestRuntime(t, 0, false)
+	rt.provider = &MockProvider{
+		ChatResponse: &provider.ChatResponse{Content: "The user asked about 30 topics.", FinishReason: "stop"},
+	}
+
+	// testAgentConfig allows 4096 context tokens; this history is far larger
+	ctx := context.Background()
+	for i := 0; i < 30; i++ {
+		for _, msg := range []*store.Message{
+			{Role: "user", Content: fmt.Sprintf("topic %d: %s", i, strings.Repeat("x", 400))},
+			{Role: "assistant", Content: strings.Repeat("y", 400)},
+		} {
+			assertNoError(t, rt.store.AddMessage(ctx, runCtx.Session.ID, msg))
+			runCtx.Messages = append(runCtx.Messages, msg)
+		}
+	}
+
+	events := rt.eventBus.Subscribe(runCtx.Run.ID)
+	defer rt.eventBus.Unsubscribe(runCtx.Run.ID, events)
+
+	assertNoError(t, rt.compactHistory(ctx, runCtx, nil))
+
+	// The marker is stored in the session so it isn't recomputed
+	stored, err := rt.store.GetMessages(ctx, runCtx.Session.ID)
+	assertNoError(t, err)
+	marker := stored[len(stored)-1]
+	assertNotNil(t, marker.Compaction)
+	assertEqual(t, compaction.StrategySummarize, marker.Compaction.Strategy)
+	assertEqual(t, "system", marker.Role)
+
+	event := waitForEvent(t, events, store.EventTypeContextCompacted)
+	assertEqual(t, compaction.StrategySummarize, event.Data["strategy"].(string))
+
+	// Requests start with the summary and keep only recent history
+	msgs := rt.buildProviderMessages(runCtx)
+	assertEqual(t, "system", msgs[0].Role)
+	assertEqual(t, "user", msgs[1].Role)
+	assertEqual(t, true, strings.Contains(msgs[1].Content, "The user asked about 30 topics."))
+	assertEqual(t, true, len(msgs) < len(runCtx.Messages))
+	assertEqual(t, strings.Repeat("y", 400), msgs[len(msgs)-1].Content)
+
+	// Nothing more to do on the next turn
+	assertNoError(t, rt.compactHistory(ctx, runCtx, nil))
+	stored, err = rt.store.GetMessages(ctx, runCtx.Session.ID)
+	assertNoError(t, err)
+	assertEqual(t, 61, len(stored))
+}
+
+func TestCompactHistory_CountsFromReportedPromptTokens(t *testing.T) {
+	rt, runCtx := newBudgetTestRuntime(t, 0, false)
+	runCtx.Config.Compaction.Strategy = compaction.StrategyDropOldest
+
+	// A short history the estimate puts well within 4096 context tokens
+	ctx := context.Background()
+	for i := 0; i < 4; i++ {
+		msg := &store.Message{Role: "user", Content: fmt.Sprintf("question %d", i)}
+		if i%2 == 1 {
+			msg.Role = "assistant"
+		}
+		assertNoError(t, rt.store.AddMessage(ctx, runCtx.Session.ID, msg))
+		runCtx.Messages = append(runCtx.Messages, msg)
+	}
+	assertNoError(t, rt.compactHistory(ctx, runCtx, nil))
+	assertEqual(t, 4, len(runCtx.Messages))
+
+	// The provider reported a much larger prompt for the first three
+	runCtx.promptTokens, runCtx.promptMessages = 3000, 3
+	assertNoError(t, rt.compactHistory(ctx, runCtx, nil))
+	assertEqual(t, 5, len(runCtx.Messages))
+	assertNotNil(t, runCtx.Messages[4].Compaction)
+}
@@ -0,0 +1,277 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	mcpgo "github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/shankarg87/agent/internal/config"
+	"github.com/shankarg87/agent/internal/events"
+	"github.com/shankarg87/agent/internal/mcp"
+	"github.com/shankarg87/agent/internal/provider"
+	"github.com/shankarg87/agent/internal/store"
+)
+
+// slowLookupServer registers an in-process MCP server whose "lookup" tool
+// sleeps for delay_ms before answering and records the peak number of
+// concurrent calls.
+func slowLookupServer(t *testing.T, registry *mcp.Registry, peak *int32) {
+	t.Helper()
+
+	var inFlight int32
+	srv := server.NewMCPServer("lookup-server", "1.0.0", server.WithToolCapabilities(false))
+	srv.AddTool(mcpgo.NewTool("lookup", mcpgo.WithString("query")), func(ctx context.Context, req mcpgo.CallToolRequest) (*mcpgo.CallToolResult, error) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			p := atomic.LoadInt32(peak)
+			if n <= p || atomic.CompareAndSwapInt32(peak, p, n) {
+				break
+			}
+		}
+
+		query, _ := req.GetArguments()["query"].(string)
+		wait, _ := req.GetArguments()["delay_ms"].(float64)
+		time.Sleep(time.Duration(wait) * time.Millisecond)
+		return mcpgo.NewToolResultText("result for " + query), nil
+	})
+
+	mcpClient, err := client.NewInProcessClient(srv)
+	assertNoError(t, err)
+	t.Cleanup(func() { mcpClient.Close() })
+
+	ctx := context.Background()
+	assertNoError(t, mcpClient.Start(ctx))
+	_, err = mcpClient.Initialize(ctx, mcpgo.InitializeRequest{
+		Params: mcpgo.InitializeParams{
+			ProtocolVersion: mcpgo.LATEST_PROTOCOL_VERSION,
+			ClientInfo:      mcpgo.Implementation{Name: "test", Version: "1.0.0"},
+		},
+	})
+	assertNoError(t, err)
+
+	registry.SetServer("lookup-server", &mcp.MCPServer{
+		Name:   "lookup-server",
+		Client: mcpClient,
+		Tools: map[string]*mcp.Tool{
+			"lookup": {Name: "lookup", ServerName: "lookup-server"},
+		},
+	})
+}
+
+func newParallelTestRuntime(t *testing.T, concurrencyLimit int) (*Runtime, *RunContext, *int32) {
+	t.Helper()
+
+	cfg := testAgentConfig()
+	cfg.Tools = []config.ToolConfig{{ServerName: "lookup-server", ConcurrencyLimit: concurrencyLimit}}
+
+	registry := mcp.NewRegistry()
+	var peak int32
+	slowLookupServer(t, registry, &peak)
+
+	st := store.NewInMemoryStore()
+	session := &store.Session{ID: "session-1", TenantID: "tenant-1"}
+	assertNoError(t, st.CreateSession(context.Background(), session))
+
+	run := &store.Run{ID: "run-1", SessionID: session.ID, TenantID: "tenant-1", Mode: "interactive"}
+	assertNoError(t, st.CreateRun(context.Background(), run))
+
+	rt := NewRuntime(config.NewConfigManagerForTest(cfg, &config.MCPConfig{}), st, events.NewEventBus(), &MockProvider{}, registry, nil)
+	runCtx := &RunContext{
+		Run:     run,
+		Session: session,
+		Config:  cfg,
+	}
+
+	return rt, runCtx, &peak
+}
+
+// lookupCalls builds n lookup calls where later calls finish first, so
+// completion order is the reverse of request order
+func lookupCalls(n int) []provider.ToolCall {
+	calls := make([]provider.ToolCall, n)
+	for i := range calls {
+		calls[i] = provider.ToolCall{
+			ID:   fmt.Sprintf("call_%d", i),
+			Type: "function",
+			Function: provider.FunctionCall{
+				Name:      "lookup",
+				Arguments: fmt.Sprintf(`{"query":"q%d","delay_ms":%d}`, i, 60-10*i),
+			},
+		}
+	}
+	return calls
+}
+
+func TestHandleToolCalls_RunsInParallel(t *testing.T) {
+	rt, runCtx, peak := newParallelTestRuntime(t, 0)
+
+	start := time.Now()
+	err := rt.handleToolCalls(context.Background(), runCtx, lookupCalls(5))
+	elapsed := time.Since(start)
+	assertNoError(t, err)
+
+	if atomic.LoadInt32(peak) < 2 {
+		t.Fatalf("Expected tool calls to overlap, peak concurrency was %d", atomic.LoadInt32(peak))
+	}
+	if elapsed > 250*time.Millisecond {
+		t.Fatalf("Expected parallel execution, took %v", elapsed)
+	}
+	assertEqual(t, 5, runCtx.ToolCallCount)
+}
+
+func TestHandleToolCalls_RespectsConcurrencyLimit(t *testing.T) {
+	rt, runCtx, peak := newParallelTestRuntime(t, 2)
+
+	err := rt.handleToolCalls(context.Background(), runCtx, lookupCalls(5))
+	assertNoError(t, err)
+
+	assertEqual(t, int32(2), atomic.LoadInt32(peak))
+}
+
+func TestAcquireToolSlot_RunsWithDifferentLimits(t *testing.T) {
+	rt, _, _ := newParallelTestRuntime(t, 0)
+	ctx := context.Background()
+	strict := &config.ToolConfig{ServerName: "lookup-server", ConcurrencyLimit: 1}
+	loose := &config.ToolConfig{ServerName: "lookup-server", ConcurrencyLimit: 3}
+
+	release, err := rt.acquireToolSlot(ctx, strict)
+	assertNoError(t, err)
+	defer release()
+
+	// A run on a config snapshot with a higher limit takes its own slots
+	// while the first run holds its only one
+	acquired := make(chan func(), 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			release, err := rt.acquireToolSlot(ctx, loose)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			acquired <- release
+		}()
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case release := <-acquired:
+			defer release()
+		case <-time.After(time.Second):
+			t.Fatal("Timed out waiting for a slot under the higher limit")
+		}
+	}
+
+	// ...without resetting the count for the run still on the lower limit
+	waitCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := rt.acquireToolSlot(waitCtx, strict); err == nil {
+		t.Fatal("Expected the run with a limit of 1 to wait for its slot")
+	}
+}
+
+func TestHandleToolCalls_ResultsInRequestOrder(t *testing.T) {
+	rt, runCtx, _ := newParallelTestRuntime(t, 0)
+
+	calls := lookupCalls(4)
+	err := rt.handleToolCalls(context.Background(), runCtx, calls)
+	assertNoError(t, err)
+
+	// One assistant message followed by one tool message per call
+	assertEqual(t, 5, len(runCtx.Messages))
+	assertEqual(t, "assistant", runCtx.Messages[0].Role)
+	for i := range calls {
+		msg := runCtx.Messages[i+1]
+		assertEqual(t, "tool", msg.Role)
+		assertEqual(t, fmt.Sprintf("result for q%d", i), msg.Content)
+	}
+
+	stored, err := rt.store.GetMessages(context.Background(), runCtx.Session.ID)
+	assertNoError(t, err)
+	assertEqual(t, 5, len(stored))
+	assertEqual(t, "result for q0", stored[1].Content)
+}
+
+func TestHandleToolCalls_LinksResultsToCalls(t *testing.T) {
+	rt, runCtx, _ := newParallelTestRuntime(t, 0)
+
+	calls := append(lookupCalls(2), provider.ToolCall{
+		ID:       "call_missing",
+		Type:     "function",
+		Function: provider.FunctionCall{Name: "missing", Arguments: "{}"},
+	})
+	err := rt.handleToolCalls(context.Background(), runCtx, calls)
+	assertNoError(t, err)
+
+	stored, err := rt.store.GetMessages(context.Background(), runCtx.Session.ID)
+	assertNoError(t, err)
+	assertEqual(t, 4, len(stored))
+	for i, tc := range calls {
+		assertEqual(t, tc.ID, stored[i+1].ToolCallID)
+		assertEqual(t, tc.Function.Name, stored[i+1].ToolName)
+		assertEqual(t, 0, len(stored[i+1].ToolCalls))
+	}
+
+	// The linkage is carried through to the provider request
+	msgs := rt.buildProviderMessages(runCtx)
+	last := msgs[len(msgs)-1]
+	assertEqual(t, "tool", last.Role)
+	assertEqual(t, "call_missing", last.ToolCallID)
+	assertEqual(t, "missing", last.Name)
+}
+
+func TestHandleToolCalls_RecordsToolCalls(t *testing.T) {
+	rt, runCtx, _ := newParallelTestRuntime(t, 0)
+	runCtx.Config.Tools[0].Redaction.Arguments = []string{"QUERY"}
+
+	calls := append(lookupCalls(1), provider.ToolCall{
+		ID:       "call_missing",
+		Type:     "function",
+		Function: provider.FunctionCall{Name: "missing", Arguments: "{}"},
+	})
+	err := rt.handleToolCalls(context.Background(), runCtx, calls)
+	assertNoError(t, err)
+
+	records, err := rt.GetToolCalls(context.Background(), "run-1")
+	assertNoError(t, err)
+	assertEqual(t, 2, len(records))
+
+	lookup := records[0]
+	assertEqual(t, "call_0", lookup.ID)
+	assertEqual(t, "lookup-server", lookup.ServerName)
+	assertEqual(t, store.ToolCallStatusCompleted, lookup.Status)
+	assertEqual(t, "result for q0", lookup.Output)
+	assertEqual(t, "[REDACTED]", lookup.Arguments["query"].(string))
+	assertEqual(t, float64(60), lookup.Arguments["delay_ms"].(float64))
+	if lookup.StartedAt == nil || lookup.CompletedAt == nil {
+		t.Fatalf("Expected start and completion times, got %+v", lookup)
+	}
+
+	missing := records[1]
+	assertEqual(t, store.ToolCallStatusFailed, missing.Status)
+	if missing.Error == "" {
+		t.Fatal("Expected the failure to be recorded")
+	}
+}
+
+func TestRedactArguments(t *testing.T) {
+	args := map[string]any{
+		"path":    "/tmp/report",
+		"api_key": "sk-123",
+		"auth":    map[string]any{"user": "ops", "password": "hunter2"},
+	}
+
+	redacted := redactArguments(args, []string{"key", "password"})
+	assertEqual(t, "/tmp/report", redacted["path"].(string))
+	assertEqual(t, "[REDACTED]", redacted["api_key"].(string))
+	nested := redacted["auth"].(map[string]any)
+	assertEqual(t, "ops", nested["user"].(string))
+	assertEqual(t, "[REDACTED]", nested["password"].(string))
+
+	// The arguments sent to the tool are left alone
+	assertEqual(t, "sk-123", args["api_key"].(string))
+}
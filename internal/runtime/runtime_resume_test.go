@@ -0,0 +1,270 @@
+package runtime
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shankarg87/agent/internal/config"
+	"github.com/shankarg87/agent/internal/events"
+	"github.com/shankarg87/agent/internal/mcp"
+	"github.com/shankarg87/agent/internal/provider"
+	"github.com/shankarg87/agent/internal/store"
+)
+
+// newResumeTestRuntime stores run-1 in the given status, as a previous
+// process left it after the model asked for a lookup that never recorded a
+// result
+func newResumeTestRuntime(t *testing.T, status string, toolConfig config.ToolConfig) *Runtime {
+	t.Helper()
+
+	cfg := testAgentConfig()
+	toolConfig.ServerName = "lookup-server"
+	cfg.Tools = []config.ToolConfig{toolConfig}
+
+	registry := mcp.NewRegistry()
+	var peak int32
+	slowLookupServer(t, registry, &peak)
+
+	ctx := context.Background()
+	st := store.NewInMemoryStore()
+	assertNoError(t, st.CreateSession(ctx, &store.Session{ID: "session-1", TenantID: "tenant-1"}))
+	assertNoError(t, st.CreateRun(ctx, &store.Run{ID: "run-1", SessionID: "session-1", TenantID: "tenant-1", Mode: "interactive", Status: status}))
+	assertNoError(t, st.AddMessage(ctx, "session-1", &store.Message{Role: "user", Content: "Look up q0"}))
+
+	call := store.ToolCallRef{ID: "call_0", Type: "function"}
+	call.Function.Name = "lookup"
+	call.Function.Arguments = `{"query":"q0"}`
+	assertNoError(t, st.AddMessage(ctx, "session-1", &store.Message{Role: "assistant", ToolCalls: []store.ToolCallRef{call}}))
+
+	prov := &MockProvider{
+		StreamEvents: []provider.StreamEvent{
+			{Type: "content_delta", Content: "Found it"},
+			{Type: "done", Done: true, FinishReason: "stop"},
+		},
+	}
+	return NewRuntime(config.NewConfigManagerForTest(cfg, &config.MCPConfig{}), st, events.NewEventBus(), prov, registry, nil)
+}
+
+// toolResults returns the content of the session's tool result messages
+func toolResults(t *testing.T, rt *Runtime) []string {
+	t.Helper()
+	messages, err := rt.store.GetMessages(context.Background(), "session-1")
+	assertNoError(t, err)
+
+	var results []string
+	for _, msg := range messages {
+		if msg.Role == "tool" {
+			results = append(results, msg.Content)
+		}
+	}
+	return results
+}
+
+func TestResumeRuns_RetriesIdempotentToolCall(t *testing.T) {
+	rt := newResumeTestRuntime(t, store.RunStateRunning, config.ToolConfig{Idempotent: true})
+	ch := rt.SubscribeToEvents("run-1")
+
+	assertNoError(t, rt.ResumeRuns(context.Background()))
+	waitForEvent(t, ch, store.EventTypeRunCompleted)
+
+	assertEqual(t, 1, len(toolResults(t, rt)))
+	assertEqual(t, "result for q0", toolResults(t, rt)[0])
+
+	run, err := rt.store.GetRun(context.Background(), "run-1")
+	assertNoError(t, err)
+	assertEqual(t, store.RunStateCompleted, run.Status)
+	assertEqual(t, "Found it", run.Output)
+	assertEqual(t, 1, run.ToolCallCount)
+}
+
+func TestResumeRuns_ReapprovesNonIdempotentToolCall(t *testing.T) {
+	rt := newResumeTestRuntime(t, store.RunStateRunning, config.ToolConfig{})
+	ch := rt.SubscribeToEvents("run-1")
+
+	assertNoError(t, rt.ResumeRuns(context.Background()))
+	checkpoint := waitForEvent(t, ch, store.EventTypeCheckpointRequired)
+	assertEqual(t, "call_0", checkpoint.Data["tool_call_id"].(string))
+	assertEqual(t, 0, len(toolResults(t, rt)))
+
+	run, err := rt.store.GetRun(context.Background(), "run-1")
+	assertNoError(t, err)
+	assertEqual(t, store.RunStatePausedCheckpoint, run.Status)
+
+	assertNoError(t, rt.ApproveToolCall(context.Background(), "run-1", true, "it did not run"))
+	waitForEvent(t, ch, store.EventTypeRunCompleted)
+	assertEqual(t, 1, len(toolResults(t, rt)))
+}
+
+func TestResumeRuns_RaisesPendingCheckpointAgain(t *testing.T) {
+	rt := newResumeTestRuntime(t, store.RunStatePausedCheckpoint, config.ToolConfig{
+		Idempotent:       true,
+		RequiresApproval: config.ApprovalRequirement{Always: true},
+	})
+	ch := rt.SubscribeToEvents("run-1")
+
+	assertNoError(t, rt.ResumeRuns(context.Background()))
+	checkpoint := waitForEvent(t, ch, store.EventTypeCheckpointRequired)
+	assertEqual(t, CheckpointTypeToolApproval, checkpoint.Data["checkpoint_type"].(string))
+
+	assertNoError(t, rt.ApproveToolCall(context.Background(), "run-1", false, "no longer needed"))
+	waitForEvent(t, ch, store.EventTypeRunCancelled)
+	assertEqual(t, 0, len(toolResults(t, rt)))
+}
+
+func TestResumeRuns_PausedRunWaitsForResume(t *testing.T) {
+	rt := newResumeTestRuntime(t, store.RunStatePaused, config.ToolConfig{Idempotent: true})
+	ch := rt.SubscribeToEvents("run-1")
+
+	assertNoError(t, rt.ResumeRuns(context.Background()))
+	waitForEvent(t, ch, store.EventTypeTextDelta)
+
+	run, err := rt.store.GetRun(context.Background(), "run-1")
+	assertNoError(t, err)
+	assertEqual(t, store.RunStatePaused, run.Status)
+	assertEqual(t, 0, len(toolResults(t, rt)))
+
+	assertNoError(t, rt.ResumeRun(context.Background(), "run-1"))
+	waitForEvent(t, ch, store.EventTypeRunCompleted)
+	assertEqual(t, 1, len(toolResults(t, rt)))
+}
+
+func TestResumeRuns_SkipsRunLeasedByAnotherReplica(t *testing.T) {
+	rt := newResumeTestRuntime(t, store.RunStateRunning, config.ToolConfig{Idempotent: true})
+	ctx := context.Background()
+	ch := rt.SubscribeToEvents("run-1")
+
+	// Another replica is still executing the run
+	assertNoError(t, rt.store.ClaimRun(ctx, "run-1", "replica-b", time.Now().Add(time.Minute)))
+	assertNoError(t, rt.ResumeRuns(ctx))
+	assertEqual(t, false, rt.isExecuting("run-1"))
+
+	// Once it stops renewing its lease, the run is taken over
+	assertNoError(t, rt.store.ClaimRun(ctx, "run-1", "replica-b", time.Now().Add(-time.Second)))
+	assertNoError(t, rt.ResumeRuns(ctx))
+	waitForEvent(t, ch, store.EventTypeRunCompleted)
+	assertEqual(t, 1, len(toolResults(t, rt)))
+}
+
+func TestResumeRuns_OneReplicaResumesEachRun(t *testing.T) {
+	a := newResumeTestRuntime(t, store.RunStateRunning, config.ToolConfig{Idempotent: true})
+	a.SetReplicaID("replica-a")
+	b := NewRuntime(a.configManager, a.store, a.eventBus, a.provider, a.mcpRegistry, nil)
+	b.SetReplicaID("replica-b")
+	ch := a.SubscribeToEvents("run-1")
+
+	ctx := context.Background()
+	assertNoError(t, a.ResumeRuns(ctx))
+	assertNoError(t, b.ResumeRuns(ctx))
+	waitForEvent(t, ch, store.EventTypeRunCompleted)
+
+	assertEqual(t, 1, len(toolResults(t, a)))
+}
+
+func TestInterruptedToolCalls(t *testing.T) {
+	runCreated := time.Now()
+	ref := func(id string) store.ToolCallRef {
+		tc := store.ToolCallRef{ID: id, Type: "function"}
+		tc.Function.Name = "lookup"
+		return tc
+	}
+
+	messages := []*store.Message{
+		// Left unanswered by an earlier run in the session
+		{Role: "assistant", ToolCalls: []store.ToolCallRef{ref("old")}, CreatedAt: runCreated.Add(-time.Minute)},
+		{Role: "user", Content: "hi", CreatedAt: runCreated},
+	}
+	assertEqual(t, 0, len(interruptedToolCalls(messages, runCreated)))
+
+	messages = append(messages,
+		&store.Message{Role: "assistant", ToolCalls: []store.ToolCallRef{ref("call_1"), ref("call_2")}, CreatedAt: runCreated},
+		&store.Message{Role: "tool", ToolCallID: "call_1", CreatedAt: runCreated},
+	)
+	calls := interruptedToolCalls(messages, runCreated)
+	assertEqual(t, 1, len(calls))
+	assertEqual(t, "call_2", calls[0].ID)
+	assertEqual(t, "lookup", calls[0].Function.Name)
+
+	messages = append(messages, &store.Message{Role: "tool", ToolCallID: "call_2", CreatedAt: runCreated})
+	assertEqual(t, 0, len(interruptedToolCalls(messages, runCreated)))
+}
+
+func TestResumeRuns_UsesToolCallRecords(t *testing.T) {
+	record := func(status string) *store.ToolCall {
+		startedAt := time.Now()
+		return &store.ToolCall{ID: "call_0", ToolName: "lookup", Status: status, Output: "result before restart", StartedAt: &startedAt}
+	}
+
+	t.Run("CompletedCallIsNotRepeated", func(t *testing.T) {
+		rt := newResumeTestRuntime(t, store.RunStateRunning, config.ToolConfig{})
+		assertNoError(t, rt.store.AddToolCall(context.Background(), "run-1", record(store.ToolCallStatusCompleted)))
+		ch := rt.SubscribeToEvents("run-1")
+
+		assertNoError(t, rt.ResumeRuns(context.Background()))
+		waitForEvent(t, ch, store.EventTypeRunCompleted)
+		assertEqual(t, "result before restart", toolResults(t, rt)[0])
+	})
+
+	t.Run("UnstartedCallNeedsNoApproval", func(t *testing.T) {
+		rt := newResumeTestRuntime(t, store.RunStateRunning, config.ToolConfig{})
+		assertNoError(t, rt.store.AddToolCall(context.Background(), "run-1", &store.ToolCall{ID: "call_0", ToolName: "lookup", Status: store.ToolCallStatusPending}))
+		ch := rt.SubscribeToEvents("run-1")
+
+		assertNoError(t, rt.ResumeRuns(context.Background()))
+		waitForEvent(t, ch, store.EventTypeRunCompleted)
+		assertEqual(t, "result for q0", toolResults(t, rt)[0])
+
+		records, err := rt.GetToolCalls(context.Background(), "run-1")
+		assertNoError(t, err)
+		assertEqual(t, 1, len(records))
+		assertEqual(t, 0, records[0].RetryCount)
+	})
+
+	t.Run("StartedCallCountsRetry", func(t *testing.T) {
+		rt := newResumeTestRuntime(t, store.RunStateRunning, config.ToolConfig{Idempotent: true})
+		assertNoError(t, rt.store.AddToolCall(context.Background(), "run-1", record(store.ToolCallStatusRunning)))
+		ch := rt.SubscribeToEvents("run-1")
+
+		assertNoError(t, rt.ResumeRuns(context.Background()))
+		waitForEvent(t, ch, store.EventTypeRunCompleted)
+
+		records, err := rt.GetToolCalls(context.Background(), "run-1")
+		assertNoError(t, err)
+		assertEqual(t, store.ToolCallStatusCompleted, records[0].Status)
+		assertEqual(t, "result for q0", records[0].Output)
+		assertEqual(t, 1, records[0].RetryCount)
+	})
+}
+
+func TestResumeRuns_KeepsApprovedBudget(t *testing.T) {
+	cfg := testAgentConfig()
+	cfg.MaxCostUSD = 1
+	cfg.ApprovalPolicies.BudgetExceeded = true
+
+	// Before the restart the run spent $1.50, after an operator extended
+	// its $1 budget to $2
+	ctx := context.Background()
+	st := store.NewInMemoryStore()
+	assertNoError(t, st.CreateSession(ctx, &store.Session{ID: "session-1", TenantID: "tenant-1"}))
+	assertNoError(t, st.CreateRun(ctx, &store.Run{
+		ID: "run-1", SessionID: "session-1", TenantID: "tenant-1", Mode: "autonomous",
+		Status: store.RunStateRunning, CostUSD: 1.5, BudgetUSD: 2,
+	}))
+	assertNoError(t, st.AddMessage(ctx, "session-1", &store.Message{Role: "user", Content: "Keep going"}))
+
+	prov := &MockProvider{
+		StreamEvents: []provider.StreamEvent{
+			{Type: "content_delta", Content: "Done"},
+			{Type: "done", Done: true, FinishReason: "stop"},
+		},
+	}
+	rt := NewRuntime(config.NewConfigManagerForTest(cfg, &config.MCPConfig{}), st, events.NewEventBus(), prov, mcp.NewRegistry(), nil)
+	ch := rt.SubscribeToEvents("run-1")
+
+	assertNoError(t, rt.ResumeRuns(ctx))
+	waitForEvent(t, ch, store.EventTypeRunCompleted)
+
+	run, err := st.GetRun(ctx, "run-1")
+	assertNoError(t, err)
+	assertEqual(t, 2.0, run.BudgetUSD)
+}
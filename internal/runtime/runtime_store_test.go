@@ -0,0 +1,336 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shankarg87/agent/internal/config"
+	"github.com/shankarg87/agent/internal/events"
+	"github.com/shankarg87/agent/internal/mcp"
+	"github.com/shankarg87/agent/internal/store"
+)
+
+// newSQLiteTestRuntime runs against a SQLite store, which commits writes in
+// transactions and round-trips runs through SQL
+func newSQLiteTestRuntime(t *testing.T) (*Runtime, *RunContext) {
+	t.Helper()
+	if !store.SQLiteAvailable {
+		t.Skip("SQLite store requires cgo")
+	}
+
+	st, err := store.NewSQLiteStore(filepath.Join(t.TempDir(), "agent.db"))
+	assertNoError(t, err)
+	t.Cleanup(func() { st.Close() })
+	return newRunTestRuntime(t, st)
+}
+
+// newRunTestRuntime creates session-1 and a running run-1 in st and returns
+// a runtime over it, with the run loaded as the agent loop holds it
+func newRunTestRuntime(t *testing.T, st store.Store) (*Runtime, *RunContext) {
+	t.Helper()
+
+	ctx := context.Background()
+	session := &store.Session{ID: "session-1", TenantID: "tenant-1"}
+	assertNoError(t, st.CreateSession(ctx, session))
+	assertNoError(t, st.CreateRun(ctx, &store.Run{ID: "run-1", SessionID: session.ID, TenantID: "tenant-1", Status: store.RunStateRunning}))
+	run, err := st.GetRun(ctx, "run-1")
+	assertNoError(t, err)
+
+	cfg := testAgentConfig()
+	rt := NewRuntime(config.NewConfigManagerForTest(cfg, &config.MCPConfig{}), st, events.NewEventBus(), &MockProvider{}, mcp.NewRegistry(), nil)
+	return rt, &RunContext{Run: run, Session: session, Config: cfg}
+}
+
+// testSaveRunConflict runs a version-conflict test against the memory store,
+// which always runs, and against SQLite where cgo is available
+func testSaveRunConflict(t *testing.T, test func(t *testing.T, rt *Runtime, runCtx *RunContext)) {
+	t.Run("memory", func(t *testing.T) {
+		rt, runCtx := newRunTestRuntime(t, store.NewInMemoryStore())
+		test(t, rt, runCtx)
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		rt, runCtx := newSQLiteTestRuntime(t)
+		test(t, rt, runCtx)
+	})
+}
+
+// setStoredStatus changes the run's status through another copy, as an
+// operator does while the loop is working
+func setStoredStatus(t *testing.T, rt *Runtime, status string) {
+	t.Helper()
+	_, err := rt.updateRun(context.Background(), "run-1", func(run *store.Run) error {
+		run.Status = status
+		return nil
+	})
+	assertNoError(t, err)
+}
+
+func TestSaveRun_KeepsConcurrentCancellation(t *testing.T) {
+	testSaveRunConflict(t, func(t *testing.T, rt *Runtime, runCtx *RunContext) {
+		ctx := context.Background()
+		setStoredStatus(t, rt, store.RunStateCancelled)
+
+		runCtx.Run.ToolCallCount = 3
+		runCtx.Run.Status = store.RunStateCompleted
+		assertNoError(t, rt.saveRun(ctx, rt.store, runCtx.Run))
+
+		stored, err := rt.store.GetRun(ctx, "run-1")
+		assertNoError(t, err)
+		assertEqual(t, store.RunStateCancelled, stored.Status)
+		assertEqual(t, 3, stored.ToolCallCount)
+		assertEqual(t, stored.Version, runCtx.Run.Version)
+	})
+}
+
+func TestSaveRun_KeepsOperatorPause(t *testing.T) {
+	testSaveRunConflict(t, func(t *testing.T, rt *Runtime, runCtx *RunContext) {
+		ctx := context.Background()
+		setStoredStatus(t, rt, store.RunStatePaused)
+
+		runCtx.Run.ToolCallCount = 2
+		runCtx.Run.CostUSD = 0.5
+		assertNoError(t, rt.saveRun(ctx, rt.store, runCtx.Run))
+
+		stored, err := rt.store.GetRun(ctx, "run-1")
+		assertNoError(t, err)
+		assertEqual(t, store.RunStatePaused, stored.Status)
+		assertEqual(t, 2, stored.ToolCallCount)
+		assertEqual(t, 0.5, stored.CostUSD)
+		assertEqual(t, store.RunStatePaused, runCtx.Run.Status)
+	})
+}
+
+func TestSaveRun_LoopTransitionsWinOverStaleCopy(t *testing.T) {
+	testSaveRunConflict(t, func(t *testing.T, rt *Runtime, runCtx *RunContext) {
+		ctx := context.Background()
+
+		// A pause and resume leave the loop's copy a version behind
+		setStoredStatus(t, rt, store.RunStatePaused)
+		setStoredStatus(t, rt, store.RunStateRunning)
+
+		runCtx.Run.Status = store.RunStatePausedCheckpoint
+		assertNoError(t, rt.saveRun(ctx, rt.store, runCtx.Run))
+		stored, err := rt.store.GetRun(ctx, "run-1")
+		assertNoError(t, err)
+		assertEqual(t, store.RunStatePausedCheckpoint, stored.Status)
+
+		setStoredStatus(t, rt, store.RunStatePausedCheckpoint)
+		runCtx.Run.Status = store.RunStateCompleted
+		runCtx.Run.Output = "done"
+		assertNoError(t, rt.saveRun(ctx, rt.store, runCtx.Run))
+		stored, err = rt.store.GetRun(ctx, "run-1")
+		assertNoError(t, err)
+		assertEqual(t, store.RunStateCompleted, stored.Status)
+		assertEqual(t, "done", stored.Output)
+	})
+}
+
+func TestCreateRun_WritesRunAndInputTogether(t *testing.T) {
+	rt, _ := newSQLiteTestRuntime(t)
+	ctx := context.Background()
+
+	run, err := rt.CreateRun(ctx, &CreateRunRequest{TenantID: "tenant-1", Mode: "interactive", Input: "Hello"})
+	assertNoError(t, err)
+
+	stored, err := rt.store.GetRun(ctx, run.ID)
+	assertNoError(t, err)
+	assertEqual(t, "Hello", stored.Input)
+
+	messages, err := rt.store.GetMessages(ctx, run.SessionID)
+	assertNoError(t, err)
+	assertEqual(t, "Hello", messages[0].Content)
+
+	// Creating a run in a missing session writes nothing
+	_, err = rt.CreateRun(ctx, &CreateRunRequest{SessionID: "missing", TenantID: "tenant-1", Input: "Hi"})
+	assertError(t, err)
+}
+
+// newMemoryTestRuntime runs against the in-memory store, which has no
+// transactions
+func newMemoryTestRuntime(t *testing.T, st store.Store) (*Runtime, *config.AgentConfig) {
+	t.Helper()
+	cfg := testAgentConfig()
+	return NewRuntime(config.NewConfigManagerForTest(cfg, &config.MCPConfig{}), st, events.NewEventBus(), &MockProvider{}, mcp.NewRegistry(), nil), cfg
+}
+
+func TestCreateRun_IdempotencyKey(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		rt, cfg := newMemoryTestRuntime(t, store.NewInMemoryStore())
+		testCreateRunIdempotencyKey(t, rt, cfg)
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		rt, runCtx := newSQLiteTestRuntime(t)
+		testCreateRunIdempotencyKey(t, rt, runCtx.Config)
+	})
+}
+
+func testCreateRunIdempotencyKey(t *testing.T, rt *Runtime, cfg *config.AgentConfig) {
+	cfg.IdempotencyKeys = true
+	ctx := context.Background()
+
+	before, _, err := rt.SearchRuns(ctx, store.RunQuery{TenantID: "tenant-1"})
+	assertNoError(t, err)
+
+	req := func(input string) *CreateRunRequest {
+		return &CreateRunRequest{TenantID: "tenant-1", Mode: "autonomous", Input: input, IdempotencyKey: "job-42"}
+	}
+
+	// Concurrent retries create a single run
+	var wg sync.WaitGroup
+	ids := make([]string, 5)
+	errs := make([]error, len(ids))
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			run, err := rt.CreateRun(ctx, req("Run the job"))
+			if errs[i] = err; err == nil {
+				ids[i] = run.ID
+			}
+		}(i)
+	}
+	wg.Wait()
+	for i := range ids {
+		assertNoError(t, errs[i])
+		assertEqual(t, ids[0], ids[i])
+	}
+
+	_, err = rt.CreateRun(ctx, req("Run another job"))
+	assertEqual(t, ErrIdempotencyKeyConflict, err)
+
+	// Losing retries leave nothing behind
+	runs, _, err := rt.SearchRuns(ctx, store.RunQuery{TenantID: "tenant-1"})
+	assertNoError(t, err)
+	assertEqual(t, len(before)+1, len(runs))
+
+	// The key is ignored unless the config enables idempotency keys
+	cfg.IdempotencyKeys = false
+	run, err := rt.CreateRun(ctx, req("Run the job"))
+	assertNoError(t, err)
+	if run.ID == ids[0] {
+		t.Fatal("Expected a new run with idempotency keys disabled")
+	}
+}
+
+// failingMessageStore fails to add messages, so CreateRun fails after
+// claiming its idempotency key
+type failingMessageStore struct {
+	store.Store
+}
+
+func (s failingMessageStore) AddMessage(ctx context.Context, sessionID string, message *store.Message) error {
+	return errors.New("disk full")
+}
+
+func TestCreateRun_ReleasesIdempotencyKeyOnFailure(t *testing.T) {
+	st := store.NewInMemoryStore()
+	rt, cfg := newMemoryTestRuntime(t, failingMessageStore{st})
+	cfg.IdempotencyKeys = true
+	ctx := context.Background()
+
+	req := &CreateRunRequest{TenantID: "tenant-1", Mode: "autonomous", Input: "Run the job", IdempotencyKey: "job-42"}
+	_, err := rt.CreateRun(ctx, req)
+	assertError(t, err)
+
+	_, err = st.GetIdempotencyKey(ctx, "tenant-1", "job-42")
+	assertEqual(t, store.ErrNotFound, err)
+	runs, _, err := st.SearchRuns(ctx, store.RunQuery{TenantID: "tenant-1"})
+	assertNoError(t, err)
+	assertEqual(t, 0, len(runs))
+
+	// A retry once the store recovers creates the run
+	rt.store = st
+	run, err := rt.CreateRun(ctx, req)
+	assertNoError(t, err)
+	assertEqual(t, "Run the job", run.Input)
+}
+
+// slowEventStore returns from AddEvent after a delay that varies with the
+// event's sequence, so concurrent publishers finish storing out of order
+type slowEventStore struct {
+	store.Store
+}
+
+func (s slowEventStore) AddEvent(ctx context.Context, runID string, event *store.Event) error {
+	err := s.Store.AddEvent(ctx, runID, event)
+	time.Sleep(time.Duration(3-event.Sequence%3) * time.Millisecond)
+	return err
+}
+
+func TestPublishEvent_DeliversInSequenceOrder(t *testing.T) {
+	rt, _ := newSQLiteTestRuntime(t)
+	rt.store = slowEventStore{rt.store}
+	ch := rt.SubscribeToEvents("run-1")
+
+	// Parallel tool calls publish from several goroutines at once
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rt.publishEvent("run-1", store.EventTypeToolCompleted, nil)
+		}()
+	}
+	wg.Wait()
+
+	for want := int64(1); want <= 30; want++ {
+		event := <-ch
+		assertEqual(t, want, event.Sequence)
+	}
+}
+
+func TestPublishEvent_CarriesRunOwner(t *testing.T) {
+	rt, _ := newSQLiteTestRuntime(t)
+	ch := rt.SubscribeToMatchingEvents(events.Filter{TenantID: "tenant-1"}, events.SubscribeOptions{})
+	defer rt.UnsubscribeFromMatchingEvents(ch)
+
+	rt.publishEvent("run-1", store.EventTypeRunPaused, nil)
+
+	event := <-ch
+	assertEqual(t, "run-1", event.RunID)
+	assertEqual(t, "session-1", event.SessionID)
+
+	stored, err := rt.store.GetEvents(context.Background(), "run-1")
+	assertNoError(t, err)
+	assertEqual(t, "tenant-1", stored[0].TenantID)
+	assertEqual(t, "session-1", stored[0].SessionID)
+}
+
+func TestPendingCheckpoints(t *testing.T) {
+	st := store.NewInMemoryStore()
+	rt, _ := newMemoryTestRuntime(t, st)
+	ctx := context.Background()
+
+	addRun := func(id, tenantID, status string, checkpoints ...string) {
+		assertNoError(t, st.CreateSession(ctx, &store.Session{ID: "session-" + id, TenantID: tenantID}))
+		assertNoError(t, st.CreateRun(ctx, &store.Run{ID: id, SessionID: "session-" + id, TenantID: tenantID, Status: status}))
+		for _, reason := range checkpoints {
+			assertNoError(t, st.AddEvent(ctx, id, &store.Event{Type: store.EventTypeCheckpointRequired, Data: map[string]any{"reason": reason}}))
+			assertNoError(t, st.AddEvent(ctx, id, &store.Event{Type: store.EventTypeTextDelta}))
+		}
+	}
+	addRun("run-1", "tenant-1", store.RunStatePausedCheckpoint, "budget", "tool")
+	addRun("run-2", "tenant-2", store.RunStatePausedCheckpoint, "tool")
+	addRun("run-3", "tenant-1", store.RunStateCompleted, "tool")
+
+	// Only the latest checkpoint of the tenant's paused run is pending
+	checkpoints, err := rt.PendingCheckpoints(ctx, events.Filter{TenantID: "tenant-1", Types: []string{"checkpoint_*"}})
+	assertNoError(t, err)
+	assertEqual(t, 1, len(checkpoints))
+	assertEqual(t, "run-1", checkpoints[0].RunID)
+	assertEqual(t, "tool", checkpoints[0].Data["reason"])
+	assertEqual(t, "tenant-1", checkpoints[0].TenantID)
+	assertEqual(t, "session-run-1", checkpoints[0].SessionID)
+
+	checkpoints, err = rt.PendingCheckpoints(ctx, events.Filter{TenantID: "tenant-1", SessionID: "session-run-3"})
+	assertNoError(t, err)
+	assertEqual(t, 0, len(checkpoints))
+
+	checkpoints, err = rt.PendingCheckpoints(ctx, events.Filter{TenantID: "tenant-1", Types: []string{store.EventTypeTextDelta}})
+	assertNoError(t, err)
+	assertEqual(t, 0, len(checkpoints))
+}
@@ -0,0 +1,172 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/shankarg87/agent/internal/events"
+	"github.com/shankarg87/agent/internal/logging"
+	"github.com/shankarg87/agent/internal/provider"
+	"github.com/shankarg87/agent/internal/store"
+)
+
+func TestStreamCompletion_PublishesDeltasAndAssemblesToolCalls(t *testing.T) {
+	st := store.NewInMemoryStore()
+	mock := &MockProvider{
+		StreamEvents: []provider.StreamEvent{
+			{Type: "content_delta", Content: "Checking "},
+			{Type: "content_delta", Content: "now"},
+			{Type: "tool_call", Index: 0, ToolCall: &provider.ToolCall{ID: "call_1", Type: "function", Function: provider.FunctionCall{Name: "echo"}}},
+			{Type: "tool_call", Index: 0, ToolCall: &provider.ToolCall{Function: provider.FunctionCall{Arguments: `{"message":"hi"}`}}},
+			{Type: "done", Done: true, FinishReason: "tool_calls"},
+		},
+	}
+
+	rt := &Runtime{
+		store:    st,
+		eventBus: events.NewEventBus(),
+		provider: mock,
+		logger:   logging.VerboseLogger("runtime"),
+	}
+	runCtx := &RunContext{Run: &store.Run{ID: "run-1"}}
+
+	resp, err := rt.streamCompletion(context.Background(), runCtx, &provider.ChatRequest{})
+	assertNoError(t, err)
+	assertEqual(t, "Checking now", resp.Content)
+	assertEqual(t, "tool_calls", resp.FinishReason)
+	assertEqual(t, 1, len(resp.ToolCalls))
+	assertEqual(t, "call_1", resp.ToolCalls[0].ID)
+	assertEqual(t, `{"message":"hi"}`, resp.ToolCalls[0].Function.Arguments)
+
+	evts, err := st.GetEvents(context.Background(), "run-1")
+	assertNoError(t, err)
+	assertEqual(t, 2, len(evts))
+	assertEqual(t, store.EventTypeTextDelta, evts[0].Type)
+	assertEqual(t, "Checking ", evts[0].Data["text"].(string))
+	assertEqual(t, "now", evts[1].Data["text"].(string))
+}
+
+func TestStreamCompletion_StreamError(t *testing.T) {
+	mock := &MockProvider{
+		StreamEvents: []provider.StreamEvent{
+			{Type: "content_delta", Content: "partial"},
+			{Type: "error", Error: context.DeadlineExceeded},
+		},
+	}
+
+	rt := &Runtime{
+		store:    store.NewInMemoryStore(),
+		eventBus: events.NewEventBus(),
+		provider: mock,
+		logger:   logging.VerboseLogger("runtime"),
+	}
+	runCtx := &RunContext{Run: &store.Run{ID: "run-1"}}
+
+	_, err := rt.streamCompletion(context.Background(), runCtx, &provider.ChatRequest{})
+	assertError(t, err)
+	assertEqual(t, true, errors.Is(err, errPartialStream))
+}
+
+// countingProvider streams the same events on every call and counts them
+type countingProvider struct {
+	MockProvider
+	calls int
+}
+
+func (p *countingProvider) Stream(ctx context.Context, req *provider.ChatRequest) (<-chan provider.StreamEvent, error) {
+	p.calls++
+	return p.MockProvider.Stream(ctx, req)
+}
+
+func TestRunAgentLoop_FailsWhenStreamBreaksMidReply(t *testing.T) {
+	rt, runCtx := newBudgetTestRuntime(t, 0, false)
+	runCtx.Config.MaxFailuresPerRun = 3
+	prov := &countingProvider{MockProvider: MockProvider{
+		StreamEvents: []provider.StreamEvent{
+			{Type: "content_delta", Content: "The answer is"},
+			{Type: "error", Error: errors.New("connection reset")},
+		},
+	}}
+	rt.provider = prov
+
+	// Retrying would stream a second reply after the first one's start
+	err := rt.runAgentLoop(context.Background(), runCtx)
+	assertError(t, err)
+	assertEqual(t, true, errors.Is(err, errPartialStream))
+	assertEqual(t, 1, prov.calls)
+
+	evts, err := rt.store.GetEvents(context.Background(), runCtx.Run.ID)
+	assertNoError(t, err)
+	deltas := 0
+	for _, e := range evts {
+		if e.Type == store.EventTypeTextDelta {
+			deltas++
+		}
+	}
+	assertEqual(t, 1, deltas)
+}
+
+func TestRunAgentLoop_RetriesStreamThatFailsBeforeText(t *testing.T) {
+	rt, runCtx := newBudgetTestRuntime(t, 0, false)
+	runCtx.Config.MaxFailuresPerRun = 3
+	prov := &countingProvider{MockProvider: MockProvider{
+		StreamEvents: []provider.StreamEvent{
+			{Type: "error", Error: errors.New("connection reset")},
+		},
+	}}
+	rt.provider = prov
+
+	err := rt.runAgentLoop(context.Background(), runCtx)
+	assertError(t, err)
+	assertEqual(t, 3, prov.calls)
+}
+
+func TestRunAgentLoop_RecordsServingModel(t *testing.T) {
+	rt, runCtx := newBudgetTestRuntime(t, 0, false)
+
+	// Events stamped by a routing provider that fell back to another model
+	rt.provider = &MockProvider{
+		StreamEvents: []provider.StreamEvent{
+			{Type: "content_delta", Content: "Hello", Provider: "openai", Model: "gpt-4o-mini"},
+			{Type: "done", Done: true, FinishReason: "stop", Provider: "openai", Model: "gpt-4o-mini",
+				Usage: &provider.Usage{PromptTokens: 1_000_000, CompletionTokens: 1_000_000}},
+		},
+	}
+
+	assertNoError(t, rt.runAgentLoop(context.Background(), runCtx))
+
+	evts, err := rt.store.GetEvents(context.Background(), runCtx.Run.ID)
+	assertNoError(t, err)
+
+	var completed *store.Event
+	for _, e := range evts {
+		if e.Type == store.EventTypeLLMCompleted {
+			completed = e
+		}
+	}
+	if completed == nil {
+		t.Fatal("Expected an llm_completed event")
+	}
+	assertEqual(t, "openai", completed.Data["provider"].(string))
+	assertEqual(t, "gpt-4o-mini", completed.Data["model"].(string))
+	assertEqual(t, 0.75, completed.Data["cost_usd"].(float64))
+
+	msg := runCtx.Messages[len(runCtx.Messages)-1]
+	assertEqual(t, "gpt-4o-mini", msg.Metadata["model"].(string))
+}
+
+func TestRunAgentLoop_ClientErrorFailsFast(t *testing.T) {
+	rt, runCtx := newBudgetTestRuntime(t, 0, false)
+	runCtx.Config.MaxFailuresPerRun = 3
+	rt.provider = &MockProvider{
+		StreamEvents: []provider.StreamEvent{
+			{Type: "error", Error: &provider.APIError{StatusCode: 400, Body: "invalid model"}},
+		},
+	}
+
+	err := rt.runAgentLoop(context.Background(), runCtx)
+	assertError(t, err)
+	assertEqual(t, true, errors.Is(err, provider.ErrClientError))
+	assertEqual(t, 0, runCtx.FailureCount)
+}
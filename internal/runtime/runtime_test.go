@@ -16,6 +16,7 @@ import (
 type MockProvider struct {
 	ChatResponse *provider.ChatResponse
 	ChatError    error
+	StreamEvents []provider.StreamEvent
 }
 
 func (m *MockProvider) Chat(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
@@ -39,6 +40,15 @@ func (m *MockProvider) Chat(ctx context.Context, req *provider.ChatRequest) (*pr
 }
 
 func (m *MockProvider) Stream(ctx context.Context, req *provider.ChatRequest) (<-chan provider.StreamEvent, error) {
+	if m.StreamEvents != nil {
+		ch := make(chan provider.StreamEvent, len(m.StreamEvents))
+		for _, e := range m.StreamEvents {
+			ch <- e
+		}
+		close(ch)
+		return ch, nil
+	}
+
 	ch := make(chan provider.StreamEvent, 1)
 	ch <- provider.StreamEvent{
 		Type:    "done",
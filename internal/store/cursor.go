@@ -0,0 +1,75 @@
+package store
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cursors are opaque to clients. Listings ordered by creation time resume
+// after the (created_at, id) of the last item, so items created meanwhile
+// don't shift later pages. Messages are append-only, so their listing
+// resumes at an offset.
+
+func timeCursor(createdAt time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("t:%d:%s", createdAt.UnixNano(), id)))
+}
+
+func parseTimeCursor(cursor string) (time.Time, string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	parts := strings.SplitN(string(data), ":", 3)
+	if len(parts) != 3 || parts[0] != "t" {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	nanos, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	return time.Unix(0, nanos), parts[2], nil
+}
+
+func offsetCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("o:%d", offset)))
+}
+
+func parseOffsetCursor(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	offset, err := strconv.Atoi(strings.TrimPrefix(string(data), "o:"))
+	if err != nil || offset < 0 || !strings.HasPrefix(string(data), "o:") {
+		return 0, ErrInvalidCursor
+	}
+	return offset, nil
+}
+
+// pageLimit applies the default and maximum page sizes
+func pageLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultPageSize
+	}
+	return min(limit, MaxPageSize)
+}
+
+// trimPage cuts items down to the page, returning the cursor of the next
+// page if any items are left over. The SQL stores fetch one extra row to
+// find out.
+func trimPage[T any](items []*T, limit int, cursor func(*T) string) ([]*T, string) {
+	if len(items) <= limit {
+		return items, ""
+	}
+	items = items[:limit]
+	return items, cursor(items[limit-1])
+}
+
+func sessionCursor(s *Session) string { return timeCursor(s.CreatedAt, s.ID) }
+func runCursor(r *Run) string         { return timeCursor(r.CreatedAt, r.ID) }
@@ -3,6 +3,8 @@ package store
 import (
 	"context"
 	"errors"
+	"slices"
+	"sort"
 	"sync"
 	"time"
 
@@ -12,6 +14,19 @@ import (
 
 var (
 	ErrNotFound = errors.New("not found")
+
+	// ErrConflict is returned by UpdateRun when the run was updated by
+	// another writer since it was read, and by ClaimRun when another owner
+	// holds the run's lease
+	ErrConflict = errors.New("conflict: modified concurrently")
+
+	// ErrAlreadyExists is returned by CreateIdempotencyKey when the key is
+	// already held
+	ErrAlreadyExists = errors.New("already exists")
+
+	// ErrInvalidCursor is returned by paged listings for a cursor they
+	// didn't produce
+	ErrInvalidCursor = errors.New("invalid cursor")
 )
 
 // InMemoryStore implements Store using in-memory data structures
@@ -24,6 +39,9 @@ type InMemoryStore struct {
 	events    map[string][]*Event    // runID -> events
 	toolCalls map[string][]*ToolCall // runID -> tool calls
 
+	idempotencyKeys map[idempotencyKeyID]*IdempotencyKey
+	runLeases       map[string]runLease // runID -> lease
+
 	// Indexes
 	sessionsByTenant map[string][]string // tenantID -> sessionIDs
 	runsBySession    map[string][]string // sessionID -> runIDs
@@ -42,8 +60,10 @@ func NewInMemoryStore() *InMemoryStore {
 		messages:         make(map[string][]*Message),
 		events:           make(map[string][]*Event),
 		toolCalls:        make(map[string][]*ToolCall),
+		runLeases:        make(map[string]runLease),
 		sessionsByTenant: make(map[string][]string),
 		runsBySession:    make(map[string][]string),
+		idempotencyKeys:  make(map[idempotencyKeyID]*IdempotencyKey),
 		logger:           logger,
 	}
 }
@@ -64,7 +84,7 @@ func (s *InMemoryStore) CreateSession(ctx context.Context, session *Session) err
 	session.CreatedAt = time.Now()
 	session.UpdatedAt = session.CreatedAt
 
-	s.sessions[session.ID] = session
+	s.sessions[session.ID] = copySession(session)
 	s.sessionsByTenant[session.TenantID] = append(s.sessionsByTenant[session.TenantID], session.ID)
 
 	s.logger.LogMemoryOperation("create_session", session.ID, true, time.Since(start))
@@ -85,7 +105,35 @@ func (s *InMemoryStore) GetSession(ctx context.Context, sessionID string) (*Sess
 	}
 
 	s.logger.LogMemoryOperation("get_session", sessionID, true, time.Since(start))
-	return session, nil
+	return copySession(session), nil
+}
+
+func (s *InMemoryStore) UpdateSession(ctx context.Context, session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sessions[session.ID]; !ok {
+		return ErrNotFound
+	}
+
+	session.UpdatedAt = time.Now()
+	s.sessions[session.ID] = copySession(session)
+
+	return nil
+}
+
+func (s *InMemoryStore) AddSessionCost(ctx context.Context, sessionID string, costUSD float64) (float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[sessionID]
+	if !ok {
+		return 0, ErrNotFound
+	}
+
+	session.CostUSD += costUSD
+	session.UpdatedAt = time.Now()
+	return session.CostUSD, nil
 }
 
 func (s *InMemoryStore) ListSessions(ctx context.Context, tenantID string, limit, offset int) ([]*Session, error) {
@@ -105,13 +153,37 @@ func (s *InMemoryStore) ListSessions(ctx context.Context, tenantID string, limit
 	sessions := make([]*Session, 0, end-offset)
 	for _, id := range sessionIDs[offset:end] {
 		if session, ok := s.sessions[id]; ok {
-			sessions = append(sessions, session)
+			sessions = append(sessions, copySession(session))
 		}
 	}
 
 	return sessions, nil
 }
 
+func (s *InMemoryStore) SearchSessions(ctx context.Context, query SessionQuery) ([]*Session, string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sessions := []*Session{}
+	for _, session := range s.sessions {
+		if (query.TenantID == "" || session.TenantID == query.TenantID) &&
+			createdBetween(session.CreatedAt, query.CreatedAfter, query.CreatedBefore) &&
+			hasMetadata(session.Metadata, query.MetadataKey, query.MetadataValue) {
+			sessions = append(sessions, copySession(session))
+		}
+	}
+
+	return pageNewestFirst(sessions, query.Cursor, query.Limit, func(session *Session) (time.Time, string) {
+		return session.CreatedAt, session.ID
+	})
+}
+
+// copySession copies a session into or out of the store, like copyRun
+func copySession(session *Session) *Session {
+	copied := *session
+	return &copied
+}
+
 // Runs
 
 func (s *InMemoryStore) CreateRun(ctx context.Context, run *Run) error {
@@ -124,7 +196,7 @@ func (s *InMemoryStore) CreateRun(ctx context.Context, run *Run) error {
 	run.CreatedAt = time.Now()
 	run.UpdatedAt = run.CreatedAt
 
-	s.runs[run.ID] = run
+	s.runs[run.ID] = copyRun(run)
 	s.runsBySession[run.SessionID] = append(s.runsBySession[run.SessionID], run.ID)
 
 	return nil
@@ -138,20 +210,55 @@ func (s *InMemoryStore) GetRun(ctx context.Context, runID string) (*Run, error)
 	if !ok {
 		return nil, ErrNotFound
 	}
-	return run, nil
+	return copyRun(run), nil
 }
 
 func (s *InMemoryStore) UpdateRun(ctx context.Context, run *Run) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if _, ok := s.runs[run.ID]; !ok {
+	existing, ok := s.runs[run.ID]
+	if !ok {
 		return ErrNotFound
 	}
+	if existing.Version != run.Version {
+		return ErrConflict
+	}
 
 	run.UpdatedAt = time.Now()
-	s.runs[run.ID] = run
+	run.Version++
+	s.runs[run.ID] = copyRun(run)
+
+	return nil
+}
+
+// copyRun copies a run into or out of the store, so the runtime can change
+// its copy while other goroutines read the stored one, as with the SQL
+// stores
+func copyRun(run *Run) *Run {
+	copied := *run
+	return &copied
+}
+
+// runLease records which replica holds a run, kept apart from the Run so
+// that UpdateRun doesn't overwrite it
+type runLease struct {
+	owner string
+	until time.Time
+}
+
+func (s *InMemoryStore) ClaimRun(ctx context.Context, runID, owner string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.runs[runID]; !ok {
+		return ErrNotFound
+	}
+	if lease, ok := s.runLeases[runID]; ok && lease.owner != owner && lease.until.After(time.Now()) {
+		return ErrConflict
+	}
 
+	s.runLeases[runID] = runLease{owner: owner, until: until}
 	return nil
 }
 
@@ -163,13 +270,103 @@ func (s *InMemoryStore) ListRuns(ctx context.Context, sessionID string) ([]*Run,
 	runs := make([]*Run, 0, len(runIDs))
 	for _, id := range runIDs {
 		if run, ok := s.runs[id]; ok {
-			runs = append(runs, run)
+			runs = append(runs, copyRun(run))
+		}
+	}
+
+	return runs, nil
+}
+
+func (s *InMemoryStore) ListRunsByStatus(ctx context.Context, statuses ...string) ([]*Run, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	runs := []*Run{}
+	for _, run := range s.runs {
+		if slices.Contains(statuses, run.Status) {
+			runs = append(runs, copyRun(run))
 		}
 	}
+	sort.Slice(runs, func(i, j int) bool {
+		if !runs[i].CreatedAt.Equal(runs[j].CreatedAt) {
+			return runs[i].CreatedAt.Before(runs[j].CreatedAt)
+		}
+		return runs[i].ID < runs[j].ID
+	})
 
 	return runs, nil
 }
 
+func (s *InMemoryStore) SearchRuns(ctx context.Context, query RunQuery) ([]*Run, string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	runs := []*Run{}
+	for _, run := range s.runs {
+		if (query.TenantID == "" || run.TenantID == query.TenantID) &&
+			(query.SessionID == "" || run.SessionID == query.SessionID) &&
+			(len(query.Statuses) == 0 || slices.Contains(query.Statuses, run.Status)) &&
+			(query.Mode == "" || run.Mode == query.Mode) &&
+			createdBetween(run.CreatedAt, query.CreatedAfter, query.CreatedBefore) &&
+			hasMetadata(run.Metadata, query.MetadataKey, query.MetadataValue) {
+			runs = append(runs, copyRun(run))
+		}
+	}
+
+	return pageNewestFirst(runs, query.Cursor, query.Limit, func(run *Run) (time.Time, string) {
+		return run.CreatedAt, run.ID
+	})
+}
+
+// createdBetween reports whether createdAt is in [after, before), where
+// zero bounds are open
+func createdBetween(createdAt, after, before time.Time) bool {
+	return (after.IsZero() || !createdAt.Before(after)) && (before.IsZero() || createdAt.Before(before))
+}
+
+// hasMetadata reports whether metadata has key set, to value if it isn't
+// empty. An empty key matches everything.
+func hasMetadata(metadata map[string]any, key, value string) bool {
+	if key == "" {
+		return true
+	}
+	v, ok := metadata[key]
+	if !ok {
+		return false
+	}
+	return value == "" || v == value
+}
+
+// pageNewestFirst sorts items newest first and returns the page following
+// cursor
+func pageNewestFirst[T any](items []*T, cursor string, limit int, key func(*T) (time.Time, string)) ([]*T, string, error) {
+	sort.Slice(items, func(i, j int) bool {
+		ti, idi := key(items[i])
+		tj, idj := key(items[j])
+		if !ti.Equal(tj) {
+			return ti.After(tj)
+		}
+		return idi > idj
+	})
+
+	if cursor != "" {
+		afterTime, afterID, err := parseTimeCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		start := sort.Search(len(items), func(i int) bool {
+			t, id := key(items[i])
+			return t.Before(afterTime) || (t.Equal(afterTime) && id < afterID)
+		})
+		items = items[start:]
+	}
+
+	items, next := trimPage(items, pageLimit(limit), func(item *T) string {
+		return timeCursor(key(item))
+	})
+	return items, next, nil
+}
+
 // Messages
 
 func (s *InMemoryStore) AddMessage(ctx context.Context, sessionID string, message *Message) error {
@@ -199,6 +396,27 @@ func (s *InMemoryStore) GetMessages(ctx context.Context, sessionID string) ([]*M
 	return messages, nil
 }
 
+func (s *InMemoryStore) ListMessages(ctx context.Context, query MessageQuery) ([]*Message, string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	offset, err := parseOffsetCursor(query.Cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	messages := s.messages[query.SessionID]
+	if offset >= len(messages) {
+		return []*Message{}, "", nil
+	}
+
+	end := offset + pageLimit(query.Limit)
+	if end >= len(messages) {
+		return slices.Clone(messages[offset:]), "", nil
+	}
+	return slices.Clone(messages[offset:end]), offsetCursor(end), nil
+}
+
 // Events
 
 func (s *InMemoryStore) AddEvent(ctx context.Context, runID string, event *Event) error {
@@ -210,6 +428,7 @@ func (s *InMemoryStore) AddEvent(ctx context.Context, runID string, event *Event
 	}
 	event.Timestamp = time.Now()
 	event.RunID = runID
+	event.Sequence = int64(len(s.events[runID]) + 1)
 
 	s.events[runID] = append(s.events[runID], event)
 
@@ -228,6 +447,22 @@ func (s *InMemoryStore) GetEvents(ctx context.Context, runID string) ([]*Event,
 	return events, nil
 }
 
+func (s *InMemoryStore) GetEventsAfter(ctx context.Context, runID string, sequence int64) ([]*Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Sequences number a run's events from 1 in order
+	events := s.events[runID]
+	if sequence < 0 {
+		sequence = 0
+	}
+	if sequence >= int64(len(events)) {
+		return []*Event{}, nil
+	}
+
+	return slices.Clone(events[sequence:]), nil
+}
+
 // Tool calls
 
 func (s *InMemoryStore) AddToolCall(ctx context.Context, runID string, toolCall *ToolCall) error {
@@ -269,7 +504,49 @@ func (s *InMemoryStore) GetToolCalls(ctx context.Context, runID string) ([]*Tool
 		return []*ToolCall{}, nil
 	}
 
-	return toolCalls, nil
+	// UpdateToolCall replaces entries in place
+	return slices.Clone(toolCalls), nil
+}
+
+// Idempotency keys
+
+type idempotencyKeyID struct {
+	tenantID string
+	key      string
+}
+
+func (s *InMemoryStore) CreateIdempotencyKey(ctx context.Context, key *IdempotencyKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key.CreatedAt = time.Now()
+
+	// Expired keys are dropped as new ones are created
+	for id, existing := range s.idempotencyKeys {
+		if !existing.ExpiresAt.After(key.CreatedAt) {
+			delete(s.idempotencyKeys, id)
+		}
+	}
+
+	id := idempotencyKeyID{key.TenantID, key.Key}
+	if _, exists := s.idempotencyKeys[id]; exists {
+		return ErrAlreadyExists
+	}
+	s.idempotencyKeys[id] = key
+
+	return nil
+}
+
+func (s *InMemoryStore) GetIdempotencyKey(ctx context.Context, tenantID, key string) (*IdempotencyKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	existing, ok := s.idempotencyKeys[idempotencyKeyID{tenantID, key}]
+	if !ok || !existing.ExpiresAt.After(time.Now()) {
+		return nil, ErrNotFound
+	}
+
+	return existing, nil
 }
 
 // DeleteSession removes a session and all associated data
@@ -302,6 +579,7 @@ func (s *InMemoryStore) deleteSessionLocked(sessionID string) {
 		delete(s.runs, runID)
 		delete(s.events, runID)
 		delete(s.toolCalls, runID)
+		s.deleteIdempotencyKeysLocked(runID)
 	}
 
 	// Clean up session data
@@ -345,8 +623,10 @@ func (s *InMemoryStore) deleteRunLocked(runID string) {
 
 	// Clean up run data
 	delete(s.runs, runID)
+	delete(s.runLeases, runID)
 	delete(s.events, runID)
 	delete(s.toolCalls, runID)
+	s.deleteIdempotencyKeysLocked(runID)
 
 	// Remove from session index
 	if sessionRuns, ok := s.runsBySession[run.SessionID]; ok {
@@ -359,6 +639,16 @@ func (s *InMemoryStore) deleteRunLocked(runID string) {
 	}
 }
 
+// deleteIdempotencyKeysLocked releases the keys that refer to a run; the
+// caller holds the write lock
+func (s *InMemoryStore) deleteIdempotencyKeysLocked(runID string) {
+	for id, key := range s.idempotencyKeys {
+		if key.RunID == runID {
+			delete(s.idempotencyKeys, id)
+		}
+	}
+}
+
 // CleanupOldSessions removes sessions older than the specified duration
 func (s *InMemoryStore) CleanupOldSessions(ctx context.Context, tenantID string, olderThan time.Duration) error {
 	s.mu.Lock()
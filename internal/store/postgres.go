@@ -0,0 +1,844 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/shankarg87/agent/internal/logging"
+)
+
+// postgresMigrations are applied in order; a database at version N has had
+// the first N applied. Never edit a released migration, append a new one.
+var postgresMigrations = []string{
+	`CREATE TABLE sessions (
+		seq          BIGSERIAL PRIMARY KEY,
+		id           TEXT NOT NULL UNIQUE,
+		tenant_id    TEXT NOT NULL,
+		profile_name TEXT NOT NULL,
+		metadata     JSONB,
+		cost_usd     DOUBLE PRECISION NOT NULL DEFAULT 0,
+		created_at   TIMESTAMPTZ NOT NULL,
+		updated_at   TIMESTAMPTZ NOT NULL
+	);
+	CREATE INDEX idx_sessions_tenant ON sessions (tenant_id, seq);
+	CREATE INDEX idx_sessions_created ON sessions (tenant_id, created_at);
+
+	CREATE TABLE runs (
+		seq             BIGSERIAL PRIMARY KEY,
+		id              TEXT NOT NULL UNIQUE,
+		session_id      TEXT NOT NULL,
+		tenant_id       TEXT NOT NULL,
+		mode            TEXT NOT NULL,
+		status          TEXT NOT NULL,
+		input           TEXT NOT NULL DEFAULT '',
+		output          TEXT NOT NULL DEFAULT '',
+		error           TEXT NOT NULL DEFAULT '',
+		metadata        JSONB,
+		tool_call_count INTEGER NOT NULL DEFAULT 0,
+		failure_count   INTEGER NOT NULL DEFAULT 0,
+		cost_usd        DOUBLE PRECISION NOT NULL DEFAULT 0,
+		cost_breakdown  JSONB,
+		created_at      TIMESTAMPTZ NOT NULL,
+		updated_at      TIMESTAMPTZ NOT NULL,
+		started_at      TIMESTAMPTZ,
+		ended_at        TIMESTAMPTZ,
+		version         INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX idx_runs_session ON runs (session_id, seq);
+	CREATE INDEX idx_runs_tenant ON runs (tenant_id, status);
+
+	CREATE TABLE messages (
+		seq          BIGSERIAL PRIMARY KEY,
+		id           TEXT NOT NULL,
+		session_id   TEXT NOT NULL,
+		role         TEXT NOT NULL,
+		content      TEXT NOT NULL DEFAULT '',
+		tool_calls   JSONB,
+		metadata     JSONB,
+		tool_call_id TEXT NOT NULL DEFAULT '',
+		tool_name    TEXT NOT NULL DEFAULT '',
+		compaction   JSONB,
+		created_at   TIMESTAMPTZ NOT NULL
+	);
+	CREATE INDEX idx_messages_session ON messages (session_id, seq);
+
+	CREATE TABLE events (
+		seq       BIGSERIAL PRIMARY KEY,
+		id        TEXT NOT NULL,
+		run_id    TEXT NOT NULL,
+		sequence  BIGINT NOT NULL,
+		type      TEXT NOT NULL,
+		data      JSONB,
+		timestamp TIMESTAMPTZ NOT NULL,
+		UNIQUE (run_id, sequence)
+	);
+
+	-- Last event sequence handed out per run. Taking the next one locks the
+	-- row until the event commits, so events commit in sequence order.
+	CREATE TABLE run_event_sequences (
+		run_id        TEXT PRIMARY KEY,
+		last_sequence BIGINT NOT NULL
+	);
+
+	CREATE TABLE tool_calls (
+		seq          BIGSERIAL PRIMARY KEY,
+		id           TEXT NOT NULL,
+		run_id       TEXT NOT NULL,
+		tool_name    TEXT NOT NULL,
+		server_name  TEXT NOT NULL,
+		arguments    JSONB,
+		status       TEXT NOT NULL,
+		output       TEXT NOT NULL DEFAULT '',
+		error        TEXT NOT NULL DEFAULT '',
+		retry_count  INTEGER NOT NULL DEFAULT 0,
+		started_at   TIMESTAMPTZ,
+		completed_at TIMESTAMPTZ,
+		created_at   TIMESTAMPTZ NOT NULL,
+		UNIQUE (run_id, id)
+	);
+	CREATE INDEX idx_tool_calls_run ON tool_calls (run_id, seq);`,
+
+	// Idempotency keys, scoped to a tenant
+	`CREATE TABLE idempotency_keys (
+		tenant_id    TEXT NOT NULL,
+		key          TEXT NOT NULL,
+		request_hash TEXT NOT NULL,
+		run_id       TEXT NOT NULL,
+		created_at   TIMESTAMPTZ NOT NULL,
+		expires_at   TIMESTAMPTZ NOT NULL,
+		PRIMARY KEY (tenant_id, key)
+	);
+	CREATE INDEX idx_idempotency_keys_expires ON idempotency_keys (expires_at);
+	CREATE INDEX idx_idempotency_keys_run ON idempotency_keys (run_id);`,
+
+	// Paged listings, newest first
+	`CREATE INDEX idx_sessions_listing ON sessions (created_at, id);
+	CREATE INDEX idx_runs_listing ON runs (created_at, id);`,
+
+	// Events carry their run's tenant and session for cross-run subscriptions
+	`ALTER TABLE events ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';
+	ALTER TABLE events ADD COLUMN session_id TEXT NOT NULL DEFAULT '';
+	UPDATE events SET tenant_id = runs.tenant_id, session_id = runs.session_id
+		FROM runs WHERE runs.id = events.run_id;`,
+
+	// Leases on runs, held by the replica executing them
+	`ALTER TABLE runs ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+	ALTER TABLE runs ADD COLUMN lease_expires_at TIMESTAMPTZ;`,
+
+	// Run budgets, which grow as operators approve more spend
+	`ALTER TABLE runs ADD COLUMN budget_usd DOUBLE PRECISION NOT NULL DEFAULT 0;`,
+}
+
+// postgresMigrationLock is the advisory lock key that serializes migrations
+// when several replicas start at once
+const postgresMigrationLock = 7306458109
+
+// PostgresStore implements Store on a PostgreSQL database, so several
+// agentd replicas can share state
+type PostgresStore struct {
+	db     *sql.DB
+	q      querier // db, or tx for a store bound to a transaction
+	tx     *sql.Tx
+	logger *logging.SimpleLogger
+}
+
+// NewPostgresStore connects to the database at dsn (a postgres:// URL or
+// key=value connection string) and applies pending migrations
+func NewPostgresStore(dsn string) (*PostgresStore, error) {
+	logger := logging.VerboseLogger("store")
+	logger.Verbose("Opening Postgres store")
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open postgres database: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to postgres: %w", err)
+	}
+
+	s := &PostgresStore{db: db, q: db, logger: logger}
+	if err := s.migrate(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Close closes the database
+func (s *PostgresStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *PostgresStore) migrate(ctx context.Context) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, postgresMigrationLock); err != nil {
+			return fmt.Errorf("failed to lock migrations: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    INTEGER PRIMARY KEY,
+			applied_at TIMESTAMPTZ NOT NULL
+		)`); err != nil {
+			return fmt.Errorf("failed to create migrations table: %w", err)
+		}
+
+		var version int
+		if err := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+			return fmt.Errorf("failed to read schema version: %w", err)
+		}
+		if version > len(postgresMigrations) {
+			return fmt.Errorf("database schema version %d is newer than supported version %d", version, len(postgresMigrations))
+		}
+
+		for i := version; i < len(postgresMigrations); i++ {
+			if _, err := tx.ExecContext(ctx, postgresMigrations[i]); err != nil {
+				return fmt.Errorf("failed to apply migration %d: %w", i+1, err)
+			}
+			if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, applied_at) VALUES ($1, $2)`,
+				i+1, time.Now()); err != nil {
+				return fmt.Errorf("failed to record migration %d: %w", i+1, err)
+			}
+			s.logger.Info("Applied Postgres migration", "version", i+1)
+		}
+		return nil
+	})
+}
+
+// WithTx runs fn against a store bound to a transaction, committing if fn
+// returns nil and rolling back otherwise
+func (s *PostgresStore) WithTx(ctx context.Context, fn func(tx Store) error) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		return fn(&PostgresStore{db: s.db, q: tx, tx: tx, logger: s.logger})
+	})
+}
+
+// withTx runs fn in a transaction, committing if it returns nil. A store
+// already bound to a transaction runs fn in it.
+func (s *PostgresStore) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	if s.tx != nil {
+		return fn(s.tx)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Sessions
+
+func (s *PostgresStore) CreateSession(ctx context.Context, session *Session) error {
+	start := time.Now()
+	s.logger.Verbose("Creating session", "session_id", session.ID, "tenant_id", session.TenantID)
+
+	if session.ID == "" {
+		session.ID = uuid.New().String()
+		s.logger.Verbose("Generated new session ID", "session_id", session.ID)
+	}
+	session.CreatedAt = time.Now()
+	session.UpdatedAt = session.CreatedAt
+
+	_, err := s.q.ExecContext(ctx, `INSERT INTO sessions (`+sessionColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		session.ID, session.TenantID, session.ProfileName, jsonValue{session.Metadata}, session.CostUSD,
+		session.CreatedAt, session.UpdatedAt)
+
+	s.logger.LogMemoryOperation("create_session", session.ID, err == nil, time.Since(start))
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) GetSession(ctx context.Context, sessionID string) (*Session, error) {
+	start := time.Now()
+	s.logger.Verbose("Getting session", "session_id", sessionID)
+
+	session, err := scanPostgresSession(s.q.QueryRowContext(ctx, `SELECT `+sessionColumns+` FROM sessions WHERE id = $1`, sessionID))
+
+	s.logger.LogMemoryOperation("get_session", sessionID, err == nil, time.Since(start))
+	return session, err
+}
+
+func (s *PostgresStore) UpdateSession(ctx context.Context, session *Session) error {
+	session.UpdatedAt = time.Now()
+
+	res, err := s.q.ExecContext(ctx, `UPDATE sessions SET tenant_id = $1, profile_name = $2, metadata = $3, cost_usd = $4, updated_at = $5
+		WHERE id = $6`,
+		session.TenantID, session.ProfileName, jsonValue{session.Metadata}, session.CostUSD, session.UpdatedAt, session.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+	return requireAffected(res)
+}
+
+func (s *PostgresStore) AddSessionCost(ctx context.Context, sessionID string, costUSD float64) (float64, error) {
+	var total float64
+	err := s.q.QueryRowContext(ctx, `UPDATE sessions SET cost_usd = cost_usd + $1, updated_at = $2 WHERE id = $3 RETURNING cost_usd`,
+		costUSD, time.Now(), sessionID).Scan(&total)
+	if err != nil {
+		return 0, scanError(err)
+	}
+	return total, nil
+}
+
+func (s *PostgresStore) ListSessions(ctx context.Context, tenantID string, limit, offset int) ([]*Session, error) {
+	rows, err := s.q.QueryContext(ctx, `SELECT `+sessionColumns+` FROM sessions WHERE tenant_id = $1 ORDER BY seq LIMIT $2 OFFSET $3`,
+		tenantID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	return scanAll(rows, scanPostgresSession)
+}
+
+func (s *PostgresStore) SearchSessions(ctx context.Context, query SessionQuery) ([]*Session, string, error) {
+	q, err := sessionListQuery(postgresDialect, query)
+	if err != nil {
+		return nil, "", err
+	}
+
+	limit := pageLimit(query.Limit)
+	sqlQuery, args := q.sql(sessionColumns, "sessions", "created_at DESC, id DESC", limit, 0)
+	rows, err := s.q.QueryContext(ctx, numberPlaceholders(sqlQuery), args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to search sessions: %w", err)
+	}
+	sessions, err := scanAll(rows, scanPostgresSession)
+	if err != nil {
+		return nil, "", err
+	}
+
+	sessions, next := trimPage(sessions, limit, sessionCursor)
+	return sessions, next, nil
+}
+
+// Runs
+
+func (s *PostgresStore) CreateRun(ctx context.Context, run *Run) error {
+	if run.ID == "" {
+		run.ID = uuid.New().String()
+	}
+	run.CreatedAt = time.Now()
+	run.UpdatedAt = run.CreatedAt
+
+	_, err := s.q.ExecContext(ctx, `INSERT INTO runs (`+runColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)`,
+		run.ID, run.SessionID, run.TenantID, run.Mode, run.Status, run.Input, run.Output, run.Error,
+		jsonValue{run.Metadata}, run.ToolCallCount, run.FailureCount, run.CostUSD, jsonValue{run.CostBreakdown},
+		run.CreatedAt, run.UpdatedAt, run.StartedAt, run.EndedAt, run.Version, run.BudgetUSD)
+	if err != nil {
+		return fmt.Errorf("failed to create run: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) GetRun(ctx context.Context, runID string) (*Run, error) {
+	return scanPostgresRun(s.q.QueryRowContext(ctx, `SELECT `+runColumns+` FROM runs WHERE id = $1`, runID))
+}
+
+// UpdateRun saves the run if it is unchanged since it was read, and returns
+// ErrConflict otherwise
+func (s *PostgresStore) UpdateRun(ctx context.Context, run *Run) error {
+	updatedAt := time.Now()
+
+	res, err := s.q.ExecContext(ctx, `UPDATE runs SET mode = $1, status = $2, input = $3, output = $4, error = $5, metadata = $6,
+		tool_call_count = $7, failure_count = $8, cost_usd = $9, cost_breakdown = $10, budget_usd = $11, updated_at = $12,
+		started_at = $13, ended_at = $14, version = version + 1
+		WHERE id = $15 AND version = $16`,
+		run.Mode, run.Status, run.Input, run.Output, run.Error, jsonValue{run.Metadata},
+		run.ToolCallCount, run.FailureCount, run.CostUSD, jsonValue{run.CostBreakdown}, run.BudgetUSD,
+		updatedAt, run.StartedAt, run.EndedAt, run.ID, run.Version)
+	if err != nil {
+		return fmt.Errorf("failed to update run: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return versionConflict(ctx, s.q, `SELECT EXISTS (SELECT 1 FROM runs WHERE id = $1)`, run.ID)
+	}
+
+	run.UpdatedAt = updatedAt
+	run.Version++
+	return nil
+}
+
+func (s *PostgresStore) ClaimRun(ctx context.Context, runID, owner string, until time.Time) error {
+	res, err := s.q.ExecContext(ctx, `UPDATE runs SET owner = $1, lease_expires_at = $2
+		WHERE id = $3 AND (owner = '' OR owner = $1 OR lease_expires_at IS NULL OR lease_expires_at < $4)`,
+		owner, until, runID, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to claim run: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return versionConflict(ctx, s.q, `SELECT EXISTS (SELECT 1 FROM runs WHERE id = $1)`, runID)
+	}
+	return nil
+}
+
+func (s *PostgresStore) ListRuns(ctx context.Context, sessionID string) ([]*Run, error) {
+	rows, err := s.q.QueryContext(ctx, `SELECT `+runColumns+` FROM runs WHERE session_id = $1 ORDER BY seq`, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list runs: %w", err)
+	}
+	return scanAll(rows, scanPostgresRun)
+}
+
+func (s *PostgresStore) ListRunsByStatus(ctx context.Context, statuses ...string) ([]*Run, error) {
+	rows, err := s.q.QueryContext(ctx, `SELECT `+runColumns+` FROM runs WHERE status = ANY($1) ORDER BY seq`, pq.Array(statuses))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list runs: %w", err)
+	}
+	return scanAll(rows, scanPostgresRun)
+}
+
+func (s *PostgresStore) SearchRuns(ctx context.Context, query RunQuery) ([]*Run, string, error) {
+	q, err := runListQuery(postgresDialect, query)
+	if err != nil {
+		return nil, "", err
+	}
+
+	limit := pageLimit(query.Limit)
+	sqlQuery, args := q.sql(runColumns, "runs", "created_at DESC, id DESC", limit, 0)
+	rows, err := s.q.QueryContext(ctx, numberPlaceholders(sqlQuery), args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to search runs: %w", err)
+	}
+	runs, err := scanAll(rows, scanPostgresRun)
+	if err != nil {
+		return nil, "", err
+	}
+
+	runs, next := trimPage(runs, limit, runCursor)
+	return runs, next, nil
+}
+
+// postgresDialect matches metadata keys with JSONB operators
+var postgresDialect = sqlDialect{
+	timeArg: func(t time.Time) any { return t },
+	metadata: func(key, value string) (string, []any) {
+		if value == "" {
+			return "metadata -> ?::text IS NOT NULL", []any{key}
+		}
+		return "metadata -> ?::text = to_jsonb(?::text)", []any{key, value}
+	},
+}
+
+// numberPlaceholders rewrites the ? placeholders of a listQuery as $1, $2...
+func numberPlaceholders(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// Messages
+
+func (s *PostgresStore) AddMessage(ctx context.Context, sessionID string, message *Message) error {
+	if message.ID == "" {
+		message.ID = uuid.New().String()
+	}
+	message.CreatedAt = time.Now()
+	message.SessionID = sessionID
+
+	_, err := s.q.ExecContext(ctx, `INSERT INTO messages (`+messageColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		message.ID, message.SessionID, message.Role, message.Content, jsonValue{message.ToolCalls},
+		jsonValue{message.Metadata}, message.ToolCallID, message.ToolName, jsonValue{message.Compaction},
+		message.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to add message: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) GetMessages(ctx context.Context, sessionID string) ([]*Message, error) {
+	rows, err := s.q.QueryContext(ctx, `SELECT `+messageColumns+` FROM messages WHERE session_id = $1 ORDER BY seq`, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get messages: %w", err)
+	}
+	return scanAll(rows, scanPostgresMessage)
+}
+
+func (s *PostgresStore) ListMessages(ctx context.Context, query MessageQuery) ([]*Message, string, error) {
+	offset, err := parseOffsetCursor(query.Cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	q := &listQuery{}
+	q.where("session_id = ?", query.SessionID)
+	limit := pageLimit(query.Limit)
+	sqlQuery, args := q.sql(messageColumns, "messages", "seq", limit, offset)
+	rows, err := s.q.QueryContext(ctx, numberPlaceholders(sqlQuery), args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list messages: %w", err)
+	}
+	messages, err := scanAll(rows, scanPostgresMessage)
+	if err != nil {
+		return nil, "", err
+	}
+
+	messages, next := trimPage(messages, limit, func(*Message) string { return offsetCursor(offset + limit) })
+	return messages, next, nil
+}
+
+// Events
+
+func (s *PostgresStore) AddEvent(ctx context.Context, runID string, event *Event) error {
+	if event.ID == "" {
+		event.ID = uuid.New().String()
+	}
+	event.Timestamp = time.Now()
+	event.RunID = runID
+
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		if err := tx.QueryRowContext(ctx, `INSERT INTO run_event_sequences (run_id, last_sequence) VALUES ($1, 1)
+			ON CONFLICT (run_id) DO UPDATE SET last_sequence = run_event_sequences.last_sequence + 1
+			RETURNING last_sequence`, runID).Scan(&event.Sequence); err != nil {
+			return fmt.Errorf("failed to assign event sequence: %w", err)
+		}
+
+		if _, err := tx.ExecContext(ctx, `INSERT INTO events (`+eventColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			event.ID, event.RunID, event.TenantID, event.SessionID, event.Type, jsonValue{event.Data}, event.Timestamp, event.Sequence); err != nil {
+			return fmt.Errorf("failed to add event: %w", err)
+		}
+		return nil
+	})
+}
+
+func (s *PostgresStore) GetEvents(ctx context.Context, runID string) ([]*Event, error) {
+	rows, err := s.q.QueryContext(ctx, `SELECT `+eventColumns+` FROM events WHERE run_id = $1 ORDER BY sequence`, runID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get events: %w", err)
+	}
+	return scanAll(rows, scanPostgresEvent)
+}
+
+func (s *PostgresStore) GetEventsAfter(ctx context.Context, runID string, sequence int64) ([]*Event, error) {
+	rows, err := s.q.QueryContext(ctx, `SELECT `+eventColumns+` FROM events
+		WHERE run_id = $1 AND sequence > $2 ORDER BY sequence`, runID, sequence)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get events: %w", err)
+	}
+	return scanAll(rows, scanPostgresEvent)
+}
+
+// Tool calls
+
+func (s *PostgresStore) AddToolCall(ctx context.Context, runID string, toolCall *ToolCall) error {
+	if toolCall.ID == "" {
+		toolCall.ID = uuid.New().String()
+	}
+	toolCall.CreatedAt = time.Now()
+	toolCall.RunID = runID
+
+	_, err := s.q.ExecContext(ctx, `INSERT INTO tool_calls (`+toolCallColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		toolCall.ID, toolCall.RunID, toolCall.ToolName, toolCall.ServerName, jsonValue{toolCall.Arguments},
+		toolCall.Status, toolCall.Output, toolCall.Error, toolCall.RetryCount,
+		toolCall.StartedAt, toolCall.CompletedAt, toolCall.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to add tool call: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) UpdateToolCall(ctx context.Context, toolCall *ToolCall) error {
+	res, err := s.q.ExecContext(ctx, `UPDATE tool_calls SET tool_name = $1, server_name = $2, arguments = $3, status = $4,
+		output = $5, error = $6, retry_count = $7, started_at = $8, completed_at = $9
+		WHERE run_id = $10 AND id = $11`,
+		toolCall.ToolName, toolCall.ServerName, jsonValue{toolCall.Arguments}, toolCall.Status,
+		toolCall.Output, toolCall.Error, toolCall.RetryCount, toolCall.StartedAt, toolCall.CompletedAt,
+		toolCall.RunID, toolCall.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update tool call: %w", err)
+	}
+	return requireAffected(res)
+}
+
+func (s *PostgresStore) GetToolCalls(ctx context.Context, runID string) ([]*ToolCall, error) {
+	rows, err := s.q.QueryContext(ctx, `SELECT `+toolCallColumns+` FROM tool_calls WHERE run_id = $1 ORDER BY seq`, runID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tool calls: %w", err)
+	}
+	return scanAll(rows, scanPostgresToolCall)
+}
+
+// Idempotency keys
+
+func (s *PostgresStore) CreateIdempotencyKey(ctx context.Context, key *IdempotencyKey) error {
+	key.CreatedAt = time.Now()
+
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		// Expired keys are dropped as new ones are created
+		if _, err := tx.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= $1`, key.CreatedAt); err != nil {
+			return fmt.Errorf("failed to expire idempotency keys: %w", err)
+		}
+
+		res, err := tx.ExecContext(ctx, `INSERT INTO idempotency_keys (tenant_id, key, request_hash, run_id, created_at, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (tenant_id, key) DO NOTHING`,
+			key.TenantID, key.Key, key.RequestHash, key.RunID, key.CreatedAt, key.ExpiresAt)
+		if err != nil {
+			return fmt.Errorf("failed to create idempotency key: %w", err)
+		}
+		if err := requireAffected(res); errors.Is(err, ErrNotFound) {
+			return ErrAlreadyExists
+		} else if err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+func (s *PostgresStore) GetIdempotencyKey(ctx context.Context, tenantID, key string) (*IdempotencyKey, error) {
+	row := s.q.QueryRowContext(ctx, `SELECT tenant_id, key, request_hash, run_id, created_at, expires_at
+		FROM idempotency_keys WHERE tenant_id = $1 AND key = $2 AND expires_at > $3`, tenantID, key, time.Now())
+
+	var k IdempotencyKey
+	if err := row.Scan(&k.TenantID, &k.Key, &k.RequestHash, &k.RunID, &k.CreatedAt, &k.ExpiresAt); err != nil {
+		return nil, scanError(err)
+	}
+	return &k, nil
+}
+
+// DeleteSession removes a session and all associated data
+func (s *PostgresStore) DeleteSession(ctx context.Context, sessionID string) error {
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `DELETE FROM sessions WHERE id = $1`, sessionID)
+		if err != nil {
+			return fmt.Errorf("failed to delete session: %w", err)
+		}
+		if err := requireAffected(res); err != nil {
+			return err
+		}
+		return deletePostgresSessionData(ctx, tx, sessionID)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.logger.Verbose("Session deleted with all associated data", "session_id", sessionID)
+	return nil
+}
+
+// deletePostgresSessionData removes a session's runs and messages
+func deletePostgresSessionData(ctx context.Context, tx *sql.Tx, sessionID string) error {
+	for _, query := range []string{
+		`DELETE FROM events WHERE run_id IN (SELECT id FROM runs WHERE session_id = $1)`,
+		`DELETE FROM run_event_sequences WHERE run_id IN (SELECT id FROM runs WHERE session_id = $1)`,
+		`DELETE FROM tool_calls WHERE run_id IN (SELECT id FROM runs WHERE session_id = $1)`,
+		`DELETE FROM idempotency_keys WHERE run_id IN (SELECT id FROM runs WHERE session_id = $1)`,
+		`DELETE FROM runs WHERE session_id = $1`,
+		`DELETE FROM messages WHERE session_id = $1`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, sessionID); err != nil {
+			return fmt.Errorf("failed to delete session data: %w", err)
+		}
+	}
+	return nil
+}
+
+// DeleteRun removes a run and its associated events/tool calls
+func (s *PostgresStore) DeleteRun(ctx context.Context, runID string) error {
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `DELETE FROM runs WHERE id = $1`, runID)
+		if err != nil {
+			return fmt.Errorf("failed to delete run: %w", err)
+		}
+		if err := requireAffected(res); err != nil {
+			return err
+		}
+		return deletePostgresRunData(ctx, tx, runID)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.logger.Verbose("Run deleted with all associated data", "run_id", runID)
+	return nil
+}
+
+// deletePostgresRunData removes a run's events and tool calls
+func deletePostgresRunData(ctx context.Context, tx *sql.Tx, runID string) error {
+	for _, query := range []string{
+		`DELETE FROM events WHERE run_id = $1`,
+		`DELETE FROM run_event_sequences WHERE run_id = $1`,
+		`DELETE FROM tool_calls WHERE run_id = $1`,
+		`DELETE FROM idempotency_keys WHERE run_id = $1`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, runID); err != nil {
+			return fmt.Errorf("failed to delete run data: %w", err)
+		}
+	}
+	return nil
+}
+
+// CleanupOldSessions removes sessions older than the specified duration
+func (s *PostgresStore) CleanupOldSessions(ctx context.Context, tenantID string, olderThan time.Duration) error {
+	cutoff := time.Now().Add(-olderThan)
+	deletedCount := 0
+
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		sessionIDs, err := queryIDs(ctx, tx, `SELECT id FROM sessions WHERE tenant_id = $1 AND created_at < $2`, tenantID, cutoff)
+		if err != nil {
+			return fmt.Errorf("failed to find old sessions: %w", err)
+		}
+		for _, sessionID := range sessionIDs {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM sessions WHERE id = $1`, sessionID); err != nil {
+				return fmt.Errorf("failed to delete session: %w", err)
+			}
+			if err := deletePostgresSessionData(ctx, tx, sessionID); err != nil {
+				return err
+			}
+		}
+		deletedCount = len(sessionIDs)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.logger.Verbose("Cleaned up old sessions",
+		"tenant_id", tenantID,
+		"deleted_count", deletedCount,
+		"older_than", olderThan)
+	return nil
+}
+
+// CleanupOldRuns removes completed runs older than the specified duration for a session
+func (s *PostgresStore) CleanupOldRuns(ctx context.Context, sessionID string, olderThan time.Duration) error {
+	cutoff := time.Now().Add(-olderThan)
+	deletedCount := 0
+
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		// Only delete completed, failed, or cancelled runs
+		runIDs, err := queryIDs(ctx, tx, `SELECT id FROM runs WHERE session_id = $1 AND created_at < $2 AND status IN ($3, $4, $5)`,
+			sessionID, cutoff, RunStateCompleted, RunStateFailed, RunStateCancelled)
+		if err != nil {
+			return fmt.Errorf("failed to find old runs: %w", err)
+		}
+		for _, runID := range runIDs {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM runs WHERE id = $1`, runID); err != nil {
+				return fmt.Errorf("failed to delete run: %w", err)
+			}
+			if err := deletePostgresRunData(ctx, tx, runID); err != nil {
+				return err
+			}
+		}
+		deletedCount = len(runIDs)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.logger.Verbose("Cleaned up old runs",
+		"session_id", sessionID,
+		"deleted_count", deletedCount,
+		"older_than", olderThan)
+	return nil
+}
+
+func scanPostgresSession(row rowScanner) (*Session, error) {
+	var session Session
+	var metadata sql.NullString
+
+	if err := row.Scan(&session.ID, &session.TenantID, &session.ProfileName, &metadata, &session.CostUSD,
+		&session.CreatedAt, &session.UpdatedAt); err != nil {
+		return nil, scanError(err)
+	}
+
+	return &session, unmarshalJSON(metadata, &session.Metadata)
+}
+
+func scanPostgresRun(row rowScanner) (*Run, error) {
+	var run Run
+	var metadata, costBreakdown sql.NullString
+	var startedAt, endedAt sql.NullTime
+
+	if err := row.Scan(&run.ID, &run.SessionID, &run.TenantID, &run.Mode, &run.Status, &run.Input, &run.Output,
+		&run.Error, &metadata, &run.ToolCallCount, &run.FailureCount, &run.CostUSD, &costBreakdown,
+		&run.CreatedAt, &run.UpdatedAt, &startedAt, &endedAt, &run.Version, &run.BudgetUSD); err != nil {
+		return nil, scanError(err)
+	}
+
+	run.StartedAt = nullTimePtr(startedAt)
+	run.EndedAt = nullTimePtr(endedAt)
+	if err := unmarshalJSON(metadata, &run.Metadata); err != nil {
+		return nil, err
+	}
+	return &run, unmarshalJSON(costBreakdown, &run.CostBreakdown)
+}
+
+func scanPostgresMessage(row rowScanner) (*Message, error) {
+	var message Message
+	var toolCalls, metadata, compaction sql.NullString
+
+	if err := row.Scan(&message.ID, &message.SessionID, &message.Role, &message.Content, &toolCalls, &metadata,
+		&message.ToolCallID, &message.ToolName, &compaction, &message.CreatedAt); err != nil {
+		return nil, scanError(err)
+	}
+
+	if err := unmarshalJSON(toolCalls, &message.ToolCalls); err != nil {
+		return nil, err
+	}
+	if err := unmarshalJSON(metadata, &message.Metadata); err != nil {
+		return nil, err
+	}
+	return &message, unmarshalJSON(compaction, &message.Compaction)
+}
+
+func scanPostgresEvent(row rowScanner) (*Event, error) {
+	var event Event
+	var data sql.NullString
+
+	if err := row.Scan(&event.ID, &event.RunID, &event.TenantID, &event.SessionID, &event.Type, &data, &event.Timestamp, &event.Sequence); err != nil {
+		return nil, scanError(err)
+	}
+
+	return &event, unmarshalJSON(data, &event.Data)
+}
+
+func scanPostgresToolCall(row rowScanner) (*ToolCall, error) {
+	var toolCall ToolCall
+	var arguments sql.NullString
+	var startedAt, completedAt sql.NullTime
+
+	if err := row.Scan(&toolCall.ID, &toolCall.RunID, &toolCall.ToolName, &toolCall.ServerName, &arguments,
+		&toolCall.Status, &toolCall.Output, &toolCall.Error, &toolCall.RetryCount,
+		&startedAt, &completedAt, &toolCall.CreatedAt); err != nil {
+		return nil, scanError(err)
+	}
+
+	toolCall.StartedAt = nullTimePtr(startedAt)
+	toolCall.CompletedAt = nullTimePtr(completedAt)
+	return &toolCall, unmarshalJSON(arguments, &toolCall.Arguments)
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
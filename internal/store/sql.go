@@ -0,0 +1,220 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Helpers shared by the SQL-backed stores
+
+// Column lists, in the order the scan functions expect
+const (
+	sessionColumns = `id, tenant_id, profile_name, metadata, cost_usd, created_at, updated_at`
+	runColumns     = `id, session_id, tenant_id, mode, status, input, output, error, metadata,
+	tool_call_count, failure_count, cost_usd, cost_breakdown, created_at, updated_at, started_at, ended_at, version, budget_usd`
+	messageColumns  = `id, session_id, role, content, tool_calls, metadata, tool_call_id, tool_name, compaction, created_at`
+	toolCallColumns = `id, run_id, tool_name, server_name, arguments, status, output, error, retry_count,
+	started_at, completed_at, created_at`
+	eventColumns = `id, run_id, tenant_id, session_id, type, data, timestamp, sequence`
+)
+
+// querier is implemented by *sql.DB and *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanAll scans every row, returning an empty slice rather than nil
+func scanAll[T any](rows *sql.Rows, scan func(rowScanner) (*T, error)) ([]*T, error) {
+	defer rows.Close()
+
+	items := []*T{}
+	for rows.Next() {
+		item, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rows: %w", err)
+	}
+	return items, nil
+}
+
+func queryIDs(ctx context.Context, q querier, query string, args ...any) ([]string, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func scanError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return fmt.Errorf("failed to read row: %w", err)
+}
+
+// requireAffected returns ErrNotFound if a statement matched no rows
+func requireAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// versionConflict explains why a conditional update of a run (a versioned
+// update or a claim) matched no rows
+func versionConflict(ctx context.Context, q querier, query, runID string) error {
+	var exists bool
+	if err := q.QueryRowContext(ctx, query, runID).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to check run: %w", err)
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	return ErrConflict
+}
+
+// jsonValue stores v in a JSON column
+type jsonValue struct{ v any }
+
+func (j jsonValue) Value() (driver.Value, error) {
+	data, err := json.Marshal(j.v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %T as JSON: %w", j.v, err)
+	}
+	return string(data), nil
+}
+
+func unmarshalJSON(data sql.NullString, v any) error {
+	if !data.Valid || data.String == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(data.String), v); err != nil {
+		return fmt.Errorf("failed to decode stored JSON: %w", err)
+	}
+	return nil
+}
+
+// sqlDialect covers how the SQL stores differ in listing conditions
+type sqlDialect struct {
+	// timeArg converts a time to the column's representation
+	timeArg func(t time.Time) any
+
+	// metadata returns a condition that the metadata column has key, set to
+	// the string value if it isn't empty
+	metadata func(key, value string) (string, []any)
+}
+
+// listQuery builds a paged listing. Conditions use ? placeholders.
+type listQuery struct {
+	conds []string
+	args  []any
+}
+
+func (q *listQuery) where(cond string, args ...any) {
+	q.conds = append(q.conds, cond)
+	q.args = append(q.args, args...)
+}
+
+// createdBetween adds the time range and the keyset cursor of a listing
+// ordered by created_at DESC, id DESC
+func (q *listQuery) createdBetween(d sqlDialect, after, before time.Time, cursor string) error {
+	if !after.IsZero() {
+		q.where("created_at >= ?", d.timeArg(after))
+	}
+	if !before.IsZero() {
+		q.where("created_at < ?", d.timeArg(before))
+	}
+	if cursor != "" {
+		t, id, err := parseTimeCursor(cursor)
+		if err != nil {
+			return err
+		}
+		q.where("(created_at < ? OR (created_at = ? AND id < ?))", d.timeArg(t), d.timeArg(t), id)
+	}
+	return nil
+}
+
+// sql returns the query for a page of limit rows plus one, which tells
+// whether there is another page
+func (q *listQuery) sql(columns, table, order string, limit, offset int) (string, []any) {
+	query := `SELECT ` + columns + ` FROM ` + table
+	if len(q.conds) > 0 {
+		query += ` WHERE ` + strings.Join(q.conds, " AND ")
+	}
+	query += ` ORDER BY ` + order + ` LIMIT ? OFFSET ?`
+	return query, append(q.args, limit+1, offset)
+}
+
+func sessionListQuery(d sqlDialect, query SessionQuery) (*listQuery, error) {
+	q := &listQuery{}
+	if query.TenantID != "" {
+		q.where("tenant_id = ?", query.TenantID)
+	}
+	if query.MetadataKey != "" {
+		cond, args := d.metadata(query.MetadataKey, query.MetadataValue)
+		q.where(cond, args...)
+	}
+	if err := q.createdBetween(d, query.CreatedAfter, query.CreatedBefore, query.Cursor); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func runListQuery(d sqlDialect, query RunQuery) (*listQuery, error) {
+	q := &listQuery{}
+	if query.TenantID != "" {
+		q.where("tenant_id = ?", query.TenantID)
+	}
+	if query.SessionID != "" {
+		q.where("session_id = ?", query.SessionID)
+	}
+	if len(query.Statuses) > 0 {
+		args := make([]any, len(query.Statuses))
+		for i, status := range query.Statuses {
+			args[i] = status
+		}
+		q.where("status IN ("+strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ")+")", args...)
+	}
+	if query.Mode != "" {
+		q.where("mode = ?", query.Mode)
+	}
+	if query.MetadataKey != "" {
+		cond, args := d.metadata(query.MetadataKey, query.MetadataValue)
+		q.where(cond, args...)
+	}
+	if err := q.createdBetween(d, query.CreatedAfter, query.CreatedBefore, query.Cursor); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
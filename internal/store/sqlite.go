@@ -0,0 +1,874 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/shankarg87/agent/internal/logging"
+)
+
+// sqliteMigrations are applied in order; a database at version N has had the
+// first N applied. Never edit a released migration, append a new one.
+var sqliteMigrations = []string{
+	`CREATE TABLE sessions (
+		seq          INTEGER PRIMARY KEY AUTOINCREMENT,
+		id           TEXT NOT NULL UNIQUE,
+		tenant_id    TEXT NOT NULL,
+		profile_name TEXT NOT NULL,
+		metadata     TEXT,
+		cost_usd     REAL NOT NULL DEFAULT 0,
+		created_at   INTEGER NOT NULL,
+		updated_at   INTEGER NOT NULL
+	);
+	CREATE INDEX idx_sessions_tenant ON sessions (tenant_id, seq);
+	CREATE INDEX idx_sessions_created ON sessions (tenant_id, created_at);
+
+	CREATE TABLE runs (
+		seq             INTEGER PRIMARY KEY AUTOINCREMENT,
+		id              TEXT NOT NULL UNIQUE,
+		session_id      TEXT NOT NULL,
+		tenant_id       TEXT NOT NULL,
+		mode            TEXT NOT NULL,
+		status          TEXT NOT NULL,
+		input           TEXT NOT NULL DEFAULT '',
+		output          TEXT NOT NULL DEFAULT '',
+		error           TEXT NOT NULL DEFAULT '',
+		metadata        TEXT,
+		tool_call_count INTEGER NOT NULL DEFAULT 0,
+		failure_count   INTEGER NOT NULL DEFAULT 0,
+		cost_usd        REAL NOT NULL DEFAULT 0,
+		cost_breakdown  TEXT,
+		created_at      INTEGER NOT NULL,
+		updated_at      INTEGER NOT NULL,
+		started_at      INTEGER,
+		ended_at        INTEGER
+	);
+	CREATE INDEX idx_runs_session ON runs (session_id, seq);
+	CREATE INDEX idx_runs_tenant ON runs (tenant_id, status);
+
+	CREATE TABLE messages (
+		seq          INTEGER PRIMARY KEY AUTOINCREMENT,
+		id           TEXT NOT NULL,
+		session_id   TEXT NOT NULL,
+		role         TEXT NOT NULL,
+		content      TEXT NOT NULL DEFAULT '',
+		tool_calls   TEXT,
+		metadata     TEXT,
+		tool_call_id TEXT NOT NULL DEFAULT '',
+		tool_name    TEXT NOT NULL DEFAULT '',
+		compaction   TEXT,
+		created_at   INTEGER NOT NULL
+	);
+	CREATE INDEX idx_messages_session ON messages (session_id, seq);
+
+	CREATE TABLE events (
+		seq       INTEGER PRIMARY KEY AUTOINCREMENT,
+		id        TEXT NOT NULL,
+		run_id    TEXT NOT NULL,
+		type      TEXT NOT NULL,
+		data      TEXT,
+		timestamp INTEGER NOT NULL
+	);
+	CREATE INDEX idx_events_run ON events (run_id, seq);
+
+	CREATE TABLE tool_calls (
+		seq          INTEGER PRIMARY KEY AUTOINCREMENT,
+		id           TEXT NOT NULL,
+		run_id       TEXT NOT NULL,
+		tool_name    TEXT NOT NULL,
+		server_name  TEXT NOT NULL,
+		arguments    TEXT,
+		status       TEXT NOT NULL,
+		output       TEXT NOT NULL DEFAULT '',
+		error        TEXT NOT NULL DEFAULT '',
+		retry_count  INTEGER NOT NULL DEFAULT 0,
+		started_at   INTEGER,
+		completed_at INTEGER,
+		created_at   INTEGER NOT NULL,
+		UNIQUE (run_id, id)
+	);
+	CREATE INDEX idx_tool_calls_run ON tool_calls (run_id, seq);`,
+
+	// Optimistic concurrency for runs and per-run event sequence numbers
+	`ALTER TABLE runs ADD COLUMN version INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE events ADD COLUMN sequence INTEGER NOT NULL DEFAULT 0;
+	UPDATE events SET sequence = (
+		SELECT COUNT(*) FROM events AS e WHERE e.run_id = events.run_id AND e.seq <= events.seq
+	);
+	CREATE UNIQUE INDEX idx_events_run_sequence ON events (run_id, sequence);`,
+
+	// Idempotency keys, scoped to a tenant
+	`CREATE TABLE idempotency_keys (
+		tenant_id    TEXT NOT NULL,
+		key          TEXT NOT NULL,
+		request_hash TEXT NOT NULL,
+		run_id       TEXT NOT NULL,
+		created_at   INTEGER NOT NULL,
+		expires_at   INTEGER NOT NULL,
+		PRIMARY KEY (tenant_id, key)
+	);
+	CREATE INDEX idx_idempotency_keys_expires ON idempotency_keys (expires_at);
+	CREATE INDEX idx_idempotency_keys_run ON idempotency_keys (run_id);`,
+
+	// Paged listings, newest first
+	`CREATE INDEX idx_sessions_listing ON sessions (created_at, id);
+	CREATE INDEX idx_runs_listing ON runs (created_at, id);`,
+
+	// Events carry their run's tenant and session for cross-run subscriptions
+	`ALTER TABLE events ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';
+	ALTER TABLE events ADD COLUMN session_id TEXT NOT NULL DEFAULT '';
+	UPDATE events SET
+		tenant_id = COALESCE((SELECT tenant_id FROM runs WHERE runs.id = events.run_id), ''),
+		session_id = COALESCE((SELECT session_id FROM runs WHERE runs.id = events.run_id), '');`,
+
+	// Leases on runs, held by the replica executing them
+	`ALTER TABLE runs ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+	ALTER TABLE runs ADD COLUMN lease_expires_at INTEGER;`,
+
+	// Run budgets, which grow as operators approve more spend
+	`ALTER TABLE runs ADD COLUMN budget_usd REAL NOT NULL DEFAULT 0;`,
+}
+
+// SQLiteStore implements Store on a SQLite database
+type SQLiteStore struct {
+	db     *sql.DB
+	q      querier // db, or tx for a store bound to a transaction
+	tx     *sql.Tx
+	logger *logging.SimpleLogger
+}
+
+// NewSQLiteStore opens (creating if needed) the SQLite database at dsn, a
+// file path or file: URI, enables WAL mode and applies pending migrations
+func NewSQLiteStore(dsn string) (*SQLiteStore, error) {
+	logger := logging.VerboseLogger("store")
+	logger.Verbose("Opening SQLite store", "dsn", dsn)
+
+	if !SQLiteAvailable {
+		return nil, fmt.Errorf("sqlite store requires a build with cgo enabled (CGO_ENABLED=1)")
+	}
+
+	db, err := sql.Open("sqlite3", sqliteDSN(dsn))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+
+	// Each connection to an in-memory database gets its own database
+	if strings.Contains(dsn, ":memory:") || strings.Contains(dsn, "mode=memory") {
+		db.SetMaxOpenConns(1)
+	}
+
+	s := &SQLiteStore{db: db, q: db, logger: logger}
+	if err := s.migrate(context.Background()); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// sqliteDSN adds the connection options the store relies on: WAL so readers
+// don't block the writer, a busy timeout instead of immediate SQLITE_BUSY
+// errors, and write locks taken when a transaction begins
+func sqliteDSN(dsn string) string {
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return dsn + sep + "_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate"
+}
+
+// Close closes the database
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLiteStore) migrate(ctx context.Context) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    INTEGER PRIMARY KEY,
+			applied_at INTEGER NOT NULL
+		)`); err != nil {
+			return fmt.Errorf("failed to create migrations table: %w", err)
+		}
+
+		var version int
+		if err := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+			return fmt.Errorf("failed to read schema version: %w", err)
+		}
+		if version > len(sqliteMigrations) {
+			return fmt.Errorf("database schema version %d is newer than supported version %d", version, len(sqliteMigrations))
+		}
+
+		for i := version; i < len(sqliteMigrations); i++ {
+			if _, err := tx.ExecContext(ctx, sqliteMigrations[i]); err != nil {
+				return fmt.Errorf("failed to apply migration %d: %w", i+1, err)
+			}
+			if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`,
+				i+1, toUnixNano(time.Now())); err != nil {
+				return fmt.Errorf("failed to record migration %d: %w", i+1, err)
+			}
+			s.logger.Info("Applied SQLite migration", "version", i+1)
+		}
+		return nil
+	})
+}
+
+// WithTx runs fn against a store bound to a transaction, committing if fn
+// returns nil and rolling back otherwise
+func (s *SQLiteStore) WithTx(ctx context.Context, fn func(tx Store) error) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		return fn(&SQLiteStore{db: s.db, q: tx, tx: tx, logger: s.logger})
+	})
+}
+
+// withTx runs fn in a transaction, committing if it returns nil. A store
+// already bound to a transaction runs fn in it.
+func (s *SQLiteStore) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	if s.tx != nil {
+		return fn(s.tx)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Sessions
+
+func (s *SQLiteStore) CreateSession(ctx context.Context, session *Session) error {
+	start := time.Now()
+	s.logger.Verbose("Creating session", "session_id", session.ID, "tenant_id", session.TenantID)
+
+	if session.ID == "" {
+		session.ID = uuid.New().String()
+		s.logger.Verbose("Generated new session ID", "session_id", session.ID)
+	}
+	session.CreatedAt = time.Now()
+	session.UpdatedAt = session.CreatedAt
+
+	_, err := s.q.ExecContext(ctx, `INSERT INTO sessions (`+sessionColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		session.ID, session.TenantID, session.ProfileName, jsonValue{session.Metadata}, session.CostUSD,
+		toUnixNano(session.CreatedAt), toUnixNano(session.UpdatedAt))
+
+	s.logger.LogMemoryOperation("create_session", session.ID, err == nil, time.Since(start))
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) GetSession(ctx context.Context, sessionID string) (*Session, error) {
+	start := time.Now()
+	s.logger.Verbose("Getting session", "session_id", sessionID)
+
+	session, err := scanSQLiteSession(s.q.QueryRowContext(ctx, `SELECT `+sessionColumns+` FROM sessions WHERE id = ?`, sessionID))
+
+	s.logger.LogMemoryOperation("get_session", sessionID, err == nil, time.Since(start))
+	return session, err
+}
+
+func (s *SQLiteStore) UpdateSession(ctx context.Context, session *Session) error {
+	session.UpdatedAt = time.Now()
+
+	res, err := s.q.ExecContext(ctx, `UPDATE sessions SET tenant_id = ?, profile_name = ?, metadata = ?, cost_usd = ?, updated_at = ? WHERE id = ?`,
+		session.TenantID, session.ProfileName, jsonValue{session.Metadata}, session.CostUSD,
+		toUnixNano(session.UpdatedAt), session.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+	return requireAffected(res)
+}
+
+func (s *SQLiteStore) AddSessionCost(ctx context.Context, sessionID string, costUSD float64) (float64, error) {
+	var total float64
+	err := s.q.QueryRowContext(ctx, `UPDATE sessions SET cost_usd = cost_usd + ?, updated_at = ? WHERE id = ? RETURNING cost_usd`,
+		costUSD, toUnixNano(time.Now()), sessionID).Scan(&total)
+	if err != nil {
+		return 0, scanError(err)
+	}
+	return total, nil
+}
+
+func (s *SQLiteStore) ListSessions(ctx context.Context, tenantID string, limit, offset int) ([]*Session, error) {
+	rows, err := s.q.QueryContext(ctx, `SELECT `+sessionColumns+` FROM sessions WHERE tenant_id = ? ORDER BY seq LIMIT ? OFFSET ?`,
+		tenantID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	return scanAll(rows, scanSQLiteSession)
+}
+
+func (s *SQLiteStore) SearchSessions(ctx context.Context, query SessionQuery) ([]*Session, string, error) {
+	q, err := sessionListQuery(sqliteDialect, query)
+	if err != nil {
+		return nil, "", err
+	}
+
+	limit := pageLimit(query.Limit)
+	sqlQuery, args := q.sql(sessionColumns, "sessions", "created_at DESC, id DESC", limit, 0)
+	rows, err := s.q.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to search sessions: %w", err)
+	}
+	sessions, err := scanAll(rows, scanSQLiteSession)
+	if err != nil {
+		return nil, "", err
+	}
+
+	sessions, next := trimPage(sessions, limit, sessionCursor)
+	return sessions, next, nil
+}
+
+// Runs
+
+func (s *SQLiteStore) CreateRun(ctx context.Context, run *Run) error {
+	if run.ID == "" {
+		run.ID = uuid.New().String()
+	}
+	run.CreatedAt = time.Now()
+	run.UpdatedAt = run.CreatedAt
+
+	_, err := s.q.ExecContext(ctx, `INSERT INTO runs (`+runColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		run.ID, run.SessionID, run.TenantID, run.Mode, run.Status, run.Input, run.Output, run.Error,
+		jsonValue{run.Metadata}, run.ToolCallCount, run.FailureCount, run.CostUSD, jsonValue{run.CostBreakdown},
+		toUnixNano(run.CreatedAt), toUnixNano(run.UpdatedAt), nullTime(run.StartedAt), nullTime(run.EndedAt), run.Version,
+		run.BudgetUSD)
+	if err != nil {
+		return fmt.Errorf("failed to create run: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) GetRun(ctx context.Context, runID string) (*Run, error) {
+	return scanSQLiteRun(s.q.QueryRowContext(ctx, `SELECT `+runColumns+` FROM runs WHERE id = ?`, runID))
+}
+
+// UpdateRun saves the run if it is unchanged since it was read, and returns
+// ErrConflict otherwise
+func (s *SQLiteStore) UpdateRun(ctx context.Context, run *Run) error {
+	updatedAt := time.Now()
+
+	res, err := s.q.ExecContext(ctx, `UPDATE runs SET mode = ?, status = ?, input = ?, output = ?, error = ?, metadata = ?,
+		tool_call_count = ?, failure_count = ?, cost_usd = ?, cost_breakdown = ?, budget_usd = ?, updated_at = ?, started_at = ?,
+		ended_at = ?, version = version + 1
+		WHERE id = ? AND version = ?`,
+		run.Mode, run.Status, run.Input, run.Output, run.Error, jsonValue{run.Metadata},
+		run.ToolCallCount, run.FailureCount, run.CostUSD, jsonValue{run.CostBreakdown}, run.BudgetUSD,
+		toUnixNano(updatedAt), nullTime(run.StartedAt), nullTime(run.EndedAt), run.ID, run.Version)
+	if err != nil {
+		return fmt.Errorf("failed to update run: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return versionConflict(ctx, s.q, `SELECT EXISTS (SELECT 1 FROM runs WHERE id = ?)`, run.ID)
+	}
+
+	run.UpdatedAt = updatedAt
+	run.Version++
+	return nil
+}
+
+func (s *SQLiteStore) ClaimRun(ctx context.Context, runID, owner string, until time.Time) error {
+	res, err := s.q.ExecContext(ctx, `UPDATE runs SET owner = ?, lease_expires_at = ?
+		WHERE id = ? AND (owner = '' OR owner = ? OR lease_expires_at IS NULL OR lease_expires_at < ?)`,
+		owner, toUnixNano(until), runID, owner, toUnixNano(time.Now()))
+	if err != nil {
+		return fmt.Errorf("failed to claim run: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return versionConflict(ctx, s.q, `SELECT EXISTS (SELECT 1 FROM runs WHERE id = ?)`, runID)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) ListRuns(ctx context.Context, sessionID string) ([]*Run, error) {
+	rows, err := s.q.QueryContext(ctx, `SELECT `+runColumns+` FROM runs WHERE session_id = ? ORDER BY seq`, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list runs: %w", err)
+	}
+	return scanAll(rows, scanSQLiteRun)
+}
+
+func (s *SQLiteStore) ListRunsByStatus(ctx context.Context, statuses ...string) ([]*Run, error) {
+	if len(statuses) == 0 {
+		return []*Run{}, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(statuses)), ", ")
+	args := make([]any, len(statuses))
+	for i, status := range statuses {
+		args[i] = status
+	}
+
+	rows, err := s.q.QueryContext(ctx, `SELECT `+runColumns+` FROM runs WHERE status IN (`+placeholders+`) ORDER BY seq`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list runs: %w", err)
+	}
+	return scanAll(rows, scanSQLiteRun)
+}
+
+func (s *SQLiteStore) SearchRuns(ctx context.Context, query RunQuery) ([]*Run, string, error) {
+	q, err := runListQuery(sqliteDialect, query)
+	if err != nil {
+		return nil, "", err
+	}
+
+	limit := pageLimit(query.Limit)
+	sqlQuery, args := q.sql(runColumns, "runs", "created_at DESC, id DESC", limit, 0)
+	rows, err := s.q.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to search runs: %w", err)
+	}
+	runs, err := scanAll(rows, scanSQLiteRun)
+	if err != nil {
+		return nil, "", err
+	}
+
+	runs, next := trimPage(runs, limit, runCursor)
+	return runs, next, nil
+}
+
+// sqliteDialect stores times as Unix nanoseconds and matches metadata keys
+// with JSON paths
+var sqliteDialect = sqlDialect{
+	timeArg: func(t time.Time) any { return toUnixNano(t) },
+	metadata: func(key, value string) (string, []any) {
+		path := `$."` + key + `"`
+		if value == "" {
+			return "json_type(metadata, ?) IS NOT NULL", []any{path}
+		}
+		return "(json_type(metadata, ?) = 'text' AND json_extract(metadata, ?) = ?)", []any{path, path, value}
+	},
+}
+
+// Messages
+
+func (s *SQLiteStore) AddMessage(ctx context.Context, sessionID string, message *Message) error {
+	if message.ID == "" {
+		message.ID = uuid.New().String()
+	}
+	message.CreatedAt = time.Now()
+	message.SessionID = sessionID
+
+	_, err := s.q.ExecContext(ctx, `INSERT INTO messages (`+messageColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		message.ID, message.SessionID, message.Role, message.Content, jsonValue{message.ToolCalls},
+		jsonValue{message.Metadata}, message.ToolCallID, message.ToolName, jsonValue{message.Compaction},
+		toUnixNano(message.CreatedAt))
+	if err != nil {
+		return fmt.Errorf("failed to add message: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) GetMessages(ctx context.Context, sessionID string) ([]*Message, error) {
+	rows, err := s.q.QueryContext(ctx, `SELECT `+messageColumns+` FROM messages WHERE session_id = ? ORDER BY seq`, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get messages: %w", err)
+	}
+	return scanAll(rows, scanSQLiteMessage)
+}
+
+func (s *SQLiteStore) ListMessages(ctx context.Context, query MessageQuery) ([]*Message, string, error) {
+	offset, err := parseOffsetCursor(query.Cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	q := &listQuery{}
+	q.where("session_id = ?", query.SessionID)
+	limit := pageLimit(query.Limit)
+	sqlQuery, args := q.sql(messageColumns, "messages", "seq", limit, offset)
+	rows, err := s.q.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list messages: %w", err)
+	}
+	messages, err := scanAll(rows, scanSQLiteMessage)
+	if err != nil {
+		return nil, "", err
+	}
+
+	messages, next := trimPage(messages, limit, func(*Message) string { return offsetCursor(offset + limit) })
+	return messages, next, nil
+}
+
+// Events
+
+func (s *SQLiteStore) AddEvent(ctx context.Context, runID string, event *Event) error {
+	if event.ID == "" {
+		event.ID = uuid.New().String()
+	}
+	event.Timestamp = time.Now()
+	event.RunID = runID
+
+	// Single statements are atomic, so concurrent writers can't take the same sequence
+	err := s.q.QueryRowContext(ctx, `INSERT INTO events (`+eventColumns+`)
+		SELECT ?, ?, ?, ?, ?, ?, ?, COALESCE(MAX(sequence), 0) + 1 FROM events WHERE run_id = ?
+		RETURNING sequence`,
+		event.ID, event.RunID, event.TenantID, event.SessionID, event.Type, jsonValue{event.Data}, toUnixNano(event.Timestamp),
+		event.RunID).Scan(&event.Sequence)
+	if err != nil {
+		return fmt.Errorf("failed to add event: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) GetEvents(ctx context.Context, runID string) ([]*Event, error) {
+	rows, err := s.q.QueryContext(ctx, `SELECT `+eventColumns+` FROM events WHERE run_id = ? ORDER BY sequence`, runID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get events: %w", err)
+	}
+	return scanAll(rows, scanSQLiteEvent)
+}
+
+func (s *SQLiteStore) GetEventsAfter(ctx context.Context, runID string, sequence int64) ([]*Event, error) {
+	rows, err := s.q.QueryContext(ctx, `SELECT `+eventColumns+` FROM events
+		WHERE run_id = ? AND sequence > ? ORDER BY sequence`, runID, sequence)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get events: %w", err)
+	}
+	return scanAll(rows, scanSQLiteEvent)
+}
+
+// Tool calls
+
+func (s *SQLiteStore) AddToolCall(ctx context.Context, runID string, toolCall *ToolCall) error {
+	if toolCall.ID == "" {
+		toolCall.ID = uuid.New().String()
+	}
+	toolCall.CreatedAt = time.Now()
+	toolCall.RunID = runID
+
+	_, err := s.q.ExecContext(ctx, `INSERT INTO tool_calls (`+toolCallColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		toolCall.ID, toolCall.RunID, toolCall.ToolName, toolCall.ServerName, jsonValue{toolCall.Arguments},
+		toolCall.Status, toolCall.Output, toolCall.Error, toolCall.RetryCount,
+		nullTime(toolCall.StartedAt), nullTime(toolCall.CompletedAt), toUnixNano(toolCall.CreatedAt))
+	if err != nil {
+		return fmt.Errorf("failed to add tool call: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) UpdateToolCall(ctx context.Context, toolCall *ToolCall) error {
+	res, err := s.q.ExecContext(ctx, `UPDATE tool_calls SET tool_name = ?, server_name = ?, arguments = ?, status = ?,
+		output = ?, error = ?, retry_count = ?, started_at = ?, completed_at = ?
+		WHERE run_id = ? AND id = ?`,
+		toolCall.ToolName, toolCall.ServerName, jsonValue{toolCall.Arguments}, toolCall.Status,
+		toolCall.Output, toolCall.Error, toolCall.RetryCount, nullTime(toolCall.StartedAt), nullTime(toolCall.CompletedAt),
+		toolCall.RunID, toolCall.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update tool call: %w", err)
+	}
+	return requireAffected(res)
+}
+
+func (s *SQLiteStore) GetToolCalls(ctx context.Context, runID string) ([]*ToolCall, error) {
+	rows, err := s.q.QueryContext(ctx, `SELECT `+toolCallColumns+` FROM tool_calls WHERE run_id = ? ORDER BY seq`, runID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tool calls: %w", err)
+	}
+	return scanAll(rows, scanSQLiteToolCall)
+}
+
+// Idempotency keys
+
+func (s *SQLiteStore) CreateIdempotencyKey(ctx context.Context, key *IdempotencyKey) error {
+	key.CreatedAt = time.Now()
+
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		// Expired keys are dropped as new ones are created
+		if _, err := tx.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= ?`, toUnixNano(key.CreatedAt)); err != nil {
+			return fmt.Errorf("failed to expire idempotency keys: %w", err)
+		}
+
+		res, err := tx.ExecContext(ctx, `INSERT INTO idempotency_keys (tenant_id, key, request_hash, run_id, created_at, expires_at)
+			VALUES (?, ?, ?, ?, ?, ?) ON CONFLICT (tenant_id, key) DO NOTHING`,
+			key.TenantID, key.Key, key.RequestHash, key.RunID, toUnixNano(key.CreatedAt), toUnixNano(key.ExpiresAt))
+		if err != nil {
+			return fmt.Errorf("failed to create idempotency key: %w", err)
+		}
+		if err := requireAffected(res); errors.Is(err, ErrNotFound) {
+			return ErrAlreadyExists
+		} else if err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+func (s *SQLiteStore) GetIdempotencyKey(ctx context.Context, tenantID, key string) (*IdempotencyKey, error) {
+	row := s.q.QueryRowContext(ctx, `SELECT tenant_id, key, request_hash, run_id, created_at, expires_at
+		FROM idempotency_keys WHERE tenant_id = ? AND key = ? AND expires_at > ?`, tenantID, key, toUnixNano(time.Now()))
+
+	var k IdempotencyKey
+	var createdAt, expiresAt int64
+	if err := row.Scan(&k.TenantID, &k.Key, &k.RequestHash, &k.RunID, &createdAt, &expiresAt); err != nil {
+		return nil, scanError(err)
+	}
+	k.CreatedAt = fromUnixNano(createdAt)
+	k.ExpiresAt = fromUnixNano(expiresAt)
+	return &k, nil
+}
+
+// DeleteSession removes a session and all associated data
+func (s *SQLiteStore) DeleteSession(ctx context.Context, sessionID string) error {
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `DELETE FROM sessions WHERE id = ?`, sessionID)
+		if err != nil {
+			return fmt.Errorf("failed to delete session: %w", err)
+		}
+		if err := requireAffected(res); err != nil {
+			return err
+		}
+		return deleteSQLiteSessionData(ctx, tx, sessionID)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.logger.Verbose("Session deleted with all associated data", "session_id", sessionID)
+	return nil
+}
+
+// deleteSQLiteSessionData removes a session's runs and messages
+func deleteSQLiteSessionData(ctx context.Context, tx *sql.Tx, sessionID string) error {
+	for _, query := range []string{
+		`DELETE FROM events WHERE run_id IN (SELECT id FROM runs WHERE session_id = ?)`,
+		`DELETE FROM tool_calls WHERE run_id IN (SELECT id FROM runs WHERE session_id = ?)`,
+		`DELETE FROM idempotency_keys WHERE run_id IN (SELECT id FROM runs WHERE session_id = ?)`,
+		`DELETE FROM runs WHERE session_id = ?`,
+		`DELETE FROM messages WHERE session_id = ?`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, sessionID); err != nil {
+			return fmt.Errorf("failed to delete session data: %w", err)
+		}
+	}
+	return nil
+}
+
+// DeleteRun removes a run and its associated events/tool calls
+func (s *SQLiteStore) DeleteRun(ctx context.Context, runID string) error {
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `DELETE FROM runs WHERE id = ?`, runID)
+		if err != nil {
+			return fmt.Errorf("failed to delete run: %w", err)
+		}
+		if err := requireAffected(res); err != nil {
+			return err
+		}
+		return deleteSQLiteRunData(ctx, tx, runID)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.logger.Verbose("Run deleted with all associated data", "run_id", runID)
+	return nil
+}
+
+// deleteSQLiteRunData removes a run's events and tool calls
+func deleteSQLiteRunData(ctx context.Context, tx *sql.Tx, runID string) error {
+	for _, query := range []string{
+		`DELETE FROM events WHERE run_id = ?`,
+		`DELETE FROM tool_calls WHERE run_id = ?`,
+		`DELETE FROM idempotency_keys WHERE run_id = ?`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, runID); err != nil {
+			return fmt.Errorf("failed to delete run data: %w", err)
+		}
+	}
+	return nil
+}
+
+// CleanupOldSessions removes sessions older than the specified duration
+func (s *SQLiteStore) CleanupOldSessions(ctx context.Context, tenantID string, olderThan time.Duration) error {
+	cutoff := toUnixNano(time.Now().Add(-olderThan))
+	deletedCount := 0
+
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		sessionIDs, err := queryIDs(ctx, tx, `SELECT id FROM sessions WHERE tenant_id = ? AND created_at < ?`, tenantID, cutoff)
+		if err != nil {
+			return fmt.Errorf("failed to find old sessions: %w", err)
+		}
+		for _, sessionID := range sessionIDs {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM sessions WHERE id = ?`, sessionID); err != nil {
+				return fmt.Errorf("failed to delete session: %w", err)
+			}
+			if err := deleteSQLiteSessionData(ctx, tx, sessionID); err != nil {
+				return err
+			}
+		}
+		deletedCount = len(sessionIDs)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.logger.Verbose("Cleaned up old sessions",
+		"tenant_id", tenantID,
+		"deleted_count", deletedCount,
+		"older_than", olderThan)
+	return nil
+}
+
+// CleanupOldRuns removes completed runs older than the specified duration for a session
+func (s *SQLiteStore) CleanupOldRuns(ctx context.Context, sessionID string, olderThan time.Duration) error {
+	cutoff := toUnixNano(time.Now().Add(-olderThan))
+	deletedCount := 0
+
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		// Only delete completed, failed, or cancelled runs
+		runIDs, err := queryIDs(ctx, tx, `SELECT id FROM runs WHERE session_id = ? AND created_at < ? AND status IN (?, ?, ?)`,
+			sessionID, cutoff, RunStateCompleted, RunStateFailed, RunStateCancelled)
+		if err != nil {
+			return fmt.Errorf("failed to find old runs: %w", err)
+		}
+		for _, runID := range runIDs {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM runs WHERE id = ?`, runID); err != nil {
+				return fmt.Errorf("failed to delete run: %w", err)
+			}
+			if err := deleteSQLiteRunData(ctx, tx, runID); err != nil {
+				return err
+			}
+		}
+		deletedCount = len(runIDs)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.logger.Verbose("Cleaned up old runs",
+		"session_id", sessionID,
+		"deleted_count", deletedCount,
+		"older_than", olderThan)
+	return nil
+}
+
+func scanSQLiteSession(row rowScanner) (*Session, error) {
+	var session Session
+	var metadata sql.NullString
+	var createdAt, updatedAt int64
+
+	if err := row.Scan(&session.ID, &session.TenantID, &session.ProfileName, &metadata, &session.CostUSD,
+		&createdAt, &updatedAt); err != nil {
+		return nil, scanError(err)
+	}
+
+	session.CreatedAt = fromUnixNano(createdAt)
+	session.UpdatedAt = fromUnixNano(updatedAt)
+	return &session, unmarshalJSON(metadata, &session.Metadata)
+}
+
+func scanSQLiteRun(row rowScanner) (*Run, error) {
+	var run Run
+	var metadata, costBreakdown sql.NullString
+	var createdAt, updatedAt int64
+	var startedAt, endedAt sql.NullInt64
+
+	if err := row.Scan(&run.ID, &run.SessionID, &run.TenantID, &run.Mode, &run.Status, &run.Input, &run.Output,
+		&run.Error, &metadata, &run.ToolCallCount, &run.FailureCount, &run.CostUSD, &costBreakdown,
+		&createdAt, &updatedAt, &startedAt, &endedAt, &run.Version, &run.BudgetUSD); err != nil {
+		return nil, scanError(err)
+	}
+
+	run.CreatedAt = fromUnixNano(createdAt)
+	run.UpdatedAt = fromUnixNano(updatedAt)
+	run.StartedAt = timePtr(startedAt)
+	run.EndedAt = timePtr(endedAt)
+	if err := unmarshalJSON(metadata, &run.Metadata); err != nil {
+		return nil, err
+	}
+	return &run, unmarshalJSON(costBreakdown, &run.CostBreakdown)
+}
+
+func scanSQLiteMessage(row rowScanner) (*Message, error) {
+	var message Message
+	var toolCalls, metadata, compaction sql.NullString
+	var createdAt int64
+
+	if err := row.Scan(&message.ID, &message.SessionID, &message.Role, &message.Content, &toolCalls, &metadata,
+		&message.ToolCallID, &message.ToolName, &compaction, &createdAt); err != nil {
+		return nil, scanError(err)
+	}
+
+	message.CreatedAt = fromUnixNano(createdAt)
+	if err := unmarshalJSON(toolCalls, &message.ToolCalls); err != nil {
+		return nil, err
+	}
+	if err := unmarshalJSON(metadata, &message.Metadata); err != nil {
+		return nil, err
+	}
+	return &message, unmarshalJSON(compaction, &message.Compaction)
+}
+
+func scanSQLiteEvent(row rowScanner) (*Event, error) {
+	var event Event
+	var data sql.NullString
+	var timestamp int64
+
+	if err := row.Scan(&event.ID, &event.RunID, &event.TenantID, &event.SessionID, &event.Type, &data, &timestamp, &event.Sequence); err != nil {
+		return nil, scanError(err)
+	}
+
+	event.Timestamp = fromUnixNano(timestamp)
+	return &event, unmarshalJSON(data, &event.Data)
+}
+
+func scanSQLiteToolCall(row rowScanner) (*ToolCall, error) {
+	var toolCall ToolCall
+	var arguments sql.NullString
+	var startedAt, completedAt sql.NullInt64
+	var createdAt int64
+
+	if err := row.Scan(&toolCall.ID, &toolCall.RunID, &toolCall.ToolName, &toolCall.ServerName, &arguments,
+		&toolCall.Status, &toolCall.Output, &toolCall.Error, &toolCall.RetryCount,
+		&startedAt, &completedAt, &createdAt); err != nil {
+		return nil, scanError(err)
+	}
+
+	toolCall.StartedAt = timePtr(startedAt)
+	toolCall.CompletedAt = timePtr(completedAt)
+	toolCall.CreatedAt = fromUnixNano(createdAt)
+	return &toolCall, unmarshalJSON(arguments, &toolCall.Arguments)
+}
+
+// Timestamps are stored as Unix nanoseconds so they compare correctly in SQL
+
+func toUnixNano(t time.Time) int64 {
+	return t.UnixNano()
+}
+
+func fromUnixNano(n int64) time.Time {
+	return time.Unix(0, n)
+}
+
+func nullTime(t *time.Time) sql.NullInt64 {
+	if t == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: t.UnixNano(), Valid: true}
+}
+
+func timePtr(n sql.NullInt64) *time.Time {
+	if !n.Valid {
+		return nil
+	}
+	t := fromUnixNano(n.Int64)
+	return &t
+}
@@ -0,0 +1,7 @@
+//go:build cgo
+
+package store
+
+// SQLiteAvailable reports whether the SQLite store works in this build. The
+// driver, mattn/go-sqlite3, is a cgo package.
+const SQLiteAvailable = true
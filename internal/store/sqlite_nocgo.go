@@ -0,0 +1,8 @@
+//go:build !cgo
+
+package store
+
+// SQLiteAvailable reports whether the SQLite store works in this build. The
+// driver, mattn/go-sqlite3, is a cgo package, and without cgo it only has
+// stubs that fail every call.
+const SQLiteAvailable = false
@@ -0,0 +1,145 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// skipWithoutSQLite skips tests of the SQLite store in builds without cgo
+func skipWithoutSQLite(t *testing.T) {
+	t.Helper()
+	if !SQLiteAvailable {
+		t.Skip("SQLite store requires cgo")
+	}
+}
+
+func newTestSQLiteStore(t *testing.T, path string) *SQLiteStore {
+	t.Helper()
+	skipWithoutSQLite(t)
+	s, err := NewSQLiteStore(path)
+	assertNoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestSQLiteStore(t *testing.T) {
+	runStoreTests(t, func(t *testing.T) storeHarness {
+		s := newTestSQLiteStore(t, filepath.Join(t.TempDir(), "agent.db"))
+		return storeHarness{
+			store: s,
+			backdate: func(t *testing.T, table, id string, at time.Time) {
+				if table != "sessions" && table != "runs" {
+					t.Fatalf("Cannot backdate %s", table)
+				}
+				_, err := s.db.Exec(`UPDATE `+table+` SET created_at = ?, updated_at = ? WHERE id = ?`,
+					toUnixNano(at), toUnixNano(at), id)
+				assertNoError(t, err)
+			},
+		}
+	})
+}
+
+func TestSQLiteStore_ReopenKeepsDataAndSchema(t *testing.T) {
+	skipWithoutSQLite(t)
+	path := filepath.Join(t.TempDir(), "agent.db")
+	ctx := context.Background()
+
+	s, err := NewSQLiteStore(path)
+	assertNoError(t, err)
+
+	var journalMode string
+	assertNoError(t, s.db.QueryRow(`PRAGMA journal_mode`).Scan(&journalMode))
+	assertEqual(t, "wal", journalMode)
+
+	assertNoError(t, s.CreateSession(ctx, &Session{ID: "session-1", TenantID: "tenant-1", ProfileName: "test"}))
+	assertNoError(t, s.Close())
+
+	// Migrations already applied are not re-run
+	s = newTestSQLiteStore(t, path)
+	var version int
+	assertNoError(t, s.db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version))
+	assertEqual(t, len(sqliteMigrations), version)
+
+	session, err := s.GetSession(ctx, "session-1")
+	assertNoError(t, err)
+	assertEqual(t, "tenant-1", session.TenantID)
+}
+
+func TestSQLiteStore_RoundTripsAllFields(t *testing.T) {
+	s := newTestSQLiteStore(t, filepath.Join(t.TempDir(), "agent.db"))
+	ctx := context.Background()
+
+	started := time.Now().Add(-time.Minute)
+	run := &Run{
+		ID:            "run-1",
+		SessionID:     "session-1",
+		TenantID:      "tenant-1",
+		Mode:          "autonomous",
+		Status:        RunStatePausedCheckpoint,
+		Input:         "do the thing",
+		ToolCallCount: 3,
+		FailureCount:  1,
+		CostUSD:       0.5,
+		CostBreakdown: CostBreakdown{PromptTokens: 100, CacheReadTokens: 40, PromptUSD: 0.25},
+		BudgetUSD:     2,
+		StartedAt:     &started,
+	}
+	assertNoError(t, s.CreateRun(ctx, run))
+
+	got, err := s.GetRun(ctx, "run-1")
+	assertNoError(t, err)
+	assertEqual(t, run.CostBreakdown, got.CostBreakdown)
+	assertEqual(t, 3, got.ToolCallCount)
+	assertEqual(t, 1, got.FailureCount)
+	assertEqual(t, 2.0, got.BudgetUSD)
+	assertEqual(t, started.UnixNano(), got.StartedAt.UnixNano())
+	if got.EndedAt != nil {
+		t.Fatal("Expected no end time")
+	}
+
+	call := ToolCallRef{ID: "call_1", Type: "function"}
+	call.Function.Name = "search"
+	call.Function.Arguments = `{"q":"x"}`
+	assertNoError(t, s.AddMessage(ctx, "session-1", &Message{Role: "assistant", ToolCalls: []ToolCallRef{call}}))
+	assertNoError(t, s.AddMessage(ctx, "session-1", &Message{Role: "tool", ToolCallID: "call_1", ToolName: "search", Content: "found"}))
+	assertNoError(t, s.AddMessage(ctx, "session-1", &Message{
+		Role:       "user",
+		Content:    "summary",
+		Compaction: &Compaction{Strategy: "summarize", ReplacesThrough: "m1", TokensBefore: 900, TokensAfter: 200},
+	}))
+
+	messages, err := s.GetMessages(ctx, "session-1")
+	assertNoError(t, err)
+	assertEqual(t, 3, len(messages))
+	assertEqual(t, call, messages[0].ToolCalls[0])
+	assertEqual(t, "call_1", messages[1].ToolCallID)
+	assertEqual(t, "search", messages[1].ToolName)
+	if messages[1].Compaction != nil {
+		t.Fatal("Expected no compaction on a regular message")
+	}
+	assertEqual(t, Compaction{Strategy: "summarize", ReplacesThrough: "m1", TokensBefore: 900, TokensAfter: 200}, *messages[2].Compaction)
+}
+
+func TestOpen(t *testing.T) {
+	s, err := Open(BackendMemory, "")
+	assertNoError(t, err)
+	if _, ok := s.(*InMemoryStore); !ok {
+		t.Fatalf("Expected in-memory store, got %T", s)
+	}
+
+	s, err = Open(BackendSQLite, filepath.Join(t.TempDir(), "agent.db"))
+	if SQLiteAvailable {
+		assertNoError(t, err)
+		s.(*SQLiteStore).Close()
+	} else {
+		assertError(t, err)
+	}
+
+	_, err = Open(BackendSQLite, "")
+	assertError(t, err)
+
+	_, err = Open("mongodb", "")
+	assertError(t, err)
+}
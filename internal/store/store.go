@@ -2,35 +2,93 @@ package store
 
 import (
 	"context"
+	"fmt"
 	"time"
 )
 
+// Store backends
+const (
+	BackendMemory   = "memory"
+	BackendSQLite   = "sqlite"
+	BackendPostgres = "postgres"
+)
+
+// Open creates a store for the given backend. dsn locates the database for
+// backends that have one; the in-memory store ignores it.
+func Open(backend, dsn string) (Store, error) {
+	switch backend {
+	case BackendMemory, "":
+		return NewInMemoryStore(), nil
+	case BackendSQLite:
+		if dsn == "" {
+			return nil, fmt.Errorf("sqlite store requires a DSN")
+		}
+		s, err := NewSQLiteStore(dsn)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	case BackendPostgres:
+		if dsn == "" {
+			return nil, fmt.Errorf("postgres store requires a DSN")
+		}
+		s, err := NewPostgresStore(dsn)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unsupported store backend: %s", backend)
+	}
+}
+
 // Store defines the interface for persisting agent runtime data
 type Store interface {
 	// Sessions
 	CreateSession(ctx context.Context, session *Session) error
 	GetSession(ctx context.Context, sessionID string) (*Session, error)
+	UpdateSession(ctx context.Context, session *Session) error
+	AddSessionCost(ctx context.Context, sessionID string, costUSD float64) (float64, error) // atomic; returns the new total
 	ListSessions(ctx context.Context, tenantID string, limit, offset int) ([]*Session, error)
 
 	// Runs
 	CreateRun(ctx context.Context, run *Run) error
 	GetRun(ctx context.Context, runID string) (*Run, error)
-	UpdateRun(ctx context.Context, run *Run) error
+	UpdateRun(ctx context.Context, run *Run) error // ErrConflict if run.Version is stale
 	ListRuns(ctx context.Context, sessionID string) ([]*Run, error)
+	ListRunsByStatus(ctx context.Context, statuses ...string) ([]*Run, error) // across sessions, oldest first
+
+	// ClaimRun gives owner a lease on a run until the given time, so that
+	// only one of several replicas sharing the store executes it. It
+	// succeeds if the run is unowned, already owned by owner (renewing the
+	// lease) or its lease has expired, and returns ErrConflict otherwise.
+	ClaimRun(ctx context.Context, runID, owner string, until time.Time) error
 
 	// Messages
 	AddMessage(ctx context.Context, sessionID string, message *Message) error
 	GetMessages(ctx context.Context, sessionID string) ([]*Message, error)
 
+	// Paged listings. Each returns the cursor of the next page, which is
+	// empty on the last one, and ErrInvalidCursor for a cursor it didn't
+	// produce.
+	SearchSessions(ctx context.Context, query SessionQuery) ([]*Session, string, error) // newest first
+	SearchRuns(ctx context.Context, query RunQuery) ([]*Run, string, error)             // newest first
+	ListMessages(ctx context.Context, query MessageQuery) ([]*Message, string, error)   // oldest first
+
 	// Events
 	AddEvent(ctx context.Context, runID string, event *Event) error
 	GetEvents(ctx context.Context, runID string) ([]*Event, error)
+	GetEventsAfter(ctx context.Context, runID string, sequence int64) ([]*Event, error) // events with a greater sequence
 
 	// Tool calls
 	AddToolCall(ctx context.Context, runID string, toolCall *ToolCall) error
 	UpdateToolCall(ctx context.Context, toolCall *ToolCall) error
 	GetToolCalls(ctx context.Context, runID string) ([]*ToolCall, error)
 
+	// Idempotency keys
+	CreateIdempotencyKey(ctx context.Context, key *IdempotencyKey) error // ErrAlreadyExists if the tenant holds the key unexpired
+	GetIdempotencyKey(ctx context.Context, tenantID, key string) (*IdempotencyKey, error)
+
 	// Cleanup methods
 	DeleteSession(ctx context.Context, sessionID string) error
 	DeleteRun(ctx context.Context, runID string) error
@@ -38,14 +96,35 @@ type Store interface {
 	CleanupOldRuns(ctx context.Context, sessionID string, olderThan time.Duration) error
 }
 
+// Transactor is implemented by stores that can apply several writes
+// atomically
+type Transactor interface {
+	// WithTx runs fn against a store bound to a transaction, committing if
+	// fn returns nil and rolling back otherwise
+	WithTx(ctx context.Context, fn func(tx Store) error) error
+}
+
+// WithTx runs fn in a transaction if s supports them, or directly against s
+// otherwise
+func WithTx(ctx context.Context, s Store, fn func(tx Store) error) error {
+	if t, ok := s.(Transactor); ok {
+		return t.WithTx(ctx, fn)
+	}
+	return fn(s)
+}
+
 // Session represents a conversation session
 type Session struct {
 	ID          string         `json:"id"`
 	TenantID    string         `json:"tenant_id"`
 	ProfileName string         `json:"profile_name"`
 	Metadata    map[string]any `json:"metadata,omitempty"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
+
+	// Stats
+	CostUSD float64 `json:"cost_usd"` // cumulative across all runs in the session
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 // Run represents a single execution run
@@ -61,14 +140,32 @@ type Run struct {
 	Metadata  map[string]any `json:"metadata,omitempty"`
 
 	// Stats
-	ToolCallCount int     `json:"tool_call_count"`
-	FailureCount  int     `json:"failure_count"`
-	CostUSD       float64 `json:"cost_usd"`
+	ToolCallCount int           `json:"tool_call_count"`
+	FailureCount  int           `json:"failure_count"`
+	CostUSD       float64       `json:"cost_usd"`
+	CostBreakdown CostBreakdown `json:"cost_breakdown"`
+	BudgetUSD     float64       `json:"budget_usd,omitempty"` // cost limit including approved extensions; 0 until the run starts or when unlimited
 
 	CreatedAt time.Time  `json:"created_at"`
 	UpdatedAt time.Time  `json:"updated_at"`
 	StartedAt *time.Time `json:"started_at,omitempty"`
 	EndedAt   *time.Time `json:"ended_at,omitempty"`
+
+	// Version is incremented by every UpdateRun. An update made from a stale
+	// copy of the run fails with ErrConflict.
+	Version int `json:"version"`
+}
+
+// CostBreakdown itemizes a run's token usage and spend by pricing category
+type CostBreakdown struct {
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	CacheReadTokens  int     `json:"cache_read_tokens"`
+	CacheWriteTokens int     `json:"cache_write_tokens"`
+	PromptUSD        float64 `json:"prompt_usd"`
+	CompletionUSD    float64 `json:"completion_usd"`
+	CacheReadUSD     float64 `json:"cache_read_usd"`
+	CacheWriteUSD    float64 `json:"cache_write_usd"`
 }
 
 // Message represents a conversation message
@@ -80,6 +177,27 @@ type Message struct {
 	ToolCalls []ToolCallRef  `json:"tool_calls,omitempty"`
 	Metadata  map[string]any `json:"metadata,omitempty"`
 	CreatedAt time.Time      `json:"created_at"`
+
+	// For tool result messages: the tool call this message answers
+	ToolCallID string `json:"tool_call_id,omitempty"`
+	ToolName   string `json:"tool_name,omitempty"`
+
+	// Set on compaction markers, which stand in for older history when
+	// building model requests
+	Compaction *Compaction `json:"compaction,omitempty"`
+}
+
+// Compaction records a compaction of session history. The marker message's
+// content (a summary or notice, possibly empty) replaces every message up to
+// and including ReplacesThrough; long tool outputs up to ElidesThrough are
+// elided.
+type Compaction struct {
+	Strategy        string `json:"strategy"`
+	ReplacesThrough string `json:"replaces_through,omitempty"` // message ID
+	ElidesThrough   string `json:"elides_through,omitempty"`   // message ID
+	ElideOverChars  int    `json:"elide_over_chars,omitempty"` // tool outputs longer than this are elided
+	TokensBefore    int    `json:"tokens_before"`
+	TokensAfter     int    `json:"tokens_after"`
 }
 
 type ToolCallRef struct {
@@ -95,9 +213,12 @@ type ToolCallRef struct {
 type Event struct {
 	ID        string         `json:"id"`
 	RunID     string         `json:"run_id"`
-	Type      string         `json:"type"` // run_started, text_delta, tool_started, etc.
+	TenantID  string         `json:"tenant_id,omitempty"`  // copied from the run, for cross-run subscriptions
+	SessionID string         `json:"session_id,omitempty"` // copied from the run, for cross-run subscriptions
+	Type      string         `json:"type"`                 // run_started, text_delta, tool_started, etc.
 	Data      map[string]any `json:"data"`
 	Timestamp time.Time      `json:"timestamp"`
+	Sequence  int64          `json:"sequence"` // assigned by AddEvent, increasing from 1 within a run
 }
 
 // ToolCall represents a tool invocation
@@ -116,6 +237,56 @@ type ToolCall struct {
 	CreatedAt   time.Time      `json:"created_at"`
 }
 
+// IdempotencyKey records the run created by the first request carrying a
+// client-supplied key, so that retries of the request return that run
+// instead of starting another
+type IdempotencyKey struct {
+	TenantID    string    `json:"tenant_id"`
+	Key         string    `json:"key"`
+	RequestHash string    `json:"request_hash"` // fingerprint of the request that claimed the key
+	RunID       string    `json:"run_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// Page sizes for paged listings
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 200
+)
+
+// SessionQuery selects a page of sessions. Zero fields don't filter.
+type SessionQuery struct {
+	TenantID      string
+	CreatedAfter  time.Time // inclusive
+	CreatedBefore time.Time // exclusive
+	MetadataKey   string    // sessions whose metadata has this key
+	MetadataValue string    // ...set to this string, if not empty
+	Cursor        string
+	Limit         int // DefaultPageSize if zero, at most MaxPageSize
+}
+
+// RunQuery selects a page of runs. Zero fields don't filter.
+type RunQuery struct {
+	TenantID      string
+	SessionID     string
+	Statuses      []string
+	Mode          string
+	CreatedAfter  time.Time // inclusive
+	CreatedBefore time.Time // exclusive
+	MetadataKey   string    // runs whose metadata has this key
+	MetadataValue string    // ...set to this string, if not empty
+	Cursor        string
+	Limit         int // DefaultPageSize if zero, at most MaxPageSize
+}
+
+// MessageQuery selects a page of a session's messages
+type MessageQuery struct {
+	SessionID string
+	Cursor    string
+	Limit     int // DefaultPageSize if zero, at most MaxPageSize
+}
+
 // RunState constants
 const (
 	RunStateQueued           = "queued"
@@ -145,6 +316,8 @@ const (
 	EventTypeRunPaused          = "run_paused"
 	EventTypeRunResumed         = "run_resumed"
 	EventTypeTextDelta          = "text_delta"
+	EventTypeLLMCompleted       = "llm_completed"
+	EventTypeContextCompacted   = "context_compacted"
 	EventTypeFinalText          = "final_text"
 	EventTypeToolStarted        = "tool_started"
 	EventTypeToolStdout         = "tool_stdout"
@@ -153,4 +326,8 @@ const (
 	EventTypeToolFailed         = "tool_failed"
 	EventTypeCheckpointRequired = "checkpoint_required"
 	EventTypeArtifactCreated    = "artifact_created"
+
+	// EventTypeLagged is sent, never stored, to a subscriber the event bus
+	// disconnected for falling behind
+	EventTypeLagged = "lagged"
 )
@@ -0,0 +1,1323 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// storeHarness adapts a Store implementation to the shared store tests
+type storeHarness struct {
+	store Store
+
+	// backdate sets the creation time of a session or run ("sessions" or
+	// "runs"), which the Store interface doesn't allow
+	backdate func(t *testing.T, table, id string, at time.Time)
+}
+
+// storeTests must pass for every Store implementation
+var storeTests = []struct {
+	name string
+	test func(t *testing.T, h storeHarness)
+}{
+	{"Sessions", testSessions},
+	{"Runs", testRuns},
+	{"ListRunsByStatus", testListRunsByStatus},
+	{"SearchRuns", testSearchRuns},
+	{"SearchSessions", testSearchSessions},
+	{"ListMessages", testListMessages},
+	{"Messages", testMessages},
+	{"Events", testEvents},
+	{"ToolCalls", testToolCalls},
+	{"AutoGeneratedIDs", testAutoGeneratedIDs},
+	{"DeleteSession", testDeleteSession},
+	{"DeleteSession_NonExistent", testDeleteSessionNonExistent},
+	{"DeleteRun", testDeleteRun},
+	{"DeleteRun_NonExistent", testDeleteRunNonExistent},
+	{"CleanupOldSessions", testCleanupOldSessions},
+	{"CleanupOldRuns", testCleanupOldRuns},
+	{"CleanupOldSessions_EmptyTenant", testCleanupOldSessionsEmptyTenant},
+	{"CleanupOldRuns_NonExistentSession", testCleanupOldRunsNonExistentSession},
+	{"UpdateRun_Conflict", testUpdateRunConflict},
+	{"ClaimRun", testClaimRun},
+	{"EventSequence", testEventSequence},
+	{"WithTx", testWithTx},
+	{"IdempotencyKeys", testIdempotencyKeys},
+}
+
+// runStoreTests runs storeTests against fresh stores from newHarness
+func runStoreTests(t *testing.T, newHarness func(t *testing.T) storeHarness) {
+	for _, tt := range storeTests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newHarness(t))
+		})
+	}
+}
+
+func testSessions(t *testing.T, h storeHarness) {
+	store := h.store
+	ctx := context.Background()
+
+	// Test CreateSession
+	session := &Session{
+		ID:          "test-session-1",
+		TenantID:    "tenant-1",
+		ProfileName: "test-profile",
+		Metadata:    map[string]any{"key": "value"},
+	}
+
+	err := store.CreateSession(ctx, session)
+	assertNoError(t, err)
+	assertNotNil(t, session.CreatedAt)
+	assertNotNil(t, session.UpdatedAt)
+
+	// Test GetSession
+	retrieved, err := store.GetSession(ctx, "test-session-1")
+	assertNoError(t, err)
+	assertEqual(t, "test-session-1", retrieved.ID)
+	assertEqual(t, "tenant-1", retrieved.TenantID)
+	assertEqual(t, "test-profile", retrieved.ProfileName)
+	assertEqual(t, "value", retrieved.Metadata["key"])
+
+	// Test UpdateSession
+	retrieved.CostUSD = 1.25
+	err = store.UpdateSession(ctx, retrieved)
+	assertNoError(t, err)
+
+	retrieved, err = store.GetSession(ctx, "test-session-1")
+	assertNoError(t, err)
+	assertEqual(t, 1.25, retrieved.CostUSD)
+
+	err = store.UpdateSession(ctx, &Session{ID: "non-existent"})
+	assertEqual(t, ErrNotFound, err)
+
+	// Test AddSessionCost, which adds to the stored total rather than
+	// writing back a copy
+	stale, err := store.GetSession(ctx, "test-session-1")
+	assertNoError(t, err)
+	total, err := store.AddSessionCost(ctx, "test-session-1", 0.5)
+	assertNoError(t, err)
+	assertEqual(t, 1.75, total)
+	total, err = store.AddSessionCost(ctx, stale.ID, 0.25)
+	assertNoError(t, err)
+	assertEqual(t, 2.0, total)
+
+	retrieved, err = store.GetSession(ctx, "test-session-1")
+	assertNoError(t, err)
+	assertEqual(t, 2.0, retrieved.CostUSD)
+
+	_, err = store.AddSessionCost(ctx, "non-existent", 1)
+	assertEqual(t, ErrNotFound, err)
+
+	// Test GetSession with non-existent ID
+	_, err = store.GetSession(ctx, "non-existent")
+	assertError(t, err)
+	assertEqual(t, ErrNotFound, err)
+
+	// Test CreateSession with auto-generated ID
+	session2 := &Session{
+		TenantID:    "tenant-1",
+		ProfileName: "test-profile-2",
+	}
+	err = store.CreateSession(ctx, session2)
+	assertNoError(t, err)
+	assertNotEqual(t, "", session2.ID)
+
+	// Test ListSessions
+	session3 := &Session{
+		ID:          "test-session-3",
+		TenantID:    "tenant-1",
+		ProfileName: "test-profile-3",
+	}
+	err = store.CreateSession(ctx, session3)
+	assertNoError(t, err)
+
+	sessions, err := store.ListSessions(ctx, "tenant-1", 10, 0)
+	assertNoError(t, err)
+	assertEqual(t, 3, len(sessions))
+
+	// Test ListSessions with different tenant
+	sessions, err = store.ListSessions(ctx, "tenant-2", 10, 0)
+	assertNoError(t, err)
+	assertEqual(t, 0, len(sessions))
+
+	// Test ListSessions with limit and offset
+	sessions, err = store.ListSessions(ctx, "tenant-1", 1, 1)
+	assertNoError(t, err)
+	assertEqual(t, 1, len(sessions))
+}
+
+func testRuns(t *testing.T, h storeHarness) {
+	store := h.store
+	ctx := context.Background()
+
+	// Create a session first
+	session := &Session{
+		ID:          "test-session",
+		TenantID:    "tenant-1",
+		ProfileName: "test-profile",
+	}
+	err := store.CreateSession(ctx, session)
+	assertNoError(t, err)
+
+	// Test CreateRun
+	run := &Run{
+		ID:        "test-run-1",
+		SessionID: "test-session",
+		TenantID:  "tenant-1",
+		Mode:      "interactive",
+		Status:    RunStateQueued,
+		Metadata:  map[string]any{"test": true},
+	}
+
+	err = store.CreateRun(ctx, run)
+	assertNoError(t, err)
+	assertNotNil(t, run.CreatedAt)
+	assertNotNil(t, run.UpdatedAt)
+
+	// Test GetRun
+	retrieved, err := store.GetRun(ctx, "test-run-1")
+	assertNoError(t, err)
+	assertEqual(t, "test-run-1", retrieved.ID)
+	assertEqual(t, "test-session", retrieved.SessionID)
+	assertEqual(t, "tenant-1", retrieved.TenantID)
+	assertEqual(t, "interactive", retrieved.Mode)
+	assertEqual(t, RunStateQueued, retrieved.Status)
+
+	// Test UpdateRun
+	retrieved.Status = RunStateRunning
+	retrieved.StartedAt = &time.Time{}
+	*retrieved.StartedAt = time.Now()
+
+	err = store.UpdateRun(ctx, retrieved)
+	assertNoError(t, err)
+
+	updated, err := store.GetRun(ctx, "test-run-1")
+	assertNoError(t, err)
+	assertEqual(t, RunStateRunning, updated.Status)
+	assertNotNil(t, updated.StartedAt)
+
+	// Test GetRun with non-existent ID
+	_, err = store.GetRun(ctx, "non-existent")
+	assertError(t, err)
+	assertEqual(t, ErrNotFound, err)
+
+	// Test ListRuns
+	run2 := &Run{
+		ID:        "test-run-2",
+		SessionID: "test-session",
+		TenantID:  "tenant-1",
+		Mode:      "autonomous",
+		Status:    RunStateCompleted,
+	}
+	err = store.CreateRun(ctx, run2)
+	assertNoError(t, err)
+
+	runs, err := store.ListRuns(ctx, "test-session")
+	assertNoError(t, err)
+	assertEqual(t, 2, len(runs))
+}
+
+func testListRunsByStatus(t *testing.T, h storeHarness) {
+	store := h.store
+	ctx := context.Background()
+
+	runs := []*Run{
+		{ID: "run-1", SessionID: "session-1", Status: RunStateRunning},
+		{ID: "run-2", SessionID: "session-2", Status: RunStateCompleted},
+		{ID: "run-3", SessionID: "session-2", Status: RunStatePausedCheckpoint},
+		{ID: "run-4", SessionID: "session-3", Status: RunStateFailed},
+	}
+	for i, run := range runs {
+		assertNoError(t, store.CreateRun(ctx, run))
+		h.backdate(t, "runs", run.ID, time.Now().Add(time.Duration(i-len(runs))*time.Minute))
+	}
+
+	found, err := store.ListRunsByStatus(ctx, RunStateRunning, RunStatePaused, RunStatePausedCheckpoint)
+	assertNoError(t, err)
+	assertEqual(t, 2, len(found))
+	assertEqual(t, "run-1", found[0].ID)
+	assertEqual(t, "run-3", found[1].ID)
+
+	found, err = store.ListRunsByStatus(ctx, RunStateQueued)
+	assertNoError(t, err)
+	assertEqual(t, 0, len(found))
+
+	found, err = store.ListRunsByStatus(ctx)
+	assertNoError(t, err)
+	assertEqual(t, 0, len(found))
+}
+
+func testSearchRuns(t *testing.T, h storeHarness) {
+	store := h.store
+	ctx := context.Background()
+
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	runs := []*Run{
+		{ID: "run-1", SessionID: "session-1", TenantID: "tenant-1", Mode: "interactive", Status: RunStateCompleted},
+		{ID: "run-2", SessionID: "session-1", TenantID: "tenant-1", Mode: "autonomous", Status: RunStateFailed, Metadata: map[string]any{"job": "nightly"}},
+		{ID: "run-3", SessionID: "session-2", TenantID: "tenant-1", Mode: "autonomous", Status: RunStateCompleted, Metadata: map[string]any{"job": "weekly"}},
+		{ID: "run-4", SessionID: "session-3", TenantID: "tenant-2", Mode: "interactive", Status: RunStateRunning, Metadata: map[string]any{"job": 7}},
+		{ID: "run-5", SessionID: "session-1", TenantID: "tenant-1", Mode: "interactive", Status: RunStateCompleted},
+	}
+	for i, run := range runs {
+		assertNoError(t, store.CreateRun(ctx, run))
+		h.backdate(t, "runs", run.ID, base.Add(time.Duration(i)*time.Minute))
+	}
+
+	ids := func(query RunQuery) []string {
+		t.Helper()
+		found, _, err := store.SearchRuns(ctx, query)
+		assertNoError(t, err)
+		var ids []string
+		for _, run := range found {
+			ids = append(ids, run.ID)
+		}
+		return ids
+	}
+	assertEqual(t, "run-5 run-4 run-3 run-2 run-1", strings.Join(ids(RunQuery{}), " "))
+	assertEqual(t, "run-5 run-3 run-2 run-1", strings.Join(ids(RunQuery{TenantID: "tenant-1"}), " "))
+	assertEqual(t, "run-5 run-2 run-1", strings.Join(ids(RunQuery{SessionID: "session-1"}), " "))
+	assertEqual(t, "run-4 run-2", strings.Join(ids(RunQuery{Statuses: []string{RunStateRunning, RunStateFailed}}), " "))
+	assertEqual(t, "run-3 run-2", strings.Join(ids(RunQuery{Mode: "autonomous"}), " "))
+	assertEqual(t, "run-3 run-2", strings.Join(ids(RunQuery{CreatedAfter: base.Add(time.Minute), CreatedBefore: base.Add(3 * time.Minute)}), " "))
+	assertEqual(t, "run-4 run-3 run-2", strings.Join(ids(RunQuery{MetadataKey: "job"}), " "))
+	assertEqual(t, "run-2", strings.Join(ids(RunQuery{MetadataKey: "job", MetadataValue: "nightly"}), " "))
+	assertEqual(t, "", strings.Join(ids(RunQuery{MetadataKey: "job", MetadataValue: "7"}), " "))
+
+	// Pages pick up where the previous one ended, even after new runs
+	page, cursor, err := store.SearchRuns(ctx, RunQuery{TenantID: "tenant-1", Limit: 2})
+	assertNoError(t, err)
+	assertEqual(t, 2, len(page))
+	assertEqual(t, "run-3", page[1].ID)
+	assertNoError(t, store.CreateRun(ctx, &Run{ID: "run-6", SessionID: "session-1", TenantID: "tenant-1"}))
+
+	page, cursor, err = store.SearchRuns(ctx, RunQuery{TenantID: "tenant-1", Limit: 2, Cursor: cursor})
+	assertNoError(t, err)
+	assertEqual(t, 2, len(page))
+	assertEqual(t, "run-2", page[0].ID)
+	assertEqual(t, "run-1", page[1].ID)
+	assertEqual(t, "", cursor)
+
+	_, _, err = store.SearchRuns(ctx, RunQuery{Cursor: "not-a-cursor"})
+	assertEqual(t, ErrInvalidCursor, err)
+}
+
+func testSearchSessions(t *testing.T, h storeHarness) {
+	store := h.store
+	ctx := context.Background()
+
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	sessions := []*Session{
+		{ID: "session-1", TenantID: "tenant-1", Metadata: map[string]any{"team": "ops"}},
+		{ID: "session-2", TenantID: "tenant-1"},
+		{ID: "session-3", TenantID: "tenant-2", Metadata: map[string]any{"team": "data"}},
+	}
+	for i, session := range sessions {
+		assertNoError(t, store.CreateSession(ctx, session))
+		h.backdate(t, "sessions", session.ID, base.Add(time.Duration(i)*time.Minute))
+	}
+
+	found, cursor, err := store.SearchSessions(ctx, SessionQuery{Limit: 2})
+	assertNoError(t, err)
+	assertEqual(t, 2, len(found))
+	assertEqual(t, "session-3", found[0].ID)
+	assertEqual(t, "session-2", found[1].ID)
+
+	found, cursor, err = store.SearchSessions(ctx, SessionQuery{Limit: 2, Cursor: cursor})
+	assertNoError(t, err)
+	assertEqual(t, 1, len(found))
+	assertEqual(t, "session-1", found[0].ID)
+	assertEqual(t, "", cursor)
+
+	found, _, err = store.SearchSessions(ctx, SessionQuery{TenantID: "tenant-1", MetadataKey: "team"})
+	assertNoError(t, err)
+	assertEqual(t, 1, len(found))
+	assertEqual(t, "session-1", found[0].ID)
+
+	found, _, err = store.SearchSessions(ctx, SessionQuery{MetadataKey: "team", MetadataValue: "data", CreatedBefore: base.Add(2 * time.Minute)})
+	assertNoError(t, err)
+	assertEqual(t, 0, len(found))
+}
+
+func testListMessages(t *testing.T, h storeHarness) {
+	store := h.store
+	ctx := context.Background()
+
+	for _, content := range []string{"one", "two", "three"} {
+		assertNoError(t, store.AddMessage(ctx, "session-1", &Message{Role: "user", Content: content}))
+	}
+	assertNoError(t, store.AddMessage(ctx, "session-2", &Message{Role: "user", Content: "other"}))
+
+	page, cursor, err := store.ListMessages(ctx, MessageQuery{SessionID: "session-1", Limit: 2})
+	assertNoError(t, err)
+	assertEqual(t, 2, len(page))
+	assertEqual(t, "one", page[0].Content)
+	assertEqual(t, "two", page[1].Content)
+
+	page, cursor, err = store.ListMessages(ctx, MessageQuery{SessionID: "session-1", Limit: 2, Cursor: cursor})
+	assertNoError(t, err)
+	assertEqual(t, 1, len(page))
+	assertEqual(t, "three", page[0].Content)
+	assertEqual(t, "", cursor)
+
+	_, _, err = store.ListMessages(ctx, MessageQuery{SessionID: "session-1", Cursor: "bad"})
+	assertEqual(t, ErrInvalidCursor, err)
+}
+
+func testMessages(t *testing.T, h storeHarness) {
+	store := h.store
+	ctx := context.Background()
+
+	// Test AddMessage
+	message1 := &Message{
+		ID:        "msg-1",
+		SessionID: "session-1",
+		Role:      "user",
+		Content:   "Hello",
+		Metadata:  map[string]any{"timestamp": time.Now().Unix()},
+	}
+
+	err := store.AddMessage(ctx, "session-1", message1)
+	assertNoError(t, err)
+	assertNotNil(t, message1.CreatedAt)
+
+	message2 := &Message{
+		ID:        "msg-2",
+		SessionID: "session-1",
+		Role:      "assistant",
+		Content:   "Hi there!",
+	}
+
+	err = store.AddMessage(ctx, "session-1", message2)
+	assertNoError(t, err)
+
+	// Test GetMessages
+	messages, err := store.GetMessages(ctx, "session-1")
+	assertNoError(t, err)
+	assertEqual(t, 2, len(messages))
+	assertEqual(t, "msg-1", messages[0].ID)
+	assertEqual(t, "user", messages[0].Role)
+	assertEqual(t, "Hello", messages[0].Content)
+	assertEqual(t, "msg-2", messages[1].ID)
+	assertEqual(t, "assistant", messages[1].Role)
+	assertEqual(t, "Hi there!", messages[1].Content)
+
+	// Test GetMessages for non-existent session
+	messages, err = store.GetMessages(ctx, "non-existent")
+	assertNoError(t, err)
+	assertEqual(t, 0, len(messages))
+}
+
+func testEvents(t *testing.T, h storeHarness) {
+	store := h.store
+	ctx := context.Background()
+
+	// Test AddEvent
+	event1 := &Event{
+		ID:    "event-1",
+		RunID: "run-1",
+		Type:  EventTypeRunStarted,
+		Data:  map[string]any{"run_id": "run-1"},
+	}
+
+	err := store.AddEvent(ctx, "run-1", event1)
+	assertNoError(t, err)
+	assertNotNil(t, event1.Timestamp)
+
+	event2 := &Event{
+		ID:    "event-2",
+		RunID: "run-1",
+		Type:  EventTypeTextDelta,
+		Data:  map[string]any{"text": "Hello"},
+	}
+
+	err = store.AddEvent(ctx, "run-1", event2)
+	assertNoError(t, err)
+
+	// Test GetEvents
+	events, err := store.GetEvents(ctx, "run-1")
+	assertNoError(t, err)
+	assertEqual(t, 2, len(events))
+	assertEqual(t, "event-1", events[0].ID)
+	assertEqual(t, EventTypeRunStarted, events[0].Type)
+	assertEqual(t, "run-1", events[0].Data["run_id"])
+	assertEqual(t, "event-2", events[1].ID)
+	assertEqual(t, EventTypeTextDelta, events[1].Type)
+	assertEqual(t, "Hello", events[1].Data["text"])
+
+	// Test GetEvents for non-existent run
+	events, err = store.GetEvents(ctx, "non-existent")
+	assertNoError(t, err)
+	assertEqual(t, 0, len(events))
+}
+
+func testToolCalls(t *testing.T, h storeHarness) {
+	store := h.store
+	ctx := context.Background()
+
+	// Test AddToolCall
+	toolCall := &ToolCall{
+		ID:         "tool-1",
+		RunID:      "run-1",
+		ToolName:   "echo",
+		ServerName: "echo-server",
+		Arguments:  map[string]any{"message": "hello"},
+		Status:     ToolCallStatusPending,
+	}
+
+	err := store.AddToolCall(ctx, "run-1", toolCall)
+	assertNoError(t, err)
+	assertNotNil(t, toolCall.CreatedAt)
+
+	// Test UpdateToolCall
+	toolCall.Status = ToolCallStatusCompleted
+	toolCall.Output = "hello"
+	now := time.Now()
+	toolCall.CompletedAt = &now
+
+	err = store.UpdateToolCall(ctx, toolCall)
+	assertNoError(t, err)
+
+	// Test GetToolCalls
+	toolCalls, err := store.GetToolCalls(ctx, "run-1")
+	assertNoError(t, err)
+	assertEqual(t, 1, len(toolCalls))
+
+	retrieved := toolCalls[0]
+	assertEqual(t, "tool-1", retrieved.ID)
+	assertEqual(t, "run-1", retrieved.RunID)
+	assertEqual(t, "echo", retrieved.ToolName)
+	assertEqual(t, "echo-server", retrieved.ServerName)
+	assertEqual(t, "hello", retrieved.Arguments["message"])
+	assertEqual(t, ToolCallStatusCompleted, retrieved.Status)
+	assertEqual(t, "hello", retrieved.Output)
+	assertNotNil(t, retrieved.CompletedAt)
+
+	// Add another tool call
+	toolCall2 := &ToolCall{
+		ID:         "tool-2",
+		RunID:      "run-1",
+		ToolName:   "uppercase",
+		ServerName: "echo-server",
+		Arguments:  map[string]any{"text": "world"},
+		Status:     ToolCallStatusFailed,
+		Error:      "some error",
+	}
+
+	err = store.AddToolCall(ctx, "run-1", toolCall2)
+	assertNoError(t, err)
+
+	toolCalls, err = store.GetToolCalls(ctx, "run-1")
+	assertNoError(t, err)
+	assertEqual(t, 2, len(toolCalls))
+
+	// Test GetToolCalls for non-existent run
+	toolCalls, err = store.GetToolCalls(ctx, "non-existent")
+	assertNoError(t, err)
+	assertEqual(t, 0, len(toolCalls))
+}
+
+func testAutoGeneratedIDs(t *testing.T, h storeHarness) {
+	store := h.store
+	ctx := context.Background()
+
+	// Test auto-generated session ID
+	session := &Session{
+		TenantID:    "tenant-1",
+		ProfileName: "test",
+	}
+	err := store.CreateSession(ctx, session)
+	assertNoError(t, err)
+	assertNotEqual(t, "", session.ID)
+
+	// Test auto-generated run ID
+	run := &Run{
+		SessionID: session.ID,
+		TenantID:  "tenant-1",
+		Mode:      "interactive",
+		Status:    RunStateQueued,
+	}
+	err = store.CreateRun(ctx, run)
+	assertNoError(t, err)
+	assertNotEqual(t, "", run.ID)
+
+	// Test auto-generated message ID
+	message := &Message{
+		SessionID: session.ID,
+		Role:      "user",
+		Content:   "test message",
+	}
+	err = store.AddMessage(ctx, session.ID, message)
+	assertNoError(t, err)
+	assertNotEqual(t, "", message.ID)
+
+	// Test auto-generated event ID
+	event := &Event{
+		RunID: run.ID,
+		Type:  EventTypeRunStarted,
+		Data:  map[string]any{},
+	}
+	err = store.AddEvent(ctx, run.ID, event)
+	assertNoError(t, err)
+	assertNotEqual(t, "", event.ID)
+
+	// Test auto-generated tool call ID
+	toolCall := &ToolCall{
+		RunID:      run.ID,
+		ToolName:   "test-tool",
+		ServerName: "test-server",
+		Arguments:  map[string]any{},
+		Status:     ToolCallStatusPending,
+	}
+	err = store.AddToolCall(ctx, run.ID, toolCall)
+	assertNoError(t, err)
+	assertNotEqual(t, "", toolCall.ID)
+}
+
+// Test helpers
+func assertNoError(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+}
+
+func assertError(t *testing.T, err error) {
+	t.Helper()
+	if err == nil {
+		t.Fatal("Expected an error, got nil")
+	}
+}
+
+func assertEqual[T comparable](t *testing.T, expected, actual T) {
+	t.Helper()
+	if expected != actual {
+		t.Fatalf("Expected %v, got %v", expected, actual)
+	}
+}
+
+func assertNotEqual[T comparable](t *testing.T, notExpected, actual T) {
+	t.Helper()
+	if notExpected == actual {
+		t.Fatalf("Expected not %v, got %v", notExpected, actual)
+	}
+}
+
+func assertNotNil(t *testing.T, value any) {
+	t.Helper()
+	if value == nil {
+		t.Fatal("Expected non-nil value, got nil")
+	}
+}
+
+func testDeleteSession(t *testing.T, h storeHarness) {
+	store := h.store
+	ctx := context.Background()
+
+	// Create a session with associated data
+	session := &Session{
+		ID:          "test-session-1",
+		TenantID:    "tenant-1",
+		ProfileName: "test-profile",
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	err := store.CreateSession(ctx, session)
+	assertNoError(t, err)
+
+	// Create a run for the session
+	run := &Run{
+		ID:        "test-run-1",
+		SessionID: "test-session-1",
+		TenantID:  "tenant-1",
+		Mode:      "interactive",
+		Status:    RunStateRunning,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	err = store.CreateRun(ctx, run)
+	assertNoError(t, err)
+
+	// Add a message to the session
+	message := &Message{
+		ID:        "test-message-1",
+		SessionID: "test-session-1",
+		Role:      "user",
+		Content:   "Test message",
+		CreatedAt: time.Now(),
+	}
+	err = store.AddMessage(ctx, "test-session-1", message)
+	assertNoError(t, err)
+
+	// Add an event to the run
+	event := &Event{
+		ID:        "test-event-1",
+		RunID:     "test-run-1",
+		Type:      EventTypeRunStarted,
+		Data:      map[string]any{"test": "data"},
+		Timestamp: time.Now(),
+	}
+	err = store.AddEvent(ctx, "test-run-1", event)
+	assertNoError(t, err)
+
+	// Add a tool call to the run
+	toolCall := &ToolCall{
+		ID:         "test-tool-call-1",
+		RunID:      "test-run-1",
+		ToolName:   "test-tool",
+		ServerName: "test-server",
+		Arguments:  map[string]any{"arg": "value"},
+		Status:     ToolCallStatusPending,
+		CreatedAt:  time.Now(),
+	}
+	err = store.AddToolCall(ctx, "test-run-1", toolCall)
+	assertNoError(t, err)
+
+	// Verify everything exists before deletion
+	_, err = store.GetSession(ctx, "test-session-1")
+	assertNoError(t, err)
+	_, err = store.GetRun(ctx, "test-run-1")
+	assertNoError(t, err)
+	messages, err := store.GetMessages(ctx, "test-session-1")
+	assertNoError(t, err)
+	assertEqual(t, 1, len(messages))
+	events, err := store.GetEvents(ctx, "test-run-1")
+	assertNoError(t, err)
+	assertEqual(t, 1, len(events))
+	toolCalls, err := store.GetToolCalls(ctx, "test-run-1")
+	assertNoError(t, err)
+	assertEqual(t, 1, len(toolCalls))
+
+	// Delete the session
+	err = store.DeleteSession(ctx, "test-session-1")
+	assertNoError(t, err)
+
+	// Verify everything is deleted
+	_, err = store.GetSession(ctx, "test-session-1")
+	assertError(t, err)
+	assertEqual(t, ErrNotFound, err)
+
+	_, err = store.GetRun(ctx, "test-run-1")
+	assertError(t, err)
+	assertEqual(t, ErrNotFound, err)
+
+	messages, err = store.GetMessages(ctx, "test-session-1")
+	assertNoError(t, err)
+	assertEqual(t, 0, len(messages))
+
+	events, err = store.GetEvents(ctx, "test-run-1")
+	assertNoError(t, err)
+	assertEqual(t, 0, len(events))
+
+	toolCalls, err = store.GetToolCalls(ctx, "test-run-1")
+	assertNoError(t, err)
+	assertEqual(t, 0, len(toolCalls))
+
+	// Verify tenant index is cleaned up
+	sessions, err := store.ListSessions(ctx, "tenant-1", 10, 0)
+	assertNoError(t, err)
+	assertEqual(t, 0, len(sessions))
+}
+
+func testDeleteSessionNonExistent(t *testing.T, h storeHarness) {
+	store := h.store
+	ctx := context.Background()
+
+	// Try to delete a non-existent session
+	err := store.DeleteSession(ctx, "non-existent")
+	assertError(t, err)
+	assertEqual(t, ErrNotFound, err)
+}
+
+func testDeleteRun(t *testing.T, h storeHarness) {
+	store := h.store
+	ctx := context.Background()
+
+	// Create a session
+	session := &Session{
+		ID:          "test-session-1",
+		TenantID:    "tenant-1",
+		ProfileName: "test-profile",
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	err := store.CreateSession(ctx, session)
+	assertNoError(t, err)
+
+	// Create two runs for the session
+	run1 := &Run{
+		ID:        "test-run-1",
+		SessionID: "test-session-1",
+		TenantID:  "tenant-1",
+		Mode:      "interactive",
+		Status:    RunStateRunning,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	err = store.CreateRun(ctx, run1)
+	assertNoError(t, err)
+
+	run2 := &Run{
+		ID:        "test-run-2",
+		SessionID: "test-session-1",
+		TenantID:  "tenant-1",
+		Mode:      "interactive",
+		Status:    RunStateCompleted,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	err = store.CreateRun(ctx, run2)
+	assertNoError(t, err)
+
+	// Add events to both runs
+	event1 := &Event{
+		ID:        "test-event-1",
+		RunID:     "test-run-1",
+		Type:      EventTypeRunStarted,
+		Data:      map[string]any{"test": "data1"},
+		Timestamp: time.Now(),
+	}
+	err = store.AddEvent(ctx, "test-run-1", event1)
+	assertNoError(t, err)
+
+	event2 := &Event{
+		ID:        "test-event-2",
+		RunID:     "test-run-2",
+		Type:      EventTypeRunStarted,
+		Data:      map[string]any{"test": "data2"},
+		Timestamp: time.Now(),
+	}
+	err = store.AddEvent(ctx, "test-run-2", event2)
+	assertNoError(t, err)
+
+	// Add tool calls to both runs
+	toolCall1 := &ToolCall{
+		ID:         "test-tool-call-1",
+		RunID:      "test-run-1",
+		ToolName:   "test-tool",
+		ServerName: "test-server",
+		Arguments:  map[string]any{"arg": "value1"},
+		Status:     ToolCallStatusPending,
+		CreatedAt:  time.Now(),
+	}
+	err = store.AddToolCall(ctx, "test-run-1", toolCall1)
+	assertNoError(t, err)
+
+	toolCall2 := &ToolCall{
+		ID:         "test-tool-call-2",
+		RunID:      "test-run-2",
+		ToolName:   "test-tool",
+		ServerName: "test-server",
+		Arguments:  map[string]any{"arg": "value2"},
+		Status:     ToolCallStatusCompleted,
+		CreatedAt:  time.Now(),
+	}
+	err = store.AddToolCall(ctx, "test-run-2", toolCall2)
+	assertNoError(t, err)
+
+	// Verify both runs exist before deletion
+	_, err = store.GetRun(ctx, "test-run-1")
+	assertNoError(t, err)
+	_, err = store.GetRun(ctx, "test-run-2")
+	assertNoError(t, err)
+
+	// Delete the first run
+	err = store.DeleteRun(ctx, "test-run-1")
+	assertNoError(t, err)
+
+	// Verify first run is deleted but second remains
+	_, err = store.GetRun(ctx, "test-run-1")
+	assertError(t, err)
+	assertEqual(t, ErrNotFound, err)
+
+	_, err = store.GetRun(ctx, "test-run-2")
+	assertNoError(t, err)
+
+	// Verify events are cleaned up properly
+	events1, err := store.GetEvents(ctx, "test-run-1")
+	assertNoError(t, err)
+	assertEqual(t, 0, len(events1))
+
+	events2, err := store.GetEvents(ctx, "test-run-2")
+	assertNoError(t, err)
+	assertEqual(t, 1, len(events2))
+
+	// Verify tool calls are cleaned up properly
+	toolCalls1, err := store.GetToolCalls(ctx, "test-run-1")
+	assertNoError(t, err)
+	assertEqual(t, 0, len(toolCalls1))
+
+	toolCalls2, err := store.GetToolCalls(ctx, "test-run-2")
+	assertNoError(t, err)
+	assertEqual(t, 1, len(toolCalls2))
+
+	// Verify session index is updated
+	runs, err := store.ListRuns(ctx, "test-session-1")
+	assertNoError(t, err)
+	assertEqual(t, 1, len(runs))
+	assertEqual(t, "test-run-2", runs[0].ID)
+
+	// Verify session still exists
+	_, err = store.GetSession(ctx, "test-session-1")
+	assertNoError(t, err)
+}
+
+func testDeleteRunNonExistent(t *testing.T, h storeHarness) {
+	store := h.store
+	ctx := context.Background()
+
+	// Try to delete a non-existent run
+	err := store.DeleteRun(ctx, "non-existent")
+	assertError(t, err)
+	assertEqual(t, ErrNotFound, err)
+}
+
+func testCleanupOldSessions(t *testing.T, h storeHarness) {
+	store := h.store
+	ctx := context.Background()
+
+	// Create sessions with different ages
+	oldTime := time.Now().Add(-2 * time.Hour)
+	recentTime := time.Now().Add(-30 * time.Minute)
+
+	// Old session (should be cleaned up) - manually set time after creation
+	oldSession := &Session{
+		ID:          "old-session",
+		TenantID:    "tenant-1",
+		ProfileName: "test-profile",
+	}
+	err := store.CreateSession(ctx, oldSession)
+	assertNoError(t, err)
+	// Manually override the timestamp to simulate old session
+	h.backdate(t, "sessions", "old-session", oldTime)
+
+	// Recent session (should remain) - manually set time after creation
+	recentSession := &Session{
+		ID:          "recent-session",
+		TenantID:    "tenant-1",
+		ProfileName: "test-profile",
+	}
+	err = store.CreateSession(ctx, recentSession)
+	assertNoError(t, err)
+	// Manually override the timestamp to simulate recent session
+	h.backdate(t, "sessions", "recent-session", recentTime)
+
+	// Session from different tenant (should remain)
+	otherTenantSession := &Session{
+		ID:          "other-tenant-session",
+		TenantID:    "tenant-2",
+		ProfileName: "test-profile",
+	}
+	err = store.CreateSession(ctx, otherTenantSession)
+	assertNoError(t, err)
+	// Manually override the timestamp to simulate old session
+	h.backdate(t, "sessions", "other-tenant-session", oldTime)
+
+	// Add runs and data to the old session
+	oldRun := &Run{
+		ID:        "old-run",
+		SessionID: "old-session",
+		TenantID:  "tenant-1",
+		Mode:      "interactive",
+		Status:    RunStateCompleted,
+	}
+	err = store.CreateRun(ctx, oldRun)
+	assertNoError(t, err)
+	h.backdate(t, "runs", "old-run", oldTime)
+
+	oldMessage := &Message{
+		ID:        "old-message",
+		SessionID: "old-session",
+		Role:      "user",
+		Content:   "Old message",
+		CreatedAt: oldTime,
+	}
+	err = store.AddMessage(ctx, "old-session", oldMessage)
+	assertNoError(t, err)
+
+	// Verify initial state
+	sessions, err := store.ListSessions(ctx, "tenant-1", 10, 0)
+	assertNoError(t, err)
+	assertEqual(t, 2, len(sessions))
+
+	sessionsOtherTenant, err := store.ListSessions(ctx, "tenant-2", 10, 0)
+	assertNoError(t, err)
+	assertEqual(t, 1, len(sessionsOtherTenant))
+
+	// Clean up sessions older than 1 hour for tenant-1
+	err = store.CleanupOldSessions(ctx, "tenant-1", 1*time.Hour)
+	assertNoError(t, err)
+
+	// Verify cleanup results
+	sessions, err = store.ListSessions(ctx, "tenant-1", 10, 0)
+	assertNoError(t, err)
+	assertEqual(t, 1, len(sessions))
+	assertEqual(t, "recent-session", sessions[0].ID)
+
+	// Verify other tenant is unaffected
+	sessionsOtherTenant, err = store.ListSessions(ctx, "tenant-2", 10, 0)
+	assertNoError(t, err)
+	assertEqual(t, 1, len(sessionsOtherTenant))
+	assertEqual(t, "other-tenant-session", sessionsOtherTenant[0].ID)
+
+	// Verify old session and associated data are gone
+	_, err = store.GetSession(ctx, "old-session")
+	assertError(t, err)
+	assertEqual(t, ErrNotFound, err)
+
+	_, err = store.GetRun(ctx, "old-run")
+	assertError(t, err)
+	assertEqual(t, ErrNotFound, err)
+
+	messages, err := store.GetMessages(ctx, "old-session")
+	assertNoError(t, err)
+	assertEqual(t, 0, len(messages))
+}
+
+func testCleanupOldRuns(t *testing.T, h storeHarness) {
+	store := h.store
+	ctx := context.Background()
+
+	// Create a session
+	session := &Session{
+		ID:          "test-session",
+		TenantID:    "tenant-1",
+		ProfileName: "test-profile",
+	}
+	err := store.CreateSession(ctx, session)
+	assertNoError(t, err)
+
+	// Create runs with different ages and statuses
+	oldTime := time.Now().Add(-2 * time.Hour)
+	recentTime := time.Now().Add(-30 * time.Minute)
+
+	// Old completed run (should be cleaned up)
+	oldCompletedRun := &Run{
+		ID:        "old-completed-run",
+		SessionID: "test-session",
+		TenantID:  "tenant-1",
+		Mode:      "interactive",
+		Status:    RunStateCompleted,
+	}
+	err = store.CreateRun(ctx, oldCompletedRun)
+	assertNoError(t, err)
+	h.backdate(t, "runs", "old-completed-run", oldTime)
+
+	// Old failed run (should be cleaned up)
+	oldFailedRun := &Run{
+		ID:        "old-failed-run",
+		SessionID: "test-session",
+		TenantID:  "tenant-1",
+		Mode:      "interactive",
+		Status:    RunStateFailed,
+	}
+	err = store.CreateRun(ctx, oldFailedRun)
+	assertNoError(t, err)
+	h.backdate(t, "runs", "old-failed-run", oldTime)
+
+	// Old running run (should NOT be cleaned up)
+	oldRunningRun := &Run{
+		ID:        "old-running-run",
+		SessionID: "test-session",
+		TenantID:  "tenant-1",
+		Mode:      "interactive",
+		Status:    RunStateRunning,
+	}
+	err = store.CreateRun(ctx, oldRunningRun)
+	assertNoError(t, err)
+	h.backdate(t, "runs", "old-running-run", oldTime)
+
+	// Recent completed run (should NOT be cleaned up)
+	recentCompletedRun := &Run{
+		ID:        "recent-completed-run",
+		SessionID: "test-session",
+		TenantID:  "tenant-1",
+		Mode:      "interactive",
+		Status:    RunStateCompleted,
+	}
+	err = store.CreateRun(ctx, recentCompletedRun)
+	assertNoError(t, err)
+	h.backdate(t, "runs", "recent-completed-run", recentTime)
+
+	// Add events and tool calls to the runs that will be deleted
+	event1 := &Event{
+		ID:        "event-1",
+		RunID:     "old-completed-run",
+		Type:      EventTypeRunCompleted,
+		Data:      map[string]any{"test": "data"},
+		Timestamp: oldTime,
+	}
+	err = store.AddEvent(ctx, "old-completed-run", event1)
+	assertNoError(t, err)
+
+	toolCall1 := &ToolCall{
+		ID:         "tool-call-1",
+		RunID:      "old-completed-run",
+		ToolName:   "test-tool",
+		ServerName: "test-server",
+		Arguments:  map[string]any{"arg": "value"},
+		Status:     ToolCallStatusCompleted,
+		CreatedAt:  oldTime,
+	}
+	err = store.AddToolCall(ctx, "old-completed-run", toolCall1)
+	assertNoError(t, err)
+
+	// Verify initial state
+	runs, err := store.ListRuns(ctx, "test-session")
+	assertNoError(t, err)
+	assertEqual(t, 4, len(runs))
+
+	// Clean up runs older than 1 hour
+	err = store.CleanupOldRuns(ctx, "test-session", 1*time.Hour)
+	assertNoError(t, err)
+
+	// Verify cleanup results - should be 2 remaining (old-running-run and recent-completed-run)
+	runs, err = store.ListRuns(ctx, "test-session")
+	assertNoError(t, err)
+
+	// We expect only 2 runs to remain: old-running-run and recent-completed-run
+	// The old-completed-run and old-failed-run should be deleted
+	assertEqual(t, 2, len(runs))
+
+	// Verify the correct runs remain
+	runIDs := make(map[string]bool)
+	for _, run := range runs {
+		runIDs[run.ID] = true
+	}
+
+	// These should remain
+	if !runIDs["old-running-run"] {
+		t.Error("Expected old-running-run to remain (running status)")
+	}
+	if !runIDs["recent-completed-run"] {
+		t.Error("Expected recent-completed-run to remain (recent)")
+	}
+
+	// These should be deleted
+	if runIDs["old-completed-run"] {
+		t.Error("Expected old-completed-run to be deleted")
+	}
+	if runIDs["old-failed-run"] {
+		t.Error("Expected old-failed-run to be deleted")
+	}
+
+	// Verify associated data is cleaned up
+	events, err := store.GetEvents(ctx, "old-completed-run")
+	assertNoError(t, err)
+	assertEqual(t, 0, len(events))
+
+	toolCalls, err := store.GetToolCalls(ctx, "old-completed-run")
+	assertNoError(t, err)
+	assertEqual(t, 0, len(toolCalls))
+
+	// Verify session still exists
+	_, err = store.GetSession(ctx, "test-session")
+	assertNoError(t, err)
+}
+
+func testCleanupOldSessionsEmptyTenant(t *testing.T, h storeHarness) {
+	store := h.store
+	ctx := context.Background()
+
+	// Try to clean up sessions for a tenant with no sessions
+	err := store.CleanupOldSessions(ctx, "non-existent-tenant", 1*time.Hour)
+	assertNoError(t, err)
+}
+
+func testCleanupOldRunsNonExistentSession(t *testing.T, h storeHarness) {
+	store := h.store
+	ctx := context.Background()
+
+	// Try to clean up runs for a non-existent session
+	err := store.CleanupOldRuns(ctx, "non-existent-session", 1*time.Hour)
+	assertNoError(t, err)
+}
+
+func testUpdateRunConflict(t *testing.T, h storeHarness) {
+	store := h.store
+	ctx := context.Background()
+
+	run := &Run{ID: "run-1", SessionID: "session-1", TenantID: "tenant-1", Mode: "interactive", Status: RunStateRunning}
+	err := store.CreateRun(ctx, run)
+	assertNoError(t, err)
+
+	// Two writers read the same version of the run
+	first, err := store.GetRun(ctx, "run-1")
+	assertNoError(t, err)
+	second := *first
+
+	first.Status = RunStateCompleted
+	err = store.UpdateRun(ctx, first)
+	assertNoError(t, err)
+	assertEqual(t, 1, first.Version)
+
+	// The second update was made from a stale copy
+	second.Status = RunStateCancelled
+	err = store.UpdateRun(ctx, &second)
+	assertEqual(t, ErrConflict, err)
+
+	retrieved, err := store.GetRun(ctx, "run-1")
+	assertNoError(t, err)
+	assertEqual(t, RunStateCompleted, retrieved.Status)
+	assertEqual(t, 1, retrieved.Version)
+
+	// Re-reading picks up the latest version
+	retrieved.Status = RunStateFailed
+	err = store.UpdateRun(ctx, retrieved)
+	assertNoError(t, err)
+	assertEqual(t, 2, retrieved.Version)
+
+	err = store.UpdateRun(ctx, &Run{ID: "non-existent"})
+	assertEqual(t, ErrNotFound, err)
+}
+
+func testEventSequence(t *testing.T, h storeHarness) {
+	store := h.store
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		err := store.AddEvent(ctx, "run-1", &Event{Type: EventTypeTextDelta})
+		assertNoError(t, err)
+	}
+	other := &Event{Type: EventTypeRunStarted}
+	err := store.AddEvent(ctx, "run-2", other)
+	assertNoError(t, err)
+
+	// Sequences count from 1 within each run
+	assertEqual(t, int64(1), other.Sequence)
+
+	events, err := store.GetEvents(ctx, "run-1")
+	assertNoError(t, err)
+	assertEqual(t, 3, len(events))
+	for i, event := range events {
+		assertEqual(t, int64(i+1), event.Sequence)
+	}
+
+	// Replaying after a sequence returns only later events
+	events, err = store.GetEventsAfter(ctx, "run-1", 1)
+	assertNoError(t, err)
+	assertEqual(t, 2, len(events))
+	assertEqual(t, int64(2), events[0].Sequence)
+
+	events, err = store.GetEventsAfter(ctx, "run-1", 3)
+	assertNoError(t, err)
+	assertEqual(t, 0, len(events))
+
+	// Events keep the run's tenant and session
+	err = store.AddEvent(ctx, "run-3", &Event{Type: EventTypeRunStarted, TenantID: "tenant-1", SessionID: "session-1"})
+	assertNoError(t, err)
+	events, err = store.GetEvents(ctx, "run-3")
+	assertNoError(t, err)
+	assertEqual(t, "tenant-1", events[0].TenantID)
+	assertEqual(t, "session-1", events[0].SessionID)
+}
+
+func testWithTx(t *testing.T, h storeHarness) {
+	store := h.store
+	ctx := context.Background()
+
+	err := WithTx(ctx, store, func(tx Store) error {
+		if err := tx.CreateRun(ctx, &Run{ID: "run-1", SessionID: "session-1", Status: RunStateQueued}); err != nil {
+			return err
+		}
+		return tx.AddMessage(ctx, "session-1", &Message{Role: "user", Content: "Hello"})
+	})
+	assertNoError(t, err)
+
+	_, err = store.GetRun(ctx, "run-1")
+	assertNoError(t, err)
+
+	if _, ok := store.(Transactor); !ok {
+		return
+	}
+
+	// A failed transaction leaves nothing behind
+	err = WithTx(ctx, store, func(tx Store) error {
+		if err := tx.CreateRun(ctx, &Run{ID: "run-2", SessionID: "session-1", Status: RunStateQueued}); err != nil {
+			return err
+		}
+		if err := tx.AddMessage(ctx, "session-1", &Message{Role: "user", Content: "Lost"}); err != nil {
+			return err
+		}
+		return ErrConflict
+	})
+	assertEqual(t, ErrConflict, err)
+
+	_, err = store.GetRun(ctx, "run-2")
+	assertEqual(t, ErrNotFound, err)
+
+	messages, err := store.GetMessages(ctx, "session-1")
+	assertNoError(t, err)
+	assertEqual(t, 1, len(messages))
+}
+
+func testIdempotencyKeys(t *testing.T, h storeHarness) {
+	store := h.store
+	ctx := context.Background()
+
+	_, err := store.GetIdempotencyKey(ctx, "tenant-1", "key-1")
+	assertEqual(t, ErrNotFound, err)
+
+	expires := time.Now().Add(time.Hour)
+	key := &IdempotencyKey{TenantID: "tenant-1", Key: "key-1", RequestHash: "hash-1", RunID: "run-1", ExpiresAt: expires}
+	assertNoError(t, store.CreateIdempotencyKey(ctx, key))
+
+	got, err := store.GetIdempotencyKey(ctx, "tenant-1", "key-1")
+	assertNoError(t, err)
+	assertEqual(t, "hash-1", got.RequestHash)
+	assertEqual(t, "run-1", got.RunID)
+	assertEqual(t, expires.Unix(), got.ExpiresAt.Unix())
+
+	// The key is held until it expires
+	err = store.CreateIdempotencyKey(ctx, &IdempotencyKey{TenantID: "tenant-1", Key: "key-1", RequestHash: "hash-2", RunID: "run-2", ExpiresAt: expires})
+	assertEqual(t, ErrAlreadyExists, err)
+
+	// Keys are scoped to a tenant
+	assertNoError(t, store.CreateIdempotencyKey(ctx, &IdempotencyKey{TenantID: "tenant-2", Key: "key-1", RequestHash: "hash-3", RunID: "run-3", ExpiresAt: expires}))
+
+	// An expired key can be claimed again
+	assertNoError(t, store.CreateIdempotencyKey(ctx, &IdempotencyKey{TenantID: "tenant-1", Key: "key-2", RequestHash: "hash-4", RunID: "run-4", ExpiresAt: time.Now().Add(-time.Second)}))
+	_, err = store.GetIdempotencyKey(ctx, "tenant-1", "key-2")
+	assertEqual(t, ErrNotFound, err)
+	assertNoError(t, store.CreateIdempotencyKey(ctx, &IdempotencyKey{TenantID: "tenant-1", Key: "key-2", RequestHash: "hash-5", RunID: "run-5", ExpiresAt: expires}))
+
+	got, err = store.GetIdempotencyKey(ctx, "tenant-1", "key-2")
+	assertNoError(t, err)
+	assertEqual(t, "run-5", got.RunID)
+
+	// Deleting the run releases its key
+	assertNoError(t, store.CreateRun(ctx, &Run{ID: "run-1", SessionID: "session-1"}))
+	assertNoError(t, store.DeleteRun(ctx, "run-1"))
+	_, err = store.GetIdempotencyKey(ctx, "tenant-1", "key-1")
+	assertEqual(t, ErrNotFound, err)
+}
+
+func testClaimRun(t *testing.T, h storeHarness) {
+	store := h.store
+	ctx := context.Background()
+
+	assertNoError(t, store.CreateRun(ctx, &Run{ID: "run-1", SessionID: "session-1", TenantID: "tenant-1", Status: RunStateRunning}))
+	run, err := store.GetRun(ctx, "run-1")
+	assertNoError(t, err)
+
+	// An unowned run can be claimed, and its owner can renew the lease
+	assertNoError(t, store.ClaimRun(ctx, "run-1", "replica-a", time.Now().Add(time.Minute)))
+	assertNoError(t, store.ClaimRun(ctx, "run-1", "replica-a", time.Now().Add(2*time.Minute)))
+
+	// Another replica can't take it while the lease lasts
+	assertEqual(t, ErrConflict, store.ClaimRun(ctx, "run-1", "replica-b", time.Now().Add(time.Minute)))
+
+	// Claims don't change the run, so the agent loop's next save still applies
+	run.Status = RunStatePaused
+	assertNoError(t, store.UpdateRun(ctx, run))
+
+	assertEqual(t, ErrNotFound, store.ClaimRun(ctx, "missing", "replica-a", time.Now().Add(time.Minute)))
+
+	// Once the lease expires, another replica can take over
+	assertNoError(t, store.CreateRun(ctx, &Run{ID: "run-2", SessionID: "session-1", TenantID: "tenant-1", Status: RunStateRunning}))
+	assertNoError(t, store.ClaimRun(ctx, "run-2", "replica-a", time.Now().Add(-time.Second)))
+	assertNoError(t, store.ClaimRun(ctx, "run-2", "replica-b", time.Now().Add(time.Minute)))
+	assertEqual(t, ErrConflict, store.ClaimRun(ctx, "run-2", "replica-a", time.Now().Add(time.Minute)))
+}